@@ -51,6 +51,9 @@ giffyApp.config(["$routeProvider", "$locationProvider",
 		}).when("/slack/complete", {
 			templateUrl: '/static/partials/slack_complete.html',
 			controller: 'slackCompleteController'
+		}).when("/slack/connect/:token?", {
+			templateUrl: '/static/partials/slack_connect.html',
+			controller: 'slackConnectController'
 		}).when("/stats", {
 			templateUrl: '/static/partials/stats.html',
 			controller: 'statsController'
@@ -94,6 +94,15 @@ giffyControllers.controller("imageController", ["$scope", "$http", "$routeParams
 			});
 		};
 
+		// prefer the video rendition of a gif when the browser can play it.
+		$scope.canPlayVideo = function () {
+			if (!$scope.image || !$scope.image.video_url) {
+				return false;
+			}
+			var video = document.createElement("video");
+			return !!(video.canPlayType && video.canPlayType($scope.image.video_mime_type));
+		};
+
 		$scope.deleteImage = function () {
 			if ($scope.currentUser.is_moderator) {
 				if (confirm("are you sure?")) {
@@ -413,6 +422,39 @@ giffyControllers.controller("slackCompleteController", ["$scope", "currentUser",
 	}
 ]);
 
+giffyControllers.controller("slackConnectController", ["$scope", "$http", "$routeParams", "currentUser",
+	function ($scope, $http, $routeParams, currentUser) {
+		var fetchIdentities = function () {
+			$http.get("/api/slack.identities").then(function (res) {
+				$scope.identities = res.data.Response;
+			});
+		};
+
+		currentUser($scope, function () {
+			if (!$scope.currentUser.is_logged_in) {
+				return;
+			}
+			if (!$routeParams.token) {
+				fetchIdentities();
+				return;
+			}
+			$http.post("/api/slack.identities", { token: $routeParams.token }).then(function () {
+				$scope.connected = true;
+				fetchIdentities();
+			}, function () {
+				$scope.error = "That link is invalid or has expired; run `/giffy connect` for a new one.";
+				fetchIdentities();
+			});
+		});
+
+		$scope.disconnect = function (identity) {
+			$http.delete("/api/slack.identity/" + identity.team_id + "/" + identity.slack_user_id).then(function () {
+				fetchIdentities();
+			});
+		};
+	}
+]);
+
 giffyControllers.controller("aboutController", ["$scope", "$http", "currentUser",
 	function ($scope, $http, currentUser) {
 		currentUser($scope);
@@ -462,6 +504,12 @@ giffyControllers.controller("teamsController", ["$scope", "$http", "$routeParams
 				fetchTeams();
 			});
 		};
+
+		$scope.updateTeamLegacyAttachments = function (team) {
+			$http.put("/api/team/" + team.team_id, team).then(function () {
+				fetchTeams();
+			});
+		};
 	}
 ]);
 
@@ -2,11 +2,14 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/blend/go-sdk/configutil"
 	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/db/dbutil"
 	"github.com/blend/go-sdk/db/migration"
 	"github.com/blend/go-sdk/logger"
 
@@ -14,10 +17,35 @@ import (
 	"github.com/wcharczuk/giffy/server/model"
 )
 
+const usage = `usage: db <command>
+
+commands:
+	init            drops and recreates the schema, then applies all migrations
+	status          lists the migrations and whether they've been applied
+	up [N]          applies the next N pending migrations (default: all)
+	down [N]        reverts the last N applied migrations (default: 1)
+	create <name>   writes empty up and down files for a new migration
+	migrate         alias for up`
+
 func main() {
 	command := "migrate"
+	var args []string
 	if len(os.Args) > 1 {
-		command = os.Args[1]
+		command = strings.ToLower(os.Args[1])
+		args = os.Args[2:]
+	}
+
+	if command == "create" {
+		if len(args) == 0 {
+			fatal(fmt.Errorf("create requires a name\n\n%s", usage))
+		}
+		upPath, downPath, err := model.CreateSchemaMigration(model.SchemaMigrationsDir, strings.Join(args, "_"))
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Println(upPath)
+		fmt.Println(downPath)
+		return
 	}
 
 	var cfg config.Giffy
@@ -34,16 +62,90 @@ func main() {
 		logger.FatalExit(err)
 	}
 
+	ctx := context.Background()
+	migrations, err := model.LoadSchemaMigrations()
+	if err != nil {
+		logger.FatalExit(err)
+	}
+	mgr := model.Manager{BaseManager: dbutil.NewBaseManager(conn)}
+
 	var m *migration.Suite
-	switch strings.ToLower(command) {
-	case "migrate":
-		m = model.Migrations(&cfg)
+	switch command {
 	case "init":
-		m = model.Schema(&cfg)
+		if err := model.Schema(&cfg).Apply(ctx, conn); err != nil {
+			logger.MaybeFatalExit(log, err)
+		}
+		m = model.SchemaMigrationsUp(migrations)
+	case "status":
+		status, err := mgr.GetSchemaMigrationStatus(ctx, migrations)
+		if err != nil {
+			logger.FatalExit(err)
+		}
+		for _, sms := range status {
+			if sms.IsApplied() {
+				fmt.Printf("applied  %s  %s\n", sms.AppliedUTC.Format("2006-01-02 15:04:05"), sms)
+			} else {
+				fmt.Printf("pending  %-19s  %s\n", "", sms)
+			}
+		}
+		return
+	case "up", "migrate":
+		count, err := parseCount(args, 0)
+		if err != nil {
+			fatal(err)
+		}
+		status, err := mgr.GetSchemaMigrationStatus(ctx, migrations)
+		if err != nil {
+			logger.FatalExit(err)
+		}
+		var pending []model.SchemaMigration
+		for _, sms := range status {
+			if !sms.IsApplied() && (count == 0 || len(pending) < count) {
+				pending = append(pending, sms.SchemaMigration)
+			}
+		}
+		m = model.SchemaMigrationsUp(pending)
+	case "down":
+		count, err := parseCount(args, 1)
+		if err != nil {
+			fatal(err)
+		}
+		status, err := mgr.GetSchemaMigrationStatus(ctx, migrations)
+		if err != nil {
+			logger.FatalExit(err)
+		}
+		var applied []model.SchemaMigration
+		for _, sms := range status {
+			if sms.IsApplied() {
+				applied = append(applied, sms.SchemaMigration)
+			}
+		}
+		if len(applied) > count {
+			applied = applied[len(applied)-count:]
+		}
+		m = model.SchemaMigrationsDown(applied)
+	default:
+		fatal(fmt.Errorf("unknown command: %s\n\n%s", command, usage))
 	}
 	m.Log = log
 
-	if err := m.Apply(context.Background(), conn); err != nil {
+	if err := m.Apply(ctx, conn); err != nil {
 		logger.MaybeFatalExit(log, err)
 	}
 }
+
+func parseCount(args []string, defaultCount int) (int, error) {
+	if len(args) == 0 {
+		return defaultCount, nil
+	}
+	count, err := strconv.Atoi(args[0])
+	if err != nil || count < 1 {
+		return 0, fmt.Errorf("invalid count: %s", args[0])
+	}
+	return count, nil
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -13,6 +13,25 @@ import (
 	"github.com/blend/go-sdk/web"
 
 	"github.com/wcharczuk/giffy/server/awsutil"
+	"github.com/wcharczuk/giffy/server/filemanager"
+	"github.com/wcharczuk/giffy/server/transcode"
+)
+
+const (
+	// DefaultSimilarImageDistance is the default max hamming distance for near-duplicate images.
+	DefaultSimilarImageDistance = 6
+
+	// DefaultReportHideThreshold is the default number of distinct users that must report something before it is hidden.
+	DefaultReportHideThreshold = 3
+
+	// DefaultSlackAPIURL is the default base url for the slack web api.
+	DefaultSlackAPIURL = "https://slack.com/api"
+
+	// DefaultSearchInteractionWeight is the default weight of slack shuffle / post feedback in search ranking.
+	DefaultSearchInteractionWeight = 0.25
+
+	// DefaultIntegrationContentRating is the default content rating filter (by name) for discord and teams.
+	DefaultIntegrationContentRating = "NR"
 )
 
 // MustNewFromEnv creates a new config from the environment.
@@ -45,16 +64,41 @@ type Giffy struct {
 	CloudFrontDNS string `json:"cloudfrontDNS" yaml:"cloudfrontDNS"`
 	S3Bucket      string `json:"s3Bucket" yaml:"s3Bucket"`
 
+	// SimilarImageDistance is the max hamming distance between perceptual hashes for an upload to be considered a duplicate.
+	SimilarImageDistance int `json:"similarImageDistance" yaml:"similarImageDistance"`
+
+	// ReportHideThreshold is the number of distinct users that must report an image or link before it is hidden pending review.
+	ReportHideThreshold int `json:"reportHideThreshold" yaml:"reportHideThreshold"`
+
+	// SearchInteractionWeight is how much (from 0 to 1) shuffle / post feedback can move a search score up or down.
+	// It's a pointer so that 0 (i.e. turning feedback off) can be told apart from unset.
+	SearchInteractionWeight *float64 `json:"searchInteractionWeight" yaml:"searchInteractionWeight"`
+
 	SlackClientID          string `json:"slackClientID" yaml:"slackClientID"`
 	SlackClientSecret      string `json:"slackClientSecret" yaml:"slackClientSecret"`
 	SlackAuthReturnURL     string `json:"slackAuthReturnURL" yaml:"slackAuthReturnURL"`
 	SlackVerificationToken string `json:"slackVerificationToken" yaml:"slackVerificationToken" env:"SLACK_VERIFICATION_TOKEN"`
-
-	Aws        awsutil.Config `json:"aws" yaml:"aws"`
-	DB         db.Config      `json:"db" yaml:"db"`
-	GoogleAuth oauth.Config   `json:"googleAuth" yaml:"googleAuth"`
-	Logger     logger.Config  `json:"logger" yaml:"logger"`
-	Web        web.Config     `json:"web" yaml:"web"`
+	SlackSigningSecret     string `json:"slackSigningSecret" yaml:"slackSigningSecret" env:"SLACK_SIGNING_SECRET"`
+	// SlackAPIURL is the base url for the slack web api; it's only overridden in tests.
+	SlackAPIURL string `json:"slackAPIURL" yaml:"slackAPIURL"`
+
+	// DiscordPublicKey is the (hex encoded) application public key discord signs interactions with.
+	DiscordPublicKey string `json:"discordPublicKey" yaml:"discordPublicKey"`
+	// DiscordContentRating is the content rating filter (i.e. `PG-13`) for discord searches.
+	DiscordContentRating string `json:"discordContentRating" yaml:"discordContentRating"`
+
+	// TeamsWebhookSecret is the (base64 encoded) security token for the teams outgoing webhook.
+	TeamsWebhookSecret string `json:"teamsWebhookSecret" yaml:"teamsWebhookSecret"`
+	// TeamsContentRating is the content rating filter (i.e. `PG-13`) for teams searches.
+	TeamsContentRating string `json:"teamsContentRating" yaml:"teamsContentRating"`
+
+	Aws        awsutil.Config     `json:"aws" yaml:"aws"`
+	Storage    filemanager.Config `json:"storage" yaml:"storage"`
+	Transcode  transcode.Config   `json:"transcode" yaml:"transcode"`
+	DB         db.Config          `json:"db" yaml:"db"`
+	GoogleAuth oauth.Config       `json:"googleAuth" yaml:"googleAuth"`
+	Logger     logger.Config      `json:"logger" yaml:"logger"`
+	Web        web.Config         `json:"web" yaml:"web"`
 }
 
 // Resolve resolves the config.
@@ -62,6 +106,8 @@ func (g *Giffy) Resolve(ctx context.Context) error {
 	return configutil.Resolve(ctx,
 		(&g.Meta).Resolve,
 		(&g.Aws).Resolve,
+		(&g.Storage).Resolve,
+		(&g.Transcode).Resolve,
 		(&g.DB).Resolve,
 		(&g.GoogleAuth).Resolve,
 		(&g.Logger).Resolve,
@@ -73,10 +119,22 @@ func (g *Giffy) Resolve(ctx context.Context) error {
 		configutil.SetString(&g.CloudFrontDNS, configutil.Env("CLOUDFRONT_DNS"), configutil.String(g.CloudFrontDNS)),
 		configutil.SetString(&g.S3Bucket, configutil.Env("S3_BUCKET"), configutil.String(g.S3Bucket), configutil.StringFunc(g.ResolveS3Bucket)),
 
+		configutil.SetInt(&g.SimilarImageDistance, configutil.Env("SIMILAR_IMAGE_DISTANCE"), configutil.Int(g.SimilarImageDistance), configutil.Int(DefaultSimilarImageDistance)),
+		configutil.SetInt(&g.ReportHideThreshold, configutil.Env("REPORT_HIDE_THRESHOLD"), configutil.Int(g.ReportHideThreshold), configutil.Int(DefaultReportHideThreshold)),
+		configutil.SetFloat64Ptr(&g.SearchInteractionWeight, configutil.Env("SEARCH_INTERACTION_WEIGHT"), configutil.Float64Ptr(g.SearchInteractionWeight), configutil.Float64(DefaultSearchInteractionWeight)),
+
 		configutil.SetString(&g.SlackClientID, configutil.Env("SLACK_CLIENT_ID"), configutil.String(g.SlackClientID)),
 		configutil.SetString(&g.SlackClientSecret, configutil.Env("SLACK_CLIENT_SECRET"), configutil.String(g.SlackClientSecret)),
 		configutil.SetString(&g.SlackAuthReturnURL, configutil.Env("SLACK_AUTH_RETURN_URL"), configutil.String(g.SlackAuthReturnURL)),
 		configutil.SetString(&g.SlackVerificationToken, configutil.Env("SLACK_VERIFICATION_TOKEN"), configutil.String(g.SlackVerificationToken)),
+		configutil.SetString(&g.SlackSigningSecret, configutil.Env("SLACK_SIGNING_SECRET"), configutil.String(g.SlackSigningSecret)),
+		configutil.SetString(&g.SlackAPIURL, configutil.Env("SLACK_API_URL"), configutil.String(g.SlackAPIURL), configutil.String(DefaultSlackAPIURL)),
+
+		configutil.SetString(&g.DiscordPublicKey, configutil.Env("DISCORD_PUBLIC_KEY"), configutil.String(g.DiscordPublicKey)),
+		configutil.SetString(&g.DiscordContentRating, configutil.Env("DISCORD_CONTENT_RATING"), configutil.String(g.DiscordContentRating), configutil.String(DefaultIntegrationContentRating)),
+
+		configutil.SetString(&g.TeamsWebhookSecret, configutil.Env("TEAMS_WEBHOOK_SECRET"), configutil.String(g.TeamsWebhookSecret)),
+		configutil.SetString(&g.TeamsContentRating, configutil.Env("TEAMS_CONTENT_RATING"), configutil.String(g.TeamsContentRating), configutil.String(DefaultIntegrationContentRating)),
 	)
 }
 
@@ -86,6 +144,14 @@ func (g Giffy) ResolveS3Bucket(_ context.Context) (*string, error) {
 	return &bucket, nil
 }
 
+// GetSearchInteractionWeight gets the search interaction weight or a default.
+func (g Giffy) GetSearchInteractionWeight() float64 {
+	if g.SearchInteractionWeight != nil {
+		return *g.SearchInteractionWeight
+	}
+	return DefaultSearchInteractionWeight
+}
+
 // GetEncryptionKey gets the config encryption key as a byte blob.
 func (g Giffy) GetEncryptionKey() []byte {
 	if len(g.EncryptionKey) > 0 {
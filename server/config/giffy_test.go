@@ -0,0 +1,30 @@
+package config
+
+import (
+	"context"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/env"
+)
+
+func TestGiffySearchInteractionWeight(t *testing.T) {
+	assert := assert.New(t)
+	ctx := env.WithVars(context.Background(), env.Vars{})
+
+	var cfg Giffy
+	assert.Nil(cfg.Resolve(ctx))
+	assert.Equal(DefaultSearchInteractionWeight, cfg.GetSearchInteractionWeight())
+
+	// zero turns feedback off, so it shouldn't be replaced with the default.
+	off := 0.0
+	cfg = Giffy{SearchInteractionWeight: &off}
+	assert.Nil(cfg.Resolve(ctx))
+	assert.Equal(0.0, cfg.GetSearchInteractionWeight())
+
+	cfg = Giffy{}
+	assert.Nil(cfg.Resolve(env.WithVars(context.Background(), env.Vars{"SEARCH_INTERACTION_WEIGHT": "0"})))
+	assert.Equal(0.0, cfg.GetSearchInteractionWeight())
+
+	assert.Equal(DefaultSearchInteractionWeight, Giffy{}.GetSearchInteractionWeight())
+}
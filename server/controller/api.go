@@ -1,7 +1,6 @@
 package controller
 
 import (
-	"crypto/md5"
 	"fmt"
 	"time"
 
@@ -16,6 +15,7 @@ import (
 	"github.com/wcharczuk/giffy/server/config"
 	"github.com/wcharczuk/giffy/server/external"
 	"github.com/wcharczuk/giffy/server/filemanager"
+	"github.com/wcharczuk/giffy/server/jobs"
 	"github.com/wcharczuk/giffy/server/model"
 	"github.com/wcharczuk/giffy/server/viewmodel"
 )
@@ -31,93 +31,127 @@ type APIs struct {
 
 func (api APIs) awareMiddleware(extra ...web.Middleware) []web.Middleware {
 	return append(extra, []web.Middleware{
-		web.SessionAware,
+		APITokenOrSessionAware(api.Model, api.Config),
 		APIProviderAsDefault,
 	}...)
 }
 
 func (api APIs) requiredMiddleware(extra ...web.Middleware) []web.Middleware {
 	return append(extra, []web.Middleware{
-		web.SessionRequired,
+		APITokenOrSessionRequired(api.Model, api.Config),
 		APIProviderAsDefault,
 	}...)
 }
 
 // Register adds the routes to the app.
 func (api APIs) Register(app *web.App) {
-	app.GET("/api/users", api.getUsersAction, api.requiredMiddleware()...)
-	app.GET("/api/users.search", api.searchUsersAction, api.requiredMiddleware()...)
-	app.GET("/api/users/pages/:count/:offset", api.getUsersByCountAndOffsetAction, api.requiredMiddleware()...)
+	app.GET("/api/users", api.getUsersAction, api.requiredMiddleware(RequireScope(model.APITokenScopeRead))...)
+	app.GET("/api/users.search", api.searchUsersAction, api.requiredMiddleware(RequireScope(model.APITokenScopeRead))...)
+	app.GET("/api/users/pages/:count/:offset", api.getUsersByCountAndOffsetAction, api.requiredMiddleware(RequireScope(model.APITokenScopeRead))...)
 
 	app.GET("/api/user/:user_id", api.getUserAction)
-	app.PUT("/api/user/:user_id", api.updateUserAction, api.requiredMiddleware()...)
+	app.PUT("/api/user/:user_id", api.updateUserAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
 	app.GET("/api/user.images/:user_id", api.getUserImagesAction)
 	app.GET("/api/user.moderation/:user_id", api.getModerationForUserAction)
-	app.GET("/api/user.votes.image/:image_id", api.getVotesForUserForImageAction, api.requiredMiddleware()...)
-	app.GET("/api/user.votes.tag/:tag_id", api.getVotesForUserForTagAction, api.requiredMiddleware()...)
+	app.GET("/api/user.votes.image/:image_id", api.getVotesForUserForImageAction, api.requiredMiddleware(RequireScope(model.APITokenScopeRead))...)
+	app.GET("/api/user.votes.tag/:tag_id", api.getVotesForUserForTagAction, api.requiredMiddleware(RequireScope(model.APITokenScopeRead))...)
 
-	app.DELETE("/api/user.vote/:image_id/:tag_id", api.deleteUserVoteAction, api.requiredMiddleware()...)
+	app.DELETE("/api/user.vote/:image_id/:tag_id", api.deleteUserVoteAction, api.requiredMiddleware(RequireScope(model.APITokenScopeVote))...)
 
 	app.GET("/api/images", api.getImagesAction)
-	app.POST("/api/images", api.createImageAction, api.requiredMiddleware()...)
-	app.GET("/api/images/random/:count", api.getRandomImagesAction, api.awareMiddleware()...)
-	app.GET("/api/images.search", api.searchImagesAction, api.awareMiddleware()...)
-	app.GET("/api/images.search/random/:count", api.searchImagesRandomAction, api.awareMiddleware()...)
+	app.POST("/api/images", api.createImageAction, api.requiredMiddleware(RequireScope(model.APITokenScopeUpload))...)
+	app.POST("/api/images.batch", api.createImagesBatchAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
+	app.GET("/api/images/random/:count", api.getRandomImagesAction, api.awareMiddleware(RequireScope(model.APITokenScopeRead))...)
+	app.GET("/api/images.search", api.searchImagesAction, api.awareMiddleware(RequireScope(model.APITokenScopeRead))...)
+	app.GET("/api/images.search/random/:count", api.searchImagesRandomAction, api.awareMiddleware(RequireScope(model.APITokenScopeRead))...)
 
 	app.GET("/api/image/:image_id", api.getImageAction)
-	app.PUT("/api/image/:image_id", api.updateImageAction, api.requiredMiddleware()...)
-	app.DELETE("/api/image/:image_id", api.deleteImageAction, api.requiredMiddleware()...)
+	app.PUT("/api/image/:image_id", api.updateImageAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
+	app.DELETE("/api/image/:image_id", api.deleteImageAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
 	app.GET("/api/image.votes/:image_id", api.getLinksForImageAction)
 	app.GET("/api/image.tags/:image_id", api.getTagsForImageAction)
+	app.GET("/api/image.similar/:image_id", api.getSimilarImagesAction, api.requiredMiddleware(RequireScope(model.APITokenScopeRead))...)
+	app.POST("/api/image.approve/:image_id", api.approveImageAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
+	app.POST("/api/image.reject/:image_id", api.rejectImageAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
+
+	app.GET("/api/images.pending", api.getPendingImagesAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
+	app.GET("/api/images.pending/pages/:count/:offset", api.getPendingImagesByCountAndOffsetAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
 
 	app.GET("/api/tags", api.getTagsAction)
-	app.POST("/api/tags", api.createTagsAction, api.requiredMiddleware()...)
+	app.POST("/api/tags", api.createTagsAction, api.requiredMiddleware(RequireScope(model.APITokenScopeVote))...)
 	app.GET("/api/tags/random/:count", api.getRandomTagsAction)
 	app.GET("/api/tags.search", api.searchTagsAction)
 	app.GET("/api/tags.search/random/:count", api.searchTagsRandomAction)
 
 	app.GET("/api/tag/:tag_id", api.getTagAction)
-	app.DELETE("/api/tag/:tag_id", api.deleteTagAction, api.requiredMiddleware()...)
+	app.DELETE("/api/tag/:tag_id", api.deleteTagAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
 	app.GET("/api/tag.images/:tag_id", api.getImagesForTagAction)
 	app.GET("/api/tag.votes/:tag_id", api.getLinksForTagAction)
 
-	app.GET("/api/teams", api.getTeamsAction, api.requiredMiddleware()...)
-	app.GET("/api/team/:team_id", api.getTeamAction, api.requiredMiddleware()...)
-	app.POST("/api/team/:team_id", api.createTeamAction, api.requiredMiddleware()...)
-	app.PUT("/api/team/:team_id", api.updateTeamAction, api.requiredMiddleware()...)
-	app.PATCH("/api/team/:team_id", api.patchTeamAction, api.requiredMiddleware()...)
-	app.DELETE("/api/team/:team_id", api.deleteTeamAction, api.requiredMiddleware()...)
+	app.GET("/api/teams", api.getTeamsAction, api.requiredMiddleware(RequireScope(model.APITokenScopeRead))...)
+	app.GET("/api/team/:team_id", api.getTeamAction, api.requiredMiddleware(RequireScope(model.APITokenScopeRead))...)
+	app.POST("/api/team/:team_id", api.createTeamAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
+	app.PUT("/api/team/:team_id", api.updateTeamAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
+	app.PATCH("/api/team/:team_id", api.patchTeamAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
+	app.DELETE("/api/team/:team_id", api.deleteTeamAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
+	app.GET("/api/team/:team_id/channels", api.getTeamChannelsAction, api.requiredMiddleware(RequireScope(model.APITokenScopeRead))...)
+	app.PUT("/api/team/:team_id/channel/:channel_id", api.updateTeamChannelAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
+	app.DELETE("/api/team/:team_id/channel/:channel_id", api.deleteTeamChannelAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
+
+	app.GET("/api/mattermost.instances", api.getMattermostInstancesAction, api.requiredMiddleware(RequireScope(model.APITokenScopeRead))...)
+	app.POST("/api/mattermost.instances", api.createMattermostInstanceAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
+	app.PUT("/api/mattermost.instance/:instance_id", api.updateMattermostInstanceAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
+	app.DELETE("/api/mattermost.instance/:instance_id", api.deleteMattermostInstanceAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
+
+	app.DELETE("/api/link/:image_id/:tag_id", api.deleteLinkAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
+
+	app.POST("/api/image.report/:image_id", api.reportImageAction, api.requiredMiddleware(RequireScope(model.APITokenScopeVote))...)
+	app.POST("/api/link.report/:image_id/:tag_id", api.reportLinkAction, api.requiredMiddleware(RequireScope(model.APITokenScopeVote))...)
 
-	app.DELETE("/api/link/:image_id/:tag_id", api.deleteLinkAction, api.requiredMiddleware()...)
+	app.GET("/api/reports", api.getReportsAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
+	app.GET("/api/reports/pages/:count/:offset", api.getReportsByCountAndOffsetAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
+	app.POST("/api/report.resolve/:report_id", api.resolveReportAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
+	app.POST("/api/report.dismiss/:report_id", api.dismissReportAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
 
-	app.POST("/api/vote.up/:image_id/:tag_id", api.upvoteAction, api.requiredMiddleware()...)
-	app.POST("/api/vote.down/:image_id/:tag_id", api.downvoteAction, api.requiredMiddleware()...)
+	app.POST("/api/vote.up/:image_id/:tag_id", api.upvoteAction, api.requiredMiddleware(RequireScope(model.APITokenScopeVote))...)
+	app.POST("/api/vote.down/:image_id/:tag_id", api.downvoteAction, api.requiredMiddleware(RequireScope(model.APITokenScopeVote))...)
 
 	app.GET("/api/moderation.log/recent", api.getRecentModerationLogAction)
 	app.GET("/api/moderation.log/pages/:count/:offset", api.getModerationLogByCountAndOffsetAction)
 
-	app.GET("/api/search.history/recent", api.getRecentSearchHistoryAction, api.requiredMiddleware()...)
-	app.GET("/api/search.history/pages/:count/:offset", api.getSearchHistoryByCountAndOffsetAction, api.requiredMiddleware()...)
+	app.GET("/api/search.history/recent", api.getRecentSearchHistoryAction, api.requiredMiddleware(RequireScope(model.APITokenScopeRead))...)
+	app.GET("/api/search.history/pages/:count/:offset", api.getSearchHistoryByCountAndOffsetAction, api.requiredMiddleware(RequireScope(model.APITokenScopeRead))...)
 
 	app.GET("/api/stats", api.getSiteStatsAction)
 	app.GET("/api/image.stats/:image_id", api.getImageStatsAction)
 
 	//session endpoints
-	app.GET("/api/session.user", api.getCurrentUserAction, api.awareMiddleware()...)
-	app.GET("/api/session/:key", api.getSessionKeyAction, api.requiredMiddleware()...)
-	app.POST("/api/session/:key", api.setSessionKeyAction, api.requiredMiddleware()...)
-	app.PUT("/api/session/:key", api.setSessionKeyAction, api.requiredMiddleware()...)
-	app.DELETE("/api/session/:key", api.deleteSessionKeyAction, api.requiredMiddleware()...)
+	app.GET("/api/session.user", api.getCurrentUserAction, api.awareMiddleware(RequireScope(model.APITokenScopeRead))...)
+	app.GET("/api/session/:key", api.getSessionKeyAction, api.requiredMiddleware(RequireCookieSession)...)
+	app.POST("/api/session/:key", api.setSessionKeyAction, api.requiredMiddleware(RequireCookieSession)...)
+	app.PUT("/api/session/:key", api.setSessionKeyAction, api.requiredMiddleware(RequireCookieSession)...)
+	app.DELETE("/api/session/:key", api.deleteSessionKeyAction, api.requiredMiddleware(RequireCookieSession)...)
+
+	//api tokens
+	app.GET("/api/tokens", api.getAPITokensAction, api.requiredMiddleware(RequireCookieSession)...)
+	app.POST("/api/tokens", api.createAPITokenAction, api.requiredMiddleware(RequireCookieSession)...)
+	app.DELETE("/api/token/:token_id", api.revokeAPITokenAction, api.requiredMiddleware(RequireCookieSession)...)
+
+	//slack identities
+	app.GET("/api/slack.identities", api.getSlackIdentitiesAction, api.requiredMiddleware(RequireCookieSession)...)
+	app.POST("/api/slack.identities", api.connectSlackIdentityAction, api.requiredMiddleware(RequireCookieSession)...)
+	app.DELETE("/api/slack.identity/:team_id/:slack_user_id", api.disconnectSlackIdentityAction, api.requiredMiddleware(RequireCookieSession)...)
 
 	//jobs
-	app.GET("/api/jobs", api.getJobsStatusAction, api.requiredMiddleware()...)
-	app.POST("/api/job/:job_id", api.runJobAction, api.requiredMiddleware()...)
+	app.GET("/api/jobs", api.getJobsStatusAction, api.requiredMiddleware(RequireScope(model.APITokenScopeRead))...)
+	app.POST("/api/job/:job_id", api.runJobAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
+	app.GET("/api/storage.report", api.getStorageReportAction, api.requiredMiddleware(RequireScope(model.APITokenScopeModerate))...)
 
 	//errors
-	app.GET("/api/errors/:limit/:offset", api.getErrorsAction, api.requiredMiddleware()...)
+	app.GET("/api/errors/:limit/:offset", api.getErrorsAction, api.requiredMiddleware(RequireScope(model.APITokenScopeRead))...)
 
 	// auth endpoints
-	app.POST("/api/logout", api.logoutAction, api.requiredMiddleware()...)
+	app.POST("/api/logout", api.logoutAction, api.requiredMiddleware(RequireCookieSession)...)
 }
 
 // GET "/api/users"
@@ -424,6 +458,7 @@ func (api APIs) getImagesAction(r *web.Ctx) web.Result {
 }
 
 // POST "/api/images"
+// Optional `tags[]` and `content_rating` fields tag the new image and set its rating in the same transaction.
 func (api APIs) createImageAction(r *web.Ctx) web.Result {
 	files, err := webutil.PostedFiles(r.Request)
 	if err != nil {
@@ -434,8 +469,13 @@ func (api APIs) createImageAction(r *web.Ctx) web.Result {
 	}
 
 	postedFile := files[0]
-	md5sum := model.ConvertMD5(md5.Sum(postedFile.Contents))
-	existing, err := api.Model.GetImageByMD5(r.Context(), md5sum)
+	metadata, err := ReadImageUploadMetadata(r.Request)
+	if err != nil {
+		return API(r).BadRequest(err)
+	}
+
+	perceptualHash := model.PerceptualHash(postedFile.Contents)
+	existing, err := GetExistingImage(r.Context(), api.Model, api.Config, postedFile.Contents, perceptualHash)
 	if err != nil {
 		return API(r).InternalError(err)
 	}
@@ -447,12 +487,17 @@ func (api APIs) createImageAction(r *web.Ctx) web.Result {
 	session := r.Session
 	sessionUser := GetUser(session)
 	userID := parseInt64(session.UserID)
-	image, err := CreateImageFromFile(r.Context(), api.Model, userID, !sessionUser.IsAdmin, postedFile.Contents, postedFile.FileName, api.Files)
+
+	// uploads from regular users wait in the moderation queue before they show up in search.
+	reviewState := model.ImageReviewStatePending
+	if sessionUser.IsModerator {
+		reviewState = model.ImageReviewStateApproved
+	}
+
+	image, err := CreateImageFromFileWithMetadata(r.Context(), api.Model, userID, !sessionUser.IsAdmin, reviewState, postedFile.Contents, perceptualHash, postedFile.FileName, metadata, api.Files)
 	if err != nil {
 		return API(r).InternalError(err)
 	}
-
-	logger.MaybeTrigger(r.Context(), api.Log, model.NewModeration(userID, model.ModerationVerbCreate, model.ModerationObjectImage, image.UUID))
 	return API(r).Result(image)
 }
 
@@ -525,6 +570,128 @@ func (api APIs) getImageAction(r *web.Ctx) web.Result {
 	return API(r).Result(viewmodel.NewImage(*image, api.Config))
 }
 
+// GET "/api/image.similar/:image_id?distance=<distance>"
+func (api APIs) getSimilarImagesAction(r *web.Ctx) web.Result {
+	sessionUser := GetUser(r.Session)
+	if !sessionUser.IsModerator {
+		return API(r).NotAuthorized()
+	}
+
+	imageUUID, err := r.RouteParam("image_id")
+	if err != nil {
+		return API(r).BadRequest(err)
+	}
+
+	distance := api.Config.SimilarImageDistance
+	if value, _ := r.Param("distance"); value != "" {
+		distance, err = web.IntValue(value, nil)
+		if err != nil {
+			return API(r).BadRequest(err)
+		}
+	}
+
+	image, err := api.Model.GetImageByUUID(r.Context(), imageUUID)
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	if image.IsZero() {
+		return API(r).NotFound()
+	}
+	if image.PerceptualHash == nil {
+		return API(r).Result([]viewmodel.Image{})
+	}
+
+	similar, err := api.Model.GetSimilarImages(r.Context(), *image.PerceptualHash, distance)
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+
+	results := []model.Image{}
+	for _, i := range similar {
+		if i.ID != image.ID {
+			results = append(results, i)
+		}
+	}
+	return API(r).Result(viewmodel.WrapImages(results, api.Config))
+}
+
+// GET "/api/images.pending"
+func (api APIs) getPendingImagesAction(r *web.Ctx) web.Result {
+	sessionUser := GetUser(r.Session)
+	if !sessionUser.IsModerator {
+		return API(r).NotAuthorized()
+	}
+
+	images, err := api.Model.GetImagesByReviewState(r.Context(), model.ImageReviewStatePending, 100, 0)
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	return API(r).Result(viewmodel.WrapImages(images, api.Config))
+}
+
+// GET "/api/images.pending/pages/:count/:offset"
+func (api APIs) getPendingImagesByCountAndOffsetAction(r *web.Ctx) web.Result {
+	sessionUser := GetUser(r.Session)
+	if !sessionUser.IsModerator {
+		return API(r).NotAuthorized()
+	}
+
+	count, err := web.IntValue(r.RouteParam("count"))
+	if err != nil {
+		return API(r).BadRequest(err)
+	}
+	offset, err := web.IntValue(r.RouteParam("offset"))
+	if err != nil {
+		return API(r).BadRequest(err)
+	}
+
+	images, err := api.Model.GetImagesByReviewState(r.Context(), model.ImageReviewStatePending, count, offset)
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	return API(r).Result(viewmodel.WrapImages(images, api.Config))
+}
+
+// POST "/api/image.approve/:image_id"
+func (api APIs) approveImageAction(r *web.Ctx) web.Result {
+	return api.reviewImageAction(model.ImageReviewStateApproved, model.ModerationVerbApprove, r)
+}
+
+// POST "/api/image.reject/:image_id"
+func (api APIs) rejectImageAction(r *web.Ctx) web.Result {
+	return api.reviewImageAction(model.ImageReviewStateRejected, model.ModerationVerbReject, r)
+}
+
+func (api APIs) reviewImageAction(reviewState, verb string, r *web.Ctx) web.Result {
+	sessionUser := GetUser(r.Session)
+	if !sessionUser.IsModerator {
+		return API(r).NotAuthorized()
+	}
+
+	imageUUID, err := r.RouteParam("image_id")
+	if err != nil {
+		return API(r).BadRequest(err)
+	}
+
+	image, err := api.Model.GetImageByUUID(r.Context(), imageUUID)
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	if image.IsZero() {
+		return API(r).NotFound()
+	}
+
+	if image.ReviewState != reviewState {
+		err = api.Model.UpdateImageReviewState(r.Context(), image.ID, reviewState)
+		if err != nil {
+			return API(r).InternalError(err)
+		}
+		image.ReviewState = reviewState
+		logger.MaybeTrigger(r.Context(), api.Log, model.NewModeration(sessionUser.ID, verb, model.ModerationObjectImage, image.UUID))
+	}
+	return API(r).Result(viewmodel.NewImage(*image, api.Config))
+}
+
 // PUT "/api/image/:image_id"
 func (api APIs) updateImageAction(r *web.Ctx) web.Result {
 	sessionUser := GetUser(r.Session)
@@ -600,12 +767,7 @@ func (api APIs) deleteImageAction(r *web.Ctx) web.Result {
 		return API(r).NotAuthorized()
 	}
 
-	//delete from s3 (!!)
-	err = api.Files.DeleteFile(api.Files.NewLocationFromKey(image.S3Key))
-	if err != nil {
-		return API(r).InternalError(err)
-	}
-
+	// the files are queued for deletion with the row, and removed by the `delete_unreferenced_files` job.
 	err = api.Model.DeleteImageByID(r.Context(), image.ID)
 	if err != nil {
 		return API(r).InternalError(err)
@@ -904,6 +1066,178 @@ func (api APIs) deleteLinkAction(r *web.Ctx) web.Result {
 	return API(r).OK()
 }
 
+// POST "/api/image.report/:image_id"
+func (api APIs) reportImageAction(r *web.Ctx) web.Result {
+	imageUUID, err := r.RouteParam("image_id")
+	if err != nil {
+		return API(r).BadRequest(err)
+	}
+
+	image, err := api.Model.GetImageByUUID(r.Context(), imageUUID)
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	if image.IsZero() {
+		return API(r).NotFound()
+	}
+	return api.createReport(r, image, nil)
+}
+
+// POST "/api/link.report/:image_id/:tag_id"
+func (api APIs) reportLinkAction(r *web.Ctx) web.Result {
+	imageUUID, err := r.RouteParam("image_id")
+	if err != nil {
+		return API(r).BadRequest(err)
+	}
+	tagUUID, err := r.RouteParam("tag_id")
+	if err != nil {
+		return API(r).BadRequest(err)
+	}
+
+	image, err := api.Model.GetImageByUUID(r.Context(), imageUUID)
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	if image.IsZero() {
+		return API(r).NotFound()
+	}
+
+	tag, err := api.Model.GetTagByUUID(r.Context(), tagUUID)
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	if tag.IsZero() {
+		return API(r).NotFound()
+	}
+
+	link, err := api.Model.GetVoteSummary(r.Context(), image.ID, tag.ID)
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	if link.IsZero() {
+		return API(r).NotFound()
+	}
+	return api.createReport(r, image, tag)
+}
+
+func (api APIs) createReport(r *web.Ctx, image *model.Image, tag *model.Tag) web.Result {
+	sessionUser := GetUser(r.Session)
+
+	var args viewmodel.CreateReportArgs
+	if err := r.PostBodyAsJSON(&args); err != nil {
+		return API(r).BadRequest(err)
+	}
+
+	var tagID *int64
+	if tag != nil {
+		tagID = &tag.ID
+	}
+	report, err := model.NewReport(sessionUser.ID, image.ID, tagID, args.Reason, args.Note)
+	if err != nil {
+		return API(r).BadRequest(err)
+	}
+
+	didHide, err := api.Model.CreateReport(r.Context(), report, api.Config.ReportHideThreshold)
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	report.UserUUID = sessionUser.UUID
+	report.ImageUUID = image.UUID
+	if tag != nil {
+		report.TagUUID = tag.UUID
+		report.TagValue = tag.TagValue
+	}
+	if didHide {
+		if tag != nil {
+			logger.MaybeTrigger(r.Context(), api.Log, model.NewModeration(sessionUser.ID, model.ModerationVerbHide, model.ModerationObjectLink, image.UUID, tag.UUID))
+		} else {
+			logger.MaybeTrigger(r.Context(), api.Log, model.NewModeration(sessionUser.ID, model.ModerationVerbHide, model.ModerationObjectImage, image.UUID))
+		}
+	}
+	return API(r).Result(report)
+}
+
+// GET "/api/reports"
+func (api APIs) getReportsAction(r *web.Ctx) web.Result {
+	sessionUser := GetUser(r.Session)
+	if !sessionUser.IsModerator {
+		return API(r).NotAuthorized()
+	}
+
+	reports, err := api.Model.GetReportsByState(r.Context(), model.ReportStateOpen, 100, 0)
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	return API(r).Result(reports)
+}
+
+// GET "/api/reports/pages/:count/:offset"
+func (api APIs) getReportsByCountAndOffsetAction(r *web.Ctx) web.Result {
+	sessionUser := GetUser(r.Session)
+	if !sessionUser.IsModerator {
+		return API(r).NotAuthorized()
+	}
+
+	count, err := web.IntValue(r.RouteParam("count"))
+	if err != nil {
+		return API(r).BadRequest(err)
+	}
+	offset, err := web.IntValue(r.RouteParam("offset"))
+	if err != nil {
+		return API(r).BadRequest(err)
+	}
+
+	reports, err := api.Model.GetReportsByState(r.Context(), model.ReportStateOpen, count, offset)
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	return API(r).Result(reports)
+}
+
+// POST "/api/report.resolve/:report_id"
+func (api APIs) resolveReportAction(r *web.Ctx) web.Result {
+	return api.closeReportAction(model.ReportStateResolved, model.ModerationVerbResolve, r)
+}
+
+// POST "/api/report.dismiss/:report_id"
+func (api APIs) dismissReportAction(r *web.Ctx) web.Result {
+	return api.closeReportAction(model.ReportStateDismissed, model.ModerationVerbDismiss, r)
+}
+
+func (api APIs) closeReportAction(state, verb string, r *web.Ctx) web.Result {
+	sessionUser := GetUser(r.Session)
+	if !sessionUser.IsModerator {
+		return API(r).NotAuthorized()
+	}
+
+	reportUUID, err := r.RouteParam("report_id")
+	if err != nil {
+		return API(r).BadRequest(err)
+	}
+
+	report, err := api.Model.GetReportByUUID(r.Context(), reportUUID)
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	if report.IsZero() {
+		return API(r).NotFound()
+	}
+	if !report.IsOpen() {
+		return API(r).OK()
+	}
+
+	if err = api.Model.CloseReports(r.Context(), report, state, sessionUser.ID); err != nil {
+		return API(r).InternalError(err)
+	}
+
+	if report.IsLinkReport() {
+		logger.MaybeTrigger(r.Context(), api.Log, model.NewModeration(sessionUser.ID, verb, model.ModerationObjectLink, report.ImageUUID, report.TagUUID))
+	} else {
+		logger.MaybeTrigger(r.Context(), api.Log, model.NewModeration(sessionUser.ID, verb, model.ModerationObjectImage, report.ImageUUID))
+	}
+	return API(r).OK()
+}
+
 // GET "/api/teams"
 func (api APIs) getTeamsAction(r *web.Ctx) web.Result {
 	sessionUser := GetUser(r.Session)
@@ -994,6 +1328,12 @@ func (api APIs) updateTeamAction(r *web.Ctx) web.Result {
 	}
 
 	updatedTeam.TeamID = teamID
+	updatedTeam.BotAccessToken = team.BotAccessToken
+	updatedTeam.UserAccessToken = team.UserAccessToken
+	updatedTeam.BotUserID = team.BotUserID
+	updatedTeam.Scopes = team.Scopes
+	updatedTeam.InstalledUTC = team.InstalledUTC
+	updatedTeam.UninstalledUTC = team.UninstalledUTC
 
 	_, err = api.Model.Invoke(r.Context()).Update(&updatedTeam)
 	if err != nil {
@@ -1073,6 +1413,230 @@ func (api APIs) deleteTeamAction(r *web.Ctx) web.Result {
 	return API(r).OK()
 }
 
+// GET "/api/team/:team_id/channels"
+func (api APIs) getTeamChannelsAction(r *web.Ctx) web.Result {
+	sessionUser := GetUser(r.Session)
+	if sessionUser != nil && !sessionUser.IsAdmin {
+		return API(r).NotAuthorized()
+	}
+
+	teamID, err := r.RouteParam("team_id")
+	if err != nil {
+		return API(r).BadRequest(err)
+	}
+
+	team, err := api.Model.GetSlackTeamByTeamID(r.Context(), teamID)
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	if team.IsZero() {
+		return API(r).NotFound()
+	}
+
+	settings, err := api.Model.GetSlackChannelSettings(r.Context(), teamID)
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	return API(r).Result(settings)
+}
+
+// PUT "/api/team/:team_id/channel/:channel_id"
+func (api APIs) updateTeamChannelAction(r *web.Ctx) web.Result {
+	sessionUser := GetUser(r.Session)
+	if sessionUser != nil && !sessionUser.IsAdmin {
+		return API(r).NotAuthorized()
+	}
+
+	teamID, err := r.RouteParam("team_id")
+	if err != nil {
+		return API(r).BadRequest(err)
+	}
+	channelID, err := r.RouteParam("channel_id")
+	if err != nil {
+		return API(r).BadRequest(err)
+	}
+
+	team, err := api.Model.GetSlackTeamByTeamID(r.Context(), teamID)
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	if team.IsZero() {
+		return API(r).NotFound()
+	}
+
+	var args model.SlackChannelSetting
+	if err = r.PostBodyAsJSON(&args); err != nil {
+		return API(r).BadRequest(err)
+	}
+	if !model.IsValidContentRating(args.ContentRatingFilter) {
+		return API(r).BadRequest(exception.New(model.ErrContentRatingInvalid, exception.OptMessagef("rating: %d", args.ContentRatingFilter)))
+	}
+
+	setting := model.NewSlackChannelSetting(teamID, channelID, args.ContentRatingFilter)
+	setting.ChannelName = args.ChannelName
+	if sessionUser != nil {
+		setting.UpdatedByID = sessionUser.UUID
+		setting.UpdatedByName = sessionUser.Username
+	}
+	if err = api.Model.SaveSlackChannelSetting(r.Context(), setting); err != nil {
+		return API(r).InternalError(err)
+	}
+
+	saved, err := api.Model.GetSlackChannelSetting(r.Context(), teamID, channelID)
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	return API(r).Result(saved)
+}
+
+// DELETE "/api/team/:team_id/channel/:channel_id"
+func (api APIs) deleteTeamChannelAction(r *web.Ctx) web.Result {
+	sessionUser := GetUser(r.Session)
+	if sessionUser != nil && !sessionUser.IsAdmin {
+		return API(r).NotAuthorized()
+	}
+
+	teamID, err := r.RouteParam("team_id")
+	if err != nil {
+		return API(r).BadRequest(err)
+	}
+	channelID, err := r.RouteParam("channel_id")
+	if err != nil {
+		return API(r).BadRequest(err)
+	}
+
+	setting, err := api.Model.GetSlackChannelSetting(r.Context(), teamID, channelID)
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	if setting.IsZero() {
+		return API(r).NotFound()
+	}
+
+	if err = api.Model.DeleteSlackChannelSetting(r.Context(), teamID, channelID); err != nil {
+		return API(r).InternalError(err)
+	}
+	return API(r).OK()
+}
+
+// GET "/api/mattermost.instances"
+func (api APIs) getMattermostInstancesAction(r *web.Ctx) web.Result {
+	sessionUser := GetUser(r.Session)
+	if sessionUser != nil && !sessionUser.IsAdmin {
+		return API(r).NotAuthorized()
+	}
+
+	instances, err := api.Model.GetAllMattermostInstances(r.Context())
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	return API(r).Result(instances)
+}
+
+// POST "/api/mattermost.instances"
+func (api APIs) createMattermostInstanceAction(r *web.Ctx) web.Result {
+	sessionUser := GetUser(r.Session)
+	if sessionUser == nil || !sessionUser.IsAdmin {
+		return API(r).NotAuthorized()
+	}
+
+	var args viewmodel.CreateMattermostInstanceArgs
+	if err := r.PostBodyAsJSON(&args); err != nil {
+		return API(r).BadRequest(err)
+	}
+	if args.Name == "" || args.Token == "" {
+		return API(r).BadRequest(fmt.Errorf("`name` and `token` are required"))
+	}
+
+	instance, err := model.NewMattermostInstance(args.Name, args.Token, sessionUser.ID, api.Config.GetEncryptionKey())
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	if args.ContentRatingFilter != 0 {
+		if !model.IsValidContentRating(args.ContentRatingFilter) {
+			return API(r).BadRequest(exception.New(model.ErrContentRatingInvalid, exception.OptMessagef("rating: %d", args.ContentRatingFilter)))
+		}
+		instance.ContentRatingFilter = args.ContentRatingFilter
+	}
+
+	existing, err := api.Model.GetMattermostInstanceByToken(r.Context(), args.Token, api.Config.GetEncryptionKey())
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	if !existing.IsZero() {
+		return API(r).BadRequest(fmt.Errorf("an instance is already registered with that token"))
+	}
+
+	if err = api.Model.Invoke(r.Context()).Create(instance); err != nil {
+		return API(r).InternalError(err)
+	}
+	return API(r).Result(instance)
+}
+
+// PUT "/api/mattermost.instance/:instance_id"
+// Only the name, content rating and whether the instance is enabled can be changed; register a new instance to change the token.
+func (api APIs) updateMattermostInstanceAction(r *web.Ctx) web.Result {
+	sessionUser := GetUser(r.Session)
+	if sessionUser != nil && !sessionUser.IsAdmin {
+		return API(r).NotAuthorized()
+	}
+
+	instanceID, err := r.RouteParam("instance_id")
+	if err != nil {
+		return API(r).BadRequest(err)
+	}
+	instance, err := api.Model.GetMattermostInstanceByUUID(r.Context(), instanceID)
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	if instance.IsZero() {
+		return API(r).NotFound()
+	}
+
+	var updated model.MattermostInstance
+	if err = r.PostBodyAsJSON(&updated); err != nil {
+		return API(r).BadRequest(err)
+	}
+	if !model.IsValidContentRating(updated.ContentRatingFilter) {
+		return API(r).BadRequest(exception.New(model.ErrContentRatingInvalid, exception.OptMessagef("rating: %d", updated.ContentRatingFilter)))
+	}
+	if updated.Name != "" {
+		instance.Name = updated.Name
+	}
+	instance.ContentRatingFilter = updated.ContentRatingFilter
+	instance.IsEnabled = updated.IsEnabled
+
+	if _, err = api.Model.Invoke(r.Context()).Update(instance); err != nil {
+		return API(r).InternalError(err)
+	}
+	return API(r).Result(instance)
+}
+
+// DELETE "/api/mattermost.instance/:instance_id"
+func (api APIs) deleteMattermostInstanceAction(r *web.Ctx) web.Result {
+	sessionUser := GetUser(r.Session)
+	if sessionUser != nil && !sessionUser.IsAdmin {
+		return API(r).NotAuthorized()
+	}
+
+	instanceID, err := r.RouteParam("instance_id")
+	if err != nil {
+		return API(r).BadRequest(err)
+	}
+	instance, err := api.Model.GetMattermostInstanceByUUID(r.Context(), instanceID)
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	if instance.IsZero() {
+		return API(r).NotFound()
+	}
+
+	if _, err = api.Model.Invoke(r.Context()).Delete(instance); err != nil {
+		return API(r).InternalError(err)
+	}
+	return API(r).OK()
+}
+
 // POST "/api/vote.up/:image_id/:tag_id"
 func (api APIs) upvoteAction(r *web.Ctx) web.Result {
 	return api.voteAction(true, r.Session, r)
@@ -1253,6 +1817,142 @@ func (api APIs) getCurrentUserAction(r *web.Ctx) web.Result {
 	return API(r).Result(cu)
 }
 
+// GET "/api/tokens"
+func (api APIs) getAPITokensAction(r *web.Ctx) web.Result {
+	sessionUser := GetUser(r.Session)
+	tokens, err := api.Model.GetAPITokensForUserID(r.Context(), sessionUser.ID)
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	return API(r).Result(tokens)
+}
+
+// POST "/api/tokens"
+func (api APIs) createAPITokenAction(r *web.Ctx) web.Result {
+	sessionUser := GetUser(r.Session)
+
+	var args viewmodel.CreateAPITokenArgs
+	if err := r.PostBodyAsJSON(&args); err != nil {
+		return API(r).BadRequest(err)
+	}
+	if len(args.Name) == 0 {
+		return API(r).BadRequest(fmt.Errorf("`name` is required"))
+	}
+	if len(args.Scopes) == 0 {
+		return API(r).BadRequest(fmt.Errorf("`scopes` is required"))
+	}
+
+	expiresUTC := args.ExpiresUTC
+	if expiresUTC == nil && args.ExpiresInDays > 0 {
+		expires := time.Now().UTC().AddDate(0, 0, args.ExpiresInDays)
+		expiresUTC = &expires
+	}
+	if expiresUTC != nil && expiresUTC.Before(time.Now().UTC()) {
+		return API(r).BadRequest(fmt.Errorf("`expires_utc` must be in the future"))
+	}
+
+	// only moderators can grant tokens that moderate.
+	for _, scope := range args.Scopes {
+		if scope == model.APITokenScopeModerate && !sessionUser.IsModerator {
+			return API(r).NotAuthorized()
+		}
+	}
+
+	apiToken, token, err := model.NewAPIToken(sessionUser.ID, args.Name, args.Scopes, expiresUTC, api.Config.GetEncryptionKey())
+	if exception.Is(err, model.ErrAPITokenScopeInvalid) {
+		return API(r).BadRequest(err)
+	}
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	if err = api.Model.Invoke(r.Context()).Create(apiToken); err != nil {
+		return API(r).InternalError(err)
+	}
+	return API(r).Result(viewmodel.CreatedAPIToken{APIToken: *apiToken, Token: token})
+}
+
+// DELETE "/api/token/:token_id"
+func (api APIs) revokeAPITokenAction(r *web.Ctx) web.Result {
+	sessionUser := GetUser(r.Session)
+
+	tokenUUID, err := r.RouteParam("token_id")
+	if err != nil {
+		return API(r).BadRequest(err)
+	}
+
+	apiToken, err := api.Model.GetAPITokenByUUID(r.Context(), tokenUUID)
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	if apiToken.IsZero() {
+		return API(r).NotFound()
+	}
+	if apiToken.UserID != sessionUser.ID && !sessionUser.IsAdmin {
+		return API(r).NotAuthorized()
+	}
+
+	if err = api.Model.RevokeAPIToken(r.Context(), apiToken.ID); err != nil {
+		return API(r).InternalError(err)
+	}
+	return API(r).OK()
+}
+
+// GET "/api/slack.identities"
+func (api APIs) getSlackIdentitiesAction(r *web.Ctx) web.Result {
+	sessionUser := GetUser(r.Session)
+	identities, err := api.Model.GetSlackIdentitiesForUserID(r.Context(), sessionUser.ID)
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	return API(r).Result(identities)
+}
+
+// POST "/api/slack.identities"
+func (api APIs) connectSlackIdentityAction(r *web.Ctx) web.Result {
+	sessionUser := GetUser(r.Session)
+
+	var args viewmodel.ConnectSlackIdentityArgs
+	if err := r.PostBodyAsJSON(&args); err != nil {
+		return API(r).BadRequest(err)
+	}
+	if len(args.Token) == 0 {
+		return API(r).BadRequest(fmt.Errorf("`token` is required"))
+	}
+
+	teamID, slackUserID, err := model.ParseSlackConnectToken(args.Token, api.Config.GetEncryptionKey())
+	if exception.Is(err, model.ErrSlackConnectTokenInvalid) || exception.Is(err, model.ErrSlackConnectTokenExpired) {
+		return API(r).BadRequest(err)
+	}
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+
+	identity := model.NewSlackIdentity(teamID, slackUserID, sessionUser.ID)
+	if err = api.Model.SaveSlackIdentity(r.Context(), identity); err != nil {
+		return API(r).InternalError(err)
+	}
+	return API(r).Result(identity)
+}
+
+// DELETE "/api/slack.identity/:team_id/:slack_user_id"
+func (api APIs) disconnectSlackIdentityAction(r *web.Ctx) web.Result {
+	sessionUser := GetUser(r.Session)
+
+	teamID, err := r.RouteParam("team_id")
+	if err != nil {
+		return API(r).BadRequest(err)
+	}
+	slackUserID, err := r.RouteParam("slack_user_id")
+	if err != nil {
+		return API(r).BadRequest(err)
+	}
+
+	if err = api.Model.DeleteSlackIdentity(r.Context(), sessionUser.ID, teamID, slackUserID); err != nil {
+		return API(r).InternalError(err)
+	}
+	return API(r).OK()
+}
+
 // GET "/api/session/:key"
 func (api APIs) getSessionKeyAction(r *web.Ctx) web.Result {
 	session := r.Session
@@ -1327,6 +2027,19 @@ func (api APIs) runJobAction(r *web.Ctx) web.Result {
 	return API(r).OK()
 }
 
+// GET "/api/storage.report"
+func (api APIs) getStorageReportAction(r *web.Ctx) web.Result {
+	sessionUser := GetUser(r.Session)
+	if sessionUser != nil && !sessionUser.IsAdmin {
+		return API(r).NotAuthorized()
+	}
+	report, err := jobs.ReconcileStorage{Log: api.Log, Model: api.Model, Files: api.Files}.Report(r.Context())
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+	return API(r).Result(report)
+}
+
 func (api APIs) getErrorsAction(r *web.Ctx) web.Result {
 	sessionUser := GetUser(r.Session)
 	if sessionUser != nil && !sessionUser.IsAdmin {
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"net/http"
 	"testing"
@@ -59,6 +60,31 @@ type testTeamResponse struct {
 	Response *model.SlackTeam `json:"response"`
 }
 
+type testTeamChannelsResponse struct {
+	Meta     *APIResponseMeta            `json:"meta"`
+	Response []model.SlackChannelSetting `json:"response"`
+}
+
+type testTeamChannelResponse struct {
+	Meta     *APIResponseMeta           `json:"meta"`
+	Response *model.SlackChannelSetting `json:"response"`
+}
+
+type testAPITokenResponse struct {
+	Meta     *APIResponseMeta           `json:"meta"`
+	Response *viewmodel.CreatedAPIToken `json:"response"`
+}
+
+type testSlackIdentitiesResponse struct {
+	Meta     *APIResponseMeta      `json:"meta"`
+	Response []model.SlackIdentity `json:"response"`
+}
+
+type testReportResponse struct {
+	Meta     *APIResponseMeta `json:"meta"`
+	Response *model.Report    `json:"response"`
+}
+
 func testCtx() context.Context {
 	return context.TODO()
 }
@@ -408,3 +434,402 @@ func TestAPIGetTeam(t *testing.T) {
 	assert.NotNil(res.Response)
 	assert.Equal(team1.TeamID, res.Response.TeamID)
 }
+
+func testAPITokenConfig(a *assert.Assertions) *config.Giffy {
+	key, err := crypto.CreateKey(32)
+	a.Nil(err)
+	cfg := config.MustNewFromEnv()
+	cfg.EncryptionKey = base64.StdEncoding.EncodeToString(key)
+	return cfg
+}
+
+func TestAPITokenBearerAuth(t *testing.T) {
+	assert := assert.New(t)
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+	cfg := testAPITokenConfig(assert)
+
+	u, err := CreateTestModeratorUser(&m)
+	assert.Nil(err)
+	_, token, err := m.CreateTestAPIToken(testCtx(), u.ID, cfg.GetEncryptionKey(), model.APITokenScopeRead)
+	assert.Nil(err)
+
+	app := web.MustNew()
+	app.Register(APIs{Model: &m, Config: cfg})
+
+	var res testCurrentUserResponse
+	_, err = web.MockGet(app, "/api/session.user", r2.OptHeaderValue("Authorization", "Bearer "+token)).JSON(&res)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.Meta.StatusCode)
+	assert.True(res.Response.IsLoggedIn)
+	assert.Equal(u.UUID, res.Response.UUID)
+}
+
+func TestAPITokenBearerAuthMissingScope(t *testing.T) {
+	assert := assert.New(t)
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+	cfg := testAPITokenConfig(assert)
+
+	u, err := CreateTestModeratorUser(&m)
+	assert.Nil(err)
+	_, token, err := m.CreateTestAPIToken(testCtx(), u.ID, cfg.GetEncryptionKey(), model.APITokenScopeRead)
+	assert.Nil(err)
+
+	app := web.MustNew()
+	app.Register(APIs{Model: &m, Config: cfg})
+
+	var res testImagesResponse
+	_, err = web.MockPost(app, "/api/images", nil, r2.OptHeaderValue("Authorization", "Bearer "+token)).JSON(&res)
+	assert.Nil(err)
+	assert.Equal(http.StatusForbidden, res.Meta.StatusCode)
+}
+
+func TestAPITokenBearerAuthRevoked(t *testing.T) {
+	assert := assert.New(t)
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+	cfg := testAPITokenConfig(assert)
+
+	u, err := CreateTestModeratorUser(&m)
+	assert.Nil(err)
+	apiToken, token, err := m.CreateTestAPIToken(testCtx(), u.ID, cfg.GetEncryptionKey(), model.APITokenScopeRead)
+	assert.Nil(err)
+	assert.Nil(m.RevokeAPIToken(testCtx(), apiToken.ID))
+
+	app := web.MustNew()
+	app.Register(APIs{Model: &m, Config: cfg})
+
+	var res testCurrentUserResponse
+	_, err = web.MockGet(app, "/api/session.user", r2.OptHeaderValue("Authorization", "Bearer "+token)).JSON(&res)
+	assert.Nil(err)
+	assert.Equal(http.StatusForbidden, res.Meta.StatusCode)
+}
+
+func TestAPITokenCreate(t *testing.T) {
+	assert := assert.New(t)
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+	cfg := testAPITokenConfig(assert)
+
+	auth, session := MockAuth(assert, &m, MockModeratorLogin)
+	defer MockLogout(assert, &m, auth, session)
+
+	app := web.MustNew()
+	app.Auth = *auth
+	app.Register(APIs{Model: &m, Config: cfg})
+
+	var res testAPITokenResponse
+	_, err = web.MockPostJSON(app, "/api/tokens", viewmodel.CreateAPITokenArgs{
+		Name:          "test",
+		Scopes:        []string{model.APITokenScopeRead},
+		ExpiresInDays: 30,
+	}, r2.OptCookieValue(auth.CookieDefaults.Name, session.SessionID)).JSON(&res)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.Meta.StatusCode)
+	assert.NotEmpty(res.Response.Token)
+	assert.NotNil(res.Response.ExpiresUTC)
+
+	// tokens cannot be used to manage tokens.
+	var listRes testAPITokenResponse
+	_, err = web.MockGet(app, "/api/tokens", r2.OptHeaderValue("Authorization", "Bearer "+res.Response.Token)).JSON(&listRes)
+	assert.Nil(err)
+	assert.Equal(http.StatusForbidden, listRes.Meta.StatusCode)
+}
+
+func TestAPISlackIdentities(t *testing.T) {
+	assert := assert.New(t)
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+	cfg := testAPITokenConfig(assert)
+
+	auth, session := MockAuth(assert, &m, MockModeratorLogin)
+	defer MockLogout(assert, &m, auth, session)
+
+	app := web.MustNew()
+	app.Auth = *auth
+	app.Register(APIs{Model: &m, Config: cfg})
+
+	teamID := uuid.V4().String()
+	token, err := model.NewSlackConnectToken(teamID, "U123", cfg.GetEncryptionKey())
+	assert.Nil(err)
+
+	var res testSlackIdentitiesResponse
+	meta, err := web.MockPostJSON(app, "/api/slack.identities", viewmodel.ConnectSlackIdentityArgs{Token: token + "x"},
+		r2.OptCookieValue(auth.CookieDefaults.Name, session.SessionID),
+	).Discard()
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, meta.StatusCode)
+
+	meta, err = web.MockPostJSON(app, "/api/slack.identities", viewmodel.ConnectSlackIdentityArgs{Token: token},
+		r2.OptCookieValue(auth.CookieDefaults.Name, session.SessionID),
+	).Discard()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, meta.StatusCode)
+
+	linked, err := m.GetUserForSlackIdentity(testCtx(), teamID, "U123")
+	assert.Nil(err)
+	assert.Equal(parseInt64(session.UserID), linked.ID)
+
+	_, err = web.MockGet(app, "/api/slack.identities", r2.OptCookieValue(auth.CookieDefaults.Name, session.SessionID)).JSON(&res)
+	assert.Nil(err)
+	assert.Len(res.Response, 1)
+	assert.Equal("U123", res.Response[0].SlackUserID)
+
+	meta, err = web.MockMethod(app, http.MethodDelete, fmt.Sprintf("/api/slack.identity/%s/U123", teamID),
+		r2.OptCookieValue(auth.CookieDefaults.Name, session.SessionID),
+	).Discard()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, meta.StatusCode)
+
+	linked, err = m.GetUserForSlackIdentity(testCtx(), teamID, "U123")
+	assert.Nil(err)
+	assert.True(linked.IsZero())
+}
+
+type testMattermostInstanceResponse struct {
+	Meta     *APIResponseMeta          `json:"meta"`
+	Response *model.MattermostInstance `json:"response"`
+}
+
+type testMattermostInstancesResponse struct {
+	Meta     *APIResponseMeta           `json:"meta"`
+	Response []model.MattermostInstance `json:"response"`
+}
+
+func TestAPIMattermostInstances(t *testing.T) {
+	assert := assert.New(t)
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+	cfg := testAPITokenConfig(assert)
+
+	auth, session := MockAuth(assert, &m, MockAdminLogin)
+	defer MockLogout(assert, &m, auth, session)
+
+	app := web.MustNew()
+	app.Auth = *auth
+	app.Register(APIs{Model: &m, Config: cfg})
+
+	token := uuid.V4().String()
+	var created testMattermostInstanceResponse
+	_, err = web.MockPostJSON(app, "/api/mattermost.instances", viewmodel.CreateMattermostInstanceArgs{Name: "test_instance", Token: token, ContentRatingFilter: model.ContentRatingPG},
+		r2.OptCookieValue(auth.CookieDefaults.Name, session.SessionID),
+	).JSON(&created)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, created.Meta.StatusCode)
+	assert.Equal(model.ContentRatingPG, created.Response.ContentRatingFilter)
+
+	// tokens can only be registered once.
+	meta, err := web.MockPostJSON(app, "/api/mattermost.instances", viewmodel.CreateMattermostInstanceArgs{Name: "other_instance", Token: token},
+		r2.OptCookieValue(auth.CookieDefaults.Name, session.SessionID),
+	).Discard()
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, meta.StatusCode)
+
+	var updated testMattermostInstanceResponse
+	_, err = web.MockMethod(app, http.MethodPut, "/api/mattermost.instance/"+created.Response.UUID,
+		r2.OptJSONBody(model.MattermostInstance{ContentRatingFilter: model.ContentRatingR, IsEnabled: false}),
+		r2.OptCookieValue(auth.CookieDefaults.Name, session.SessionID),
+	).JSON(&updated)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, updated.Meta.StatusCode)
+	assert.Equal("test_instance", updated.Response.Name)
+
+	verify, err := m.GetMattermostInstanceByToken(testCtx(), token, cfg.GetEncryptionKey())
+	assert.Nil(err)
+	assert.Equal(model.ContentRatingR, verify.ContentRatingFilter)
+	assert.False(verify.IsEnabled)
+
+	var list testMattermostInstancesResponse
+	_, err = web.MockGet(app, "/api/mattermost.instances", r2.OptCookieValue(auth.CookieDefaults.Name, session.SessionID)).JSON(&list)
+	assert.Nil(err)
+	assert.NotEmpty(list.Response)
+
+	meta, err = web.MockMethod(app, http.MethodDelete, "/api/mattermost.instance/"+created.Response.UUID,
+		r2.OptCookieValue(auth.CookieDefaults.Name, session.SessionID),
+	).Discard()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, meta.StatusCode)
+
+	verify, err = m.GetMattermostInstanceByUUID(testCtx(), created.Response.UUID)
+	assert.Nil(err)
+	assert.True(verify.IsZero())
+}
+
+func TestAPIReviewImage(t *testing.T) {
+	assert := assert.New(t)
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	auth, session := MockAuth(assert, &m, MockModeratorLogin)
+	defer MockLogout(assert, &m, auth, session)
+
+	u, err := m.CreateTestUser(testCtx())
+	assert.Nil(err)
+	i, err := m.CreateTestImage(testCtx(), u.ID)
+	assert.Nil(err)
+	assert.Nil(m.UpdateImageReviewState(testCtx(), i.ID, model.ImageReviewStatePending))
+
+	app := web.MustNew()
+	app.Auth = *auth
+	app.Register(APIs{Model: &m, Config: config.MustNewFromEnv()})
+
+	var pending testImagesResponse
+	_, err = web.MockGet(app, "/api/images.pending/pages/1000/0", r2.OptCookieValue(auth.CookieDefaults.Name, session.SessionID)).JSON(&pending)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, pending.Meta.StatusCode)
+	assert.Any(pending.Response, func(v interface{}) bool {
+		return v.(viewmodel.Image).UUID == i.UUID
+	})
+
+	_, err = web.MockMethod(app, "POST", fmt.Sprintf("/api/image.approve/%s", i.UUID), r2.OptCookieValue(auth.CookieDefaults.Name, session.SessionID)).Discard()
+	assert.Nil(err)
+
+	verify, err := m.GetImageByID(testCtx(), i.ID)
+	assert.Nil(err)
+	assert.True(verify.IsApproved())
+}
+
+func TestAPIReviewImageNotModerator(t *testing.T) {
+	assert := assert.New(t)
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	u, err := m.CreateTestUser(testCtx())
+	assert.Nil(err)
+	auth, session, err := AuthTestUser(u, &m)
+	assert.Nil(err)
+	defer MockLogout(assert, &m, auth, session)
+
+	i, err := m.CreateTestImage(testCtx(), u.ID)
+	assert.Nil(err)
+	assert.Nil(m.UpdateImageReviewState(testCtx(), i.ID, model.ImageReviewStatePending))
+
+	app := web.MustNew()
+	app.Auth = *auth
+	app.Register(APIs{Model: &m, Config: config.MustNewFromEnv()})
+
+	var res testImagesResponse
+	_, err = web.MockMethod(app, "POST", fmt.Sprintf("/api/image.approve/%s", i.UUID), r2.OptCookieValue(auth.CookieDefaults.Name, session.SessionID)).JSON(&res)
+	assert.Nil(err)
+	assert.Equal(http.StatusForbidden, res.Meta.StatusCode)
+
+	verify, err := m.GetImageByID(testCtx(), i.ID)
+	assert.Nil(err)
+	assert.False(verify.IsApproved())
+}
+
+func TestAPIReportImage(t *testing.T) {
+	assert := assert.New(t)
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	u, err := m.CreateTestUser(testCtx())
+	assert.Nil(err)
+	auth, session, err := AuthTestUser(u, &m)
+	assert.Nil(err)
+	defer MockLogout(assert, &m, auth, session)
+
+	i, err := m.CreateTestImage(testCtx(), u.ID)
+	assert.Nil(err)
+
+	cfg := config.MustNewFromEnv()
+	cfg.ReportHideThreshold = 1
+
+	app := web.MustNew()
+	app.Auth = *auth
+	app.Register(APIs{Model: &m, Config: cfg})
+
+	var res testReportResponse
+	_, err = web.MockPostJSON(app, fmt.Sprintf("/api/image.report/%s", i.UUID), viewmodel.CreateReportArgs{
+		Reason: "not-a-reason",
+	}, r2.OptCookieValue(auth.CookieDefaults.Name, session.SessionID)).JSON(&res)
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, res.Meta.StatusCode)
+
+	_, err = web.MockPostJSON(app, fmt.Sprintf("/api/image.report/%s", i.UUID), viewmodel.CreateReportArgs{
+		Reason: model.ReportReasonMisrated,
+		Note:   "this is not pg-13",
+	}, r2.OptCookieValue(auth.CookieDefaults.Name, session.SessionID)).JSON(&res)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.Meta.StatusCode)
+	assert.Equal(i.UUID, res.Response.ImageUUID)
+
+	verify, err := m.GetImageByID(testCtx(), i.ID)
+	assert.Nil(err)
+	assert.False(verify.IsApproved())
+}
+
+func TestAPITeamChannels(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	auth, session, err := MockAdminLogin(&m)
+	assert.Nil(err)
+
+	team := model.NewSlackTeam(uuid.V4().String(), "Test Team", uuid.V4().String(), "Test User")
+	assert.Nil(m.Invoke(todo).Create(team))
+
+	app := web.MustNew()
+	app.Auth = *auth
+	app.Register(APIs{Model: &m, Config: config.MustNewFromEnv()})
+
+	var res testTeamChannelResponse
+	_, err = web.MockMethod(app, http.MethodPut, fmt.Sprintf("/api/team/%s/channel/C123", team.TeamID),
+		r2.OptJSONBody(model.SlackChannelSetting{ChannelName: "random", ContentRatingFilter: model.ContentRatingR}),
+		r2.OptCookieValue(auth.CookieDefaults.Name, session.SessionID),
+	).JSON(&res)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.Meta.StatusCode)
+	assert.Equal("C123", res.Response.ChannelID)
+	assert.Equal(model.ContentRatingR, res.Response.ContentRatingFilter)
+
+	var invalidRes testTeamChannelResponse
+	_, err = web.MockMethod(app, http.MethodPut, fmt.Sprintf("/api/team/%s/channel/C123", team.TeamID),
+		r2.OptJSONBody(model.SlackChannelSetting{ContentRatingFilter: 99}),
+		r2.OptCookieValue(auth.CookieDefaults.Name, session.SessionID),
+	).JSON(&invalidRes)
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, invalidRes.Meta.StatusCode)
+
+	var channelsRes testTeamChannelsResponse
+	_, err = web.MockGet(app, fmt.Sprintf("/api/team/%s/channels", team.TeamID),
+		r2.OptCookieValue(auth.CookieDefaults.Name, session.SessionID),
+	).JSON(&channelsRes)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, channelsRes.Meta.StatusCode)
+	assert.Len(channelsRes.Response, 1)
+
+	var deleteRes testTeamChannelResponse
+	_, err = web.MockMethod(app, http.MethodDelete, fmt.Sprintf("/api/team/%s/channel/C123", team.TeamID),
+		r2.OptCookieValue(auth.CookieDefaults.Name, session.SessionID),
+	).JSON(&deleteRes)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, deleteRes.Meta.StatusCode)
+
+	settings, err := m.GetSlackChannelSettings(todo, team.TeamID)
+	assert.Nil(err)
+	assert.Empty(settings)
+}
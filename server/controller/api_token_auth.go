@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blend/go-sdk/web"
+	"github.com/blend/go-sdk/webutil"
+
+	"github.com/wcharczuk/giffy/server/config"
+	"github.com/wcharczuk/giffy/server/model"
+)
+
+const (
+	// SessionStateAPITokenKey is the key we store the api token in the session state
+	// when a request authenticated with a bearer token.
+	SessionStateAPITokenKey = "APIToken"
+)
+
+// GetAPIToken returns the api token a session was authenticated with.
+// It returns nil for cookie sessions.
+func GetAPIToken(session *web.Session) *model.APIToken {
+	if session == nil {
+		return nil
+	}
+	if tokenData, hasToken := session.State[SessionStateAPITokenKey]; hasToken {
+		if token, isToken := tokenData.(*model.APIToken); isToken {
+			return token
+		}
+	}
+	return nil
+}
+
+// BearerToken returns the `Authorization: Bearer <token>` value for a request.
+func BearerToken(r *web.Ctx) string {
+	header := r.Request.Header.Get(webutil.HeaderAuthorization)
+	if len(header) > len("Bearer ") && strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+		return strings.TrimSpace(header[len("Bearer "):])
+	}
+	return ""
+}
+
+// APITokenOrSessionRequired is like `web.SessionRequired` but also accepts api bearer tokens.
+func APITokenOrSessionRequired(mgr *model.Manager, cfg *config.Giffy) web.Middleware {
+	return apiTokenOrSession(mgr, cfg, web.SessionRequired)
+}
+
+// APITokenOrSessionAware is like `web.SessionAware` but also accepts api bearer tokens.
+func APITokenOrSessionAware(mgr *model.Manager, cfg *config.Giffy) web.Middleware {
+	return apiTokenOrSession(mgr, cfg, web.SessionAware)
+}
+
+// RequireScope rejects requests authenticated with an api token that wasn't granted the scope.
+// Cookie sessions are unaffected.
+func RequireScope(scope string) web.Middleware {
+	return func(action web.Action) web.Action {
+		return func(r *web.Ctx) web.Result {
+			if token := GetAPIToken(r.Session); token != nil && !token.HasScope(scope) {
+				return r.DefaultProvider.NotAuthorized()
+			}
+			return action(r)
+		}
+	}
+}
+
+// RequireCookieSession rejects requests authenticated with an api token.
+func RequireCookieSession(action web.Action) web.Action {
+	return func(r *web.Ctx) web.Result {
+		if GetAPIToken(r.Session) != nil {
+			return r.DefaultProvider.NotAuthorized()
+		}
+		return action(r)
+	}
+}
+
+func apiTokenOrSession(mgr *model.Manager, cfg *config.Giffy, sessionMiddleware web.Middleware) web.Middleware {
+	return func(action web.Action) web.Action {
+		withSession := sessionMiddleware(action)
+		return func(r *web.Ctx) web.Result {
+			bearerToken := BearerToken(r)
+			if bearerToken == "" {
+				return withSession(r)
+			}
+
+			session, err := fetchAPITokenSession(r, mgr, cfg, bearerToken)
+			if err != nil {
+				return r.DefaultProvider.InternalError(err)
+			}
+			// a bad token is always an error, even on routes where a session is optional.
+			if session == nil {
+				return r.DefaultProvider.NotAuthorized()
+			}
+			r.Session = session
+			r.WithContext(web.WithSession(r.Context(), session))
+			return action(r)
+		}
+	}
+}
+
+func fetchAPITokenSession(r *web.Ctx, mgr *model.Manager, cfg *config.Giffy, bearerToken string) (*web.Session, error) {
+	now := time.Now().UTC()
+	apiToken, err := mgr.GetAPITokenByToken(r.Context(), bearerToken, cfg.GetEncryptionKey())
+	if err != nil {
+		return nil, err
+	}
+	if !apiToken.IsValid(now) {
+		return nil, nil
+	}
+
+	var dbUser model.User
+	if _, err = mgr.Invoke(r.Context()).Get(&dbUser, apiToken.UserID); err != nil {
+		return nil, err
+	}
+	if dbUser.IsZero() || dbUser.IsBanned {
+		return nil, nil
+	}
+
+	if err = mgr.UpdateAPITokenLastUsed(r.Context(), apiToken.ID, now); err != nil {
+		return nil, err
+	}
+	apiToken.LastUsedUTC = &now
+
+	session := &web.Session{
+		CreatedUTC: apiToken.CreatedUTC,
+		SessionID:  apiToken.UUID,
+		UserID:     strconv.FormatInt(apiToken.UserID, 10),
+	}
+	SetUser(session, &dbUser)
+	session.State[SessionStateAPITokenKey] = apiToken
+	return session, nil
+}
@@ -165,12 +165,33 @@ func (ac Auth) oauthSlackAction(r *web.Ctx) web.Result {
 		return r.Views.InternalError(err)
 	}
 
+	install := model.SlackTeamInstall{
+		BotToken:  res.BotToken(),
+		BotUserID: res.Bot.BotUserID,
+		Scopes:    res.Scopes(),
+	}
+	// the access token is the installing user's token if slack also issued a bot token.
+	if res.Bot.BotAccessToken != "" {
+		install.UserToken = res.AccessToken
+	}
+
 	if existingTeam.IsZero() {
 		team := model.NewSlackTeam(auth.TeamID, auth.Team, auth.UserID, auth.User)
+		if err = team.SetInstall(install, ac.Config.GetEncryptionKey()); err != nil {
+			return r.Views.InternalError(err)
+		}
 		err = ac.Model.Invoke(r.Context()).Create(team)
 		if err != nil {
 			return r.Views.InternalError(err)
 		}
+	} else {
+		// reinstalling refreshes the tokens.
+		if err = existingTeam.SetInstall(install, ac.Config.GetEncryptionKey()); err != nil {
+			return r.Views.InternalError(err)
+		}
+		if _, err = ac.Model.Invoke(r.Context()).Update(existingTeam); err != nil {
+			return r.Views.InternalError(err)
+		}
 	}
 	return web.RedirectWithMethodf(http.MethodGet, "/slack/complete")
 }
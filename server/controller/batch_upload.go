@@ -0,0 +1,500 @@
+package controller
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	exception "github.com/blend/go-sdk/ex"
+	"github.com/blend/go-sdk/logger"
+	"github.com/blend/go-sdk/web"
+	"github.com/blend/go-sdk/webutil"
+
+	"github.com/wcharczuk/giffy/server/model"
+	"github.com/wcharczuk/giffy/server/viewmodel"
+)
+
+const (
+	// ErrBatchUploadInvalid is returned when a batch upload (or its manifest) can't be read.
+	ErrBatchUploadInvalid exception.Class = "invalid batch upload"
+
+	// batchUploadMaxFiles is the most files a single batch can import.
+	batchUploadMaxFiles = 500
+	// batchUploadMaxArchiveSize is the most an archive can hold once it's uncompressed.
+	batchUploadMaxArchiveSize = 1 << 30 // 1gb
+	// batchUploadManifestKey is the form key a manifest can be posted under (instead of being in the archive).
+	batchUploadManifestKey = "manifest"
+	// batchUploadManifestTagSeparator separates the tags in a csv manifest's `tags` column.
+	batchUploadManifestTagSeparator = "|"
+)
+
+var (
+	// batchUploadWorkers is the number of files imported concurrently.
+	batchUploadWorkers = 4
+)
+
+// batchUploadFile is a file to import in a batch upload.
+// Files are only read as they're imported, so a batch never holds more than a file per worker in memory.
+type batchUploadFile struct {
+	FileName string
+	// Size is the size the file claims to be; what's actually read is checked too.
+	Size int64
+	// Open opens the file's contents.
+	Open func() (io.ReadCloser, error)
+}
+
+// Read reads the file's contents, refusing anything larger than an image can be.
+func (buf batchUploadFile) Read() ([]byte, error) {
+	return readBatchUploadPart(buf.Open, buf.Size)
+}
+
+// batchManifestEntry is the metadata a manifest sets for a file.
+type batchManifestEntry struct {
+	FileName      string   `json:"filename"`
+	Tags          []string `json:"tags"`
+	DisplayName   string   `json:"display_name"`
+	ContentRating string   `json:"content_rating"`
+
+	contentRating int
+}
+
+// batchManifest is the manifest entries by file name.
+type batchManifest map[string]batchManifestEntry
+
+// Entry returns the manifest entry for a file, matching on the full path and then just the file name.
+func (bm batchManifest) Entry(fileName string) batchManifestEntry {
+	if entry, ok := bm[fileName]; ok {
+		return entry
+	}
+	return bm[path.Base(fileName)]
+}
+
+// POST "/api/images.batch"
+// The body is either multiple multipart files or a single `.zip` archive of images.
+// An optional manifest (`manifest.csv` or `manifest.json`) sets the tags, display name and content rating for each file;
+// it can be posted under the `manifest` key, or stored in the root of the archive.
+func (api APIs) createImagesBatchAction(r *web.Ctx) web.Result {
+	sessionUser := GetUser(r.Session)
+	if sessionUser == nil || !sessionUser.IsModerator {
+		return API(r).NotAuthorized()
+	}
+
+	files, manifest, err := readBatchUpload(r.Request)
+	if err != nil {
+		return API(r).BadRequest(err)
+	}
+	if len(files) == 0 {
+		return API(r).BadRequest(fmt.Errorf("no files posted"))
+	}
+	if len(files) > batchUploadMaxFiles {
+		return API(r).BadRequest(fmt.Errorf("too many files posted; the limit is %d", batchUploadMaxFiles))
+	}
+
+	// tags are created up front so concurrent imports don't race to create the same tag.
+	tags, err := api.getOrCreateBatchTags(r.Context(), sessionUser.ID, files, manifest)
+	if err != nil {
+		return API(r).InternalError(err)
+	}
+
+	report := api.importBatch(r.Context(), sessionUser, files, manifest, tags)
+	return API(r).Result(report)
+}
+
+// importBatch imports files with a bounded pool of workers.
+// Files that are exact duplicates of an earlier file in the batch aren't imported twice.
+func (api APIs) importBatch(ctx context.Context, user *model.User, files []batchUploadFile, manifest batchManifest, tags map[string]*model.Tag) viewmodel.BatchUploadReport {
+	results := make([]viewmodel.BatchUploadResult, len(files))
+
+	// files are read by the workers, so duplicates are found as they're read.
+	var duplicatesLock sync.Mutex
+	firstByMD5 := map[string]int{}
+	duplicateOf := map[int]int{}
+	isDuplicate := func(index int, contents []byte) bool {
+		sum := fmt.Sprintf("%x", md5.Sum(contents))
+		duplicatesLock.Lock()
+		defer duplicatesLock.Unlock()
+		if first, ok := firstByMD5[sum]; ok {
+			duplicateOf[index] = first
+			return true
+		}
+		firstByMD5[sum] = index
+		return false
+	}
+
+	work := make(chan int, len(files))
+	for index := range files {
+		work <- index
+	}
+	close(work)
+
+	wg := sync.WaitGroup{}
+	for x := 0; x < batchUploadWorkers; x++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range work {
+				file := files[index]
+				contents, err := file.Read()
+				if err != nil {
+					results[index] = api.batchFileFailed(file.FileName, err)
+					continue
+				}
+				if isDuplicate(index, contents) {
+					continue
+				}
+				results[index] = api.importBatchFile(ctx, user, file.FileName, contents, manifest.Entry(file.FileName), tags)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// duplicates tag the image their first file was imported as, the same as a duplicate of an existing image.
+	for index, first := range duplicateOf {
+		fileName := files[index].FileName
+		if results[first].Image == nil {
+			results[index] = api.batchFileFailed(fileName, fmt.Errorf("same file as %s, which failed", files[first].FileName))
+			continue
+		}
+		results[index] = api.tagBatchImage(ctx, user, fileName, results[first].Image, manifest.Entry(fileName), tags)
+		if results[index].Status == viewmodel.BatchUploadStatusDuplicate {
+			results[index].Error = fmt.Sprintf("same file as %s", files[first].FileName)
+		}
+	}
+
+	report := viewmodel.BatchUploadReport{Results: results}
+	for _, result := range results {
+		switch result.Status {
+		case viewmodel.BatchUploadStatusCreated:
+			report.Created++
+		case viewmodel.BatchUploadStatusDuplicate:
+			report.Duplicates++
+		default:
+			report.Failed++
+		}
+	}
+	return report
+}
+
+// importBatchFile imports a single file, and tags it with the tags from its manifest entry.
+// Files that duplicate an existing image tag the existing image instead.
+// Either way, the image and its votes are saved in a single transaction.
+func (api APIs) importBatchFile(ctx context.Context, user *model.User, fileName string, contents []byte, entry batchManifestEntry, tags map[string]*model.Tag) viewmodel.BatchUploadResult {
+	result := viewmodel.BatchUploadResult{FileName: fileName}
+
+	perceptualHash := model.PerceptualHash(contents)
+	image, err := GetExistingImage(ctx, api.Model, api.Config, contents, perceptualHash)
+	if err != nil {
+		return api.batchFileFailed(fileName, err)
+	}
+	if image.IsZero() {
+		image, err = UploadImageFile(ctx, api.Model, user.ID, !user.IsAdmin, model.ImageReviewStateApproved, contents, perceptualHash, path.Base(fileName), api.Files)
+		if err != nil {
+			return api.batchFileFailed(fileName, err)
+		}
+		if entry.DisplayName != "" {
+			image.DisplayName = entry.DisplayName
+		}
+		if entry.contentRating > 0 {
+			image.ContentRating = entry.contentRating
+		}
+		if err = api.Model.CreateImageWithTags(ctx, image, entry.Tags); err != nil {
+			return api.batchFileFailed(fileName, err)
+		}
+		result.Status = viewmodel.BatchUploadStatusCreated
+		result.Image = image
+		for _, tag := range image.Tags {
+			result.Tags = append(result.Tags, tag.TagValue)
+		}
+		return result
+	}
+	return api.tagBatchImage(ctx, user, fileName, image, entry, tags)
+}
+
+// tagBatchImage tags an image that a file duplicates with the tags from the file's manifest entry.
+func (api APIs) tagBatchImage(ctx context.Context, user *model.User, fileName string, image *model.Image, entry batchManifestEntry, tags map[string]*model.Tag) viewmodel.BatchUploadResult {
+	result := viewmodel.BatchUploadResult{FileName: fileName}
+
+	var links []*model.Tag
+	err := api.Model.InTx(ctx, func(txm model.Manager) error {
+		for _, tagValue := range entry.Tags {
+			tag, ok := tags[tagValue]
+			if !ok {
+				continue
+			}
+			didCreate, err := txm.CreateOrUpdateVote(ctx, user.ID, image.ID, tag.ID, true)
+			if err != nil {
+				return err
+			}
+			if didCreate {
+				links = append(links, tag)
+			}
+			result.Tags = append(result.Tags, tag.TagValue)
+		}
+		return nil
+	})
+	if err != nil {
+		return api.batchFileFailed(fileName, err)
+	}
+	for _, tag := range links {
+		logger.MaybeTrigger(ctx, api.Log, model.NewModeration(user.ID, model.ModerationVerbCreate, model.ModerationObjectLink, image.UUID, tag.UUID))
+	}
+	result.Status = viewmodel.BatchUploadStatusDuplicate
+	result.Image = image
+	return result
+}
+
+// batchFileFailed returns the result for a file that couldn't be imported.
+func (api APIs) batchFileFailed(fileName string, err error) viewmodel.BatchUploadResult {
+	logger.MaybeWarningf(api.Log, "batch upload: %s: %v", fileName, err)
+	result := viewmodel.BatchUploadResult{
+		FileName: fileName,
+		Status:   viewmodel.BatchUploadStatusFailed,
+		Error:    err.Error(),
+	}
+	if message := exception.ErrMessage(err); message != "" {
+		result.Error = fmt.Sprintf("%s: %s", result.Error, message)
+	}
+	return result
+}
+
+// getOrCreateBatchTags returns the tags the manifest sets for the batch's files by value, creating any that don't exist yet.
+func (api APIs) getOrCreateBatchTags(ctx context.Context, userID int64, files []batchUploadFile, manifest batchManifest) (map[string]*model.Tag, error) {
+	tags := map[string]*model.Tag{}
+	for _, file := range files {
+		for _, tagValue := range manifest.Entry(file.FileName).Tags {
+			if _, ok := tags[tagValue]; ok {
+				continue
+			}
+			tag, err := api.Model.GetTagByValue(ctx, tagValue)
+			if err != nil {
+				return nil, err
+			}
+			if tag.IsZero() {
+				tag = model.NewTag(userID, tagValue)
+				if err = api.Model.Invoke(ctx).Create(tag); err != nil {
+					return nil, err
+				}
+				logger.MaybeTrigger(ctx, api.Log, model.NewModeration(userID, model.ModerationVerbCreate, model.ModerationObjectTag, tag.UUID))
+			}
+			tags[tagValue] = tag
+		}
+	}
+	return tags, nil
+}
+
+// readBatchUpload reads the files (and manifest) from a batch upload request.
+// Files are returned in the order they were posted, and aren't read until they're imported.
+func readBatchUpload(r *http.Request) ([]batchUploadFile, batchManifest, error) {
+	if err := r.ParseMultipartForm(webutil.DefaultPostedFilesMaxMemory); err != nil {
+		return nil, nil, exception.New(ErrBatchUploadInvalid, exception.OptMessage(err.Error()))
+	}
+
+	var files []batchUploadFile
+	var manifestFile *batchUploadFile
+
+	var keys []string
+	for key := range r.MultipartForm.File {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, header := range r.MultipartForm.File[key] {
+			header := header
+			file := batchUploadFile{
+				FileName: header.Filename,
+				Size:     header.Size,
+				Open:     func() (io.ReadCloser, error) { return header.Open() },
+			}
+			if key == batchUploadManifestKey || isBatchManifest(header.Filename) {
+				manifestFile = &file
+				continue
+			}
+			files = append(files, file)
+		}
+	}
+
+	if len(files) == 1 && strings.EqualFold(path.Ext(files[0].FileName), ".zip") {
+		// the archive itself is held in memory, but its entries are decompressed as they're imported.
+		contents, err := files[0].Read()
+		if err != nil {
+			return nil, nil, err
+		}
+		archiveFiles, archiveManifest, err := readBatchArchive(contents)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = archiveFiles
+		if manifestFile == nil {
+			manifestFile = archiveManifest
+		}
+	}
+
+	manifest := batchManifest{}
+	if manifestFile != nil {
+		contents, err := manifestFile.Read()
+		if err != nil {
+			return nil, nil, err
+		}
+		if manifest, err = parseBatchManifest(manifestFile.FileName, contents); err != nil {
+			return nil, nil, err
+		}
+	}
+	return files, manifest, nil
+}
+
+// readBatchArchive lists the images (and manifest) in a zip archive.
+// Directories, hidden files and macOS resource forks are skipped.
+func readBatchArchive(contents []byte) ([]batchUploadFile, *batchUploadFile, error) {
+	archive, err := zip.NewReader(bytes.NewReader(contents), int64(len(contents)))
+	if err != nil {
+		return nil, nil, exception.New(ErrBatchUploadInvalid, exception.OptMessagef("problem reading archive: %v", err))
+	}
+
+	var files []batchUploadFile
+	var manifestFile *batchUploadFile
+	var totalSize uint64
+	for _, entry := range archive.File {
+		name := entry.Name
+		if entry.FileInfo().IsDir() || strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), ".") {
+			continue
+		}
+		if len(files) > batchUploadMaxFiles {
+			break
+		}
+		totalSize += entry.UncompressedSize64
+		if totalSize > batchUploadMaxArchiveSize {
+			return nil, nil, exception.New(ErrBatchUploadInvalid, exception.OptMessage("the archive is too large to import at once"))
+		}
+		file := batchUploadFile{FileName: name, Size: int64(entry.UncompressedSize64), Open: entry.Open}
+		if !strings.Contains(name, "/") && isBatchManifest(name) {
+			manifestFile = &file
+			continue
+		}
+		files = append(files, file)
+	}
+	return files, manifestFile, nil
+}
+
+// readBatchUploadPart reads a posted file or archive entry, refusing anything larger than an image can be.
+// The size is checked against what's actually read too, as archive headers can lie.
+func readBatchUploadPart(open func() (io.ReadCloser, error), size int64) ([]byte, error) {
+	if size > model.MaxImageSize {
+		return nil, exception.New(ErrBatchUploadInvalid, exception.OptMessage("Image file size should be < 32 mb."))
+	}
+	reader, err := open()
+	if err != nil {
+		return nil, exception.New(err)
+	}
+	defer reader.Close()
+	contents, err := ioutil.ReadAll(io.LimitReader(reader, model.MaxImageSize+1))
+	if err != nil {
+		return nil, exception.New(err)
+	}
+	if len(contents) > model.MaxImageSize {
+		return nil, exception.New(ErrBatchUploadInvalid, exception.OptMessage("Image file size should be < 32 mb."))
+	}
+	return contents, nil
+}
+
+// isBatchManifest returns if a file name is a manifest.
+func isBatchManifest(fileName string) bool {
+	switch strings.ToLower(path.Base(fileName)) {
+	case "manifest.csv", "manifest.json":
+		return true
+	}
+	return false
+}
+
+// parseBatchManifest parses a csv or json manifest, keyed by file name.
+//
+// A json manifest is a list of objects with `filename`, `tags`, `display_name` and `content_rating` fields.
+// A csv manifest has a header row naming the same columns; its tags are separated by `|`.
+// Tags are cleaned and content ratings are parsed (i.e. `PG-13`) up front, so a bad manifest fails the whole batch.
+func parseBatchManifest(fileName string, contents []byte) (batchManifest, error) {
+	var entries []batchManifestEntry
+	if strings.EqualFold(path.Ext(fileName), ".csv") {
+		var err error
+		if entries, err = parseBatchManifestCSV(contents); err != nil {
+			return nil, err
+		}
+	} else if err := json.Unmarshal(contents, &entries); err != nil {
+		return nil, exception.New(ErrBatchUploadInvalid, exception.OptMessagef("problem reading manifest: %v", err))
+	}
+
+	manifest := batchManifest{}
+	for _, entry := range entries {
+		if entry.FileName == "" {
+			return nil, exception.New(ErrBatchUploadInvalid, exception.OptMessage("manifest entries need a `filename`"))
+		}
+		var tags []string
+		for _, value := range entry.Tags {
+			if strings.TrimSpace(value) == "" {
+				continue
+			}
+			tagValue := model.CleanTagValue(value)
+			if len(tagValue) == 0 {
+				return nil, exception.New(ErrBatchUploadInvalid, exception.OptMessagef("%s: invalid tag: %s", entry.FileName, value))
+			}
+			tags = append(tags, tagValue)
+		}
+		entry.Tags = tags
+		if entry.ContentRating != "" {
+			contentRating, err := model.ParseContentRating(entry.ContentRating)
+			if err != nil {
+				return nil, exception.New(ErrBatchUploadInvalid, exception.OptMessagef("%s: invalid content rating: %s", entry.FileName, entry.ContentRating))
+			}
+			entry.contentRating = contentRating
+		}
+		manifest[entry.FileName] = entry
+	}
+	return manifest, nil
+}
+
+func parseBatchManifestCSV(contents []byte) ([]batchManifestEntry, error) {
+	rows, err := csv.NewReader(bytes.NewReader(contents)).ReadAll()
+	if err != nil {
+		return nil, exception.New(ErrBatchUploadInvalid, exception.OptMessagef("problem reading manifest: %v", err))
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	columns := map[string]int{}
+	for index, column := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(column))] = index
+	}
+	if _, ok := columns["filename"]; !ok {
+		return nil, exception.New(ErrBatchUploadInvalid, exception.OptMessage("manifest header needs a `filename` column"))
+	}
+	value := func(row []string, column string) string {
+		if index, ok := columns[column]; ok && index < len(row) {
+			return strings.TrimSpace(row[index])
+		}
+		return ""
+	}
+
+	var entries []batchManifestEntry
+	for _, row := range rows[1:] {
+		entry := batchManifestEntry{
+			FileName:      value(row, "filename"),
+			DisplayName:   value(row, "display_name"),
+			ContentRating: value(row, "content_rating"),
+		}
+		if tags := value(row, "tags"); tags != "" {
+			entry.Tags = strings.Split(tags, batchUploadManifestTagSeparator)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,242 @@
+package controller
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	exception "github.com/blend/go-sdk/ex"
+	"github.com/blend/go-sdk/r2"
+	"github.com/blend/go-sdk/testutil"
+	"github.com/blend/go-sdk/uuid"
+	"github.com/blend/go-sdk/web"
+	"github.com/blend/go-sdk/webutil"
+
+	"github.com/wcharczuk/giffy/server/config"
+	"github.com/wcharczuk/giffy/server/filemanager"
+	"github.com/wcharczuk/giffy/server/model"
+	"github.com/wcharczuk/giffy/server/viewmodel"
+)
+
+type testBatchUploadResponse struct {
+	Meta     *APIResponseMeta
+	Response viewmodel.BatchUploadReport
+}
+
+// createTestArchive creates a zip archive of the files, in order by name.
+func createTestArchive(a *assert.Assertions, files map[string][]byte) []byte {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buffer := new(bytes.Buffer)
+	archive := zip.NewWriter(buffer)
+	for _, name := range names {
+		writer, err := archive.Create(name)
+		a.Nil(err)
+		_, err = writer.Write(files[name])
+		a.Nil(err)
+	}
+	a.Nil(archive.Close())
+	return buffer.Bytes()
+}
+
+func TestParseBatchManifest(t *testing.T) {
+	assert := assert.New(t)
+
+	manifest, err := parseBatchManifest("manifest.csv", []byte("filename,tags,display_name,content_rating\nfoo.gif,Cat Gifs|dogs,Foo,pg-13\nbar.gif,,,\n"))
+	assert.Nil(err)
+	assert.Len(manifest, 2)
+	assert.Equal([]string{"cat gifs", "dogs"}, manifest["foo.gif"].Tags)
+	assert.Equal("Foo", manifest["foo.gif"].DisplayName)
+	assert.Equal(model.ContentRatingPG13, manifest["foo.gif"].contentRating)
+	assert.Empty(manifest["bar.gif"].Tags)
+	assert.Zero(manifest["bar.gif"].contentRating)
+
+	manifest, err = parseBatchManifest("manifest.json", []byte(`[{"filename":"foo.gif","tags":["cats"],"content_rating":"g"}]`))
+	assert.Nil(err)
+	assert.Equal([]string{"cats"}, manifest["foo.gif"].Tags)
+	assert.Equal(model.ContentRatingG, manifest["foo.gif"].contentRating)
+
+	// entries match on the file name when the archive has directories.
+	assert.Equal([]string{"cats"}, manifest.Entry("some/dir/foo.gif").Tags)
+	assert.Empty(manifest.Entry("some/dir/bar.gif").Tags)
+
+	_, err = parseBatchManifest("manifest.json", []byte(`[{"filename":"foo.gif","content_rating":"nope"}]`))
+	assert.True(exception.Is(err, ErrBatchUploadInvalid))
+
+	_, err = parseBatchManifest("manifest.json", []byte(`[{"tags":["cats"]}]`))
+	assert.True(exception.Is(err, ErrBatchUploadInvalid))
+
+	_, err = parseBatchManifest("manifest.csv", []byte("name,tags\nfoo.gif,cats\n"))
+	assert.True(exception.Is(err, ErrBatchUploadInvalid))
+
+	_, err = parseBatchManifest("manifest.json", []byte(`{`))
+	assert.True(exception.Is(err, ErrBatchUploadInvalid))
+}
+
+func TestReadBatchArchive(t *testing.T) {
+	assert := assert.New(t)
+
+	contents := createTestArchive(assert, map[string][]byte{
+		"manifest.csv":             []byte("filename,tags\none.gif,cats\n"),
+		"one.gif":                  []byte("one"),
+		"nested/two.gif":           []byte("two"),
+		"nested/manifest.json":     []byte("[]"),
+		".DS_Store":                []byte("nope"),
+		"__MACOSX/._one.gif":       []byte("nope"),
+		"nested/.hidden/three.gif": []byte("three"),
+	})
+
+	files, manifestFile, err := readBatchArchive(contents)
+	assert.Nil(err)
+	assert.NotNil(manifestFile)
+	assert.Equal("manifest.csv", manifestFile.FileName)
+
+	// entries are listed, but not read until they're imported.
+	byName := map[string]string{}
+	for _, file := range files {
+		contents, err := file.Read()
+		assert.Nil(err)
+		byName[file.FileName] = string(contents)
+	}
+	// only root manifests are manifests; nested ones are just (invalid) images.
+	assert.Equal(map[string]string{
+		"one.gif":                  "one",
+		"nested/two.gif":           "two",
+		"nested/manifest.json":     "[]",
+		"nested/.hidden/three.gif": "three",
+	}, byName)
+
+	_, _, err = readBatchArchive([]byte("not a zip"))
+	assert.True(exception.Is(err, ErrBatchUploadInvalid))
+}
+
+func TestAPICreateImagesBatch(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	// the test manager shares a single transaction, which isn't safe to use concurrently.
+	defer func(workers int) { batchUploadWorkers = workers }(batchUploadWorkers)
+	batchUploadWorkers = 1
+
+	auth, session := MockAuth(assert, &m, MockModeratorLogin)
+	defer MockLogout(assert, &m, auth, session)
+
+	fm := filemanager.NewWithStorage(uuid.V4().String(), filemanager.NewMemoryStorage())
+	app := web.MustNew()
+	app.Auth = *auth
+	app.Register(APIs{Model: &m, Config: config.MustNewFromEnv(), Files: fm})
+
+	image, err := ioutil.ReadFile("server/controller/testdata/image.gif")
+	assert.Nil(err)
+	tagValue := "__test_batch_" + uuid.V4().String()
+	copyTagValue := "__test_batch_copy_" + uuid.V4().String()
+	archive := createTestArchive(assert, map[string][]byte{
+		"manifest.json": []byte(`[
+			{"filename":"image.gif","tags":["` + tagValue + `"],"display_name":"Batch Image","content_rating":"pg"},
+			{"filename":"image_copy.gif","tags":["` + copyTagValue + `"]}
+		]`),
+		"image.gif":          image,
+		"image_copy.gif":     image,
+		"not_image.gif":      []byte("not an image"),
+		"not_image_copy.gif": []byte("not an image"),
+	})
+
+	var res testBatchUploadResponse
+	meta, err := web.MockMethod(app, http.MethodPost, "/api/images.batch",
+		r2.OptCookieValue(auth.CookieDefaults.Name, session.SessionID),
+		r2.OptPostedFiles(webutil.PostedFile{Key: "archive", FileName: "images.zip", Contents: archive}),
+	).JSON(&res)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, meta.StatusCode)
+	assert.Equal(1, res.Response.Created)
+	assert.Equal(1, res.Response.Duplicates)
+	assert.Equal(2, res.Response.Failed)
+	assert.Len(res.Response.Results, 4)
+
+	results := map[string]viewmodel.BatchUploadResult{}
+	for _, result := range res.Response.Results {
+		results[result.FileName] = result
+	}
+	assert.Equal(viewmodel.BatchUploadStatusCreated, results["image.gif"].Status)
+	assert.Equal([]string{tagValue}, results["image.gif"].Tags)
+	assert.Equal(viewmodel.BatchUploadStatusDuplicate, results["image_copy.gif"].Status)
+	assert.Equal([]string{copyTagValue}, results["image_copy.gif"].Tags)
+	assert.Equal(viewmodel.BatchUploadStatusFailed, results["not_image.gif"].Status)
+	assert.NotEmpty(results["not_image.gif"].Error)
+	// a copy of a file that failed fails too.
+	assert.Equal(viewmodel.BatchUploadStatusFailed, results["not_image_copy.gif"].Status)
+	assert.Nil(results["not_image_copy.gif"].Image)
+
+	created := results["image.gif"].Image
+	assert.NotNil(created)
+	assert.Equal(results["image_copy.gif"].Image.UUID, created.UUID)
+
+	verify, err := m.GetImageByUUID(todo, created.UUID)
+	assert.Nil(err)
+	assert.Equal("Batch Image", verify.DisplayName)
+	assert.Equal(model.ContentRatingPG, verify.ContentRating)
+
+	// the copy's tags are added to the image.
+	tags, err := m.GetTagsForImageID(todo, verify.ID)
+	assert.Nil(err)
+	var tagValues []string
+	for _, tag := range tags {
+		tagValues = append(tagValues, tag.TagValue)
+	}
+	expected := []string{tagValue, copyTagValue}
+	sort.Strings(expected)
+	sort.Strings(tagValues)
+	assert.Equal(expected, tagValues)
+
+	// posting the same image again reports it as a duplicate of the existing image.
+	res = testBatchUploadResponse{}
+	meta, err = web.MockMethod(app, http.MethodPost, "/api/images.batch",
+		r2.OptCookieValue(auth.CookieDefaults.Name, session.SessionID),
+		r2.OptPostedFiles(webutil.PostedFile{Key: "image", FileName: "image.gif", Contents: image}),
+	).JSON(&res)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, meta.StatusCode)
+	assert.Equal(0, res.Response.Created)
+	assert.Equal(1, res.Response.Duplicates)
+	assert.Equal(created.UUID, res.Response.Results[0].Image.UUID)
+}
+
+func TestAPICreateImagesBatchInvalidManifest(t *testing.T) {
+	assert := assert.New(t)
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	auth, session := MockAuth(assert, &m, MockModeratorLogin)
+	defer MockLogout(assert, &m, auth, session)
+
+	fm := filemanager.NewWithStorage(uuid.V4().String(), filemanager.NewMemoryStorage())
+	app := web.MustNew()
+	app.Auth = *auth
+	app.Register(APIs{Model: &m, Config: config.MustNewFromEnv(), Files: fm})
+
+	archive := createTestArchive(assert, map[string][]byte{
+		"manifest.csv": []byte("filename,content_rating\nimage.gif,nc-17\n"),
+		"image.gif":    []byte("not an image"),
+	})
+
+	meta, err := web.MockMethod(app, http.MethodPost, "/api/images.batch",
+		r2.OptCookieValue(auth.CookieDefaults.Name, session.SessionID),
+		r2.OptPostedFiles(webutil.PostedFile{Key: "archive", FileName: "images.zip", Contents: archive}),
+	).Discard()
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, meta.StatusCode)
+}
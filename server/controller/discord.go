@@ -0,0 +1,382 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	exception "github.com/blend/go-sdk/ex"
+	"github.com/blend/go-sdk/logger"
+	"github.com/blend/go-sdk/web"
+	"github.com/blend/go-sdk/webutil"
+
+	"github.com/wcharczuk/giffy/server/config"
+	"github.com/wcharczuk/giffy/server/external"
+	"github.com/wcharczuk/giffy/server/model"
+	"github.com/wcharczuk/giffy/server/viewmodel"
+)
+
+const (
+	discordContentTypeJSON = "application/json; charset=utf-8"
+	discordErrorUnverified = "This request could not be verified as coming from Discord."
+	discordErrorBadPayload = "There was an error processing a payload from discord. Saddness."
+
+	// discordOptionQuery is the name of the `/giffy` command option with the search query.
+	discordOptionQuery = "query"
+
+	// discordCustomIDMaxLength is the longest custom id discord allows on a component.
+	discordCustomIDMaxLength = 100
+)
+
+// Discord interaction types.
+const (
+	discordInteractionPing               = 1
+	discordInteractionApplicationCommand = 2
+	discordInteractionMessageComponent   = 3
+)
+
+// Discord interaction callback types.
+const (
+	discordCallbackPong                     = 1
+	discordCallbackChannelMessageWithSource = 4
+	discordCallbackUpdateMessage            = 7
+)
+
+// Discord component types, button styles and message flags.
+const (
+	discordComponentActionRow = 1
+	discordComponentButton    = 2
+
+	discordButtonPrimary   = 1
+	discordButtonSecondary = 2
+	discordButtonSuccess   = 3
+
+	discordFlagEphemeral = 1 << 6
+)
+
+// discordIntegration is the chat integration for discord.
+// Discord doesn't have per-server settings (yet), so every search uses the configured content rating.
+type discordIntegration struct {
+	cfg *config.Giffy
+}
+
+// Source implements chatIntegration.
+func (di discordIntegration) Source() string { return "discord" }
+
+// ContentRating implements chatIntegration.
+func (di discordIntegration) ContentRating(_ context.Context, _, _ string) (int, error) {
+	return model.ParseContentRating(di.cfg.DiscordContentRating)
+}
+
+// DiscordVerified returns a middleware that rejects interactions that aren't signed with the application's key.
+// Discord requires every interaction to be verified, so requests are rejected if the public key isn't configured.
+func DiscordVerified(cfg *config.Giffy, log logger.Log) web.Middleware {
+	return func(action web.Action) web.Action {
+		return func(rc *web.Ctx) web.Result {
+			if err := VerifyDiscordRequest(cfg, rc); err != nil {
+				logger.MaybeWarningf(log, "rejecting discord request to %s from %s: %v", rc.Request.URL.Path, webutil.GetRemoteAddr(rc.Request), err)
+				return &web.RawResult{
+					StatusCode:  http.StatusUnauthorized,
+					ContentType: slackContentTypeTextPlain,
+					Response:    []byte(discordErrorUnverified),
+				}
+			}
+			return action(rc)
+		}
+	}
+}
+
+// VerifyDiscordRequest verifies a request came from discord.
+// It buffers the request body so it can still be read by the action.
+func VerifyDiscordRequest(cfg *config.Giffy, rc *web.Ctx) error {
+	if cfg.DiscordPublicKey == "" {
+		return exception.New(external.ErrDiscordPublicKeyInvalid, exception.OptMessage("the discord public key is not configured"))
+	}
+	body, err := rc.PostBody()
+	if err != nil {
+		return err
+	}
+	rc.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return external.VerifyDiscordSignature(cfg.DiscordPublicKey, rc.Request.Header.Get(external.DiscordHeaderTimestamp), rc.Request.Header.Get(external.DiscordHeaderSignature), body)
+}
+
+func (i Integrations) discord(rc *web.Ctx) web.Result {
+	var interaction discordInteraction
+	if err := rc.PostBodyAsJSON(&interaction); err != nil {
+		logger.MaybeError(i.Log, err)
+		return i.discordRespond(discordMessage(discordErrorBadPayload), rc)
+	}
+
+	switch interaction.Type {
+	case discordInteractionPing:
+		return i.discordRespond(discordInteractionResponse{Type: discordCallbackPong}, rc)
+	case discordInteractionApplicationCommand:
+		return i.discordSearch(interaction, rc)
+	case discordInteractionMessageComponent:
+		action, uuid, query := parseDiscordCustomID(interaction.Data.CustomID)
+		switch action {
+		case slackActionShuffle:
+			return i.discordShuffle(interaction, query, uuid, rc)
+		case slackActionPost:
+			return i.discordPost(interaction, query, uuid, rc)
+		case slackActionCancel:
+			i.recordInteractionForUUID(rc.Context(), discordIntegration{cfg: i.Config}, interaction.Arguments(query), uuid, model.SearchInteractionActionCancel)
+			return i.discordRespond(discordInteractionResponse{
+				Type: discordCallbackUpdateMessage,
+				Data: discordClearedMessage{Content: "Cancelled.", Embeds: []discordEmbed{}, Components: []discordComponent{}},
+			}, rc)
+		}
+		return i.discordRespond(discordMessage(slackErrorInvalidAction), rc)
+	}
+	return API(rc).BadRequest(fmt.Errorf("unknown interaction type: %d", interaction.Type))
+}
+
+// discordSearch handles `/giffy query:<query>`, which shows the searcher a prompt with the best result.
+func (i Integrations) discordSearch(interaction discordInteraction, rc *web.Ctx) web.Result {
+	query := strings.TrimSpace(interaction.Data.Option(discordOptionQuery))
+	if len(query) < 3 {
+		return i.discordRespond(discordMessage(slackErrorInvalidQuery), rc)
+	}
+
+	result, err := i.integrationSearch(rc.Context(), discordIntegration{cfg: i.Config}, interaction.Arguments(query))
+	if err != nil {
+		logger.MaybeFatal(i.Log, err)
+		return i.discordRespond(discordMessage(slackErrorInternal), rc)
+	}
+	if result == nil {
+		return i.discordRespond(discordMessage(i.slackErrorNoResults()), rc)
+	}
+	return i.discordRespond(discordInteractionResponse{
+		Type: discordCallbackChannelMessageWithSource,
+		Data: i.discordPrompt(query, viewmodel.NewImage(*result, i.Config)),
+	}, rc)
+}
+
+// discordShuffle replaces the prompt with the next best result.
+func (i Integrations) discordShuffle(interaction discordInteraction, query, uuid string, rc *web.Ctx) web.Result {
+	if uuid == "" {
+		return i.discordRespond(discordMessage(slackErrorInvalidCallbackState), rc)
+	}
+	result, err := i.integrationShuffle(rc.Context(), discordIntegration{cfg: i.Config}, interaction.Arguments(query), uuid)
+	if err != nil {
+		logger.MaybeFatal(i.Log, err)
+		return i.discordRespond(discordMessage(slackErrorInternal), rc)
+	}
+	if result == nil {
+		return i.discordRespond(discordMessage(i.slackErrorNoResults()), rc)
+	}
+	return i.discordRespond(discordInteractionResponse{
+		Type: discordCallbackUpdateMessage,
+		Data: i.discordPrompt(query, viewmodel.NewImage(*result, i.Config)),
+	}, rc)
+}
+
+// discordPost posts the result in the prompt to the channel.
+// Ephemeral messages can't be made public, so the result is sent as a new message.
+func (i Integrations) discordPost(interaction discordInteraction, query, uuid string, rc *web.Ctx) web.Result {
+	if uuid == "" {
+		return i.discordRespond(discordMessage(slackErrorInvalidCallbackState), rc)
+	}
+	img, err := i.integrationPost(rc.Context(), discordIntegration{cfg: i.Config}, interaction.Arguments(query), uuid)
+	if err != nil {
+		logger.MaybeFatal(i.Log, err)
+		return i.discordRespond(discordMessage(slackErrorInternal), rc)
+	}
+	if img == nil {
+		return i.discordRespond(discordMessage(i.slackErrorNoResults()), rc)
+	}
+	result := viewmodel.NewImage(*img, i.Config)
+	data := &discordInteractionData{
+		Embeds: []discordEmbed{i.discordEmbed(result)},
+	}
+	if user := interaction.User(); user.ID != "" {
+		data.Content = fmt.Sprintf("posted by <@%s>", user.ID)
+		data.AllowedMentions = &discordAllowedMentions{Parse: []string{}}
+	}
+	return i.discordRespond(discordInteractionResponse{Type: discordCallbackChannelMessageWithSource, Data: data}, rc)
+}
+
+// discordPrompt is the ephemeral result with the `Shuffle`, `Post` and `Cancel` buttons.
+func (i Integrations) discordPrompt(query string, result viewmodel.Image) *discordInteractionData {
+	return &discordInteractionData{
+		Flags:  discordFlagEphemeral,
+		Embeds: []discordEmbed{i.discordEmbed(result)},
+		Components: []discordComponent{
+			{
+				Type: discordComponentActionRow,
+				Components: []discordComponent{
+					{Type: discordComponentButton, Style: discordButtonPrimary, Label: "Post", CustomID: createDiscordCustomID(slackActionPost, result.UUID, query)},
+					{Type: discordComponentButton, Style: discordButtonSuccess, Label: "Shuffle", CustomID: createDiscordCustomID(slackActionShuffle, result.UUID, query)},
+					{Type: discordComponentButton, Style: discordButtonSecondary, Label: "Cancel", CustomID: createDiscordCustomID(slackActionCancel, result.UUID, query)},
+				},
+			},
+		},
+	}
+}
+
+func (i Integrations) discordEmbed(result viewmodel.Image) discordEmbed {
+	return discordEmbed{
+		Title: resultTitle(result),
+		URL:   fmt.Sprintf("%s/image/%s", i.Config.Web.BaseURL, result.UUID),
+		Image: &discordEmbedImage{URL: result.S3ReadURL},
+	}
+}
+
+func (i Integrations) discordRespond(res discordInteractionResponse, rc *web.Ctx) web.Result {
+	responseBytes, err := json.Marshal(res)
+	if err != nil {
+		logger.MaybeFatal(i.Log, err)
+		return API(rc).InternalError(err)
+	}
+	return web.RawWithContentType(discordContentTypeJSON, responseBytes)
+}
+
+// discordMessage is an ephemeral text reply to an interaction.
+func discordMessage(text string) discordInteractionResponse {
+	return discordInteractionResponse{
+		Type: discordCallbackChannelMessageWithSource,
+		Data: &discordInteractionData{Content: text, Flags: discordFlagEphemeral},
+	}
+}
+
+// createDiscordCustomID returns the custom id for a button (`<action>:<image uuid>:<query>`).
+// Custom ids are capped at 100 characters, so long queries are truncated.
+func createDiscordCustomID(action, uuid, query string) string {
+	customID := action + ":" + uuid + ":"
+	for _, r := range query {
+		if len(customID)+len(string(r)) > discordCustomIDMaxLength {
+			break
+		}
+		customID += string(r)
+	}
+	return customID
+}
+
+func parseDiscordCustomID(customID string) (action, uuid, query string) {
+	parts := strings.SplitN(customID, ":", 3)
+	if len(parts) != 3 {
+		return
+	}
+	return parts[0], parts[1], parts[2]
+}
+
+// --------------------------------------------------------------------------------
+// Discord Types
+// --------------------------------------------------------------------------------
+
+type discordInteraction struct {
+	ID        string                     `json:"id"`
+	Type      int                        `json:"type"`
+	Token     string                     `json:"token"`
+	GuildID   string                     `json:"guild_id"`
+	ChannelID string                     `json:"channel_id"`
+	Member    *discordMember             `json:"member"`
+	DMUser    *discordUser               `json:"user"`
+	Data      discordInteractionCallback `json:"data"`
+}
+
+// User returns the user that triggered the interaction; it's on the member in servers, and the user in DMs.
+func (di discordInteraction) User() discordUser {
+	if di.Member != nil && di.Member.User != nil {
+		return *di.Member.User
+	}
+	if di.DMUser != nil {
+		return *di.DMUser
+	}
+	return discordUser{}
+}
+
+// Arguments returns the integration arguments for a search (or action on a result) for a query.
+func (di discordInteraction) Arguments(query string) integrationArguments {
+	user := di.User()
+	return integrationArguments{
+		TeamID:    di.GuildID,
+		ChannelID: di.ChannelID,
+		UserID:    user.ID,
+		UserName:  user.Username,
+		Query:     query,
+	}
+}
+
+type discordMember struct {
+	User *discordUser `json:"user"`
+	Nick string       `json:"nick"`
+}
+
+type discordUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// discordInteractionCallback is the `data` of an interaction; commands set the name and options,
+// components set the custom id.
+type discordInteractionCallback struct {
+	Name          string                     `json:"name"`
+	Options       []discordInteractionOption `json:"options"`
+	CustomID      string                     `json:"custom_id"`
+	ComponentType int                        `json:"component_type"`
+}
+
+// Option returns the value of a (string) command option.
+func (dic discordInteractionCallback) Option(name string) string {
+	for _, option := range dic.Options {
+		if option.Name == name {
+			var value string
+			_ = json.Unmarshal(option.Value, &value)
+			return value
+		}
+	}
+	return ""
+}
+
+type discordInteractionOption struct {
+	Name  string          `json:"name"`
+	Type  int             `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+type discordInteractionResponse struct {
+	Type int         `json:"type"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+type discordInteractionData struct {
+	Content         string                  `json:"content,omitempty"`
+	Flags           int                     `json:"flags,omitempty"`
+	Embeds          []discordEmbed          `json:"embeds,omitempty"`
+	Components      []discordComponent      `json:"components,omitempty"`
+	AllowedMentions *discordAllowedMentions `json:"allowed_mentions,omitempty"`
+}
+
+// discordClearedMessage replaces a message, removing its embeds and components.
+type discordClearedMessage struct {
+	Content    string             `json:"content"`
+	Embeds     []discordEmbed     `json:"embeds"`
+	Components []discordComponent `json:"components"`
+}
+
+type discordEmbed struct {
+	Title string             `json:"title,omitempty"`
+	URL   string             `json:"url,omitempty"`
+	Image *discordEmbedImage `json:"image,omitempty"`
+}
+
+type discordEmbedImage struct {
+	URL string `json:"url"`
+}
+
+type discordComponent struct {
+	Type       int                `json:"type"`
+	Style      int                `json:"style,omitempty"`
+	Label      string             `json:"label,omitempty"`
+	CustomID   string             `json:"custom_id,omitempty"`
+	Components []discordComponent `json:"components,omitempty"`
+}
+
+type discordAllowedMentions struct {
+	Parse []string `json:"parse"`
+}
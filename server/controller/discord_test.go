@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/logger"
+	"github.com/blend/go-sdk/r2"
+	"github.com/blend/go-sdk/testutil"
+	"github.com/blend/go-sdk/uuid"
+	"github.com/blend/go-sdk/web"
+
+	"github.com/wcharczuk/giffy/server/config"
+	"github.com/wcharczuk/giffy/server/external"
+	"github.com/wcharczuk/giffy/server/model"
+)
+
+// testDiscordApp returns an app with the integrations registered and a func that signs interactions for it.
+func testDiscordApp(a *assert.Assertions, m *model.Manager) (*web.App, func(interface{}) []r2.Option) {
+	public, private, err := ed25519.GenerateKey(nil)
+	a.Nil(err)
+
+	cfg := config.MustNewFromEnv()
+	cfg.DiscordPublicKey = hex.EncodeToString(public)
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Integrations{Model: m, Config: cfg})
+
+	return app, func(interaction interface{}) []r2.Option {
+		body, err := json.Marshal(interaction)
+		a.Nil(err)
+		timestamp := "1577934245"
+		return []r2.Option{
+			r2.OptBodyBytes(body),
+			r2.OptHeaderValue(external.DiscordHeaderTimestamp, timestamp),
+			r2.OptHeaderValue(external.DiscordHeaderSignature, hex.EncodeToString(ed25519.Sign(private, append([]byte(timestamp), body...)))),
+		}
+	}
+}
+
+func testDiscordCommand(query string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":       discordInteractionApplicationCommand,
+		"guild_id":   uuid.V4().String(),
+		"channel_id": uuid.V4().String(),
+		"member":     map[string]interface{}{"user": map[string]interface{}{"id": "1234", "username": "test_user"}},
+		"data": map[string]interface{}{
+			"name":    "giffy",
+			"options": []map[string]interface{}{{"name": discordOptionQuery, "type": 3, "value": query}},
+		},
+	}
+}
+
+type testDiscordResponse struct {
+	Type int                    `json:"type"`
+	Data discordInteractionData `json:"data"`
+}
+
+func TestDiscordPing(t *testing.T) {
+	assert := assert.New(t)
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	app, sign := testDiscordApp(assert, &m)
+
+	var res testDiscordResponse
+	meta, err := web.MockMethod(app, http.MethodPost, "/integrations/discord", sign(map[string]interface{}{"type": discordInteractionPing})...).JSON(&res)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, meta.StatusCode)
+	assert.Equal(discordCallbackPong, res.Type)
+}
+
+func TestDiscordRejectsUnsigned(t *testing.T) {
+	assert := assert.New(t)
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	app, _ := testDiscordApp(assert, &m)
+
+	contents, res, err := web.MockMethod(app, http.MethodPost, "/integrations/discord", r2.OptJSONBody(map[string]interface{}{"type": discordInteractionPing})).Bytes()
+	assert.Nil(err)
+	assert.Equal(http.StatusUnauthorized, res.StatusCode)
+	assert.Equal(discordErrorUnverified, string(contents))
+
+	// requests are rejected if the integration isn't configured.
+	unconfigured := web.MustNew()
+	unconfigured.Log = logger.None()
+	unconfigured.Register(Integrations{Model: &m, Config: config.MustNewFromEnv()})
+	_, res, err = web.MockMethod(unconfigured, http.MethodPost, "/integrations/discord", r2.OptJSONBody(map[string]interface{}{"type": discordInteractionPing})).Bytes()
+	assert.Nil(err)
+	assert.Equal(http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestDiscordCommandAndComponents(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	first, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	_, err = m.CreateTestTagForImageWithVote(todo, u.ID, first.ID, "__test")
+	assert.Nil(err)
+	second, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	_, err = m.CreateTestTagForImageWithVote(todo, u.ID, second.ID, "__test")
+	assert.Nil(err)
+
+	app, sign := testDiscordApp(assert, &m)
+
+	var prompt testDiscordResponse
+	_, err = web.MockMethod(app, http.MethodPost, "/integrations/discord", sign(testDiscordCommand("__test"))...).JSON(&prompt)
+	assert.Nil(err)
+	assert.Equal(discordCallbackChannelMessageWithSource, prompt.Type)
+	assert.Equal(discordFlagEphemeral, prompt.Data.Flags)
+	assert.Len(prompt.Data.Embeds, 1)
+	assert.Len(prompt.Data.Components, 1)
+	assert.Len(prompt.Data.Components[0].Components, 3)
+
+	shuffleID := prompt.Data.Components[0].Components[1].CustomID
+	action, shownUUID, query := parseDiscordCustomID(shuffleID)
+	assert.Equal(slackActionShuffle, action)
+	assert.Equal("__test", query)
+
+	component := testDiscordCommand("")
+	component["type"] = discordInteractionMessageComponent
+	component["data"] = map[string]interface{}{"custom_id": shuffleID, "component_type": discordComponentButton}
+
+	var shuffled testDiscordResponse
+	_, err = web.MockMethod(app, http.MethodPost, "/integrations/discord", sign(component)...).JSON(&shuffled)
+	assert.Nil(err)
+	assert.Equal(discordCallbackUpdateMessage, shuffled.Type)
+	assert.Len(shuffled.Data.Components, 1)
+	_, shuffledUUID, _ := parseDiscordCustomID(shuffled.Data.Components[0].Components[0].CustomID)
+	assert.NotEqual(shownUUID, shuffledUUID)
+
+	component["data"] = map[string]interface{}{"custom_id": shuffled.Data.Components[0].Components[0].CustomID, "component_type": discordComponentButton}
+	var posted testDiscordResponse
+	_, err = web.MockMethod(app, http.MethodPost, "/integrations/discord", sign(component)...).JSON(&posted)
+	assert.Nil(err)
+	assert.Equal(discordCallbackChannelMessageWithSource, posted.Type)
+	assert.Zero(posted.Data.Flags)
+	assert.Len(posted.Data.Embeds, 1)
+	assert.Empty(posted.Data.Components)
+}
+
+func TestDiscordErrorsWithShortQuery(t *testing.T) {
+	assert := assert.New(t)
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	app, sign := testDiscordApp(assert, &m)
+
+	var res testDiscordResponse
+	_, err = web.MockMethod(app, http.MethodPost, "/integrations/discord", sign(testDiscordCommand("do"))...).JSON(&res)
+	assert.Nil(err)
+	assert.Equal(discordFlagEphemeral, res.Data.Flags)
+	assert.Equal(slackErrorInvalidQuery, res.Data.Content)
+}
+
+func TestDiscordCustomID(t *testing.T) {
+	assert := assert.New(t)
+
+	imageUUID := uuid.V4().String()
+	action, parsedUUID, query := parseDiscordCustomID(createDiscordCustomID(slackActionPost, imageUUID, "a query: with colons"))
+	assert.Equal(slackActionPost, action)
+	assert.Equal(imageUUID, parsedUUID)
+	assert.Equal("a query: with colons", query)
+
+	long := createDiscordCustomID(slackActionShuffle, imageUUID, strings.Repeat("é", 100))
+	assert.True(len(long) <= discordCustomIDMaxLength)
+	_, parsedUUID, query = parseDiscordCustomID(long)
+	assert.Equal(imageUUID, parsedUUID)
+	assert.NotEmpty(query)
+
+	action, parsedUUID, _ = parseDiscordCustomID("garbage")
+	assert.Empty(action)
+	assert.Empty(parsedUUID)
+}
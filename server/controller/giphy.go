@@ -0,0 +1,307 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	exception "github.com/blend/go-sdk/ex"
+	"github.com/blend/go-sdk/logger"
+	"github.com/blend/go-sdk/uuid"
+	"github.com/blend/go-sdk/web"
+
+	"github.com/wcharczuk/giffy/server/config"
+	"github.com/wcharczuk/giffy/server/model"
+	"github.com/wcharczuk/giffy/server/transcode"
+	"github.com/wcharczuk/giffy/server/viewmodel"
+)
+
+const (
+	// ErrGiphyRatingInvalid is returned when a giphy rating isn't one of g, pg, pg-13 or r.
+	ErrGiphyRatingInvalid exception.Class = "invalid giphy rating"
+
+	giphyLimitDefault = 25
+	giphyLimitMax     = 50
+
+	giphyTypeGIF              = "gif"
+	giphyImportDateTimeFormat = "2006-01-02 15:04:05"
+)
+
+var (
+	// giphyRatings are the content rating filters for giphy ratings.
+	giphyRatings = map[string]int{
+		"g":     model.ContentRatingG,
+		"pg":    model.ContentRatingPG,
+		"pg-13": model.ContentRatingPG13,
+		"r":     model.ContentRatingR,
+	}
+
+	giphySlugExpr = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// Giphy is the controller for the giphy compatible api.
+// It answers the subset of giphy's `/v1/gifs` api chat tools and bots use, so they can point at giffy without code changes.
+// The `api_key` parameter is accepted but ignored.
+type Giphy struct {
+	Log    logger.Log
+	Config *config.Giffy
+	Model  *model.Manager
+}
+
+// Register registers the controller's routes.
+func (g Giphy) Register(app *web.App) {
+	app.GET("/v1/gifs/search", g.searchAction)
+	app.GET("/v1/gifs/random", g.randomAction)
+}
+
+// GET "/v1/gifs/search?q=<query>&limit=<limit>&offset=<offset>&rating=<rating>"
+func (g Giphy) searchAction(r *web.Ctx) web.Result {
+	query := strings.TrimSpace(web.StringValue(r.Param("q")))
+	if query == "" {
+		return g.badRequest("q is required")
+	}
+	rating, err := parseGiphyRating(web.StringValue(r.Param("rating")))
+	if err != nil {
+		return g.badRequest(err.Error())
+	}
+	limit, err := giphyIntParam(r, "limit", giphyLimitDefault)
+	if err != nil || limit < 1 {
+		return g.badRequest("limit must be a positive integer")
+	}
+	if limit > giphyLimitMax {
+		limit = giphyLimitMax
+	}
+	offset, err := giphyIntParam(r, "offset", 0)
+	if err != nil || offset < 0 {
+		return g.badRequest("offset must be a non-negative integer")
+	}
+
+	results, err := g.Model.SearchImages(r.Context(), query, rating)
+	if err != nil {
+		logger.MaybeError(g.Log, err)
+		return g.internalError()
+	}
+
+	// search results come back best first, so a page is a slice of them.
+	page := []model.Image{}
+	if offset < len(results) {
+		end := offset + limit
+		if end > len(results) {
+			end = len(results)
+		}
+		page = results[offset:end]
+	}
+
+	data := make([]giphyGIF, len(page))
+	for index, image := range page {
+		data[index] = g.gif(image)
+	}
+	return &web.JSONResult{
+		StatusCode: http.StatusOK,
+		Response: giphyResponse{
+			Data: data,
+			Pagination: &giphyPagination{
+				TotalCount: len(results),
+				Count:      len(data),
+				Offset:     offset,
+			},
+			Meta: newGiphyMeta(http.StatusOK, "OK"),
+		},
+	}
+}
+
+// GET "/v1/gifs/random?tag=<tag>&rating=<rating>"
+func (g Giphy) randomAction(r *web.Ctx) web.Result {
+	tag := strings.TrimSpace(web.StringValue(r.Param("tag")))
+	rating, err := parseGiphyRating(web.StringValue(r.Param("rating")))
+	if err != nil {
+		return g.badRequest(err.Error())
+	}
+
+	var result *model.Image
+	if tag != "" {
+		var results []model.Image
+		results, err = g.Model.SearchImagesWeightedRandom(r.Context(), tag, rating, 1)
+		if len(results) > 0 {
+			result = &results[0]
+		}
+	} else if rating == model.ContentRatingR {
+		var results []model.Image
+		results, err = g.Model.GetRandomImages(r.Context(), 1)
+		if len(results) > 0 {
+			result = &results[0]
+		}
+	} else {
+		result, err = g.Model.GetRandomImageForContentRating(r.Context(), rating, nil)
+	}
+	if err != nil {
+		logger.MaybeError(g.Log, err)
+		return g.internalError()
+	}
+
+	// giphy returns an empty list rather than an object when nothing matches.
+	var data interface{} = []giphyGIF{}
+	if result != nil && !result.IsZero() {
+		data = g.gif(*result)
+	}
+	return &web.JSONResult{
+		StatusCode: http.StatusOK,
+		Response: giphyResponse{
+			Data: data,
+			Meta: newGiphyMeta(http.StatusOK, "OK"),
+		},
+	}
+}
+
+// gif returns the giphy shaped object for an image.
+func (g Giphy) gif(image model.Image) giphyGIF {
+	output := viewmodel.NewImage(image, g.Config)
+
+	// clients use the still as a placeholder, so fall back to the thumbnail and then the image itself.
+	stillURL := output.PosterReadURL
+	if stillURL == "" {
+		stillURL = output.ThumbnailReadURL
+	}
+	if stillURL == "" {
+		stillURL = output.S3ReadURL
+	}
+
+	title := resultTitle(output)
+	return giphyGIF{
+		Type:           giphyTypeGIF,
+		ID:             image.UUID,
+		URL:            fmt.Sprintf("%s/image/%s", g.Config.Web.BaseURL, image.UUID),
+		Slug:           giphySlug(title, image.UUID),
+		Title:          title,
+		Rating:         strings.ToLower(model.ContentRatingNames[image.ContentRating]),
+		ImportDateTime: image.CreatedUTC.Format(giphyImportDateTimeFormat),
+		Images: giphyImages{
+			Original: giphyRendition{
+				URL:    output.S3ReadURL,
+				Width:  strconv.Itoa(image.Width),
+				Height: strconv.Itoa(image.Height),
+				Size:   strconv.Itoa(image.FileSize),
+				MP4:    g.videoURL(output, transcode.FormatMP4),
+				WebM:   g.videoURL(output, transcode.FormatWebM),
+			},
+			OriginalStill: giphyRendition{
+				URL:    stillURL,
+				Width:  strconv.Itoa(image.Width),
+				Height: strconv.Itoa(image.Height),
+			},
+		},
+	}
+}
+
+// videoURL returns the url of an image's video rendition if it's in a given format.
+func (g Giphy) videoURL(image viewmodel.Image, format transcode.Format) string {
+	if image.VideoMimeType != format.MimeType {
+		return ""
+	}
+	return image.VideoURL
+}
+
+func (g Giphy) badRequest(message string) web.Result {
+	return &web.JSONResult{
+		StatusCode: http.StatusBadRequest,
+		Response: giphyResponse{
+			Data: []giphyGIF{},
+			Meta: newGiphyMeta(http.StatusBadRequest, message),
+		},
+	}
+}
+
+func (g Giphy) internalError() web.Result {
+	return &web.JSONResult{
+		StatusCode: http.StatusInternalServerError,
+		Response: giphyResponse{
+			Data: []giphyGIF{},
+			Meta: newGiphyMeta(http.StatusInternalServerError, "Internal Server Error"),
+		},
+	}
+}
+
+// parseGiphyRating translates a giphy rating into a content rating filter.
+// Giphy defaults to every rating through `r` when the rating is omitted, so we do too.
+func parseGiphyRating(rating string) (int, error) {
+	rating = strings.ToLower(strings.TrimSpace(rating))
+	if rating == "" {
+		return model.ContentRatingR, nil
+	}
+	if contentRating, ok := giphyRatings[rating]; ok {
+		return contentRating, nil
+	}
+	return 0, exception.New(ErrGiphyRatingInvalid, exception.OptMessagef("rating: %s", rating))
+}
+
+// giphyIntParam returns an integer query parameter, or a default if it's omitted.
+func giphyIntParam(r *web.Ctx, name string, defaultValue int) (int, error) {
+	value := web.StringValue(r.QueryValue(name))
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// giphySlug returns a giphy style slug for an image, i.e. `the-title-<id>`.
+func giphySlug(title, id string) string {
+	slug := strings.Trim(giphySlugExpr.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if slug == "" {
+		return id
+	}
+	return slug + "-" + id
+}
+
+// --------------------------------------------------------------------------------
+// Giphy Types
+// --------------------------------------------------------------------------------
+
+func newGiphyMeta(status int, message string) giphyMeta {
+	return giphyMeta{Status: status, Message: message, ResponseID: uuid.V4().String()}
+}
+
+type giphyResponse struct {
+	Data       interface{}      `json:"data"`
+	Pagination *giphyPagination `json:"pagination,omitempty"`
+	Meta       giphyMeta        `json:"meta"`
+}
+
+type giphyPagination struct {
+	TotalCount int `json:"total_count"`
+	Count      int `json:"count"`
+	Offset     int `json:"offset"`
+}
+
+type giphyMeta struct {
+	Status     int    `json:"status"`
+	Message    string `json:"msg"`
+	ResponseID string `json:"response_id"`
+}
+
+type giphyGIF struct {
+	Type           string      `json:"type"`
+	ID             string      `json:"id"`
+	URL            string      `json:"url"`
+	Slug           string      `json:"slug"`
+	Title          string      `json:"title"`
+	Rating         string      `json:"rating"`
+	ImportDateTime string      `json:"import_datetime"`
+	Images         giphyImages `json:"images"`
+}
+
+type giphyImages struct {
+	Original      giphyRendition `json:"original"`
+	OriginalStill giphyRendition `json:"original_still"`
+}
+
+// giphyRendition is a rendition of a gif; giphy encodes the dimensions and size as strings.
+type giphyRendition struct {
+	URL    string `json:"url"`
+	Width  string `json:"width"`
+	Height string `json:"height"`
+	Size   string `json:"size,omitempty"`
+	MP4    string `json:"mp4,omitempty"`
+	WebM   string `json:"webm,omitempty"`
+}
@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/logger"
+	"github.com/blend/go-sdk/r2"
+	"github.com/blend/go-sdk/testutil"
+	"github.com/blend/go-sdk/web"
+
+	"github.com/wcharczuk/giffy/server/config"
+	"github.com/wcharczuk/giffy/server/model"
+)
+
+type testGiphySearchResponse struct {
+	Data       []giphyGIF       `json:"data"`
+	Pagination *giphyPagination `json:"pagination"`
+	Meta       giphyMeta        `json:"meta"`
+}
+
+type testGiphyRandomResponse struct {
+	Data giphyGIF  `json:"data"`
+	Meta giphyMeta `json:"meta"`
+}
+
+func TestParseGiphyRating(t *testing.T) {
+	assert := assert.New(t)
+
+	for rating, expected := range map[string]int{
+		"":      model.ContentRatingR,
+		"g":     model.ContentRatingG,
+		"pg":    model.ContentRatingPG,
+		"PG-13": model.ContentRatingPG13,
+		" r ":   model.ContentRatingR,
+	} {
+		contentRating, err := parseGiphyRating(rating)
+		assert.Nil(err)
+		assert.Equal(expected, contentRating)
+	}
+
+	_, err := parseGiphyRating("nc-17")
+	assert.NotNil(err)
+	_, err = parseGiphyRating("nr")
+	assert.NotNil(err)
+}
+
+func TestGiphySlug(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("shia-labeouf-just-do-it-abc", giphySlug("Shia LaBeouf: Just Do It!", "abc"))
+	assert.Equal("abc", giphySlug("???", "abc"))
+}
+
+func TestGiphySearch(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	for x := 0; x < 3; x++ {
+		i, err := m.CreateTestImage(todo, u.ID)
+		assert.Nil(err)
+		_, err = m.CreateTestTagForImageWithVote(todo, u.ID, i.ID, "__test_giphy")
+		assert.Nil(err)
+	}
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Giphy{Model: &m, Config: config.MustNewFromEnv()})
+
+	var res testGiphySearchResponse
+	meta, err := web.MockGet(app, "/v1/gifs/search",
+		r2.OptQueryValue("q", "__test_giphy"),
+		r2.OptQueryValue("limit", "2"),
+		r2.OptQueryValue("api_key", "ignored"),
+	).JSON(&res)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, meta.StatusCode)
+	assert.Equal(http.StatusOK, res.Meta.Status)
+	assert.NotEmpty(res.Meta.ResponseID)
+	assert.Len(res.Data, 2)
+	assert.NotNil(res.Pagination)
+	assert.Equal(3, res.Pagination.TotalCount)
+	assert.Equal(2, res.Pagination.Count)
+	assert.Equal(giphyTypeGIF, res.Data[0].Type)
+	assert.Equal("__test_giphy", res.Data[0].Title)
+	assert.Equal("pg-13", res.Data[0].Rating)
+	assert.NotEmpty(res.Data[0].Images.Original.URL)
+	assert.NotEmpty(res.Data[0].Images.OriginalStill.URL)
+	assert.Equal("720", res.Data[0].Images.Original.Width)
+
+	meta, err = web.MockGet(app, "/v1/gifs/search",
+		r2.OptQueryValue("q", "__test_giphy"),
+		r2.OptQueryValue("offset", "2"),
+	).JSON(&res)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, meta.StatusCode)
+	assert.Len(res.Data, 1)
+	assert.Equal(2, res.Pagination.Offset)
+
+	// the test images are rated pg-13.
+	meta, err = web.MockGet(app, "/v1/gifs/search",
+		r2.OptQueryValue("q", "__test_giphy"),
+		r2.OptQueryValue("rating", "pg"),
+	).JSON(&res)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, meta.StatusCode)
+	assert.Empty(res.Data)
+	assert.Equal(0, res.Pagination.TotalCount)
+
+	meta, err = web.MockGet(app, "/v1/gifs/search",
+		r2.OptQueryValue("q", "__test_giphy"),
+		r2.OptQueryValue("rating", "nc-17"),
+	).JSON(&res)
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, meta.StatusCode)
+	assert.Equal(http.StatusBadRequest, res.Meta.Status)
+
+	meta, err = web.MockGet(app, "/v1/gifs/search").JSON(&res)
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, meta.StatusCode)
+}
+
+func TestGiphyRandom(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	i, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	_, err = m.CreateTestTagForImageWithVote(todo, u.ID, i.ID, "__test_giphy")
+	assert.Nil(err)
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Giphy{Model: &m, Config: config.MustNewFromEnv()})
+
+	var res testGiphyRandomResponse
+	meta, err := web.MockGet(app, "/v1/gifs/random", r2.OptQueryValue("tag", "__test_giphy")).JSON(&res)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, meta.StatusCode)
+	assert.Equal(i.UUID, res.Data.ID)
+
+	meta, err = web.MockGet(app, "/v1/gifs/random").JSON(&res)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, meta.StatusCode)
+	assert.NotEmpty(res.Data.ID)
+
+	// nothing matches, so data is an empty list.
+	contents, meta, err := web.MockGet(app, "/v1/gifs/random",
+		r2.OptQueryValue("tag", "__test_giphy"),
+		r2.OptQueryValue("rating", "g"),
+	).Bytes()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, meta.StatusCode)
+	assert.Contains(string(contents), `"data":[]`)
+}
@@ -77,5 +77,10 @@ func (i Index) Register(app *web.App) {
 	app.SetStaticHeader("/static", "access-control-allow-origin", "*")
 	app.SetStaticHeader("/static", "cache-control", "public,max-age=315360000")
 
+	if i.Config.Storage.IsLocal() {
+		app.ServeStaticCached("/files", []string{i.Config.Storage.LocalPathOrDefault()})
+		app.SetStaticHeader("/files", "access-control-allow-origin", "*")
+	}
+
 	app.GET("/status", i.statusAction)
 }
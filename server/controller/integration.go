@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	exception "github.com/blend/go-sdk/ex"
+	"github.com/blend/go-sdk/logger"
+
+	"github.com/wcharczuk/giffy/server/model"
+	"github.com/wcharczuk/giffy/server/viewmodel"
+)
+
+// chatIntegration is the platform specific part of a chat integration (slack, discord, teams).
+// Searches, shuffles and posts from every platform go through the same paths on `Integrations`,
+// so they share content rating filters, search history and ranking feedback.
+type chatIntegration interface {
+	// Source is the `search_history` source the integration logs as.
+	Source() string
+	// ContentRating returns the content rating filter for a channel.
+	ContentRating(ctx context.Context, teamID, channelID string) (int, error)
+}
+
+// integrationBackgroundTimeout bounds the work done after a chat request has been answered.
+const integrationBackgroundTimeout = 5 * time.Minute
+
+// runInBackground runs work that shouldn't hold up the response; tests swap it to run the work inline.
+var runInBackground = func(action func()) {
+	go action()
+}
+
+// background runs an action after the request is answered.
+// The request context is cancelled once the response is written, so the action gets a detached one.
+func (i Integrations) background(action func(context.Context)) {
+	runInBackground(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), integrationBackgroundTimeout)
+		defer cancel()
+		defer func() {
+			if r := recover(); r != nil {
+				logger.MaybeError(i.Log, exception.New(r))
+			}
+		}()
+		action(ctx)
+	})
+}
+
+// integrationArguments identify a search (or an action on a result) from a chat integration.
+type integrationArguments struct {
+	TeamID      string
+	ChannelID   string
+	UserID      string
+	TeamName    string
+	ChannelName string
+	UserName    string
+	Query       string
+	// ResponseURL is where results can be sent after the request has been answered, if the platform has one.
+	ResponseURL string
+
+	// User is the giffy user the chat user is linked to, if any.
+	User *model.User
+}
+
+// integrationSearch finds the best result for a query and logs the search.
+// The returned image is nil if nothing matched.
+func (i Integrations) integrationSearch(ctx context.Context, ci chatIntegration, args integrationArguments) (*model.Image, error) {
+	searchHistory := i.integrationHistory(ci, args)
+	defer func() {
+		logger.MaybeTrigger(ctx, i.Log, searchHistory)
+	}()
+
+	contentRatingFilter, err := ci.ContentRating(ctx, args.TeamID, args.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+	result, err := i.Model.SearchImagesBestResult(ctx, args.Query, nil, contentRatingFilter)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil || result.IsZero() {
+		return nil, nil
+	}
+	searchHistory.DidFindMatch = true
+	searchHistory.ImageID = &result.ID
+	return result, nil
+}
+
+// integrationShuffle records that the user shuffled away from an image and finds the next best result.
+// Prompts without a query (i.e. `/giffy random`) shuffle to another random image.
+// The returned image is nil if nothing else matched.
+func (i Integrations) integrationShuffle(ctx context.Context, ci chatIntegration, args integrationArguments, excludeUUID string) (*model.Image, error) {
+	i.recordInteractionForUUID(ctx, ci, args, excludeUUID, model.SearchInteractionActionShuffle)
+
+	contentRatingFilter, err := ci.ContentRating(ctx, args.TeamID, args.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.MaybeInfof(i.Log, "search query: %s, excludes: %s", args.Query, excludeUUID)
+	var result *model.Image
+	if args.Query == "" {
+		result, err = i.Model.GetRandomImageForContentRating(ctx, contentRatingFilter, []string{excludeUUID})
+	} else {
+		result, err = i.Model.SearchImagesBestResult(ctx, args.Query, []string{excludeUUID}, contentRatingFilter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if result == nil || result.IsZero() {
+		return nil, nil
+	}
+	return result, nil
+}
+
+// integrationPost loads an image a user posted from a prompt, logs the post and records it as positive feedback.
+// Posts from linked users also count as an upvote for the tag that matched the query.
+// The returned image is nil if it doesn't exist.
+func (i Integrations) integrationPost(ctx context.Context, ci chatIntegration, args integrationArguments, imageUUID string) (*model.Image, error) {
+	searchHistory := i.integrationHistory(ci, args)
+	searchHistory.IsPost = true
+	defer func() {
+		logger.MaybeTrigger(ctx, i.Log, searchHistory)
+	}()
+
+	image, err := i.Model.GetImageByUUID(ctx, imageUUID)
+	if err != nil {
+		return nil, err
+	}
+	if image == nil || image.IsZero() {
+		return nil, nil
+	}
+	searchHistory.DidFindMatch = true
+	searchHistory.ImageID = &image.ID
+
+	if tag := i.matchingTag(args.Query, image.Tags); tag != nil {
+		searchHistory.TagID = &tag.ID
+		if args.User != nil {
+			i.implicitUpvote(ctx, args.User, image, tag)
+		}
+	}
+	i.recordInteraction(ctx, ci, args, image, searchHistory.TagID, model.SearchInteractionActionPost)
+	return image, nil
+}
+
+// integrationHistory returns a search history entry for a search or post from an integration.
+func (i Integrations) integrationHistory(ci chatIntegration, args integrationArguments) *model.SearchHistory {
+	searchHistory := model.NewSearchHistoryDetailed(ci.Source(), args.TeamID, args.TeamName, args.ChannelID, args.ChannelName, args.UserID, args.UserName, args.Query, false, nil, nil)
+	if args.User != nil {
+		searchHistory.UserID = &args.User.ID
+	}
+	return searchHistory
+}
+
+// resultTitle returns the title to show for a result; its top tag, falling back to its display name.
+func resultTitle(result viewmodel.Image) string {
+	if len(result.Tags) > 0 {
+		return result.Tags[0].TagValue
+	}
+	return result.DisplayName
+}
+
+// recordInteraction records what a user did with a result they were shown for a query,
+// which feeds back into search ranking. Prompts without a query (i.e. `/giffy random`) aren't recorded.
+func (i Integrations) recordInteraction(ctx context.Context, ci chatIntegration, args integrationArguments, image *model.Image, tagID *int64, action string) {
+	if args.Query == "" || image == nil || image.IsZero() {
+		return
+	}
+	logger.MaybeTrigger(ctx, i.Log, model.NewSearchInteraction(ci.Source(), args.TeamID, args.UserID, args.Query, image.ID, tagID, action))
+}
+
+// recordInteractionForUUID records an interaction for an image that was shown but not fetched (i.e. shuffled away from).
+func (i Integrations) recordInteractionForUUID(ctx context.Context, ci chatIntegration, args integrationArguments, imageUUID, action string) {
+	if args.Query == "" || imageUUID == "" {
+		return
+	}
+	image, err := i.Model.GetImageByUUID(ctx, imageUUID)
+	if err != nil {
+		logger.MaybeError(i.Log, err)
+		return
+	}
+	if image == nil || image.IsZero() {
+		return
+	}
+	var tagID *int64
+	if tag := i.matchingTag(args.Query, image.Tags); tag != nil {
+		tagID = &tag.ID
+	}
+	i.recordInteraction(ctx, ci, args, image, tagID, action)
+}
+
+// implicitUpvote upvotes a tag for an image on behalf of a linked user.
+// It never overrides a vote the user has already cast.
+func (i Integrations) implicitUpvote(ctx context.Context, user *model.User, image *model.Image, tag *model.Tag) {
+	existing, err := i.Model.GetVote(ctx, user.ID, image.ID, tag.ID)
+	if err != nil {
+		logger.MaybeError(i.Log, err)
+		return
+	}
+	if !existing.IsZero() {
+		return
+	}
+	didCreate, err := i.Model.CreateOrUpdateVote(ctx, user.ID, image.ID, tag.ID, true)
+	if err != nil {
+		logger.MaybeError(i.Log, err)
+		return
+	}
+	if didCreate {
+		logger.MaybeTrigger(ctx, i.Log, model.NewModeration(user.ID, model.ModerationVerbCreate, model.ModerationObjectLink, image.UUID, tag.UUID))
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"regexp"
+	"sort"
 	"strings"
 
 	// heroku runtime metrics
@@ -14,6 +16,8 @@ import (
 	"github.com/blend/go-sdk/logger"
 	"github.com/blend/go-sdk/web"
 	"github.com/wcharczuk/giffy/server/config"
+	"github.com/wcharczuk/giffy/server/external"
+	"github.com/wcharczuk/giffy/server/filemanager"
 	"github.com/wcharczuk/giffy/server/model"
 	"github.com/wcharczuk/giffy/server/viewmodel"
 )
@@ -27,64 +31,126 @@ const (
 	slackErrorInvalidCallbackState = "An invalid callback state was passed to the button handler."
 	slackErrorInternal             = "There was an error processing your request. Sadness."
 	slackErrorTeamDisabled         = "Your team has been disabled; contact the integration owner to re-enable."
+	slackErrorTeamNotInstalled     = "Giffy hasn't been installed for your team; install it to change settings."
 
 	slackActionShuffle = "shuffle"
 	slackActionPost    = "post"
 	slackActionCancel  = "cancel"
+
+	slackPayloadBlockActions = "block_actions"
+
+	slackEventLinkShared = "link_shared"
+	slackEventAppMention = "app_mention"
+
+	slackEventAppUninstalled = "app_uninstalled"
+	slackEventTokensRevoked  = "tokens_revoked"
+
+	slackUnfurlMaxTags = 3
 )
 
+var slackMentionExpr = regexp.MustCompile(`<@[^>]+>`)
+
 // Integrations controller is responsible for integration responses.
 type Integrations struct {
 	Log    logger.Log
 	Config *config.Giffy
 	Model  *model.Manager
+	Files  *filemanager.FileManager
 }
 
 // Register registers the controller's actions with the app.
 func (i Integrations) Register(app *web.App) {
-	app.POST("/integrations/slack", i.slack)
-	app.POST("/integrations/slack.action", i.slackAction)
-	app.POST("/integrations/slack.event", i.slackEvent)
+	app.POST("/integrations/slack", i.slack, SlackVerified(i.Config, i.Log))
+	app.POST("/integrations/slack.action", i.slackAction, SlackVerified(i.Config, i.Log))
+	app.POST("/integrations/slack.event", i.slackEvent, SlackVerified(i.Config, i.Log))
+	app.POST("/integrations/discord", i.discord, DiscordVerified(i.Config, i.Log))
+	app.POST("/integrations/teams", i.teams, TeamsVerified(i.Config, i.Log))
+	app.POST("/integrations/mattermost", i.mattermost)
+	app.POST("/integrations/mattermost.action", i.mattermostAction)
 }
 
 func (i Integrations) slack(rc *web.Ctx) web.Result {
 	args := i.arguments(rc)
 
-	if len(args.Query) < 3 {
+	command := parseSlackCommand(args.Query)
+	if command.IsSearch() && len(args.Query) < 3 {
 		return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInvalidQuery))
 	}
 
-	result, errRes := i.getResult(args, rc)
+	team, err := i.getSlackTeam(rc.Context(), args.TeamID)
+	if err != nil {
+		logger.MaybeFatal(i.Log, err)
+		return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInternal))
+	}
+
+	if !command.IsSearch() {
+		return i.slackCommand(command, args, team, rc)
+	}
+
+	args.User = i.getLinkedUser(rc.Context(), args.TeamID, args.UserID)
+	result, errRes := i.getResult(slackIntegration{i: i, team: team}, args, rc)
 	if errRes != nil {
 		return errRes
 	}
 
-	res := slackMessage{}
 	if strings.HasPrefix(args.Query, "img:") {
-		res.DeleteOriginal = true
-		res.AsUser = true
-		res.ResponseType = "in_channel"
-		res.AuthorName = args.UserName
-		res.Attachments = []interface{}{
-			slackImageAttachment{Title: args.Query, ImageURL: result.S3ReadURL},
-		}
+		return i.renderResult(i.postedMessage(team.UseLegacyAttachments, args.UserID, args.UserName, args.Query, *result), rc)
+	}
+
+	var title string
+	if len(result.Tags) > 0 {
+		title = result.Tags[0].TagValue
 	} else {
-		res.ReplaceOriginal = true
-		res.ResponseType = "ephemeral"
-		var title string
-		if len(result.Tags) > 0 {
-			title = result.Tags[0].TagValue
-		} else {
-			title = fmt.Sprintf("search: `%s`", args.Query)
-		}
+		title = fmt.Sprintf("search: `%s`", args.Query)
+	}
+	return i.renderResult(i.promptMessage(team.UseLegacyAttachments, args.Query, title, *result), rc)
+}
 
-		res.Attachments = []interface{}{
-			slackImageAttachment{Title: title, ImageURL: result.S3ReadURL},
-			i.buttonActions(args.Query, result.UUID),
+// slackConfig handles `/giffy config rating [rating]`, which shows or sets the content rating for the channel.
+// Anyone in a channel can run it, so it can only lower the rating from the team default; raising it past that
+// (or to NR) is left to team admins through the api.
+func (i Integrations) slackConfig(args integrationArguments, team *model.SlackTeam, fields []string, rc *web.Ctx) web.Result {
+	if len(fields) == 0 || len(fields) > 2 || strings.ToLower(fields[0]) != slackConfigRating {
+		return i.renderResult(slackMessage{ResponseType: "ephemeral", Text: slackConfigUsage}, rc)
+	}
+	if team.IsZero() {
+		return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorTeamNotInstalled))
+	}
+
+	if len(fields) == 1 {
+		contentRatingFilter, err := i.getContentRatingForChannel(rc.Context(), team, args.ChannelID)
+		if err != nil {
+			logger.MaybeFatal(i.Log, err)
+			return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInternal))
 		}
+		return i.renderResult(slackMessage{
+			ResponseType: "ephemeral",
+			Text:         fmt.Sprintf("The content rating for this channel is `%s`.", model.ContentRatingNames[contentRatingFilter]),
+		}, rc)
 	}
 
-	return i.renderResult(res, rc)
+	contentRatingFilter, err := model.ParseContentRating(fields[1])
+	if err != nil {
+		return i.renderResult(slackMessage{ResponseType: "ephemeral", Text: slackConfigUsage}, rc)
+	}
+	if maxContentRatingFilter := slackChannelMaxContentRating(team); contentRatingFilter > maxContentRatingFilter {
+		return i.renderResult(slackMessage{
+			ResponseType: "ephemeral",
+			Text:         fmt.Sprintf(slackErrorRatingTooHigh, model.ContentRatingNames[maxContentRatingFilter]),
+		}, rc)
+	}
+	setting := model.NewSlackChannelSetting(team.TeamID, args.ChannelID, contentRatingFilter)
+	setting.ChannelName = args.ChannelName
+	setting.UpdatedByID = args.UserID
+	setting.UpdatedByName = args.UserName
+	if err := i.Model.SaveSlackChannelSetting(rc.Context(), setting); err != nil {
+		logger.MaybeFatal(i.Log, err)
+		return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInternal))
+	}
+	return i.renderResult(slackMessage{
+		ResponseType: "in_channel",
+		Text:         fmt.Sprintf("<@%s> set the content rating for this channel to `%s`.", args.UserID, model.ContentRatingNames[contentRatingFilter]),
+	}, rc)
 }
 
 func (i Integrations) slackAction(rc *web.Ctx) web.Result {
@@ -111,9 +177,11 @@ func (i Integrations) slackAction(rc *web.Ctx) web.Result {
 	case slackActionPost:
 		return i.slackPost(payload, rc)
 	case slackActionCancel:
-		return i.renderResult(slackMessage{DeleteOriginal: true}, rc)
+		query, uuid := i.parseActionState(payload)
+		i.recordInteractionForUUID(rc.Context(), slackIntegration{i: i}, payload.Arguments(query), uuid, model.SearchInteractionActionCancel)
+		return i.slackActionRespond(payload, slackMessage{DeleteOriginal: true}, rc)
 	}
-	return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInvalidAction))
+	return i.slackActionError(payload, slackErrorInvalidAction, rc)
 }
 
 func (i Integrations) slackErrorNoResults() string {
@@ -121,90 +189,80 @@ func (i Integrations) slackErrorNoResults() string {
 }
 
 func (i Integrations) slackShuffle(payload slackActionPayload, rc *web.Ctx) web.Result {
-	query, uuid := i.parseCallbackID(payload.CallbackID)
-	if query == "" || uuid == "" {
-		return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInvalidCallbackState))
+	query, uuid := i.parseActionState(payload)
+	if uuid == "" {
+		return i.slackActionError(payload, slackErrorInvalidCallbackState, rc)
 	}
-	contentRatingFilter, err := i.getContentRatingForTeamID(rc.Context(), payload.Team.ID)
+
+	team, err := i.getSlackTeam(rc.Context(), payload.Team.ID)
 	if err != nil {
 		logger.MaybeFatal(i.Log, err)
-		return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInternal))
+		return i.slackActionError(payload, slackErrorInternal, rc)
 	}
 
-	logger.MaybeInfof(i.Log, "search query: %s, excludes: %s", query, uuid)
-	result, err := i.Model.SearchImagesBestResult(rc.Context(), query, []string{uuid}, contentRatingFilter)
+	result, err := i.integrationShuffle(rc.Context(), slackIntegration{i: i, team: team}, payload.Arguments(query), uuid)
 	if err != nil {
 		logger.MaybeFatal(i.Log, err)
-		return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInternal))
+		return i.slackActionError(payload, slackErrorInternal, rc)
 	}
-	if result == nil || result.IsZero() {
-		return web.RawWithContentType(slackContentTypeTextPlain, []byte(i.slackErrorNoResults()))
+	if result == nil {
+		return i.slackActionError(payload, i.slackErrorNoResults(), rc)
 	}
 	output := viewmodel.NewImage(*result, i.Config)
-
-	res := slackMessage{
-		ReplaceOriginal: true,
-		ResponseType:    "ephemeral",
-	}
-	var title string
-	if len(result.Tags) > 0 {
-		title = output.Tags[0].TagValue
-	} else {
-		title = output.DisplayName
-	}
-
-	res.Attachments = []interface{}{
-		slackImageAttachment{Title: title, ImageURL: output.S3ReadURL},
-		i.buttonActions(query, result.UUID),
-	}
-	return i.renderResult(res, rc)
+	return i.slackActionRespond(payload, i.promptMessage(!payload.IsBlockActions(), query, resultTitle(output), output), rc)
 }
 
 func (i Integrations) slackPost(payload slackActionPayload, rc *web.Ctx) web.Result {
-	var resultID *int64
-	var tagID *int64
-
-	if payload.Team.Name != "" {
-		defer func() {
-			logger.MaybeTrigger(rc.Context(),
-				i.Log,
-				model.NewSearchHistoryDetailed("slack", payload.Team.ID, payload.Team.Name, payload.Channel.ID, payload.Channel.Name, payload.User.ID, payload.User.Name, payload.OriginalMessage.Text, true, resultID, tagID),
-			)
-		}()
-	}
-
-	_, uuid := i.parseCallbackID(payload.CallbackID)
+	query, uuid := i.parseActionState(payload)
 	if uuid == "" {
-		return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInvalidCallbackState))
+		return i.slackActionError(payload, slackErrorInvalidCallbackState, rc)
 	}
 
-	img, err := i.Model.GetImageByUUID(rc.Context(), uuid)
+	args := payload.Arguments(query)
+	// posting a result is an implicit upvote (from linked users) for the tag it matched.
+	args.User = i.getLinkedUser(rc.Context(), payload.Team.ID, payload.User.ID)
+	img, err := i.integrationPost(rc.Context(), slackIntegration{i: i}, args, uuid)
 	if err != nil {
 		logger.MaybeFatal(i.Log, err)
-		return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInternal))
+		return i.slackActionError(payload, slackErrorInternal, rc)
 	}
-	if img == nil || img.IsZero() {
-		return web.RawWithContentType(slackContentTypeTextPlain, []byte(i.slackErrorNoResults()))
+	if img == nil {
+		return i.slackActionError(payload, i.slackErrorNoResults(), rc)
 	}
 
 	result := viewmodel.NewImage(*img, i.Config)
+	posted := i.postedMessage(!payload.IsBlockActions(), payload.User.ID, payload.User.Name, resultTitle(result), result)
+	if !payload.IsBlockActions() {
+		return i.renderResult(posted, rc)
+	}
 
-	res := slackMessage{
-		DeleteOriginal: true,
-		AsUser:         true,
-		ResponseType:   "in_channel",
-		AuthorName:     payload.User.Name,
+	// an ephemeral prompt can't be replaced with an in-channel message,
+	// so post the result and then delete the prompt.
+	if err := external.SlackRespond(rc.Context(), payload.ResponseURL, posted); err != nil {
+		logger.MaybeError(i.Log, err)
+		return i.slackActionError(payload, slackErrorInternal, rc)
 	}
-	var title string
-	if len(result.Tags) > 0 {
-		title = result.Tags[0].TagValue
-	} else {
-		title = result.DisplayName
+	return i.slackActionRespond(payload, slackMessage{DeleteOriginal: true}, rc)
+}
+
+// slackActionRespond renders the response to an interaction.
+// Block kit interactions ignore the response body, so they're answered through the response url.
+func (i Integrations) slackActionRespond(payload slackActionPayload, res slackMessage, rc *web.Ctx) web.Result {
+	if !payload.IsBlockActions() {
+		return i.renderResult(res, rc)
 	}
-	res.Attachments = []interface{}{
-		slackImageAttachment{Title: title, ImageURL: result.S3ReadURL},
+	if err := external.SlackRespond(rc.Context(), payload.ResponseURL, res); err != nil {
+		logger.MaybeError(i.Log, err)
 	}
-	return i.renderResult(res, rc)
+	return web.RawWithContentType(slackContentTypeTextPlain, nil)
+}
+
+// slackActionError shows an error message to the user that triggered an interaction.
+func (i Integrations) slackActionError(payload slackActionPayload, message string, rc *web.Ctx) web.Result {
+	if !payload.IsBlockActions() {
+		return web.RawWithContentType(slackContentTypeTextPlain, []byte(message))
+	}
+	return i.slackActionRespond(payload, slackMessage{ResponseType: "ephemeral", Text: message}, rc)
 }
 
 func (i Integrations) slackEvent(rc *web.Ctx) web.Result {
@@ -217,30 +275,297 @@ func (i Integrations) slackEvent(rc *web.Ctx) web.Result {
 	switch e.Type {
 	case "url_verification":
 		return web.RawWithContentType("application/json", []byte(toJSON(slackEventChallegeRepsonse{Challenge: e.Challenge})))
+	case "event_callback":
+		// slack retries events it isn't sure we got (i.e. a timeout or an error before they were acknowledged),
+		// so only the first delivery of each event is handled.
+		isNew, err := i.Model.MarkSlackEventHandled(rc.Context(), e.EventID)
+		if err != nil {
+			return API(rc).InternalError(err)
+		}
+		if !isNew {
+			logger.MaybeInfof(i.Log, "ignoring slack event %s redelivery %s", e.EventID, rc.Request.Header.Get(external.SlackHeaderRetryNum))
+			break
+		}
+		i.background(func(ctx context.Context) {
+			i.slackEventCallback(ctx, e)
+		})
+	}
+	return web.RawWithContentType(slackContentTypeTextPlain, nil)
+}
+
+// slackEventCallback handles events we've subscribed to.
+// It runs after the event has been acknowledged, so errors are logged.
+func (i Integrations) slackEventCallback(ctx context.Context, e slackEvent) {
+	switch e.Event.Type {
+	case slackEventAppUninstalled:
+		logger.MaybeInfof(i.Log, "slack team %s sent %s; disabling team", e.TeamID, e.Event.Type)
+		logger.MaybeError(i.Log, i.Model.UninstallSlackTeam(ctx, e.TeamID))
+		return
+	case slackEventTokensRevoked:
+		logger.MaybeError(i.Log, i.slackTokensRevoked(ctx, e))
+		return
+	case slackEventLinkShared, slackEventAppMention:
+	default:
+		return
+	}
+
+	team, err := i.Model.GetSlackTeamByTeamID(ctx, e.TeamID)
+	if err != nil {
+		logger.MaybeError(i.Log, err)
+		return
+	}
+	if team.IsZero() || !team.IsEnabled || !team.HasBotToken() {
+		logger.MaybeInfof(i.Log, "ignoring slack event %s for team %s; team is missing, disabled or has no bot token", e.Event.Type, e.TeamID)
+		return
+	}
+	token, err := team.BotToken(i.Config.GetEncryptionKey())
+	if err != nil {
+		logger.MaybeError(i.Log, err)
+		return
 	}
+	client := external.NewSlackClient(i.Config, token)
 
-	return web.NoContent
+	switch e.Event.Type {
+	case slackEventLinkShared:
+		err = i.slackLinkShared(ctx, client, team, e.Event)
+	case slackEventAppMention:
+		err = i.slackAppMention(ctx, client, team, e.Event)
+	}
+	logger.MaybeError(i.Log, err)
+}
+
+// slackTokensRevoked disables a team when its bot token is one of the revoked tokens.
+// Revoking other tokens (i.e. a member's user token) leaves the team alone, as the bot token is what every feature uses.
+func (i Integrations) slackTokensRevoked(ctx context.Context, e slackEvent) error {
+	team, err := i.Model.GetSlackTeamByTeamID(ctx, e.TeamID)
+	if err != nil {
+		return err
+	}
+	if team.IsZero() || team.BotUserID == "" {
+		return nil
+	}
+	for _, userID := range e.Event.Tokens.Bot {
+		if userID == team.BotUserID {
+			logger.MaybeInfof(i.Log, "slack team %s revoked the bot token; disabling team", e.TeamID)
+			return i.Model.UninstallSlackTeam(ctx, e.TeamID)
+		}
+	}
+	logger.MaybeInfof(i.Log, "slack team %s revoked tokens other than the bot token; ignoring", e.TeamID)
+	return nil
+}
+
+// slackLinkShared unfurls any giffy image links in a message.
+func (i Integrations) slackLinkShared(ctx context.Context, client *external.SlackClient, team *model.SlackTeam, event slackEventDetails) error {
+	contentRatingFilter, err := i.getContentRatingForChannel(ctx, team, event.Channel)
+	if err != nil {
+		return err
+	}
+
+	unfurls := map[string]external.SlackUnfurl{}
+	for _, link := range event.Links {
+		imageUUID := i.parseImageURL(link.URL)
+		if imageUUID == "" {
+			continue
+		}
+		img, err := i.Model.GetImageByUUID(ctx, imageUUID)
+		if err != nil {
+			return err
+		}
+		if img.IsZero() || !img.IsApproved() || img.ContentRating > contentRatingFilter {
+			continue
+		}
+
+		output := viewmodel.NewImage(*img, i.Config)
+		tags := i.topTagValues(img.Tags, slackUnfurlMaxTags)
+		title := output.DisplayName
+		if len(tags) > 0 {
+			title = tags[0]
+		}
+		unfurls[link.URL] = external.SlackUnfurl{
+			Title:     title,
+			TitleLink: link.URL,
+			Text:      strings.Join(tags, ", "),
+			ImageURL:  output.S3ReadURL,
+			ThumbURL:  output.ThumbnailReadURL,
+			Footer:    "giffy",
+		}
+	}
+	if len(unfurls) == 0 {
+		return nil
+	}
+	return client.ChatUnfurl(ctx, external.SlackChatUnfurlArgs{
+		Channel: event.Channel,
+		TS:      event.MessageTS,
+		Unfurls: unfurls,
+	})
+}
+
+// slackAppMention replies in-thread to "@giffy <query>" with the best result.
+func (i Integrations) slackAppMention(ctx context.Context, client *external.SlackClient, team *model.SlackTeam, event slackEventDetails) error {
+	reply := external.SlackChatPostMessageArgs{
+		Channel:  event.Channel,
+		ThreadTS: event.ThreadTS,
+	}
+	if reply.ThreadTS == "" {
+		reply.ThreadTS = event.TS
+	}
+
+	query := strings.TrimSpace(slackMentionExpr.ReplaceAllString(event.Text, ""))
+	if len(query) < 3 {
+		reply.Text = slackErrorInvalidQuery
+		return client.ChatPostMessage(ctx, reply)
+	}
+
+	args := integrationArguments{
+		TeamID:    team.TeamID,
+		TeamName:  team.TeamName,
+		ChannelID: event.Channel,
+		UserID:    event.User,
+		Query:     query,
+	}
+	result, err := i.integrationSearch(ctx, slackIntegration{i: i, team: team}, args)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		reply.Text = i.slackErrorNoResults()
+		return client.ChatPostMessage(ctx, reply)
+	}
+
+	output := viewmodel.NewImage(*result, i.Config)
+	title := query
+	if len(output.Tags) > 0 {
+		title = output.Tags[0].TagValue
+	}
+	posted := i.postedMessage(team.UseLegacyAttachments, "", "", title, output)
+	reply.Text = posted.Text
+	reply.Attachments = posted.Attachments
+	reply.Blocks = posted.Blocks
+	return client.ChatPostMessage(ctx, reply)
 }
 
 // --------------------------------------------------------------------------------
 // Slack Helpers
 // --------------------------------------------------------------------------------
 
-func (i Integrations) getContentRatingForTeamID(ctx context.Context, teamID string) (contentRatingFilter int, err error) {
-	contentRatingFilter = model.ContentRatingNR
-	var slackTeam *model.SlackTeam
-	slackTeam, err = i.Model.GetSlackTeamByTeamID(ctx, teamID)
+// getSlackTeam returns the settings for a team.
+// Teams that haven't been mapped get the default (unfiltered) settings.
+func (i Integrations) getSlackTeam(ctx context.Context, teamID string) (*model.SlackTeam, error) {
+	team, err := i.Model.GetSlackTeamByTeamID(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+	if team.IsZero() {
+		team.ContentRatingFilter = model.ContentRatingNR
+	}
+	return team, nil
+}
+
+// slackIntegration is the chat integration for a slack team.
+type slackIntegration struct {
+	i    Integrations
+	team *model.SlackTeam
+}
+
+// Source implements chatIntegration.
+func (si slackIntegration) Source() string { return "slack" }
+
+// ContentRating implements chatIntegration.
+// Actions don't have the team loaded up front, so it's fetched as needed.
+func (si slackIntegration) ContentRating(ctx context.Context, teamID, channelID string) (int, error) {
+	team := si.team
+	if team == nil {
+		var err error
+		if team, err = si.i.getSlackTeam(ctx, teamID); err != nil {
+			return 0, err
+		}
+	}
+	return si.i.getContentRatingForChannel(ctx, team, channelID)
+}
+
+// slackChannelMaxContentRating returns the highest content rating a channel can be set to with `/giffy config`,
+// which is the team default, and never NR.
+func slackChannelMaxContentRating(team *model.SlackTeam) int {
+	if team.ContentRatingFilter < model.ContentRatingNR {
+		return team.ContentRatingFilter
+	}
+	return model.ContentRatingR
+}
+
+// getContentRatingForChannel returns the content rating override for a channel, falling back to the team default.
+func (i Integrations) getContentRatingForChannel(ctx context.Context, team *model.SlackTeam, channelID string) (int, error) {
+	if team.IsZero() || channelID == "" {
+		return team.ContentRatingFilter, nil
+	}
+	setting, err := i.Model.GetSlackChannelSetting(ctx, team.TeamID, channelID)
+	if err != nil {
+		return 0, err
+	}
+	if !setting.IsZero() {
+		return setting.ContentRatingFilter, nil
+	}
+	return team.ContentRatingFilter, nil
+}
+
+// parseImageURL returns the image uuid from a giffy image url (i.e. `<base url>/image/<uuid>`).
+func (i Integrations) parseImageURL(rawURL string) (imageUUID string) {
+	parsed, err := url.Parse(rawURL)
 	if err != nil {
 		return
 	}
-	if slackTeam != nil && !slackTeam.IsZero() {
-		contentRatingFilter = slackTeam.ContentRatingFilter
+	if i.Config.Web.BaseURL != "" {
+		base, err := url.Parse(i.Config.Web.BaseURL)
+		if err != nil || !strings.EqualFold(base.Host, parsed.Host) {
+			return
+		}
+	}
+	// older links use the hash router, i.e. `/#/image/<uuid>`.
+	path := parsed.Path
+	if parsed.Fragment != "" {
+		path = parsed.Fragment
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 2 || parts[0] != "image" || parts[1] == "" {
+		return
 	}
-	return contentRatingFilter, nil
+	imageUUID = parts[1]
+	return
 }
 
-func (i Integrations) arguments(rc *web.Ctx) slackArguments {
-	return slackArguments{
+// matchingTag returns the tag that matches a search query, or the top voted tag if none match.
+func (i Integrations) matchingTag(query string, tags []model.Tag) *model.Tag {
+	var top *model.Tag
+	cleaned := model.CleanTagValue(query)
+	for index := range tags {
+		if cleaned != "" && tags[index].TagValue == cleaned {
+			return &tags[index]
+		}
+		if top == nil || tags[index].VotesTotal > top.VotesTotal {
+			top = &tags[index]
+		}
+	}
+	return top
+}
+
+// topTagValues returns up to `count` tag values by vote rank.
+func (i Integrations) topTagValues(tags []model.Tag, count int) []string {
+	sorted := make([]model.Tag, len(tags))
+	copy(sorted, tags)
+	sort.Slice(sorted, func(x, y int) bool {
+		return sorted[x].VotesTotal > sorted[y].VotesTotal
+	})
+	var values []string
+	for _, tag := range sorted {
+		if len(values) == count {
+			break
+		}
+		values = append(values, tag.TagValue)
+	}
+	return values
+}
+
+func (i Integrations) arguments(rc *web.Ctx) integrationArguments {
+	return integrationArguments{
 		TeamID:      web.StringValue(rc.Param("team_id")),
 		ChannelID:   web.StringValue(rc.Param("channel_id")),
 		UserID:      web.StringValue(rc.Param("user_id")),
@@ -248,46 +573,29 @@ func (i Integrations) arguments(rc *web.Ctx) slackArguments {
 		ChannelName: web.StringValue(rc.Param("channel_name")),
 		UserName:    web.StringValue(rc.Param("user_name")),
 		Query:       web.StringValue(rc.Param("text")),
+		ResponseURL: web.StringValue(rc.Param("response_url")),
 	}
 }
 
-func (i Integrations) getResult(args slackArguments, rc *web.Ctx) (*viewmodel.Image, web.Result) {
+// getResult returns the result for a slash command (from slack or mattermost); errors are rendered as plain text.
+func (i Integrations) getResult(ci chatIntegration, args integrationArguments, rc *web.Ctx) (*viewmodel.Image, web.Result) {
 	var result *model.Image
-	var resultID *int64
-	var tagID *int64
-	var foundResult bool
 	var err error
 
-	if args.TeamName != "" {
-		defer func() {
-			logger.MaybeTrigger(rc.Context(), i.Log, model.NewSearchHistoryDetailed("slack", args.TeamID, args.TeamName, args.ChannelID, args.ChannelName, args.UserID, args.UserName, args.Query, foundResult, resultID, tagID))
-		}()
-	}
-
-	contentRatingFilter, err := i.getContentRatingForTeamID(rc.Context(), args.TeamID)
-	if err != nil {
-		logger.MaybeFatal(i.Log, err)
-		return nil, web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInternal))
-	}
-
-	if strings.HasPrefix(args.Query, "img:") {
-		uuid := strings.TrimPrefix(args.Query, "img:")
-		result, err = i.Model.GetImageByUUID(rc.Context(), uuid)
+	if uuid := strings.TrimPrefix(args.Query, "img:"); uuid != args.Query {
+		// `img:` results are posted straight to the channel.
+		result, err = i.integrationPost(rc.Context(), ci, args, uuid)
 	} else {
-		result, err = i.Model.SearchImagesBestResult(rc.Context(), args.Query, nil, contentRatingFilter)
+		result, err = i.integrationSearch(rc.Context(), ci, args)
 	}
-
 	if err != nil {
 		logger.MaybeFatal(i.Log, err)
 		return nil, web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInternal))
 	}
-
-	if result == nil || result.IsZero() {
+	if result == nil {
 		return nil, web.RawWithContentType(slackContentTypeTextPlain, []byte(i.slackErrorNoResults()))
 	}
 
-	foundResult = true
-	resultID = &result.ID
 	output := viewmodel.NewImage(*result, i.Config)
 	return &output, nil
 }
@@ -302,6 +610,98 @@ func (i Integrations) renderResult(res slackMessage, rc *web.Ctx) web.Result {
 	return web.RawWithContentType(slackContentTypeJSON, responseBytes)
 }
 
+// promptMessage is the ephemeral result with the `Shuffle`, `Post` and `Cancel` buttons.
+func (i Integrations) promptMessage(legacy bool, query, title string, result viewmodel.Image) slackMessage {
+	res := slackMessage{
+		ReplaceOriginal: true,
+		ResponseType:    "ephemeral",
+	}
+	if legacy {
+		res.Attachments = []interface{}{
+			slackImageAttachment{Title: title, ImageURL: result.S3ReadURL, ThumbURL: result.ThumbnailReadURL},
+			i.buttonActions(query, result.UUID),
+		}
+		return res
+	}
+	res.Text = title
+	res.Blocks = []interface{}{
+		i.imageBlock(title, result),
+		i.buttonBlock(query, result.UUID),
+	}
+	return res
+}
+
+// postedMessage is a result posted to the channel.
+func (i Integrations) postedMessage(legacy bool, userID, userName, title string, result viewmodel.Image) slackMessage {
+	if legacy {
+		return slackMessage{
+			DeleteOriginal: true,
+			AsUser:         true,
+			ResponseType:   "in_channel",
+			AuthorName:     userName,
+			Attachments: []interface{}{
+				slackImageAttachment{Title: title, ImageURL: result.S3ReadURL, ThumbURL: result.ThumbnailReadURL},
+			},
+		}
+	}
+	res := slackMessage{
+		ResponseType: "in_channel",
+		Text:         title,
+		Blocks: []interface{}{
+			i.imageBlock(title, result),
+		},
+	}
+	if userID != "" {
+		res.Blocks = append(res.Blocks, slackContextBlock{
+			Type:     "context",
+			Elements: []slackTextObject{{Type: "mrkdwn", Text: fmt.Sprintf("posted by <@%s>", userID)}},
+		})
+	}
+	return res
+}
+
+func (i Integrations) imageBlock(title string, result viewmodel.Image) slackImageBlock {
+	block := slackImageBlock{
+		Type:     "image",
+		ImageURL: result.S3ReadURL,
+		AltText:  title,
+	}
+	if title != "" {
+		block.Title = &slackTextObject{Type: "plain_text", Text: title}
+	} else {
+		block.AltText = "gif"
+	}
+	return block
+}
+
+func (i Integrations) buttonBlock(query, imageUUID string) slackActionsBlock {
+	value := i.createButtonValue(query, imageUUID)
+	return slackActionsBlock{
+		Type: "actions",
+		Elements: []slackButtonElement{
+			{
+				Type:     "button",
+				ActionID: slackActionShuffle,
+				Text:     slackTextObject{Type: "plain_text", Text: "Shuffle"},
+				Value:    value,
+			},
+			{
+				Type:     "button",
+				ActionID: slackActionPost,
+				Text:     slackTextObject{Type: "plain_text", Text: "Post"},
+				Style:    "primary",
+				Value:    value,
+			},
+			{
+				Type:     "button",
+				ActionID: slackActionCancel,
+				Text:     slackTextObject{Type: "plain_text", Text: "Cancel"},
+				Value:    value,
+			},
+		},
+	}
+}
+
 func (i Integrations) buttonActions(query, imageUUID string) slackActionAttachment {
 	return slackActionAttachment{
 		Text:           "Hit either `Post` or `Shuffle` (for a new image).",
@@ -332,6 +732,31 @@ func (i Integrations) buttonActions(query, imageUUID string) slackActionAttachme
 	}
 }
 
+func (i Integrations) createButtonValue(query, uuid string) string {
+	value, _ := json.Marshal(slackButtonValue{Query: query, ImageUUID: uuid})
+	return string(value)
+}
+
+func (i Integrations) parseButtonValue(value string) (query, uuid string) {
+	var state slackButtonValue
+	if err := json.Unmarshal([]byte(value), &state); err != nil {
+		return
+	}
+	return state.Query, state.ImageUUID
+}
+
+// parseActionState returns the query and image uuid an interaction was for.
+// Block kit buttons carry it in their value, legacy attachments in the callback id.
+func (i Integrations) parseActionState(payload slackActionPayload) (query, uuid string) {
+	if payload.IsBlockActions() {
+		if len(payload.Actions) == 0 {
+			return
+		}
+		return i.parseButtonValue(payload.Actions[0].Value)
+	}
+	return i.parseCallbackID(payload.CallbackID)
+}
+
 func (i Integrations) createCallbackID(query, uuid string) string {
 	return fmt.Sprintf("%s||%s", base64.StdEncoding.EncodeToString([]byte(query)), uuid)
 }
@@ -355,40 +780,76 @@ func (i Integrations) parseCallbackID(callbackState string) (query, uuid string)
 // Slack Types
 // --------------------------------------------------------------------------------
 
-type slackArguments struct {
-	TeamID      string
-	ChannelID   string
-	UserID      string
-	TeamName    string
-	ChannelName string
-	UserName    string
-	Query       string
+type slackActionPayload struct {
+	Type            string               `json:"type"`
+	Actions         []slackPayloadAction `json:"actions"`
+	CallbackID      string               `json:"callback_id"`
+	Team            slackIdentifier      `json:"team"`
+	Channel         slackIdentifier      `json:"channel"`
+	User            slackIdentifier      `json:"user"`
+	ActionTS        string               `json:"action_ts"`
+	MessageTS       string               `json:"message_ts"`
+	Token           string               `json:"token"`
+	OriginalMessage slackMessage         `json:"original_message"`
+	ResponseURL     string               `json:"response_url"`
 }
 
-type slackActionPayload struct {
-	Actions         []slackAction   `json:"actions"`
-	CallbackID      string          `json:"callback_id"`
-	Team            slackIdentifier `json:"team"`
-	Channel         slackIdentifier `json:"channel"`
-	User            slackIdentifier `json:"user"`
-	ActionTS        string          `json:"action_ts"`
-	MessageTS       string          `json:"message_ts"`
-	Token           string          `json:"token"`
-	OriginalMessage slackMessage    `json:"original_message"`
-	ResponseURL     string          `json:"response_url"`
+// IsBlockActions returns if the payload is from a block kit interaction.
+func (sap slackActionPayload) IsBlockActions() bool {
+	return sap.Type == slackPayloadBlockActions
+}
+
+// Arguments returns the integration arguments for an action on a result for a query.
+func (sap slackActionPayload) Arguments(query string) integrationArguments {
+	return integrationArguments{
+		TeamID:      sap.Team.ID,
+		TeamName:    sap.Team.DisplayName(),
+		ChannelID:   sap.Channel.ID,
+		ChannelName: sap.Channel.Name,
+		UserID:      sap.User.ID,
+		UserName:    sap.User.Name,
+		Query:       query,
+	}
 }
 
 func (sap slackActionPayload) Action() (action string) {
 	if len(sap.Actions) == 0 {
 		return
 	}
+	if sap.IsBlockActions() {
+		action = sap.Actions[0].ActionID
+		return
+	}
 	action = sap.Actions[0].Value
 	return
 }
 
+// slackPayloadAction is an action in an interaction payload; legacy buttons set
+// the name and value, block kit buttons set the action and block ids.
+type slackPayloadAction struct {
+	Name     string `json:"name"`
+	ActionID string `json:"action_id"`
+	BlockID  string `json:"block_id"`
+	Value    string `json:"value"`
+}
+
+type slackButtonValue struct {
+	Query     string `json:"q"`
+	ImageUUID string `json:"i"`
+}
+
 type slackIdentifier struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Domain string `json:"domain"`
+}
+
+// DisplayName returns the name, falling back to the domain (which is all block kit payloads send for teams).
+func (si slackIdentifier) DisplayName() string {
+	if si.Name != "" {
+		return si.Name
+	}
+	return si.Domain
 }
 
 type slackMessage struct {
@@ -399,7 +860,8 @@ type slackMessage struct {
 	DeleteOriginal  bool          `json:"delete_original"`
 	Text            string        `json:"text,omitempty"`
 	AsUser          bool          `json:"as_user"`
-	Attachments     []interface{} `json:"attachments"`
+	Attachments     []interface{} `json:"attachments,omitempty"`
+	Blocks          []interface{} `json:"blocks,omitempty"`
 }
 
 type slackActionAttachment struct {
@@ -425,6 +887,36 @@ type slackImageAttachment struct {
 	ThumbURL string `json:"thumb_url,omitempty"`
 }
 
+type slackTextObject struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackImageBlock struct {
+	Type     string           `json:"type"`
+	ImageURL string           `json:"image_url"`
+	AltText  string           `json:"alt_text"`
+	Title    *slackTextObject `json:"title,omitempty"`
+}
+
+type slackActionsBlock struct {
+	Type     string               `json:"type"`
+	Elements []slackButtonElement `json:"elements"`
+}
+
+type slackButtonElement struct {
+	Type     string          `json:"type"`
+	ActionID string          `json:"action_id"`
+	Text     slackTextObject `json:"text"`
+	Style    string          `json:"style,omitempty"`
+	Value    string          `json:"value"`
+}
+
+type slackContextBlock struct {
+	Type     string            `json:"type"`
+	Elements []slackTextObject `json:"elements"`
+}
+
 type slackMessageAttachment struct {
 	Text   string       `json:"text"`
 	Fields []slackField `json:"field"`
@@ -437,9 +929,35 @@ type slackField struct {
 }
 
 type slackEvent struct {
-	Type      string `json:"type"`
-	Challenge string `json:"challenge"`
-	Token     string `json:"token"`
+	Type      string            `json:"type"`
+	Challenge string            `json:"challenge"`
+	Token     string            `json:"token"`
+	TeamID    string            `json:"team_id"`
+	EventID   string            `json:"event_id"`
+	Event     slackEventDetails `json:"event"`
+}
+
+type slackEventDetails struct {
+	Type      string           `json:"type"`
+	User      string           `json:"user"`
+	Channel   string           `json:"channel"`
+	Text      string           `json:"text"`
+	TS        string           `json:"ts"`
+	ThreadTS  string           `json:"thread_ts"`
+	MessageTS string           `json:"message_ts"`
+	Links     []slackEventLink `json:"links"`
+	Tokens    slackEventTokens `json:"tokens"`
+}
+
+// slackEventTokens are the tokens revoked in a `tokens_revoked` event, as the ids of the users they belong to.
+type slackEventTokens struct {
+	OAuth []string `json:"oauth"`
+	Bot   []string `json:"bot"`
+}
+
+type slackEventLink struct {
+	Domain string `json:"domain"`
+	URL    string `json:"url"`
 }
 
 type slackEventChallegeRepsonse struct {
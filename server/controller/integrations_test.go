@@ -1,8 +1,15 @@
 package controller
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/blend/go-sdk/assert"
 	"github.com/blend/go-sdk/logger"
@@ -10,11 +17,46 @@ import (
 	"github.com/blend/go-sdk/testutil"
 	"github.com/blend/go-sdk/uuid"
 	"github.com/blend/go-sdk/web"
+	"github.com/blend/go-sdk/webutil"
 
 	"github.com/wcharczuk/giffy/server/config"
+	"github.com/wcharczuk/giffy/server/external"
 	"github.com/wcharczuk/giffy/server/model"
 )
 
+// testSlackSigningSecret is the signing secret `testSlackConfig` sets, and slack test requests are signed with.
+const testSlackSigningSecret = "test_signing_secret"
+
+// testSlackConfig returns a config that verifies slack requests with the test signing secret.
+func testSlackConfig(a *assert.Assertions) *config.Giffy {
+	cfg := testAPITokenConfig(a)
+	cfg.SlackSigningSecret = testSlackSigningSecret
+	return cfg
+}
+
+// testSlackSigned returns the options for a request with a body signed with the test signing secret.
+func testSlackSigned(body []byte, contentType string) []r2.Option {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	return []r2.Option{
+		r2.OptBodyBytes(body),
+		r2.OptHeaderValue(webutil.HeaderContentType, contentType),
+		r2.OptHeaderValue(external.SlackHeaderTimestamp, timestamp),
+		r2.OptHeaderValue(external.SlackHeaderSignature, external.SlackSignature(testSlackSigningSecret, timestamp, body)),
+	}
+}
+
+// testSlackForm returns the options for a signed form post, like slash commands and actions.
+func testSlackForm(form url.Values) []r2.Option {
+	return testSlackSigned([]byte(form.Encode()), webutil.ContentTypeApplicationFormEncoded)
+}
+
+// testSlackJSON returns the options for a signed json post, like events.
+func testSlackJSON(a *assert.Assertions, v interface{}) []r2.Option {
+	body, err := json.Marshal(v)
+	a.Nil(err)
+	return testSlackSigned(body, webutil.ContentTypeApplicationJSON)
+}
+
 func TestSlack(t *testing.T) {
 	assert := assert.New(t)
 	todo := testCtx()
@@ -34,22 +76,185 @@ func TestSlack(t *testing.T) {
 
 	app := web.MustNew()
 	app.Log = logger.None()
-	app.Register(Integrations{Model: &m, Config: config.MustNewFromEnv()})
+	app.Register(Integrations{Model: &m, Config: testSlackConfig(assert)})
 
 	var res slackMessage
 	_, err = web.MockMethod(app, http.MethodPost, "/integrations/slack",
-		r2.OptQueryValue("team_id", uuid.V4().String()),
-		r2.OptQueryValue("channel_id", uuid.V4().String()),
-		r2.OptQueryValue("user_id", uuid.V4().String()),
-		r2.OptQueryValue("team_doman", "test_domain"),
-		r2.OptQueryValue("channel_name", "test_channel"),
-		r2.OptQueryValue("user_name", "test_user"),
-		r2.OptQueryValue("text", "__test"),
+		testSlackForm(url.Values{
+			"team_id":      {uuid.V4().String()},
+			"channel_id":   {uuid.V4().String()},
+			"user_id":      {uuid.V4().String()},
+			"team_doman":   {"test_domain"},
+			"channel_name": {"test_channel"},
+			"user_name":    {"test_user"},
+			"text":         {"__test"},
+		})...,
 	).JSON(&res)
 
 	assert.Nil(err)
 	assert.NotNil(res)
-	assert.NotEmpty(res.Attachments)
+	assert.NotEmpty(res.Blocks)
+	assert.Empty(res.Attachments)
+}
+
+func TestSlackLegacyAttachments(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	team := model.NewSlackTeam(uuid.V4().String(), "test_team", uuid.V4().String(), "test_user")
+	team.UseLegacyAttachments = true
+	assert.Nil(m.Invoke(todo).Create(team))
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	i, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	_, err = m.CreateTestTagForImageWithVote(todo, u.ID, i.ID, "__test")
+	assert.Nil(err)
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Integrations{Model: &m, Config: testSlackConfig(assert)})
+
+	var res slackMessage
+	_, err = web.MockMethod(app, http.MethodPost, "/integrations/slack",
+		testSlackForm(url.Values{
+			"team_id":    {team.TeamID},
+			"channel_id": {uuid.V4().String()},
+			"user_id":    {uuid.V4().String()},
+			"text":       {"__test"},
+		})...,
+	).JSON(&res)
+	assert.Nil(err)
+	assert.Len(res.Attachments, 2)
+	assert.Empty(res.Blocks)
+}
+
+func TestSlackBlockActionShuffle(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	responseURL, calls := testSlackAPI(assert)
+	defer responseURL.Close()
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	i0, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	_, err = m.CreateTestTagForImageWithVote(todo, u.ID, i0.ID, "__test_shuffle")
+	assert.Nil(err)
+	i1, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	_, err = m.CreateTestTagForImageWithVote(todo, u.ID, i1.ID, "__test_shuffle")
+	assert.Nil(err)
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	integrations := Integrations{Model: &m, Config: testSlackConfig(assert)}
+	app.Register(integrations)
+
+	payload := slackActionPayload{
+		Type:        slackPayloadBlockActions,
+		Team:        slackIdentifier{ID: uuid.V4().String()},
+		User:        slackIdentifier{ID: "U123", Name: "test_user"},
+		ResponseURL: responseURL.URL + "/response",
+		Actions: []slackPayloadAction{
+			{ActionID: slackActionShuffle, Value: integrations.createButtonValue("__test_shuffle", i0.UUID)},
+		},
+	}
+	_, res, err := web.MockMethod(app, http.MethodPost, "/integrations/slack.action",
+		testSlackForm(url.Values{"payload": {toJSON(payload)}})...,
+	).Bytes()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	assert.Len(*calls, 1)
+	call := (*calls)[0]
+	assert.Equal("response", call.Method)
+	assert.Equal(true, call.Body["replace_original"])
+	assert.Equal("ephemeral", call.Body["response_type"])
+	assert.NotEmpty(call.Body["blocks"])
+	assert.Contains(toJSON(call.Body["blocks"]), i1.UUID)
+}
+
+func TestSlackBlockActionPost(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	responseURL, calls := testSlackAPI(assert)
+	defer responseURL.Close()
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	i, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	integrations := Integrations{Model: &m, Config: testSlackConfig(assert)}
+	app.Register(integrations)
+
+	payload := slackActionPayload{
+		Type:        slackPayloadBlockActions,
+		User:        slackIdentifier{ID: "U123", Name: "test_user"},
+		ResponseURL: responseURL.URL + "/response",
+		Actions: []slackPayloadAction{
+			{ActionID: slackActionPost, Value: integrations.createButtonValue("__test_post", i.UUID)},
+		},
+	}
+	_, res, err := web.MockMethod(app, http.MethodPost, "/integrations/slack.action",
+		testSlackForm(url.Values{"payload": {toJSON(payload)}})...,
+	).Bytes()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	assert.Len(*calls, 2)
+	assert.Equal("in_channel", (*calls)[0].Body["response_type"])
+	assert.NotEmpty((*calls)[0].Body["blocks"])
+	assert.Equal(true, (*calls)[1].Body["delete_original"])
+}
+
+func TestSlackParseActionState(t *testing.T) {
+	assert := assert.New(t)
+	i := Integrations{}
+
+	query, uuid := i.parseActionState(slackActionPayload{
+		Type:    slackPayloadBlockActions,
+		Actions: []slackPayloadAction{{ActionID: slackActionShuffle, Value: i.createButtonValue("dancing || cat", "abc123")}},
+	})
+	assert.Equal("dancing || cat", query)
+	assert.Equal("abc123", uuid)
+
+	query, uuid = i.parseActionState(slackActionPayload{
+		CallbackID: i.createCallbackID("dancing cat", "abc123"),
+		Actions:    []slackPayloadAction{{Name: "action", Value: slackActionShuffle}},
+	})
+	assert.Equal("dancing cat", query)
+	assert.Equal("abc123", uuid)
+
+	query, uuid = i.parseActionState(slackActionPayload{Type: slackPayloadBlockActions})
+	assert.Empty(query)
+	assert.Empty(uuid)
+
+	assert.Equal(slackActionShuffle, slackActionPayload{
+		Type:    slackPayloadBlockActions,
+		Actions: []slackPayloadAction{{ActionID: slackActionShuffle, Value: "{}"}},
+	}.Action())
+	assert.Equal(slackActionPost, slackActionPayload{
+		Actions: []slackPayloadAction{{Name: "action", Value: slackActionPost}},
+	}.Action())
 }
 
 func TestSlackErrorsWithShortQuery(t *testing.T) {
@@ -60,19 +265,544 @@ func TestSlackErrorsWithShortQuery(t *testing.T) {
 	m := model.NewTestManager(tx)
 
 	app := web.MustNew()
-	app.Register(Integrations{Model: &m, Config: config.MustNewFromEnv()})
+	app.Register(Integrations{Model: &m, Config: testSlackConfig(assert)})
 
 	contents, _, err := web.MockMethod(app, http.MethodPost, "/integrations/slack",
-		r2.OptQueryValue("team_id", uuid.V4().String()),
-		r2.OptQueryValue("channel_id", uuid.V4().String()),
-		r2.OptQueryValue("user_id", uuid.V4().String()),
-		r2.OptQueryValue("team_doman", "test_domain"),
-		r2.OptQueryValue("channel_name", "test_channel"),
-		r2.OptQueryValue("user_name", "test_user"),
-		r2.OptQueryValue("text", "do"),
+		testSlackForm(url.Values{
+			"team_id":      {uuid.V4().String()},
+			"channel_id":   {uuid.V4().String()},
+			"user_id":      {uuid.V4().String()},
+			"team_doman":   {"test_domain"},
+			"channel_name": {"test_channel"},
+			"user_name":    {"test_user"},
+			"text":         {"do"},
+		})...,
 	).Bytes()
 
 	assert.Nil(err)
 	assert.NotEmpty(contents)
 	assert.Equal(slackErrorInvalidQuery, string(contents))
 }
+
+func TestSlackRejectsUnsigned(t *testing.T) {
+	assert := assert.New(t)
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Integrations{Model: &m, Config: testSlackConfig(assert)})
+
+	form := url.Values{"team_id": {uuid.V4().String()}, "text": {"__test"}}
+	contents, res, err := web.MockMethod(app, http.MethodPost, "/integrations/slack",
+		r2.OptPostForm(form),
+	).Bytes()
+	assert.Nil(err)
+	assert.Equal(http.StatusUnauthorized, res.StatusCode)
+	assert.Equal(slackErrorUnverified, string(contents))
+
+	_, res, err = web.MockMethod(app, http.MethodPost, "/integrations/slack",
+		r2.OptPostForm(form),
+		r2.OptHeaderValue(external.SlackHeaderTimestamp, strconv.FormatInt(time.Now().Unix(), 10)),
+		r2.OptHeaderValue(external.SlackHeaderSignature, "v0=not_a_signature"),
+	).Bytes()
+	assert.Nil(err)
+	assert.Equal(http.StatusUnauthorized, res.StatusCode)
+
+	// without a signing secret or a verification token, nothing can be verified, so everything is rejected.
+	unconfigured := web.MustNew()
+	unconfigured.Log = logger.None()
+	unconfigured.Register(Integrations{Model: &m, Config: config.MustNewFromEnv()})
+
+	contents, res, err = web.MockMethod(unconfigured, http.MethodPost, "/integrations/slack",
+		r2.OptPostForm(form),
+	).Bytes()
+	assert.Nil(err)
+	assert.Equal(http.StatusUnauthorized, res.StatusCode)
+	assert.Equal(slackErrorUnverified, string(contents))
+}
+
+func TestSlackSigned(t *testing.T) {
+	assert := assert.New(t)
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Integrations{Model: &m, Config: testSlackConfig(assert)})
+
+	form := url.Values{"team_id": {uuid.V4().String()}, "text": {"do"}}
+	contents, res, err := web.MockMethod(app, http.MethodPost, "/integrations/slack",
+		testSlackForm(form)...,
+	).Bytes()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Equal(slackErrorInvalidQuery, string(contents))
+
+	// the signature covers the body, so a body other than the one signed is rejected.
+	signed := testSlackForm(form)
+	tampered := url.Values{"team_id": form["team_id"], "text": {"dog"}}
+	_, res, err = web.MockMethod(app, http.MethodPost, "/integrations/slack",
+		append(signed, r2.OptBodyBytes([]byte(tampered.Encode())))...,
+	).Bytes()
+	assert.Nil(err)
+	assert.Equal(http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestSlackLegacyToken(t *testing.T) {
+	assert := assert.New(t)
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	cfg := config.MustNewFromEnv()
+	cfg.SlackVerificationToken = "test_verification_token"
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Integrations{Model: &m, Config: cfg})
+
+	contents, res, err := web.MockMethod(app, http.MethodPost, "/integrations/slack",
+		r2.OptPostFormValue("token", cfg.SlackVerificationToken),
+		r2.OptPostFormValue("text", "do"),
+	).Bytes()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Equal(slackErrorInvalidQuery, string(contents))
+
+	_, res, err = web.MockMethod(app, http.MethodPost, "/integrations/slack",
+		r2.OptPostFormValue("token", "not_the_token"),
+		r2.OptPostFormValue("text", "do"),
+	).Bytes()
+	assert.Nil(err)
+	assert.Equal(http.StatusUnauthorized, res.StatusCode)
+}
+
+type testSlackAPICall struct {
+	Method        string
+	Authorization string
+	Body          map[string]interface{}
+}
+
+// testSlackAPI returns a stub slack web api that records the calls made to it.
+// testInlineBackground runs background work inline, so its effects can be checked once a request returns.
+// The returned func restores the default.
+func testInlineBackground() func() {
+	run := runInBackground
+	runInBackground = func(action func()) { action() }
+	return func() { runInBackground = run }
+}
+
+func testSlackAPI(a *assert.Assertions) (*httptest.Server, *[]testSlackAPICall) {
+	var calls []testSlackAPICall
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		call := testSlackAPICall{
+			Method:        strings.TrimPrefix(req.URL.Path, "/"),
+			Authorization: req.Header.Get("Authorization"),
+		}
+		a.Nil(json.NewDecoder(req.Body).Decode(&call.Body))
+		calls = append(calls, call)
+		rw.Write([]byte(`{"ok":true}`))
+	}))
+	return server, &calls
+}
+
+func createTestSlackTeamWithBotToken(a *assert.Assertions, m *model.Manager, cfg *config.Giffy) *model.SlackTeam {
+	team := model.NewSlackTeam(uuid.V4().String(), "test_team", uuid.V4().String(), "test_user")
+	a.Nil(team.SetInstall(model.SlackTeamInstall{BotToken: "xoxb-test", BotUserID: "UGIFFY"}, cfg.GetEncryptionKey()))
+	a.Nil(m.Invoke(testCtx()).Create(team))
+	return team
+}
+
+func TestSlackEventLinkShared(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+	defer testInlineBackground()()
+
+	slackAPI, calls := testSlackAPI(assert)
+	defer slackAPI.Close()
+
+	cfg := testSlackConfig(assert)
+	cfg.Web.BaseURL = "https://giffy.test"
+	cfg.SlackAPIURL = slackAPI.URL
+	team := createTestSlackTeamWithBotToken(assert, &m, cfg)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	i, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	_, err = m.CreateTestTagForImageWithVote(todo, u.ID, i.ID, "__test_unfurl")
+	assert.Nil(err)
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Integrations{Model: &m, Config: cfg})
+
+	imageURL := fmt.Sprintf("https://giffy.test/image/%s", i.UUID)
+	_, res, err := web.MockMethod(app, http.MethodPost, "/integrations/slack.event", testSlackJSON(assert, slackEvent{
+		Type:    "event_callback",
+		EventID: uuid.V4().String(),
+		TeamID:  team.TeamID,
+		Event: slackEventDetails{
+			Type:      slackEventLinkShared,
+			Channel:   "C123",
+			MessageTS: "1234.5678",
+			Links: []slackEventLink{
+				{Domain: "giffy.test", URL: imageURL},
+				{Domain: "example.com", URL: "https://example.com/image/not-giffy"},
+			},
+		},
+	})...).Bytes()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	assert.Len(*calls, 1)
+	call := (*calls)[0]
+	assert.Equal("chat.unfurl", call.Method)
+	assert.Equal("Bearer xoxb-test", call.Authorization)
+	assert.Equal("C123", call.Body["channel"])
+	assert.Equal("1234.5678", call.Body["ts"])
+
+	unfurls, ok := call.Body["unfurls"].(map[string]interface{})
+	assert.True(ok)
+	assert.Len(unfurls, 1)
+	unfurl, ok := unfurls[imageURL].(map[string]interface{})
+	assert.True(ok)
+	assert.Equal("__test_unfurl", unfurl["title"])
+	assert.NotEmpty(unfurl["image_url"])
+}
+
+func TestSlackEventAppMention(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+	defer testInlineBackground()()
+
+	slackAPI, calls := testSlackAPI(assert)
+	defer slackAPI.Close()
+
+	cfg := testSlackConfig(assert)
+	cfg.SlackAPIURL = slackAPI.URL
+	team := createTestSlackTeamWithBotToken(assert, &m, cfg)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	i, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	_, err = m.CreateTestTagForImageWithVote(todo, u.ID, i.ID, "__test_mention")
+	assert.Nil(err)
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Integrations{Model: &m, Config: cfg})
+
+	_, res, err := web.MockMethod(app, http.MethodPost, "/integrations/slack.event", testSlackJSON(assert, slackEvent{
+		Type:    "event_callback",
+		EventID: uuid.V4().String(),
+		TeamID:  team.TeamID,
+		Event: slackEventDetails{
+			Type:    slackEventAppMention,
+			User:    "U123",
+			Channel: "C123",
+			Text:    "<@UGIFFY> __test_mention",
+			TS:      "1234.5678",
+		},
+	})...).Bytes()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	assert.Len(*calls, 1)
+	call := (*calls)[0]
+	assert.Equal("chat.postMessage", call.Method)
+	assert.Equal("C123", call.Body["channel"])
+	assert.Equal("1234.5678", call.Body["thread_ts"])
+	assert.NotEmpty(call.Body["blocks"])
+}
+
+func TestSlackEventIgnoresTeamWithoutBotToken(t *testing.T) {
+	assert := assert.New(t)
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+	defer testInlineBackground()()
+
+	slackAPI, calls := testSlackAPI(assert)
+	defer slackAPI.Close()
+
+	cfg := testSlackConfig(assert)
+	cfg.SlackAPIURL = slackAPI.URL
+	team := model.NewSlackTeam(uuid.V4().String(), "test_team", uuid.V4().String(), "test_user")
+	assert.Nil(m.Invoke(testCtx()).Create(team))
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Integrations{Model: &m, Config: cfg})
+
+	_, res, err := web.MockMethod(app, http.MethodPost, "/integrations/slack.event", testSlackJSON(assert, slackEvent{
+		Type:    "event_callback",
+		EventID: uuid.V4().String(),
+		TeamID:  team.TeamID,
+		Event: slackEventDetails{
+			Type:    slackEventAppMention,
+			Channel: "C123",
+			Text:    "<@UGIFFY> __test_mention",
+			TS:      "1234.5678",
+		},
+	})...).Bytes()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Empty(*calls)
+}
+
+func TestSlackEventIgnoresRedeliveries(t *testing.T) {
+	assert := assert.New(t)
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+	defer testInlineBackground()()
+
+	slackAPI, calls := testSlackAPI(assert)
+	defer slackAPI.Close()
+
+	cfg := testSlackConfig(assert)
+	cfg.SlackAPIURL = slackAPI.URL
+	team := createTestSlackTeamWithBotToken(assert, &m, cfg)
+
+	u, err := m.CreateTestUser(testCtx())
+	assert.Nil(err)
+	i, err := m.CreateTestImage(testCtx(), u.ID)
+	assert.Nil(err)
+	_, err = m.CreateTestTagForImageWithVote(testCtx(), u.ID, i.ID, "__test_mention")
+	assert.Nil(err)
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Integrations{Model: &m, Config: cfg})
+
+	event := slackEvent{
+		Type:    "event_callback",
+		TeamID:  team.TeamID,
+		EventID: uuid.V4().String(),
+		Event: slackEventDetails{
+			Type:    slackEventAppMention,
+			User:    "U123",
+			Channel: "C123",
+			Text:    "<@UGIFFY> __test_mention",
+			TS:      "1234.5678",
+		},
+	}
+	deliver := func(retryNum string) {
+		_, res, err := web.MockMethod(app, http.MethodPost, "/integrations/slack.event",
+			append(testSlackJSON(assert, event), r2.OptHeaderValue(external.SlackHeaderRetryNum, retryNum))...,
+		).Bytes()
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.StatusCode)
+	}
+
+	// a retry of an event we never saw (i.e. the first delivery failed) is handled.
+	deliver("1")
+	assert.Len(*calls, 1)
+	// but any delivery after that is dropped.
+	deliver("2")
+	assert.Len(*calls, 1)
+}
+
+func TestSlackParseImageURL(t *testing.T) {
+	assert := assert.New(t)
+
+	i := Integrations{Config: &config.Giffy{}}
+	i.Config.Web.BaseURL = "https://giffy.test"
+
+	assert.Equal("abc123", i.parseImageURL("https://giffy.test/image/abc123"))
+	assert.Equal("abc123", i.parseImageURL("https://giffy.test/image/abc123/"))
+	assert.Equal("abc123", i.parseImageURL("https://giffy.test/#/image/abc123"))
+	assert.Empty(i.parseImageURL("https://example.com/image/abc123"))
+	assert.Empty(i.parseImageURL("https://giffy.test/images/abc123"))
+	assert.Empty(i.parseImageURL("https://giffy.test/image/"))
+	assert.Empty(i.parseImageURL("https://giffy.test/image/abc123/edit"))
+}
+
+func TestSlackEventAppUninstalled(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+	defer testInlineBackground()()
+
+	cfg := testSlackConfig(assert)
+	team := createTestSlackTeamWithBotToken(assert, &m, cfg)
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Integrations{Model: &m, Config: cfg})
+
+	_, res, err := web.MockMethod(app, http.MethodPost, "/integrations/slack.event", testSlackJSON(assert, slackEvent{
+		Type:    "event_callback",
+		EventID: uuid.V4().String(),
+		TeamID:  team.TeamID,
+		Event:   slackEventDetails{Type: slackEventAppUninstalled},
+	})...).Bytes()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	verify, err := m.GetSlackTeamByTeamID(todo, team.TeamID)
+	assert.Nil(err)
+	assert.False(verify.IsEnabled)
+	assert.False(verify.HasBotToken())
+	assert.True(verify.IsUninstalled())
+}
+
+func TestSlackEventTokensRevoked(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+	defer testInlineBackground()()
+
+	cfg := testSlackConfig(assert)
+	team := createTestSlackTeamWithBotToken(assert, &m, cfg)
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Integrations{Model: &m, Config: cfg})
+
+	revoke := func(tokens slackEventTokens) {
+		_, res, err := web.MockMethod(app, http.MethodPost, "/integrations/slack.event", testSlackJSON(assert, slackEvent{
+			Type:    "event_callback",
+			EventID: uuid.V4().String(),
+			TeamID:  team.TeamID,
+			Event:   slackEventDetails{Type: slackEventTokensRevoked, Tokens: tokens},
+		})...).Bytes()
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.StatusCode)
+	}
+
+	// a member's user token being revoked leaves the team alone.
+	revoke(slackEventTokens{OAuth: []string{"U123"}})
+	verify, err := m.GetSlackTeamByTeamID(todo, team.TeamID)
+	assert.Nil(err)
+	assert.True(verify.IsEnabled)
+	assert.True(verify.HasBotToken())
+	assert.False(verify.IsUninstalled())
+
+	revoke(slackEventTokens{Bot: []string{"UOTHERBOT"}})
+	verify, err = m.GetSlackTeamByTeamID(todo, team.TeamID)
+	assert.Nil(err)
+	assert.True(verify.IsEnabled)
+	assert.True(verify.HasBotToken())
+
+	revoke(slackEventTokens{OAuth: []string{"U123"}, Bot: []string{"UGIFFY"}})
+	verify, err = m.GetSlackTeamByTeamID(todo, team.TeamID)
+	assert.Nil(err)
+	assert.False(verify.IsEnabled)
+	assert.False(verify.HasBotToken())
+	assert.True(verify.IsUninstalled())
+}
+
+func TestSlackConfigRating(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	team := model.NewSlackTeam(uuid.V4().String(), "test_team", uuid.V4().String(), "test_user")
+	team.ContentRatingFilter = model.ContentRatingR
+	assert.Nil(m.Invoke(todo).Create(team))
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	i, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	_, err = m.CreateTestTagForImageWithVote(todo, u.ID, i.ID, "__test_channel_rating")
+	assert.Nil(err)
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Integrations{Model: &m, Config: testSlackConfig(assert)})
+
+	slash := func(channelID, text string) (*slackMessage, string) {
+		contents, _, err := web.MockMethod(app, http.MethodPost, "/integrations/slack",
+			testSlackForm(url.Values{
+				"team_id":      {team.TeamID},
+				"channel_id":   {channelID},
+				"channel_name": {"random"},
+				"user_id":      {"U123"},
+				"text":         {text},
+			})...,
+		).Bytes()
+		assert.Nil(err)
+		var res slackMessage
+		if json.Unmarshal(contents, &res) != nil {
+			return nil, string(contents)
+		}
+		return &res, string(contents)
+	}
+
+	// the test image is PG-13, which the team default allows.
+	res, _ := slash("C123", "__test_channel_rating")
+	assert.NotNil(res)
+	assert.NotEmpty(res.Blocks)
+
+	res, _ = slash("C123", "config rating G")
+	assert.NotNil(res)
+	assert.Equal("in_channel", res.ResponseType)
+	assert.Contains(res.Text, "`G`")
+
+	res, _ = slash("C123", "config rating")
+	assert.NotNil(res)
+	assert.Contains(res.Text, "`G`")
+
+	res, contents := slash("C123", "__test_channel_rating")
+	assert.Nil(res)
+	assert.Contains(contents, "couldn't find")
+
+	// other channels still use the team default.
+	res, _ = slash("C456", "__test_channel_rating")
+	assert.NotNil(res)
+	assert.NotEmpty(res.Blocks)
+
+	// channels can go back up to the team default, but not past it.
+	res, _ = slash("C123", "config rating R")
+	assert.NotNil(res)
+	assert.Equal("in_channel", res.ResponseType)
+
+	res, _ = slash("C123", "config rating NR")
+	assert.NotNil(res)
+	assert.Equal("ephemeral", res.ResponseType)
+	assert.Equal(fmt.Sprintf(slackErrorRatingTooHigh, "R"), res.Text)
+
+	setting, err := m.GetSlackChannelSetting(todo, team.TeamID, "C123")
+	assert.Nil(err)
+	assert.Equal(model.ContentRatingR, setting.ContentRatingFilter)
+
+	team.ContentRatingFilter = model.ContentRatingPG13
+	assert.Nil(m.Invoke(todo).Update(team))
+
+	res, _ = slash("C456", "config rating R")
+	assert.NotNil(res)
+	assert.Equal(fmt.Sprintf(slackErrorRatingTooHigh, "PG-13"), res.Text)
+
+	res, _ = slash("C123", "config rating X")
+	assert.NotNil(res)
+	assert.Equal(slackConfigUsage, res.Text)
+}
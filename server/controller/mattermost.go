@@ -0,0 +1,307 @@
+package controller
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/blend/go-sdk/crypto"
+	"github.com/blend/go-sdk/logger"
+	"github.com/blend/go-sdk/web"
+	"github.com/blend/go-sdk/webutil"
+
+	"github.com/wcharczuk/giffy/server/external"
+	"github.com/wcharczuk/giffy/server/model"
+	"github.com/wcharczuk/giffy/server/viewmodel"
+)
+
+const (
+	mattermostErrorUnverified    = "This request could not be verified as coming from a registered Mattermost instance."
+	mattermostErrorBadPayload    = "There was an error processing a payload from mattermost. Saddness."
+	mattermostAuthorizationToken = "Token"
+)
+
+// mattermostIntegration is the chat integration for a mattermost instance.
+type mattermostIntegration struct {
+	instance *model.MattermostInstance
+}
+
+// Source implements chatIntegration.
+func (mmi mattermostIntegration) Source() string { return "mattermost" }
+
+// ContentRating implements chatIntegration.
+func (mmi mattermostIntegration) ContentRating(_ context.Context, _, _ string) (int, error) {
+	return mmi.instance.ContentRatingFilter, nil
+}
+
+// mattermost handles the `/giffy` slash command from a mattermost instance.
+// Mattermost sends slack style slash commands, but the instance is identified (and verified) by the command's token.
+func (i Integrations) mattermost(rc *web.Ctx) web.Result {
+	instance, err := i.Model.GetMattermostInstanceByToken(rc.Context(), i.mattermostToken(rc), i.Config.GetEncryptionKey())
+	if err != nil {
+		logger.MaybeFatal(i.Log, err)
+		return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInternal))
+	}
+	if instance.IsZero() || !instance.IsEnabled {
+		logger.MaybeWarningf(i.Log, "rejecting mattermost request to %s from %s: unknown or disabled instance", rc.Request.URL.Path, webutil.GetRemoteAddr(rc.Request))
+		return &web.RawResult{
+			StatusCode:  http.StatusUnauthorized,
+			ContentType: slackContentTypeTextPlain,
+			Response:    []byte(mattermostErrorUnverified),
+		}
+	}
+
+	args := i.arguments(rc)
+	if len(args.Query) < 3 {
+		return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInvalidQuery))
+	}
+
+	result, errRes := i.getResult(mattermostIntegration{instance: instance}, args, rc)
+	if errRes != nil {
+		return errRes
+	}
+	if strings.HasPrefix(args.Query, "img:") {
+		return i.mattermostRespond(i.mattermostPostedMessage(args.UserName, *result), rc)
+	}
+	responseURL := web.StringValue(rc.Param("response_url"))
+	return i.mattermostRespond(mattermostMessage{
+		ResponseType: "ephemeral",
+		Attachments:  []mattermostAttachment{i.mattermostPrompt(instance, args.Query, responseURL, *result)},
+	}, rc)
+}
+
+// mattermostAction handles the buttons on a prompt.
+// Action requests aren't signed by mattermost, so the button context is signed when the prompt is rendered.
+func (i Integrations) mattermostAction(rc *web.Ctx) web.Result {
+	var payload mattermostActionPayload
+	if err := rc.PostBodyAsJSON(&payload); err != nil {
+		logger.MaybeError(i.Log, err)
+		return i.mattermostActionRespond(mattermostActionResponse{EphemeralText: mattermostErrorBadPayload}, rc)
+	}
+
+	state := payload.Context
+	if len(i.Config.GetEncryptionKey()) == 0 || !hmac.Equal([]byte(state.Signature), []byte(i.signMattermostContext(state))) {
+		logger.MaybeWarningf(i.Log, "rejecting mattermost action from %s: invalid context signature", webutil.GetRemoteAddr(rc.Request))
+		return &web.RawResult{
+			StatusCode:  http.StatusUnauthorized,
+			ContentType: slackContentTypeTextPlain,
+			Response:    []byte(mattermostErrorUnverified),
+		}
+	}
+	instance, err := i.Model.GetMattermostInstanceByUUID(rc.Context(), state.InstanceUUID)
+	if err != nil {
+		logger.MaybeFatal(i.Log, err)
+		return i.mattermostActionRespond(mattermostActionResponse{EphemeralText: slackErrorInternal}, rc)
+	}
+	if instance.IsZero() || !instance.IsEnabled {
+		return i.mattermostActionRespond(mattermostActionResponse{EphemeralText: mattermostErrorUnverified}, rc)
+	}
+	if state.ImageUUID == "" {
+		return i.mattermostActionRespond(mattermostActionResponse{EphemeralText: slackErrorInvalidCallbackState}, rc)
+	}
+
+	ci := mattermostIntegration{instance: instance}
+	args := payload.Arguments(state.Query)
+	switch state.Action {
+	case slackActionShuffle:
+		result, err := i.integrationShuffle(rc.Context(), ci, args, state.ImageUUID)
+		if err != nil {
+			logger.MaybeFatal(i.Log, err)
+			return i.mattermostActionRespond(mattermostActionResponse{EphemeralText: slackErrorInternal}, rc)
+		}
+		if result == nil {
+			return i.mattermostActionRespond(mattermostActionResponse{EphemeralText: i.slackErrorNoResults()}, rc)
+		}
+		output := viewmodel.NewImage(*result, i.Config)
+		return i.mattermostActionRespond(mattermostActionResponse{
+			Update: &mattermostPostUpdate{
+				Props: mattermostProps{Attachments: []mattermostAttachment{i.mattermostPrompt(instance, state.Query, state.ResponseURL, output)}},
+			},
+		}, rc)
+	case slackActionPost:
+		img, err := i.integrationPost(rc.Context(), ci, args, state.ImageUUID)
+		if err != nil {
+			logger.MaybeFatal(i.Log, err)
+			return i.mattermostActionRespond(mattermostActionResponse{EphemeralText: slackErrorInternal}, rc)
+		}
+		if img == nil {
+			return i.mattermostActionRespond(mattermostActionResponse{EphemeralText: i.slackErrorNoResults()}, rc)
+		}
+		// the prompt is ephemeral, so the result is posted through the slash command's response url.
+		// mattermost response urls take the same (slack style) messages as slash command responses.
+		if err := external.SlackRespond(rc.Context(), state.ResponseURL, i.mattermostPostedMessage(payload.UserName, viewmodel.NewImage(*img, i.Config))); err != nil {
+			logger.MaybeError(i.Log, err)
+			return i.mattermostActionRespond(mattermostActionResponse{EphemeralText: slackErrorInternal}, rc)
+		}
+		return i.mattermostActionRespond(mattermostActionResponse{
+			Update: &mattermostPostUpdate{Message: "Posted.", Props: mattermostProps{Attachments: []mattermostAttachment{}}},
+		}, rc)
+	case slackActionCancel:
+		i.recordInteractionForUUID(rc.Context(), ci, args, state.ImageUUID, model.SearchInteractionActionCancel)
+		return i.mattermostActionRespond(mattermostActionResponse{
+			Update: &mattermostPostUpdate{Message: "Cancelled.", Props: mattermostProps{Attachments: []mattermostAttachment{}}},
+		}, rc)
+	}
+	return i.mattermostActionRespond(mattermostActionResponse{EphemeralText: slackErrorInvalidAction}, rc)
+}
+
+// mattermostToken returns the slash command token from the `Authorization: Token <token>` header, falling back to the form body.
+func (i Integrations) mattermostToken(rc *web.Ctx) string {
+	if authorization := rc.Request.Header.Get(webutil.HeaderAuthorization); strings.HasPrefix(authorization, mattermostAuthorizationToken+" ") {
+		return strings.TrimSpace(strings.TrimPrefix(authorization, mattermostAuthorizationToken+" "))
+	}
+	return web.StringValue(rc.Param("token"))
+}
+
+// mattermostPrompt is the result attachment with the `Post`, `Shuffle` and `Cancel` integration actions.
+func (i Integrations) mattermostPrompt(instance *model.MattermostInstance, query, responseURL string, result viewmodel.Image) mattermostAttachment {
+	attachment := i.mattermostImageAttachment(result)
+	for _, action := range []struct{ ID, Name string }{
+		{slackActionPost, "Post"},
+		{slackActionShuffle, "Shuffle"},
+		{slackActionCancel, "Cancel"},
+	} {
+		state := mattermostActionContext{
+			Action:       action.ID,
+			Query:        query,
+			ImageUUID:    result.UUID,
+			InstanceUUID: instance.UUID,
+			ResponseURL:  responseURL,
+		}
+		state.Signature = i.signMattermostContext(state)
+		attachment.Actions = append(attachment.Actions, mattermostAction{
+			ID:   action.ID,
+			Name: action.Name,
+			Integration: mattermostActionIntegration{
+				URL:     i.Config.Web.BaseURL + "/integrations/mattermost.action",
+				Context: state,
+			},
+		})
+	}
+	return attachment
+}
+
+// mattermostPostedMessage is a result posted to the channel.
+func (i Integrations) mattermostPostedMessage(userName string, result viewmodel.Image) mattermostMessage {
+	res := mattermostMessage{
+		ResponseType: "in_channel",
+		Attachments:  []mattermostAttachment{i.mattermostImageAttachment(result)},
+	}
+	if userName != "" {
+		res.Text = fmt.Sprintf("posted by @%s", userName)
+	}
+	return res
+}
+
+func (i Integrations) mattermostImageAttachment(result viewmodel.Image) mattermostAttachment {
+	title := resultTitle(result)
+	return mattermostAttachment{
+		Fallback: title,
+		Title:    title,
+		ImageURL: result.S3ReadURL,
+	}
+}
+
+// signMattermostContext returns the signature for an action context, keyed by the encryption key.
+func (i Integrations) signMattermostContext(state mattermostActionContext) string {
+	message := strings.Join([]string{state.InstanceUUID, state.Action, state.ImageUUID, state.Query, state.ResponseURL}, "\n")
+	return hex.EncodeToString(crypto.HMAC256(i.Config.GetEncryptionKey(), []byte(message)))
+}
+
+func (i Integrations) mattermostRespond(res mattermostMessage, rc *web.Ctx) web.Result {
+	responseBytes, err := json.Marshal(res)
+	if err != nil {
+		logger.MaybeFatal(i.Log, err)
+		return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInternal))
+	}
+	return web.RawWithContentType(slackContentTypeJSON, responseBytes)
+}
+
+func (i Integrations) mattermostActionRespond(res mattermostActionResponse, rc *web.Ctx) web.Result {
+	responseBytes, err := json.Marshal(res)
+	if err != nil {
+		logger.MaybeFatal(i.Log, err)
+		return API(rc).InternalError(err)
+	}
+	return web.RawWithContentType(slackContentTypeJSON, responseBytes)
+}
+
+// --------------------------------------------------------------------------------
+// Mattermost Types
+// --------------------------------------------------------------------------------
+
+type mattermostMessage struct {
+	ResponseType string                 `json:"response_type"`
+	Text         string                 `json:"text,omitempty"`
+	Attachments  []mattermostAttachment `json:"attachments,omitempty"`
+}
+
+type mattermostAttachment struct {
+	Fallback string             `json:"fallback"`
+	Title    string             `json:"title,omitempty"`
+	ImageURL string             `json:"image_url"`
+	Actions  []mattermostAction `json:"actions,omitempty"`
+}
+
+type mattermostAction struct {
+	ID          string                      `json:"id"`
+	Name        string                      `json:"name"`
+	Integration mattermostActionIntegration `json:"integration"`
+}
+
+type mattermostActionIntegration struct {
+	URL     string                  `json:"url"`
+	Context mattermostActionContext `json:"context"`
+}
+
+// mattermostActionContext is round tripped through a button; mattermost sends it back with the action payload.
+type mattermostActionContext struct {
+	Action       string `json:"action"`
+	Query        string `json:"query"`
+	ImageUUID    string `json:"image_uuid"`
+	InstanceUUID string `json:"instance_uuid"`
+	ResponseURL  string `json:"response_url"`
+	Signature    string `json:"signature"`
+}
+
+type mattermostActionPayload struct {
+	UserID      string                  `json:"user_id"`
+	UserName    string                  `json:"user_name"`
+	ChannelID   string                  `json:"channel_id"`
+	ChannelName string                  `json:"channel_name"`
+	TeamID      string                  `json:"team_id"`
+	TeamDomain  string                  `json:"team_domain"`
+	PostID      string                  `json:"post_id"`
+	Context     mattermostActionContext `json:"context"`
+}
+
+// Arguments returns the integration arguments for an action on a result for a query.
+func (mp mattermostActionPayload) Arguments(query string) integrationArguments {
+	return integrationArguments{
+		TeamID:      mp.TeamID,
+		TeamName:    mp.TeamDomain,
+		ChannelID:   mp.ChannelID,
+		ChannelName: mp.ChannelName,
+		UserID:      mp.UserID,
+		UserName:    mp.UserName,
+		Query:       query,
+	}
+}
+
+type mattermostActionResponse struct {
+	Update        *mattermostPostUpdate `json:"update,omitempty"`
+	EphemeralText string                `json:"ephemeral_text,omitempty"`
+}
+
+type mattermostPostUpdate struct {
+	Message string          `json:"message"`
+	Props   mattermostProps `json:"props"`
+}
+
+type mattermostProps struct {
+	Attachments []mattermostAttachment `json:"attachments"`
+}
@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/logger"
+	"github.com/blend/go-sdk/r2"
+	"github.com/blend/go-sdk/testutil"
+	"github.com/blend/go-sdk/uuid"
+	"github.com/blend/go-sdk/web"
+
+	"github.com/wcharczuk/giffy/server/model"
+)
+
+func TestMattermost(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	cfg := testAPITokenConfig(assert)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	first, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	_, err = m.CreateTestTagForImageWithVote(todo, u.ID, first.ID, "__test")
+	assert.Nil(err)
+	second, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	_, err = m.CreateTestTagForImageWithVote(todo, u.ID, second.ID, "__test")
+	assert.Nil(err)
+
+	token := uuid.V4().String()
+	instance, err := model.NewMattermostInstance("test_instance", token, u.ID, cfg.GetEncryptionKey())
+	assert.Nil(err)
+	instance.ContentRatingFilter = model.ContentRatingFilterAll
+	assert.Nil(m.Invoke(todo).Create(instance))
+
+	responseURL, calls := testSlackAPI(assert)
+	defer responseURL.Close()
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Integrations{Model: &m, Config: cfg})
+
+	var prompt mattermostMessage
+	_, err = web.MockMethod(app, http.MethodPost, "/integrations/mattermost",
+		r2.OptHeaderValue("Authorization", "Token "+token),
+		r2.OptPostFormValue("team_id", uuid.V4().String()),
+		r2.OptPostFormValue("team_domain", "test_team"),
+		r2.OptPostFormValue("channel_id", uuid.V4().String()),
+		r2.OptPostFormValue("user_id", uuid.V4().String()),
+		r2.OptPostFormValue("user_name", "test_user"),
+		r2.OptPostFormValue("text", "__test"),
+		r2.OptPostFormValue("response_url", responseURL.URL),
+	).JSON(&prompt)
+	assert.Nil(err)
+	assert.Equal("ephemeral", prompt.ResponseType)
+	assert.Len(prompt.Attachments, 1)
+	assert.Len(prompt.Attachments[0].Actions, 3)
+	assert.Equal(cfg.Web.BaseURL+"/integrations/mattermost.action", prompt.Attachments[0].Actions[0].Integration.URL)
+
+	shuffle := prompt.Attachments[0].Actions[1].Integration.Context
+	assert.Equal(slackActionShuffle, shuffle.Action)
+	assert.Equal(responseURL.URL, shuffle.ResponseURL)
+
+	var shuffled mattermostActionResponse
+	_, err = web.MockMethod(app, http.MethodPost, "/integrations/mattermost.action",
+		r2.OptJSONBody(mattermostActionPayload{UserID: "U123", UserName: "test_user", Context: shuffle}),
+	).JSON(&shuffled)
+	assert.Nil(err)
+	assert.NotNil(shuffled.Update)
+	assert.Len(shuffled.Update.Props.Attachments, 1)
+	assert.NotEqual(shuffle.ImageUUID, shuffled.Update.Props.Attachments[0].Actions[0].Integration.Context.ImageUUID)
+
+	post := shuffled.Update.Props.Attachments[0].Actions[0].Integration.Context
+	assert.Equal(slackActionPost, post.Action)
+	var posted mattermostActionResponse
+	_, err = web.MockMethod(app, http.MethodPost, "/integrations/mattermost.action",
+		r2.OptJSONBody(mattermostActionPayload{UserID: "U123", UserName: "test_user", Context: post}),
+	).JSON(&posted)
+	assert.Nil(err)
+	assert.NotNil(posted.Update)
+	assert.Empty(posted.Update.Props.Attachments)
+	assert.Len(*calls, 1)
+	assert.Equal("in_channel", (*calls)[0].Body["response_type"])
+
+	// contexts can't be tampered with.
+	post.ImageUUID = first.UUID
+	if post.ImageUUID == shuffled.Update.Props.Attachments[0].Actions[0].Integration.Context.ImageUUID {
+		post.ImageUUID = second.UUID
+	}
+	_, meta, err := web.MockMethod(app, http.MethodPost, "/integrations/mattermost.action",
+		r2.OptJSONBody(mattermostActionPayload{UserID: "U123", UserName: "test_user", Context: post}),
+	).Bytes()
+	assert.Nil(err)
+	assert.Equal(http.StatusUnauthorized, meta.StatusCode)
+}
+
+func TestMattermostRejectsUnknownToken(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	cfg := testAPITokenConfig(assert)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	token := uuid.V4().String()
+	instance, err := model.NewMattermostInstance("test_instance", token, u.ID, cfg.GetEncryptionKey())
+	assert.Nil(err)
+	instance.IsEnabled = false
+	assert.Nil(m.Invoke(todo).Create(instance))
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Integrations{Model: &m, Config: cfg})
+
+	contents, res, err := web.MockMethod(app, http.MethodPost, "/integrations/mattermost",
+		r2.OptPostFormValue("token", uuid.V4().String()),
+		r2.OptPostFormValue("text", "__test"),
+	).Bytes()
+	assert.Nil(err)
+	assert.Equal(http.StatusUnauthorized, res.StatusCode)
+	assert.Equal(mattermostErrorUnverified, string(contents))
+
+	// disabled instances are rejected too.
+	_, res, err = web.MockMethod(app, http.MethodPost, "/integrations/mattermost",
+		r2.OptPostFormValue("token", token),
+		r2.OptPostFormValue("text", "__test"),
+	).Bytes()
+	assert.Nil(err)
+	assert.Equal(http.StatusUnauthorized, res.StatusCode)
+}
@@ -0,0 +1,349 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/blend/go-sdk/logger"
+	"github.com/blend/go-sdk/uuid"
+	"github.com/blend/go-sdk/web"
+
+	"github.com/wcharczuk/giffy/server/external"
+	"github.com/wcharczuk/giffy/server/model"
+	"github.com/wcharczuk/giffy/server/viewmodel"
+)
+
+const (
+	slackCommandHelp     = "help"
+	slackCommandTag      = "tag"
+	slackCommandUpvote   = "upvote"
+	slackCommandDownvote = "downvote"
+	slackCommandAdd      = "add"
+	slackCommandRandom   = "random"
+	slackCommandConfig   = "config"
+	slackCommandConnect  = "connect"
+
+	slackConfigRating = "rating"
+
+	slackCommandsHelp = "*Giffy commands*\n" +
+		"`/giffy <search>` finds a gif and lets you `Shuffle` or `Post` it.\n" +
+		"`/giffy random` finds a random gif.\n" +
+		"`/giffy tag <image uuid> <tag>` tags an image.\n" +
+		"`/giffy upvote` or `/giffy downvote` votes on the last gif posted in the channel.\n" +
+		"`/giffy add <url>` adds a gif from a url.\n" +
+		"`/giffy config rating [G|PG|PG-13|R]` shows or lowers the content rating for the channel.\n" +
+		"`/giffy connect` links your Slack account to your giffy account.\n" +
+		"`/giffy help` shows this message."
+	slackConfigUsage           = "Usage: `/giffy config rating [G|PG|PG-13|R]`"
+	slackErrorRatingTooHigh    = "Channels can only lower the content rating; the highest it can be set to here is `%s`."
+	slackErrorNotLinked        = "Your Slack account isn't linked to a giffy account yet; run `/giffy connect` to link it."
+	slackErrorBanned           = "Your giffy account has been banned."
+	slackErrorInvalidTag       = "Tags have to be in the form [a-z,A-Z,0-9]+."
+	slackErrorNoLastPost       = "Nothing has been posted to this channel yet."
+	slackErrorImageNotFound    = "That image doesn't exist."
+	slackErrorFetchingImage    = "There was a problem fetching that image: %v"
+	slackMessageImageExists    = "That image already exists: %s"
+	slackMessageImageSubmitted = "That image has already been submitted."
+	slackMessageImageAdding    = "Adding that image, I'll let you know when it's done."
+	slackMessageImageAdded     = "Added! %s"
+	slackMessageImagePending   = "Added! It'll show up in search once a moderator approves it."
+	slackMessageConnect        = "<%s|Connect your Slack account> to giffy. The link is good for %d minutes."
+)
+
+// slackCommand is a parsed `/giffy` subcommand.
+type slackCommand struct {
+	Name string
+	Args []string
+}
+
+// IsSearch returns if the command text is a search rather than a subcommand.
+func (sc slackCommand) IsSearch() bool {
+	return sc.Name == ""
+}
+
+// parseSlackCommand parses the text of a `/giffy` command.
+// Subcommands have to match their arguments exactly (i.e. `tag` needs an image uuid),
+// anything else is treated as a search and returns an empty name.
+func parseSlackCommand(text string) (command slackCommand) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return
+	}
+	name, args := strings.ToLower(fields[0]), fields[1:]
+	switch name {
+	case slackCommandHelp, slackCommandRandom, slackCommandUpvote, slackCommandDownvote, slackCommandConnect:
+		if len(args) != 0 {
+			return
+		}
+	case slackCommandTag:
+		if len(args) < 2 {
+			return
+		}
+		if _, err := uuid.Parse(args[0]); err != nil {
+			return
+		}
+	case slackCommandAdd:
+		if len(args) != 1 {
+			return
+		}
+		// slack escapes links as `<url>` or `<url|label>`.
+		link := strings.SplitN(strings.Trim(args[0], "<>"), "|", 2)[0]
+		if !strings.HasPrefix(link, "http://") && !strings.HasPrefix(link, "https://") {
+			return
+		}
+		args = []string{link}
+	case slackCommandConfig:
+	default:
+		return
+	}
+	return slackCommand{Name: name, Args: args}
+}
+
+// slackCommand runs a `/giffy` subcommand.
+func (i Integrations) slackCommand(command slackCommand, args integrationArguments, team *model.SlackTeam, rc *web.Ctx) web.Result {
+	switch command.Name {
+	case slackCommandHelp:
+		return i.slackEphemeral(slackCommandsHelp, rc)
+	case slackCommandRandom:
+		return i.slackRandom(args, team, rc)
+	case slackCommandConfig:
+		return i.slackConfig(args, team, command.Args, rc)
+	case slackCommandConnect:
+		return i.slackConnect(args, rc)
+	}
+
+	user, errRes := i.getSlackUser(args, rc)
+	if errRes != nil {
+		return errRes
+	}
+	switch command.Name {
+	case slackCommandTag:
+		return i.slackTag(user, command.Args[0], strings.Join(command.Args[1:], " "), rc)
+	case slackCommandUpvote:
+		return i.slackVote(user, args, true, rc)
+	case slackCommandDownvote:
+		return i.slackVote(user, args, false, rc)
+	case slackCommandAdd:
+		return i.slackAdd(user, args, command.Args[0], rc)
+	}
+	return i.slackEphemeral(slackCommandsHelp, rc)
+}
+
+// slackRandom shows a random image with the `Shuffle` and `Post` buttons.
+func (i Integrations) slackRandom(args integrationArguments, team *model.SlackTeam, rc *web.Ctx) web.Result {
+	contentRatingFilter, err := i.getContentRatingForChannel(rc.Context(), team, args.ChannelID)
+	if err != nil {
+		logger.MaybeFatal(i.Log, err)
+		return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInternal))
+	}
+	result, err := i.Model.GetRandomImageForContentRating(rc.Context(), contentRatingFilter, nil)
+	if err != nil {
+		logger.MaybeFatal(i.Log, err)
+		return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInternal))
+	}
+	if result.IsZero() {
+		return web.RawWithContentType(slackContentTypeTextPlain, []byte(i.slackErrorNoResults()))
+	}
+	// random prompts have an empty query, which shuffle treats as "another random image".
+	return i.renderResult(i.promptMessage(team.UseLegacyAttachments, "", slackCommandRandom, viewmodel.NewImage(*result, i.Config)), rc)
+}
+
+// slackTag tags an image as the linked giffy user.
+func (i Integrations) slackTag(user *model.User, imageUUID, tagValue string, rc *web.Ctx) web.Result {
+	tagValue = model.CleanTagValue(tagValue)
+	if len(tagValue) == 0 {
+		return i.slackEphemeral(slackErrorInvalidTag, rc)
+	}
+
+	image, err := i.Model.GetImageByUUID(rc.Context(), imageUUID)
+	if err != nil {
+		logger.MaybeFatal(i.Log, err)
+		return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInternal))
+	}
+	if image.IsZero() {
+		return i.slackEphemeral(slackErrorImageNotFound, rc)
+	}
+
+	tag, err := i.Model.GetTagByValue(rc.Context(), tagValue)
+	if err != nil {
+		logger.MaybeFatal(i.Log, err)
+		return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInternal))
+	}
+	if tag.IsZero() {
+		tag = model.NewTag(user.ID, tagValue)
+		if err = i.Model.Invoke(rc.Context()).Create(tag); err != nil {
+			logger.MaybeFatal(i.Log, err)
+			return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInternal))
+		}
+		logger.MaybeTrigger(rc.Context(), i.Log, model.NewModeration(user.ID, model.ModerationVerbCreate, model.ModerationObjectTag, tag.UUID))
+	}
+
+	didCreate, err := i.Model.CreateOrUpdateVote(rc.Context(), user.ID, image.ID, tag.ID, true)
+	if err != nil {
+		logger.MaybeFatal(i.Log, err)
+		return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInternal))
+	}
+	if didCreate {
+		logger.MaybeTrigger(rc.Context(), i.Log, model.NewModeration(user.ID, model.ModerationVerbCreate, model.ModerationObjectLink, image.UUID, tag.UUID))
+	}
+	return i.slackEphemeral(fmt.Sprintf("Tagged `%s` with `%s`.", image.UUID, tag.TagValue), rc)
+}
+
+// slackVote votes on the last image posted in the channel, for the tag it was posted for.
+func (i Integrations) slackVote(user *model.User, args integrationArguments, isUpvote bool, rc *web.Ctx) web.Result {
+	post, err := i.Model.GetLastSlackPost(rc.Context(), args.TeamID, args.ChannelID)
+	if err != nil {
+		logger.MaybeFatal(i.Log, err)
+		return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInternal))
+	}
+	if post.ImageID == nil {
+		return i.slackEphemeral(slackErrorNoLastPost, rc)
+	}
+
+	image, err := i.Model.GetImageByID(rc.Context(), *post.ImageID)
+	if err != nil {
+		logger.MaybeFatal(i.Log, err)
+		return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInternal))
+	}
+	if image.IsZero() {
+		return i.slackEphemeral(slackErrorImageNotFound, rc)
+	}
+
+	var tag *model.Tag
+	if post.TagID != nil {
+		tag, err = i.Model.GetTagByID(rc.Context(), *post.TagID)
+		if err != nil {
+			logger.MaybeFatal(i.Log, err)
+			return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInternal))
+		}
+	} else {
+		tag = i.matchingTag(post.SearchQuery, image.Tags)
+	}
+	if tag == nil || tag.IsZero() {
+		return i.slackEphemeral(slackErrorNoLastPost, rc)
+	}
+
+	didCreate, err := i.Model.CreateOrUpdateVote(rc.Context(), user.ID, image.ID, tag.ID, isUpvote)
+	if err != nil {
+		logger.MaybeFatal(i.Log, err)
+		return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInternal))
+	}
+	if didCreate {
+		logger.MaybeTrigger(rc.Context(), i.Log, model.NewModeration(user.ID, model.ModerationVerbCreate, model.ModerationObjectLink, image.UUID, tag.UUID))
+	}
+
+	verb := "Downvoted"
+	if isUpvote {
+		verb = "Upvoted"
+	}
+	return i.slackEphemeral(fmt.Sprintf("%s `%s` for the last gif posted here.", verb, tag.TagValue), rc)
+}
+
+// slackAdd adds an image from a url as the linked giffy user.
+// Fetching and processing the image takes longer than slack waits for a reply, so the command is answered
+// right away and the result is sent to the command's `response_url` once the image is added.
+func (i Integrations) slackAdd(user *model.User, args integrationArguments, imageURL string, rc *web.Ctx) web.Result {
+	i.background(func(ctx context.Context) {
+		message := slackMessage{ResponseType: "ephemeral", Text: i.slackAddImage(ctx, user, imageURL)}
+		if err := external.SlackRespond(ctx, args.ResponseURL, message); err != nil {
+			logger.MaybeError(i.Log, err)
+		}
+	})
+	return i.slackEphemeral(slackMessageImageAdding, rc)
+}
+
+// slackAddImage fetches and adds an image, returning the message to show the user.
+func (i Integrations) slackAddImage(ctx context.Context, user *model.User, imageURL string) string {
+	fileName, fileContents, err := UploadImage{Log: i.Log}.FetchImageFromURL(ctx, imageURL)
+	if err != nil {
+		return fmt.Sprintf(slackErrorFetchingImage, err)
+	}
+	return i.slackAddImageContents(ctx, user, fileName, fileContents)
+}
+
+// slackAddImageContents adds a fetched image, and returns the message to reply with.
+func (i Integrations) slackAddImageContents(ctx context.Context, user *model.User, fileName string, fileContents []byte) string {
+	perceptualHash := model.PerceptualHash(fileContents)
+	existing, err := GetExistingImage(ctx, i.Model, i.Config, fileContents, perceptualHash)
+	if err != nil {
+		logger.MaybeFatal(i.Log, err)
+		return slackErrorInternal
+	}
+	if !existing.IsZero() {
+		// only link images anyone can already find; pending and rejected images stay hidden.
+		if !existing.IsApproved() {
+			return slackMessageImageSubmitted
+		}
+		return fmt.Sprintf(slackMessageImageExists, i.imageURL(existing.UUID))
+	}
+
+	// uploads from regular users wait in the moderation queue before they show up in search.
+	reviewState := model.ImageReviewStatePending
+	if user.IsModerator {
+		reviewState = model.ImageReviewStateApproved
+	}
+	image, err := CreateImageFromFile(ctx, i.Model, user.ID, !user.IsAdmin, reviewState, fileContents, perceptualHash, fileName, i.Files)
+	if err != nil {
+		logger.MaybeFatal(i.Log, err)
+		return slackErrorInternal
+	}
+	logger.MaybeTrigger(ctx, i.Log, model.NewModeration(user.ID, model.ModerationVerbCreate, model.ModerationObjectImage, image.UUID))
+
+	if !image.IsApproved() {
+		return slackMessageImagePending
+	}
+	return fmt.Sprintf(slackMessageImageAdded, i.imageURL(image.UUID))
+}
+
+// slackConnect hands the slack user a link that connects their slack account to the giffy account they're logged in with.
+func (i Integrations) slackConnect(args integrationArguments, rc *web.Ctx) web.Result {
+	token, err := model.NewSlackConnectToken(args.TeamID, args.UserID, i.Config.GetEncryptionKey())
+	if err != nil {
+		logger.MaybeFatal(i.Log, err)
+		return web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInternal))
+	}
+	connectURL := fmt.Sprintf("%s/slack/connect/%s", strings.TrimSuffix(i.Config.Web.BaseURL, "/"), token)
+	return i.slackEphemeral(fmt.Sprintf(slackMessageConnect, connectURL, int(model.SlackConnectTokenTTL.Minutes())), rc)
+}
+
+// getLinkedUser returns the giffy user linked to a slack user, or nil if there isn't one (or they're banned).
+// It's used to attribute searches and posts, so lookup errors are logged rather than failing the request.
+func (i Integrations) getLinkedUser(ctx context.Context, teamID, slackUserID string) *model.User {
+	if teamID == "" || slackUserID == "" {
+		return nil
+	}
+	user, err := i.Model.GetUserForSlackIdentity(ctx, teamID, slackUserID)
+	if err != nil {
+		logger.MaybeError(i.Log, err)
+		return nil
+	}
+	if user.IsZero() || user.IsBanned {
+		return nil
+	}
+	return user
+}
+
+// getSlackUser returns the giffy user linked to the slack user running a command.
+func (i Integrations) getSlackUser(args integrationArguments, rc *web.Ctx) (*model.User, web.Result) {
+	user, err := i.Model.GetUserForSlackIdentity(rc.Context(), args.TeamID, args.UserID)
+	if err != nil {
+		logger.MaybeFatal(i.Log, err)
+		return nil, web.RawWithContentType(slackContentTypeTextPlain, []byte(slackErrorInternal))
+	}
+	if user.IsZero() {
+		return nil, i.slackEphemeral(slackErrorNotLinked, rc)
+	}
+	if user.IsBanned {
+		return nil, i.slackEphemeral(slackErrorBanned, rc)
+	}
+	return user, nil
+}
+
+func (i Integrations) slackEphemeral(text string, rc *web.Ctx) web.Result {
+	return i.renderResult(slackMessage{ResponseType: "ephemeral", Text: text}, rc)
+}
+
+func (i Integrations) imageURL(imageUUID string) string {
+	return fmt.Sprintf("%s/image/%s", strings.TrimSuffix(i.Config.Web.BaseURL, "/"), imageUUID)
+}
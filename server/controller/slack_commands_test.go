@@ -0,0 +1,367 @@
+package controller
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/logger"
+	"github.com/blend/go-sdk/testutil"
+	"github.com/blend/go-sdk/uuid"
+	"github.com/blend/go-sdk/web"
+
+	"github.com/wcharczuk/giffy/server/model"
+)
+
+func TestParseSlackCommand(t *testing.T) {
+	assert := assert.New(t)
+
+	imageUUID := uuid.V4().String()
+	for text, expected := range map[string]slackCommand{
+		"help":                       {Name: slackCommandHelp, Args: []string{}},
+		"RANDOM":                     {Name: slackCommandRandom, Args: []string{}},
+		"upvote":                     {Name: slackCommandUpvote, Args: []string{}},
+		"downvote":                   {Name: slackCommandDownvote, Args: []string{}},
+		"tag " + imageUUID + " cat":  {Name: slackCommandTag, Args: []string{imageUUID, "cat"}},
+		"add <https://x.com/a.gif>":  {Name: slackCommandAdd, Args: []string{"https://x.com/a.gif"}},
+		"add <http://x.com/a.gif|a>": {Name: slackCommandAdd, Args: []string{"http://x.com/a.gif"}},
+		"config rating PG":           {Name: slackCommandConfig, Args: []string{"rating", "PG"}},
+		"help me":                    {},
+		"random cat":                 {},
+		"tag cat dog":                {},
+		"tag " + imageUUID:           {},
+		"add a cat":                  {},
+		"add ftp://x.com/a.gif":      {},
+		"dancing cat":                {},
+		"":                           {},
+	} {
+		actual := parseSlackCommand(text)
+		assert.Equal(expected.Name, actual.Name, text)
+		assert.Equal(expected.IsSearch(), actual.IsSearch(), text)
+		if !expected.IsSearch() {
+			assert.Equal(expected.Args, actual.Args, text)
+		}
+	}
+}
+
+func testSlackSlash(a *assert.Assertions, app *web.App, teamID, channelID, userID, text string) (*slackMessage, string) {
+	contents, _, err := web.MockMethod(app, http.MethodPost, "/integrations/slack",
+		testSlackForm(url.Values{
+			"team_id":    {teamID},
+			"channel_id": {channelID},
+			"user_id":    {userID},
+			"text":       {text},
+		})...,
+	).Bytes()
+	a.Nil(err)
+	var res slackMessage
+	if json.Unmarshal(contents, &res) != nil {
+		return nil, string(contents)
+	}
+	return &res, string(contents)
+}
+
+func TestSlackCommandHelp(t *testing.T) {
+	assert := assert.New(t)
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Integrations{Model: &m, Config: testSlackConfig(assert)})
+
+	res, _ := testSlackSlash(assert, app, uuid.V4().String(), "C123", "U123", "help")
+	assert.NotNil(res)
+	assert.Equal("ephemeral", res.ResponseType)
+	assert.Equal(slackCommandsHelp, res.Text)
+}
+
+func TestSlackCommandRequiresLinkedUser(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	i, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Integrations{Model: &m, Config: testSlackConfig(assert)})
+
+	res, _ := testSlackSlash(assert, app, uuid.V4().String(), "C123", "U123", "tag "+i.UUID+" __test_not_linked")
+	assert.NotNil(res)
+	assert.Equal(slackErrorNotLinked, res.Text)
+
+	tag, err := m.GetTagByValue(todo, "__test_not_linked")
+	assert.Nil(err)
+	assert.True(tag.IsZero())
+}
+
+func TestSlackCommandTag(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	i, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+
+	teamID := uuid.V4().String()
+	assert.Nil(m.Invoke(todo).Create(model.NewSlackIdentity(teamID, "U123", u.ID)))
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Integrations{Model: &m, Config: testSlackConfig(assert)})
+
+	res, _ := testSlackSlash(assert, app, teamID, "C123", "U123", "tag "+i.UUID+" __test_slack_tag")
+	assert.NotNil(res)
+	assert.Equal("ephemeral", res.ResponseType)
+	assert.Contains(res.Text, "__test_slack_tag")
+
+	tag, err := m.GetTagByValue(todo, "__test_slack_tag")
+	assert.Nil(err)
+	assert.False(tag.IsZero())
+	assert.Equal(u.ID, tag.CreatedBy)
+
+	vote, err := m.GetVote(todo, u.ID, i.ID, tag.ID)
+	assert.Nil(err)
+	assert.False(vote.IsZero())
+	assert.True(vote.IsUpvote)
+}
+
+func TestSlackCommandVote(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	voter, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	i, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	tag, err := m.CreateTestTagForImageWithVote(todo, u.ID, i.ID, "__test_slack_vote")
+	assert.Nil(err)
+
+	teamID := uuid.V4().String()
+	assert.Nil(m.Invoke(todo).Create(model.NewSlackIdentity(teamID, "U123", voter.ID)))
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Integrations{Model: &m, Config: testSlackConfig(assert)})
+
+	res, _ := testSlackSlash(assert, app, teamID, "C123", "U123", "downvote")
+	assert.NotNil(res)
+	assert.Equal(slackErrorNoLastPost, res.Text)
+
+	post := model.NewSearchHistoryDetailed("slack", teamID, "test_team", "C123", "random", "U456", "test_user", "__test_slack_vote", true, &i.ID, &tag.ID)
+	post.IsPost = true
+	assert.Nil(m.Invoke(todo).Create(post))
+
+	res, _ = testSlackSlash(assert, app, teamID, "C123", "U123", "downvote")
+	assert.NotNil(res)
+	assert.Contains(res.Text, "Downvoted")
+
+	vote, err := m.GetVote(todo, voter.ID, i.ID, tag.ID)
+	assert.Nil(err)
+	assert.False(vote.IsZero())
+	assert.False(vote.IsUpvote)
+}
+
+func TestSlackCommandRandom(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	_, err = m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+
+	team := model.NewSlackTeam(uuid.V4().String(), "test_team", uuid.V4().String(), "test_user")
+	team.ContentRatingFilter = model.ContentRatingNR
+	assert.Nil(m.Invoke(todo).Create(team))
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Integrations{Model: &m, Config: testSlackConfig(assert)})
+
+	res, _ := testSlackSlash(assert, app, team.TeamID, "C123", "U123", "random")
+	assert.NotNil(res)
+	assert.NotEmpty(res.Blocks)
+}
+
+func TestSlackCommandConnect(t *testing.T) {
+	assert := assert.New(t)
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+	cfg := testSlackConfig(assert)
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Integrations{Model: &m, Config: cfg})
+
+	teamID := uuid.V4().String()
+	res, _ := testSlackSlash(assert, app, teamID, "C123", "U123", "connect")
+	assert.NotNil(res)
+	assert.Equal("ephemeral", res.ResponseType)
+	assert.Contains(res.Text, "/slack/connect/")
+
+	token := strings.SplitN(strings.SplitN(res.Text, "/slack/connect/", 2)[1], "|", 2)[0]
+	parsedTeamID, slackUserID, err := model.ParseSlackConnectToken(token, cfg.GetEncryptionKey())
+	assert.Nil(err)
+	assert.Equal(teamID, parsedTeamID)
+	assert.Equal("U123", slackUserID)
+}
+
+func TestSlackPostImplicitUpvote(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	responseURL, _ := testSlackAPI(assert)
+	defer responseURL.Close()
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	poster, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	i, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	tag, err := m.CreateTestTagForImageWithVote(todo, u.ID, i.ID, "__test_implicit_upvote")
+	assert.Nil(err)
+
+	teamID := uuid.V4().String()
+	assert.Nil(m.Invoke(todo).Create(model.NewSlackIdentity(teamID, "U123", poster.ID)))
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	integrations := Integrations{Model: &m, Config: testSlackConfig(assert)}
+	app.Register(integrations)
+
+	payload := slackActionPayload{
+		Type:        slackPayloadBlockActions,
+		Team:        slackIdentifier{ID: teamID, Domain: "test_team"},
+		Channel:     slackIdentifier{ID: "C123", Name: "random"},
+		User:        slackIdentifier{ID: "U123", Name: "test_user"},
+		ResponseURL: responseURL.URL + "/response",
+		Actions: []slackPayloadAction{
+			{ActionID: slackActionPost, Value: integrations.createButtonValue("__test_implicit_upvote", i.UUID)},
+		},
+	}
+	_, res, err := web.MockMethod(app, http.MethodPost, "/integrations/slack.action",
+		testSlackForm(url.Values{"payload": {toJSON(payload)}})...,
+	).Bytes()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	vote, err := m.GetVote(todo, poster.ID, i.ID, tag.ID)
+	assert.Nil(err)
+	assert.False(vote.IsZero())
+	assert.True(vote.IsUpvote)
+}
+
+func TestSlackCommandAdd(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	// run the import inline so its response can be checked.
+	defer testInlineBackground()()
+
+	responseURL, calls := testSlackAPI(assert)
+	defer responseURL.Close()
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	teamID := uuid.V4().String()
+	assert.Nil(m.Invoke(todo).Create(model.NewSlackIdentity(teamID, "U123", u.ID)))
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Integrations{Model: &m, Config: testSlackConfig(assert)})
+
+	contents, _, err := web.MockMethod(app, http.MethodPost, "/integrations/slack",
+		testSlackForm(url.Values{
+			"team_id":      {teamID},
+			"channel_id":   {"C123"},
+			"user_id":      {"U123"},
+			"text":         {"add <http://127.0.0.1:1/image.gif>"},
+			"response_url": {responseURL.URL + "/response"},
+		})...,
+	).Bytes()
+	assert.Nil(err)
+	var res slackMessage
+	assert.Nil(json.Unmarshal(contents, &res))
+	assert.Equal("ephemeral", res.ResponseType)
+	assert.Equal(slackMessageImageAdding, res.Text)
+
+	// the result goes to the response url; internal addresses aren't fetched, so it's an error.
+	assert.Len(*calls, 1)
+	assert.Equal("response", (*calls)[0].Method)
+	assert.Equal("ephemeral", (*calls)[0].Body["response_type"])
+	assert.Contains(fmt.Sprint((*calls)[0].Body["text"]), "There was a problem fetching that image")
+}
+
+func TestSlackAddImageExisting(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	contents, err := ioutil.ReadFile("server/controller/testdata/image.gif")
+	assert.Nil(err)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	existing, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	_, err = m.Invoke(todo).Exec(`update image set md5 = $2 where id = $1`, existing.ID, model.ConvertMD5(md5.Sum(contents)))
+	assert.Nil(err)
+
+	i := Integrations{Model: &m, Config: testSlackConfig(assert)}
+
+	// pending and rejected images aren't linked, so they can't be found by adding them again.
+	for _, reviewState := range []string{model.ImageReviewStatePending, model.ImageReviewStateRejected} {
+		assert.Nil(m.UpdateImageReviewState(todo, existing.ID, reviewState))
+		message := i.slackAddImageContents(todo, u, "image.gif", contents)
+		assert.Equal(slackMessageImageSubmitted, message)
+		assert.NotContains(message, existing.UUID)
+	}
+
+	assert.Nil(m.UpdateImageReviewState(todo, existing.ID, model.ImageReviewStateApproved))
+	assert.Equal(fmt.Sprintf(slackMessageImageExists, i.imageURL(existing.UUID)), i.slackAddImageContents(todo, u, "image.gif", contents))
+}
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	exception "github.com/blend/go-sdk/ex"
+	"github.com/blend/go-sdk/logger"
+	"github.com/blend/go-sdk/web"
+	"github.com/blend/go-sdk/webutil"
+
+	"github.com/wcharczuk/giffy/server/config"
+	"github.com/wcharczuk/giffy/server/external"
+)
+
+const (
+	slackErrorUnverified = "This request could not be verified as coming from Slack."
+)
+
+// SlackVerified returns a middleware that rejects requests that aren't signed by slack.
+//
+// Requests with an `X-Slack-Signature` are checked against the signing secret. Requests
+// without one fall back to the legacy verification token if it is configured.
+// If neither is configured, every request is rejected.
+func SlackVerified(cfg *config.Giffy, log logger.Log) web.Middleware {
+	return func(action web.Action) web.Action {
+		return func(rc *web.Ctx) web.Result {
+			if err := VerifySlackRequest(cfg, rc, time.Now().UTC()); err != nil {
+				logger.MaybeWarningf(log, "rejecting slack request to %s from %s: %v", rc.Request.URL.Path, webutil.GetRemoteAddr(rc.Request), err)
+				return &web.RawResult{
+					StatusCode:  http.StatusUnauthorized,
+					ContentType: slackContentTypeTextPlain,
+					Response:    []byte(slackErrorUnverified),
+				}
+			}
+			return action(rc)
+		}
+	}
+}
+
+// VerifySlackRequest verifies a request came from slack.
+// It buffers the request body so it can still be read by the action.
+func VerifySlackRequest(cfg *config.Giffy, rc *web.Ctx, now time.Time) error {
+	if cfg.SlackSigningSecret == "" && cfg.SlackVerificationToken == "" {
+		return exception.New(external.ErrSlackSignatureMissing, exception.OptMessage("neither the slack signing secret nor the verification token is configured"))
+	}
+
+	body, err := rc.PostBody()
+	if err != nil {
+		return err
+	}
+	// reset the body so form parsing still works downstream.
+	rc.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	signature := rc.Request.Header.Get(external.SlackHeaderSignature)
+	if cfg.SlackSigningSecret != "" && signature != "" {
+		return external.VerifySlackSignature(cfg.SlackSigningSecret, rc.Request.Header.Get(external.SlackHeaderTimestamp), signature, body, now)
+	}
+	if cfg.SlackVerificationToken != "" {
+		return external.VerifySlackToken(cfg.SlackVerificationToken, rc.Request.Header.Get(webutil.HeaderContentType), body)
+	}
+	return exception.New(external.ErrSlackSignatureMissing)
+}
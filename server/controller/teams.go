@@ -0,0 +1,211 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+
+	exception "github.com/blend/go-sdk/ex"
+	"github.com/blend/go-sdk/logger"
+	"github.com/blend/go-sdk/web"
+	"github.com/blend/go-sdk/webutil"
+
+	"github.com/wcharczuk/giffy/server/config"
+	"github.com/wcharczuk/giffy/server/external"
+	"github.com/wcharczuk/giffy/server/model"
+	"github.com/wcharczuk/giffy/server/viewmodel"
+)
+
+const (
+	teamsContentTypeJSON = "application/json; charset=utf-8"
+	teamsErrorUnverified = "This request could not be verified as coming from Microsoft Teams."
+	teamsErrorBadPayload = "There was an error processing a payload from teams. Saddness."
+
+	teamsActivityMessage = "message"
+	teamsContentTypeHero = "application/vnd.microsoft.card.hero"
+)
+
+var (
+	teamsMentionExpr = regexp.MustCompile(`<at>[^<]*</at>`)
+	teamsMarkupExpr  = regexp.MustCompile(`<[^>]+>`)
+)
+
+// teamsIntegration is the chat integration for a teams outgoing webhook.
+// An outgoing webhook belongs to a single team, so every search uses the configured content rating.
+type teamsIntegration struct {
+	cfg *config.Giffy
+}
+
+// Source implements chatIntegration.
+func (ti teamsIntegration) Source() string { return "teams" }
+
+// ContentRating implements chatIntegration.
+func (ti teamsIntegration) ContentRating(_ context.Context, _, _ string) (int, error) {
+	return model.ParseContentRating(ti.cfg.TeamsContentRating)
+}
+
+// TeamsVerified returns a middleware that rejects requests that aren't signed with the outgoing webhook's security token.
+// Requests are rejected if the security token isn't configured.
+func TeamsVerified(cfg *config.Giffy, log logger.Log) web.Middleware {
+	return func(action web.Action) web.Action {
+		return func(rc *web.Ctx) web.Result {
+			if err := VerifyTeamsRequest(cfg, rc); err != nil {
+				logger.MaybeWarningf(log, "rejecting teams request to %s from %s: %v", rc.Request.URL.Path, webutil.GetRemoteAddr(rc.Request), err)
+				return &web.RawResult{
+					StatusCode:  http.StatusUnauthorized,
+					ContentType: slackContentTypeTextPlain,
+					Response:    []byte(teamsErrorUnverified),
+				}
+			}
+			return action(rc)
+		}
+	}
+}
+
+// VerifyTeamsRequest verifies a request came from a teams outgoing webhook.
+// It buffers the request body so it can still be read by the action.
+func VerifyTeamsRequest(cfg *config.Giffy, rc *web.Ctx) error {
+	if cfg.TeamsWebhookSecret == "" {
+		return exception.New(external.ErrTeamsSecretInvalid, exception.OptMessage("the teams webhook secret is not configured"))
+	}
+	body, err := rc.PostBody()
+	if err != nil {
+		return err
+	}
+	rc.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return external.VerifyTeamsSignature(cfg.TeamsWebhookSecret, rc.Request.Header.Get(webutil.HeaderAuthorization), body)
+}
+
+// teams handles "@giffy <query>" from a teams outgoing webhook, replying in the channel with the best result.
+// Outgoing webhooks can't receive card actions, so there isn't a prompt to shuffle or cancel.
+func (i Integrations) teams(rc *web.Ctx) web.Result {
+	var activity teamsActivity
+	if err := rc.PostBodyAsJSON(&activity); err != nil {
+		logger.MaybeError(i.Log, err)
+		return i.teamsRespond(teamsMessage(teamsErrorBadPayload), rc)
+	}
+
+	query := activity.Query()
+	if len(query) < 3 {
+		return i.teamsRespond(teamsMessage(slackErrorInvalidQuery), rc)
+	}
+
+	result, err := i.integrationSearch(rc.Context(), teamsIntegration{cfg: i.Config}, activity.Arguments(query))
+	if err != nil {
+		logger.MaybeFatal(i.Log, err)
+		return i.teamsRespond(teamsMessage(slackErrorInternal), rc)
+	}
+	if result == nil {
+		return i.teamsRespond(teamsMessage(i.slackErrorNoResults()), rc)
+	}
+
+	output := viewmodel.NewImage(*result, i.Config)
+	return i.teamsRespond(teamsActivity{
+		Type: teamsActivityMessage,
+		Attachments: []teamsAttachment{
+			{
+				ContentType: teamsContentTypeHero,
+				Content: teamsHeroCard{
+					Title:  resultTitle(output),
+					Images: []teamsCardImage{{URL: output.S3ReadURL, Alt: resultTitle(output)}},
+				},
+			},
+		},
+	}, rc)
+}
+
+func (i Integrations) teamsRespond(res teamsActivity, rc *web.Ctx) web.Result {
+	responseBytes, err := json.Marshal(res)
+	if err != nil {
+		logger.MaybeFatal(i.Log, err)
+		return API(rc).InternalError(err)
+	}
+	return web.RawWithContentType(teamsContentTypeJSON, responseBytes)
+}
+
+// teamsMessage is a text reply to an outgoing webhook.
+func teamsMessage(text string) teamsActivity {
+	return teamsActivity{Type: teamsActivityMessage, Text: text}
+}
+
+// --------------------------------------------------------------------------------
+// Teams Types
+// --------------------------------------------------------------------------------
+
+type teamsActivity struct {
+	Type         string            `json:"type"`
+	ID           string            `json:"id,omitempty"`
+	Text         string            `json:"text,omitempty"`
+	From         *teamsIdentifier  `json:"from,omitempty"`
+	Conversation *teamsIdentifier  `json:"conversation,omitempty"`
+	ChannelData  *teamsChannelData `json:"channelData,omitempty"`
+	Attachments  []teamsAttachment `json:"attachments,omitempty"`
+}
+
+// Query returns the message text without the mention of the webhook (or any other markup).
+func (ta teamsActivity) Query() string {
+	text := teamsMentionExpr.ReplaceAllString(ta.Text, "")
+	text = teamsMarkupExpr.ReplaceAllString(text, "")
+	return strings.TrimSpace(html.UnescapeString(text))
+}
+
+// Arguments returns the integration arguments for a search for a query.
+// Activities identify the team and channel in the channel data, falling back to the tenant and conversation.
+func (ta teamsActivity) Arguments(query string) integrationArguments {
+	args := integrationArguments{Query: query}
+	if ta.From != nil {
+		args.UserID = ta.From.ID
+		args.UserName = ta.From.Name
+	}
+	if ta.Conversation != nil {
+		args.ChannelID = ta.Conversation.ID
+		args.ChannelName = ta.Conversation.Name
+	}
+	if ta.ChannelData != nil {
+		if ta.ChannelData.Team != nil {
+			args.TeamID = ta.ChannelData.Team.ID
+			args.TeamName = ta.ChannelData.Team.Name
+		} else if ta.ChannelData.Tenant != nil {
+			args.TeamID = ta.ChannelData.Tenant.ID
+		}
+		if ta.ChannelData.Channel != nil {
+			args.ChannelID = ta.ChannelData.Channel.ID
+			if ta.ChannelData.Channel.Name != "" {
+				args.ChannelName = ta.ChannelData.Channel.Name
+			}
+		}
+	}
+	return args
+}
+
+type teamsIdentifier struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+type teamsChannelData struct {
+	Tenant  *teamsIdentifier `json:"tenant"`
+	Team    *teamsIdentifier `json:"team"`
+	Channel *teamsIdentifier `json:"channel"`
+}
+
+type teamsAttachment struct {
+	ContentType string        `json:"contentType"`
+	Content     teamsHeroCard `json:"content"`
+}
+
+type teamsHeroCard struct {
+	Title  string           `json:"title,omitempty"`
+	Text   string           `json:"text,omitempty"`
+	Images []teamsCardImage `json:"images,omitempty"`
+}
+
+type teamsCardImage struct {
+	URL string `json:"url"`
+	Alt string `json:"alt,omitempty"`
+}
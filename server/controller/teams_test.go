@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/logger"
+	"github.com/blend/go-sdk/r2"
+	"github.com/blend/go-sdk/testutil"
+	"github.com/blend/go-sdk/uuid"
+	"github.com/blend/go-sdk/web"
+
+	"github.com/wcharczuk/giffy/server/config"
+	"github.com/wcharczuk/giffy/server/external"
+	"github.com/wcharczuk/giffy/server/model"
+)
+
+func testTeamsActivity(text string) teamsActivity {
+	return teamsActivity{
+		Type:         teamsActivityMessage,
+		Text:         text,
+		From:         &teamsIdentifier{ID: "29:" + uuid.V4().String(), Name: "Test User"},
+		Conversation: &teamsIdentifier{ID: "19:" + uuid.V4().String()},
+		ChannelData: &teamsChannelData{
+			Tenant:  &teamsIdentifier{ID: uuid.V4().String()},
+			Team:    &teamsIdentifier{ID: "19:" + uuid.V4().String()},
+			Channel: &teamsIdentifier{ID: "19:" + uuid.V4().String()},
+		},
+	}
+}
+
+func TestTeams(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	i, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	_, err = m.CreateTestTagForImageWithVote(todo, u.ID, i.ID, "__test")
+	assert.Nil(err)
+
+	cfg := config.MustNewFromEnv()
+	cfg.TeamsWebhookSecret = base64.StdEncoding.EncodeToString([]byte("test_webhook_secret"))
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Integrations{Model: &m, Config: cfg})
+
+	body, err := json.Marshal(testTeamsActivity("<at>Giffy</at> __test\n"))
+	assert.Nil(err)
+	authorization, err := external.TeamsSignature(cfg.TeamsWebhookSecret, body)
+	assert.Nil(err)
+
+	var res teamsActivity
+	meta, err := web.MockMethod(app, http.MethodPost, "/integrations/teams",
+		r2.OptBodyBytes(body),
+		r2.OptHeaderValue("Authorization", authorization),
+	).JSON(&res)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, meta.StatusCode)
+	assert.Equal(teamsActivityMessage, res.Type)
+	assert.Len(res.Attachments, 1)
+	assert.Equal(teamsContentTypeHero, res.Attachments[0].ContentType)
+	assert.Len(res.Attachments[0].Content.Images, 1)
+
+	// the signature covers the body.
+	_, meta, err = web.MockMethod(app, http.MethodPost, "/integrations/teams",
+		r2.OptBodyBytes([]byte(`{"type":"message","text":"<at>Giffy</at> something else"}`)),
+		r2.OptHeaderValue("Authorization", authorization),
+	).Bytes()
+	assert.Nil(err)
+	assert.Equal(http.StatusUnauthorized, meta.StatusCode)
+}
+
+func TestTeamsRejectsUnsigned(t *testing.T) {
+	assert := assert.New(t)
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	app := web.MustNew()
+	app.Log = logger.None()
+	app.Register(Integrations{Model: &m, Config: config.MustNewFromEnv()})
+
+	contents, res, err := web.MockMethod(app, http.MethodPost, "/integrations/teams", r2.OptJSONBody(testTeamsActivity("<at>Giffy</at> __test"))).Bytes()
+	assert.Nil(err)
+	assert.Equal(http.StatusUnauthorized, res.StatusCode)
+	assert.Equal(teamsErrorUnverified, string(contents))
+}
+
+func TestTeamsActivityQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("cats & dogs", teamsActivity{Text: "<at>Giffy</at> cats &amp; dogs\n"}.Query())
+	assert.Equal("cats", teamsActivity{Text: "<at>Giffy</at>&nbsp;<p>cats</p>"}.Query())
+	assert.Empty(teamsActivity{Text: "<at>Giffy</at>"}.Query())
+
+	activity := testTeamsActivity("cats")
+	args := activity.Arguments("cats")
+	assert.Equal(activity.ChannelData.Team.ID, args.TeamID)
+	assert.Equal(activity.ChannelData.Channel.ID, args.ChannelID)
+	assert.Equal(activity.From.ID, args.UserID)
+	assert.Equal("Test User", args.UserName)
+
+	activity.ChannelData.Team = nil
+	assert.Equal(activity.ChannelData.Tenant.ID, activity.Arguments("cats").TeamID)
+}
@@ -6,16 +6,16 @@ import (
 	"crypto/md5"
 	"fmt"
 	"net/http"
-	"net/url"
-	"path"
+	"strconv"
+	"strings"
 
 	exception "github.com/blend/go-sdk/ex"
 	"github.com/blend/go-sdk/logger"
-	"github.com/blend/go-sdk/r2"
 	"github.com/blend/go-sdk/web"
 	"github.com/blend/go-sdk/webutil"
 
 	"github.com/wcharczuk/giffy/server/config"
+	"github.com/wcharczuk/giffy/server/external"
 	"github.com/wcharczuk/giffy/server/filemanager"
 	"github.com/wcharczuk/giffy/server/model"
 )
@@ -70,7 +70,7 @@ func (ic UploadImage) uploadImageCompleteAction(r *web.Ctx) web.Result {
 		fileName = files[0].FileName
 		fileContents = files[0].Contents
 	} else if imageURL, _ := r.Param("image_url"); imageURL != "" {
-		fileName, fileContents, fileErr = ic.FetchImageFromURL(imageURL)
+		fileName, fileContents, fileErr = ic.FetchImageFromURL(r.Context(), imageURL)
 		if fileErr != nil {
 			return r.Views.BadRequest(fileErr)
 		}
@@ -78,9 +78,13 @@ func (ic UploadImage) uploadImageCompleteAction(r *web.Ctx) web.Result {
 	if len(fileContents) == 0 {
 		return r.Views.BadRequest(fmt.Errorf("no files posted"))
 	}
+	metadata, err := ReadImageUploadMetadata(r.Request)
+	if err != nil {
+		return r.Views.BadRequest(err)
+	}
 
-	md5sum := model.ConvertMD5(md5.Sum(fileContents))
-	existing, err := ic.Model.GetImageByMD5(r.Context(), md5sum)
+	perceptualHash := model.PerceptualHash(fileContents)
+	existing, err := GetExistingImage(r.Context(), ic.Model, ic.Config, fileContents, perceptualHash)
 	if err != nil {
 		return r.Views.InternalError(err)
 	}
@@ -89,53 +93,124 @@ func (ic UploadImage) uploadImageCompleteAction(r *web.Ctx) web.Result {
 		return r.Views.View("upload_image_complete", existing)
 	}
 
-	image, err := CreateImageFromFile(r.Context(), ic.Model, sessionUser.ID, !sessionUser.IsAdmin, fileContents, fileName, ic.Files)
+	image, err := CreateImageFromFileWithMetadata(r.Context(), ic.Model, sessionUser.ID, !sessionUser.IsAdmin, model.ImageReviewStateApproved, fileContents, perceptualHash, fileName, metadata, ic.Files)
 	if err != nil {
 		return r.Views.InternalError(err)
 	}
 	if image == nil {
-		return r.Views.InternalError(exception.New("image returned from `createImageFromFile` was unset"))
+		return r.Views.InternalError(exception.New("image returned from `createImageFromFileWithMetadata` was unset"))
 	}
-
-	logger.MaybeTrigger(r.Context(), ic.Log, model.NewModeration(sessionUser.ID, model.ModerationVerbCreate, model.ModerationObjectImage, image.UUID))
 	return r.Views.View("upload_image_complete", image)
 }
 
-func (ic UploadImage) FetchImageFromURL(imageURL string) (fileName string, fileContents []byte, err error) {
-	refURL, parseErr := url.Parse(imageURL)
-	if parseErr != nil {
-		err = fmt.Errorf("`image_url` was malformed")
-		return
+// FetchImageFromURL fetches an image to upload from a user supplied url.
+// Private and internal destinations are refused, and the image has to be a supported type under the max image size.
+func (ic UploadImage) FetchImageFromURL(ctx context.Context, imageURL string) (fileName string, fileContents []byte, err error) {
+	return external.NewImageFetcher(ic.Log, model.MaxImageSize).Fetch(ctx, imageURL)
+}
+
+// GetExistingImage returns an image that is an exact (by md5) or near (by perceptual hash) duplicate of the file contents.
+// The perceptual hash is nil if the contents couldn't be hashed. The returned image will be zero if there is no duplicate.
+func GetExistingImage(ctx context.Context, mgr *model.Manager, cfg *config.Giffy, fileContents []byte, perceptualHash *int64) (*model.Image, error) {
+	existing, err := mgr.GetImageByMD5(ctx, model.ConvertMD5(md5.Sum(fileContents)))
+	if err != nil {
+		return nil, err
+	}
+	if !existing.IsZero() {
+		return existing, nil
 	}
+	if perceptualHash == nil {
+		return existing, nil
+	}
+	return mgr.GetSimilarImage(ctx, *perceptualHash, cfg.SimilarImageDistance)
+}
 
-	contents, res, reqErr := r2.New(refURL.String(),
-		r2.OptLog(ic.Log),
-		r2.OptHeaderValue("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/48.0.2564.116 Safari/537.36"),
-		r2.OptHeaderValue("Cache-Control", "no-cache"),
-	).Bytes()
-	if reqErr != nil {
-		err = fmt.Errorf("error fetching remote image: %+v", reqErr)
-		return
+// CreateImageFromFile creates and uploads a new image.
+func CreateImageFromFile(ctx context.Context, mgr *model.Manager, userID int64, shouldValidate bool, reviewState string, fileContents []byte, perceptualHash *int64, fileName string, fm *filemanager.FileManager) (*model.Image, error) {
+	newImage, err := UploadImageFile(ctx, mgr, userID, shouldValidate, reviewState, fileContents, perceptualHash, fileName, fm)
+	if err != nil {
+		return nil, err
 	}
-	if res.StatusCode != http.StatusOK {
-		err = fmt.Errorf("non 200 returned from `image_url`")
-		return
+	err = mgr.Invoke(ctx).Create(newImage)
+	if err != nil {
+		return nil, err
+	}
+	return newImage, nil
+}
+
+// CreateImageFromFileWithMetadata uploads a new image and saves it, along with the uploader's votes for the posted tags,
+// in a single transaction. The moderation entry for the upload is written with the image, so callers shouldn't trigger one.
+func CreateImageFromFileWithMetadata(ctx context.Context, mgr *model.Manager, userID int64, shouldValidate bool, reviewState string, fileContents []byte, perceptualHash *int64, fileName string, metadata ImageUploadMetadata, fm *filemanager.FileManager) (*model.Image, error) {
+	newImage, err := UploadImageFile(ctx, mgr, userID, shouldValidate, reviewState, fileContents, perceptualHash, fileName, fm)
+	if err != nil {
+		return nil, err
+	}
+	if metadata.ContentRating > 0 {
+		newImage.ContentRating = metadata.ContentRating
+	}
+	if err = mgr.CreateImageWithTags(ctx, newImage, metadata.Tags); err != nil {
+		return nil, err
 	}
-	if len(contents) == 0 {
-		err = fmt.Errorf("empty response returned from `image_url`")
+	return newImage, nil
+}
+
+// ImageUploadMetadata are the optional fields that can be posted along with an image.
+type ImageUploadMetadata struct {
+	// Tags are the cleaned `tags[]` values.
+	Tags []string
+	// ContentRating is the `content_rating`, or zero to leave the image's default.
+	ContentRating int
+}
+
+// ReadImageUploadMetadata reads the `tags[]` and `content_rating` fields posted along with an image.
+// Tags can also be posted as a comma separated `tags` field (which is what the upload form does).
+// The content rating can be either a name (i.e. `PG-13`) or its value.
+func ReadImageUploadMetadata(req *http.Request) (metadata ImageUploadMetadata, err error) {
+	if err = req.ParseMultipartForm(webutil.DefaultPostedFilesMaxMemory); err != nil && err != http.ErrNotMultipart {
+		err = fmt.Errorf("problem reading posted form: %v", err)
 		return
 	}
-	fileName = path.Base(refURL.Path)
-	fileContents = contents
+	err = nil
+
+	seen := map[string]bool{}
+	values := req.Form["tags[]"]
+	for _, value := range req.Form["tags"] {
+		values = append(values, strings.Split(value, ",")...)
+	}
+	for _, value := range values {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		tagValue := model.CleanTagValue(value)
+		if len(tagValue) == 0 {
+			err = fmt.Errorf("`tags[]` should be in the form [a-z,A-Z,0-9]+")
+			return
+		}
+		if !seen[tagValue] {
+			seen[tagValue] = true
+			metadata.Tags = append(metadata.Tags, tagValue)
+		}
+	}
+
+	if value := strings.TrimSpace(req.Form.Get("content_rating")); value != "" {
+		if contentRating, parseErr := strconv.Atoi(value); parseErr == nil && model.IsValidContentRating(contentRating) {
+			metadata.ContentRating = contentRating
+		} else if metadata.ContentRating, err = model.ParseContentRating(value); err != nil {
+			err = fmt.Errorf("`content_rating` is invalid: %s", value)
+			return
+		}
+	}
 	return
 }
 
-// CreateImageFromFile creates and uploads a new image.
-func CreateImageFromFile(ctx context.Context, mgr *model.Manager, userID int64, shouldValidate bool, fileContents []byte, fileName string, fm *filemanager.FileManager) (*model.Image, error) {
-	newImage, err := model.NewImageFromPostedFile(userID, shouldValidate, fileContents, fileName)
+// UploadImageFile uploads a new image (and its derivatives) to storage.
+// The returned image hasn't been saved yet, so callers can fill in more of it first.
+func UploadImageFile(ctx context.Context, mgr *model.Manager, userID int64, shouldValidate bool, reviewState string, fileContents []byte, perceptualHash *int64, fileName string, fm *filemanager.FileManager) (*model.Image, error) {
+	newImage, err := model.NewImageFromPostedFile(userID, shouldValidate, fileContents, perceptualHash, fileName)
 	if err != nil {
 		return nil, err
 	}
+	newImage.ReviewState = reviewState
 
 	buf := bytes.NewBuffer(fileContents)
 	remoteEntry, err := fm.UploadFile(buf, filemanager.FileType{Extension: newImage.Extension, MimeType: http.DetectContentType(fileContents)})
@@ -146,10 +221,19 @@ func CreateImageFromFile(ctx context.Context, mgr *model.Manager, userID int64,
 	newImage.S3Bucket = remoteEntry.Bucket
 	newImage.S3Key = remoteEntry.Key
 
-	err = mgr.Invoke(ctx).Create(newImage)
-	if err != nil {
-		return nil, err
+	// derivatives are best effort; the `generate_image_derivatives` job will pick up any that fail here.
+	derivatives, derivativesErr := fm.UploadDerivatives(fileContents)
+	if derivativesErr == nil {
+		newImage.PosterS3Key = derivatives.Poster.Key
+		newImage.ThumbnailS3Key = derivatives.Thumbnail.Key
+	} else if derivatives != nil && derivatives.Poster != nil {
+		if err = mgr.QueueFileDeletion(ctx, derivatives.Poster.Bucket, derivatives.Poster.Key); err != nil {
+			return nil, err
+		}
+	}
+	// so is the video rendition of a gif; the image just keeps playing as a gif without one.
+	if video, videoErr := fm.UploadVideo(ctx, fileContents); videoErr == nil && video != nil {
+		newImage.VideoS3Key = video.Key
 	}
-
 	return newImage, nil
 }
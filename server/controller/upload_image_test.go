@@ -1,8 +1,11 @@
 package controller
 
 import (
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 
@@ -13,10 +16,11 @@ import (
 	"github.com/blend/go-sdk/uuid"
 	"github.com/blend/go-sdk/web"
 	"github.com/blend/go-sdk/webutil"
-	"github.com/wcharczuk/giffy/server/awsutil"
 	"github.com/wcharczuk/giffy/server/config"
 	"github.com/wcharczuk/giffy/server/filemanager"
 	"github.com/wcharczuk/giffy/server/model"
+	"github.com/wcharczuk/giffy/server/transcode"
+	"github.com/wcharczuk/giffy/server/viewmodel"
 )
 
 func TestUploadImageByPostedFile(t *testing.T) {
@@ -27,9 +31,7 @@ func TestUploadImageByPostedFile(t *testing.T) {
 	defer tx.Rollback()
 	m := model.NewTestManager(tx)
 
-	fm := filemanager.New(uuid.V4().String(), awsutil.Config{})
-	fm.Mock()
-	defer fm.ReleaseMock()
+	fm := filemanager.NewWithStorage(uuid.V4().String(), filemanager.NewMemoryStorage())
 
 	auth, session := MockAuth(assert, &m, MockAdminLogin)
 	defer MockLogout(assert, &m, auth, session)
@@ -74,4 +76,130 @@ func TestUploadImageByPostedFile(t *testing.T) {
 	assert.Equal(275, imagesByUser[0].Width)
 	assert.Equal(364, imagesByUser[0].Height)
 	assert.NotEmpty(imagesByUser[0].MD5)
+	assert.NotEmpty(imagesByUser[0].PosterS3Key)
+	assert.NotEmpty(imagesByUser[0].ThumbnailS3Key)
+}
+
+func TestCreateImageFromFileTranscodes(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+
+	contents, err := ioutil.ReadFile("server/controller/testdata/image.gif")
+	assert.Nil(err)
+
+	storage := filemanager.NewMemoryStorage()
+	worker := &transcode.Fake{Output: []byte("not really a video")}
+	fm := filemanager.NewWithStorage(uuid.V4().String(), storage).WithTranscoder(worker, transcode.FormatMP4)
+
+	image, err := CreateImageFromFile(todo, &m, u.ID, false, model.ImageReviewStateApproved, contents, model.PerceptualHash(contents), "image.gif", fm)
+	assert.Nil(err)
+	assert.Len(worker.Calls, 1)
+	assert.True(strings.HasSuffix(image.VideoS3Key, ".mp4"))
+
+	// original, poster, thumbnail and video.
+	assert.Equal(4, storage.Len())
+
+	stored, err := m.GetImageByUUID(todo, image.UUID)
+	assert.Nil(err)
+	assert.Equal(image.VideoS3Key, stored.VideoS3Key)
+
+	output := viewmodel.NewImage(*stored, config.MustNewFromEnv())
+	assert.NotEmpty(output.VideoURL)
+	assert.Equal(transcode.FormatMP4.MimeType, output.VideoMimeType)
+
+	// a failed encode doesn't fail the upload.
+	worker.Err = fmt.Errorf("encoder failed")
+	image, err = CreateImageFromFile(todo, &m, u.ID, false, model.ImageReviewStateApproved, append(contents, 0), nil, "image.gif", fm)
+	assert.Nil(err)
+	assert.Empty(image.VideoS3Key)
+}
+
+func TestReadImageUploadMetadata(t *testing.T) {
+	assert := assert.New(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/images", strings.NewReader(url.Values{
+		"tags[]":         {"Cats", "dogs", "cats"},
+		"tags":           {"funny, reaction"},
+		"content_rating": {"pg-13"},
+	}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	metadata, err := ReadImageUploadMetadata(req)
+	assert.Nil(err)
+	assert.Equal([]string{"cats", "dogs", "funny", "reaction"}, metadata.Tags)
+	assert.Equal(model.ContentRatingPG13, metadata.ContentRating)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/images", strings.NewReader(url.Values{"content_rating": {"1"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	metadata, err = ReadImageUploadMetadata(req)
+	assert.Nil(err)
+	assert.Empty(metadata.Tags)
+	assert.Equal(model.ContentRatingG, metadata.ContentRating)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/images", strings.NewReader(url.Values{"content_rating": {"nc-17"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = ReadImageUploadMetadata(req)
+	assert.NotNil(err)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/images", strings.NewReader(url.Values{"tags[]": {"!!!"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = ReadImageUploadMetadata(req)
+	assert.NotNil(err)
+}
+
+func TestAPICreateImageWithTags(t *testing.T) {
+	assert := assert.New(t)
+	todo := testCtx()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+
+	auth, session := MockAuth(assert, &m, MockModeratorLogin)
+	defer MockLogout(assert, &m, auth, session)
+
+	fm := filemanager.NewWithStorage(uuid.V4().String(), filemanager.NewMemoryStorage())
+	app := web.MustNew()
+	app.Auth = *auth
+	app.Register(APIs{Model: &m, Config: config.MustNewFromEnv(), Files: fm})
+
+	contents, err := ioutil.ReadFile("server/controller/testdata/image.gif")
+	assert.Nil(err)
+
+	tagValue := "__test_upload_" + uuid.V4().String()
+	var res struct {
+		Meta     *APIResponseMeta
+		Response model.Image
+	}
+	meta, err := web.MockMethod(app, http.MethodPost, "/api/images",
+		r2.OptCookieValue(auth.CookieDefaults.Name, session.SessionID),
+		r2.OptPostForm(url.Values{
+			"tags[]":         {tagValue, tagValue},
+			"content_rating": {"PG"},
+		}),
+		r2.OptPostedFiles(webutil.PostedFile{Key: "image", FileName: "image.gif", Contents: contents}),
+	).JSON(&res)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, meta.StatusCode)
+	assert.Len(res.Response.Tags, 1)
+
+	image, err := m.GetImageByUUID(todo, res.Response.UUID)
+	assert.Nil(err)
+	assert.Equal(model.ContentRatingPG, image.ContentRating)
+
+	tags, err := m.GetTagsForImageID(todo, image.ID)
+	assert.Nil(err)
+	assert.Len(tags, 1)
+	assert.Equal(tagValue, tags[0].TagValue)
+
+	moderation, err := m.GetModerationForUserID(todo, parseInt64(session.UserID))
+	assert.Nil(err)
+	assert.Len(moderation, 1)
+	assert.Equal(model.ModerationObjectImage, moderation[0].Object)
 }
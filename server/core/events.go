@@ -7,6 +7,9 @@ var (
 	// FlagModeration denotes an event.
 	FlagModeration string = "giffy.moderation"
 
+	// FlagSearchInteraction denotes an event.
+	FlagSearchInteraction string = "giffy.search.interaction"
+
 	// FlagVote denotes an event.
 	FlagVote string = "giffy.vote"
 )
@@ -0,0 +1,45 @@
+package external
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+
+	exception "github.com/blend/go-sdk/ex"
+)
+
+const (
+	// DiscordHeaderSignature is the header discord sets the (hex encoded) ed25519 request signature on.
+	DiscordHeaderSignature = "X-Signature-Ed25519"
+	// DiscordHeaderTimestamp is the header discord sets the request timestamp on.
+	DiscordHeaderTimestamp = "X-Signature-Timestamp"
+)
+
+const (
+	// ErrDiscordPublicKeyInvalid is returned when the application public key isn't a hex encoded ed25519 key.
+	ErrDiscordPublicKeyInvalid exception.Class = "discord public key is invalid"
+	// ErrDiscordSignatureMissing is returned when a request is missing the signature or timestamp.
+	ErrDiscordSignatureMissing exception.Class = "discord request is unsigned"
+	// ErrDiscordSignatureInvalid is returned when a request signature doesn't match the body.
+	ErrDiscordSignatureInvalid exception.Class = "discord request signature is invalid"
+)
+
+// VerifyDiscordSignature verifies an interaction request was signed by the application's key.
+// Discord signs the timestamp followed by the raw request body.
+func VerifyDiscordSignature(publicKey, timestamp, signature string, body []byte) error {
+	key, err := hex.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return exception.New(ErrDiscordPublicKeyInvalid)
+	}
+	if signature == "" || timestamp == "" {
+		return exception.New(ErrDiscordSignatureMissing)
+	}
+	sig, err := hex.DecodeString(signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return exception.New(ErrDiscordSignatureInvalid)
+	}
+	message := append([]byte(timestamp), body...)
+	if !ed25519.Verify(ed25519.PublicKey(key), message, sig) {
+		return exception.New(ErrDiscordSignatureInvalid)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package external
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	exception "github.com/blend/go-sdk/ex"
+)
+
+func TestVerifyDiscordSignature(t *testing.T) {
+	assert := assert.New(t)
+
+	public, private, err := ed25519.GenerateKey(nil)
+	assert.Nil(err)
+	publicKey := hex.EncodeToString(public)
+
+	timestamp := "1577934245"
+	body := []byte(`{"type":1}`)
+	signature := hex.EncodeToString(ed25519.Sign(private, append([]byte(timestamp), body...)))
+
+	assert.Nil(VerifyDiscordSignature(publicKey, timestamp, signature, body))
+
+	assert.True(exception.Is(VerifyDiscordSignature(publicKey, timestamp, signature, []byte(`{"type":2}`)), ErrDiscordSignatureInvalid))
+	assert.True(exception.Is(VerifyDiscordSignature(publicKey, "1577934246", signature, body), ErrDiscordSignatureInvalid))
+	assert.True(exception.Is(VerifyDiscordSignature(publicKey, timestamp, "not hex", body), ErrDiscordSignatureInvalid))
+	assert.True(exception.Is(VerifyDiscordSignature(publicKey, timestamp, "", body), ErrDiscordSignatureMissing))
+	assert.True(exception.Is(VerifyDiscordSignature(publicKey, "", signature, body), ErrDiscordSignatureMissing))
+
+	other, _, err := ed25519.GenerateKey(nil)
+	assert.Nil(err)
+	assert.True(exception.Is(VerifyDiscordSignature(hex.EncodeToString(other), timestamp, signature, body), ErrDiscordSignatureInvalid))
+	assert.True(exception.Is(VerifyDiscordSignature("", timestamp, signature, body), ErrDiscordPublicKeyInvalid))
+}
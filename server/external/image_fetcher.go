@@ -0,0 +1,244 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/blend/go-sdk/ex"
+	"github.com/blend/go-sdk/logger"
+	"github.com/blend/go-sdk/r2"
+)
+
+const (
+	// ErrImageFetchURL is returned when the url to fetch is malformed or isn't http(s).
+	ErrImageFetchURL ex.Class = "invalid remote image url"
+	// ErrImageFetchDestination is returned when the url (or a redirect) resolves to a private, loopback or link-local address.
+	ErrImageFetchDestination ex.Class = "remote image destination not allowed"
+	// ErrImageFetchTimeout is returned when the remote image isn't fetched within the timeout.
+	ErrImageFetchTimeout ex.Class = "remote image fetch timed out"
+	// ErrImageFetchStatus is returned when the remote server responds with a non 200.
+	ErrImageFetchStatus ex.Class = "remote image fetch failed"
+	// ErrImageFetchTooLarge is returned when the remote image is larger than the limit.
+	ErrImageFetchTooLarge ex.Class = "remote image too large"
+	// ErrImageFetchContentType is returned when the remote image isn't a supported image type.
+	ErrImageFetchContentType ex.Class = "remote image type not supported"
+)
+
+const (
+	// DefaultImageFetchTimeout is the default time allowed to fetch a remote image, including reading the body.
+	DefaultImageFetchTimeout = 30 * time.Second
+	// DefaultImageFetchMaxRedirects is the default number of redirects followed.
+	DefaultImageFetchMaxRedirects = 5
+	// ImageFetchUserAgent is the user agent remote images are fetched with.
+	ImageFetchUserAgent = "Mozilla/5.0 (compatible; giffy)"
+)
+
+// ImageFetchContentTypes are the image types that can be fetched, and the extension for each.
+var ImageFetchContentTypes = map[string]string{
+	"image/gif":  ".gif",
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+}
+
+// blockedNetworks are the non-public ranges not covered by the `net.IP` helpers.
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",      // "this" network
+	"10.0.0.0/8",     // private
+	"100.64.0.0/10",  // carrier grade nat
+	"172.16.0.0/12",  // private
+	"192.0.0.0/24",   // ietf protocol assignments
+	"192.168.0.0/16", // private
+	"198.18.0.0/15",  // benchmarking
+	"240.0.0.0/4",    // reserved
+	"64:ff9b::/96",   // nat64, which can embed any of the above
+	"fc00::/7",       // unique local
+	"fec0::/10",      // site local (deprecated)
+	"2001:db8::/32",  // documentation
+)
+
+// IsPublicIP returns if an ip is a public unicast address, i.e. not private, loopback, link-local or multicast.
+func IsPublicIP(ip net.IP) bool {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	if ip.IsUnspecified() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	if ip.Equal(net.IPv4bcast) {
+		return false
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewImageFetcher returns a new image fetcher with the default timeout and redirect limit.
+func NewImageFetcher(log logger.Log, maxBytes int64) *ImageFetcher {
+	return &ImageFetcher{
+		Log:          log,
+		MaxBytes:     maxBytes,
+		Timeout:      DefaultImageFetchTimeout,
+		MaxRedirects: DefaultImageFetchMaxRedirects,
+		IsAllowedIP:  IsPublicIP,
+	}
+}
+
+// ImageFetcher fetches images from user supplied urls.
+//
+// The address is checked when each connection is dialed, after dns resolution, so neither a hostname that
+// resolves to an internal address nor a redirect to one gets a connection. Proxies from the environment are ignored
+// for the same reason.
+type ImageFetcher struct {
+	Log logger.Log
+	// MaxBytes is the largest response body read.
+	MaxBytes int64
+	// Timeout covers the whole fetch, including redirects and reading the body.
+	Timeout time.Duration
+	// MaxRedirects is the number of redirects followed.
+	MaxRedirects int
+	// IsAllowedIP returns if a connection can be made to an address; it's `IsPublicIP` by default.
+	IsAllowedIP func(net.IP) bool
+}
+
+// Fetch fetches an image, returning a file name for it (with an extension matching its type) and its contents.
+func (f ImageFetcher) Fetch(ctx context.Context, imageURL string) (fileName string, contents []byte, err error) {
+	refURL, err := url.Parse(strings.TrimSpace(imageURL))
+	if err != nil || refURL.Host == "" || (refURL.Scheme != "http" && refURL.Scheme != "https") {
+		err = ex.New(ErrImageFetchURL, ex.OptMessagef("url: %s", imageURL))
+		return
+	}
+
+	res, err := r2.New(refURL.String(),
+		r2.OptContext(ctx),
+		r2.OptLog(f.Log),
+		r2.OptClient(f.client()),
+		r2.OptHeaderValue("User-Agent", ImageFetchUserAgent),
+		r2.OptHeaderValue("Cache-Control", "no-cache"),
+	).Do()
+	if err != nil {
+		err = f.requestError(err)
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		err = ex.New(ErrImageFetchStatus, ex.OptMessagef("status: %d", res.StatusCode))
+		return
+	}
+	if res.ContentLength > f.MaxBytes {
+		err = ex.New(ErrImageFetchTooLarge, ex.OptMessagef("content length: %d", res.ContentLength))
+		return
+	}
+	contentType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if contentType == "image/jpg" || contentType == "image/pjpeg" {
+		contentType = "image/jpeg"
+	}
+	extension, ok := ImageFetchContentTypes[contentType]
+	if !ok {
+		err = ex.New(ErrImageFetchContentType, ex.OptMessagef("content type: %s", res.Header.Get("Content-Type")))
+		return
+	}
+
+	contents, err = ioutil.ReadAll(io.LimitReader(res.Body, f.MaxBytes+1))
+	if err != nil {
+		err = f.requestError(err)
+		return
+	}
+	if int64(len(contents)) > f.MaxBytes {
+		err = ex.New(ErrImageFetchTooLarge, ex.OptMessagef("read more than %d bytes", f.MaxBytes))
+		return
+	}
+	if sniffed := http.DetectContentType(contents); sniffed != contentType {
+		err = ex.New(ErrImageFetchContentType, ex.OptMessagef("content type: %s, but the contents are: %s", contentType, sniffed))
+		return
+	}
+
+	fileName = path.Base(res.Request.URL.Path)
+	if fileName == "/" || fileName == "." {
+		fileName = "image"
+	}
+	if !strings.EqualFold(path.Ext(fileName), extension) && !(extension == ".jpg" && strings.EqualFold(path.Ext(fileName), ".jpeg")) {
+		fileName = fileName + extension
+	}
+	return
+}
+
+// client returns an http client that refuses to connect to disallowed addresses.
+func (f ImageFetcher) client() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: f.Timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return ex.New(ErrImageFetchDestination, ex.OptMessagef("address: %s", address))
+			}
+			if ip := net.ParseIP(host); ip == nil || !f.isAllowedIP(ip) {
+				return ex.New(ErrImageFetchDestination, ex.OptMessagef("address: %s", host))
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: f.Timeout,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: f.Timeout,
+			DisableKeepAlives:   true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= f.MaxRedirects {
+				return ex.New(ErrImageFetchStatus, ex.OptMessagef("more than %d redirects", f.MaxRedirects))
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return ex.New(ErrImageFetchURL, ex.OptMessagef("redirect url: %s", req.URL.String()))
+			}
+			return nil
+		},
+	}
+}
+
+func (f ImageFetcher) isAllowedIP(ip net.IP) bool {
+	if f.IsAllowedIP != nil {
+		return f.IsAllowedIP(ip)
+	}
+	return IsPublicIP(ip)
+}
+
+// requestError returns the fetcher error a failed request wraps, if any, and otherwise classifies it.
+func (f ImageFetcher) requestError(err error) error {
+	var typed *ex.Ex
+	if errors.As(err, &typed) {
+		return typed
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ex.New(ErrImageFetchTimeout, ex.OptMessagef("timeout: %v", f.Timeout))
+	}
+	return ex.New(ErrImageFetchStatus, ex.OptMessagef("%v", err))
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
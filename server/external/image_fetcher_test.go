@@ -0,0 +1,230 @@
+package external
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/blend/go-sdk/assert"
+	exception "github.com/blend/go-sdk/ex"
+)
+
+var testGIF = append([]byte("GIF89a"), bytes.Repeat([]byte{0}, 64)...)
+
+// testImageFetcher returns a fetcher that can reach the local test servers, but nothing else that isn't public.
+func testImageFetcher(maxBytes int64) *ImageFetcher {
+	fetcher := NewImageFetcher(nil, maxBytes)
+	fetcher.IsAllowedIP = func(ip net.IP) bool {
+		return ip.IsLoopback() || IsPublicIP(ip)
+	}
+	return fetcher
+}
+
+func testImageServer(contentType string, contents []byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", contentType)
+		rw.Write(contents)
+	}))
+}
+
+func TestIsPublicIP(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, public := range []string{"8.8.8.8", "151.101.1.69", "2606:4700::6810:84e5"} {
+		assert.True(IsPublicIP(net.ParseIP(public)), public)
+	}
+	for _, internal := range []string{
+		"127.0.0.1",
+		"10.1.2.3",
+		"172.16.0.1",
+		"192.168.1.1",
+		"169.254.169.254",
+		"100.64.0.1",
+		"0.0.0.0",
+		"255.255.255.255",
+		"224.0.0.1",
+		"::1",
+		"::",
+		"fe80::1",
+		"fd00::1",
+		"::ffff:127.0.0.1",
+		"::ffff:169.254.169.254",
+		"64:ff9b::a9fe:a9fe",
+	} {
+		assert.False(IsPublicIP(net.ParseIP(internal)), internal)
+	}
+}
+
+func TestImageFetcherFetch(t *testing.T) {
+	assert := assert.New(t)
+
+	server := testImageServer("image/gif", testGIF)
+	defer server.Close()
+
+	fileName, contents, err := testImageFetcher(1024).Fetch(context.TODO(), server.URL+"/images/foo.gif?size=large")
+	assert.Nil(err)
+	assert.Equal("foo.gif", fileName)
+	assert.Equal(testGIF, contents)
+
+	// the extension comes from the type when the url doesn't have one.
+	fileName, _, err = testImageFetcher(1024).Fetch(context.TODO(), server.URL+"/images/foo")
+	assert.Nil(err)
+	assert.Equal("foo.gif", fileName)
+}
+
+func TestImageFetcherFetchInvalidURL(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, imageURL := range []string{"", "not a url", "file:///etc/passwd", "ftp://example.com/foo.gif", "http:///foo.gif"} {
+		_, _, err := testImageFetcher(1024).Fetch(context.TODO(), imageURL)
+		assert.True(exception.Is(err, ErrImageFetchURL), imageURL)
+	}
+}
+
+func TestImageFetcherFetchLoopback(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests++
+		rw.Header().Set("Content-Type", "image/gif")
+		rw.Write(testGIF)
+	}))
+	defer server.Close()
+
+	_, _, err := NewImageFetcher(nil, 1024).Fetch(context.TODO(), server.URL+"/foo.gif")
+	assert.True(exception.Is(err, ErrImageFetchDestination), err)
+	assert.Zero(requests)
+}
+
+func TestImageFetcherFetchResolvesToLoopback(t *testing.T) {
+	assert := assert.New(t)
+
+	server := testImageServer("image/gif", testGIF)
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	assert.Nil(err)
+
+	// the check is on the address that's dialed, so a name that resolves to an internal address is refused too.
+	_, _, err = NewImageFetcher(nil, 1024).Fetch(context.TODO(), "http://localhost:"+serverURL.Port()+"/foo.gif")
+	assert.True(exception.Is(err, ErrImageFetchDestination), err)
+}
+
+func TestImageFetcherFetchRedirectToLinkLocal(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		http.Redirect(rw, req, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer server.Close()
+
+	_, _, err := testImageFetcher(1024).Fetch(context.TODO(), server.URL+"/foo.gif")
+	assert.True(exception.Is(err, ErrImageFetchDestination), err)
+}
+
+func TestImageFetcherFetchTooManyRedirects(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		http.Redirect(rw, req, req.URL.Path+"x", http.StatusFound)
+	}))
+	defer server.Close()
+
+	_, _, err := testImageFetcher(1024).Fetch(context.TODO(), server.URL+"/foo.gif")
+	assert.True(exception.Is(err, ErrImageFetchStatus), err)
+}
+
+func TestImageFetcherFetchStatus(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		http.NotFound(rw, req)
+	}))
+	defer server.Close()
+
+	_, _, err := testImageFetcher(1024).Fetch(context.TODO(), server.URL+"/foo.gif")
+	assert.True(exception.Is(err, ErrImageFetchStatus), err)
+}
+
+func TestImageFetcherFetchContentLengthTooLarge(t *testing.T) {
+	assert := assert.New(t)
+
+	server := testImageServer("image/gif", append(testGIF, make([]byte, 1024)...))
+	defer server.Close()
+
+	_, _, err := testImageFetcher(1024).Fetch(context.TODO(), server.URL+"/foo.gif")
+	assert.True(exception.Is(err, ErrImageFetchTooLarge), err)
+}
+
+func TestImageFetcherFetchStreamTooLarge(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		// flushing before the body is done means there's no content length, so the limit is enforced as it's read.
+		rw.Header().Set("Content-Type", "image/gif")
+		rw.Write(testGIF)
+		rw.(http.Flusher).Flush()
+		for x := 0; x < 1024; x++ {
+			if _, err := rw.Write(make([]byte, 1024)); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	_, _, err := testImageFetcher(1024).Fetch(context.TODO(), server.URL+"/foo.gif")
+	assert.True(exception.Is(err, ErrImageFetchTooLarge), err)
+}
+
+func TestImageFetcherFetchTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		select {
+		case <-release:
+		case <-req.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	fetcher := testImageFetcher(1024)
+	fetcher.Timeout = 50 * time.Millisecond
+	_, _, err := fetcher.Fetch(context.TODO(), server.URL+"/foo.gif")
+	assert.True(exception.Is(err, ErrImageFetchTimeout), err)
+}
+
+func TestImageFetcherFetchContentType(t *testing.T) {
+	assert := assert.New(t)
+
+	server := testImageServer("text/html; charset=utf-8", []byte("<html><body>not a gif</body></html>"))
+	defer server.Close()
+
+	_, _, err := testImageFetcher(1024).Fetch(context.TODO(), server.URL+"/foo.gif")
+	assert.True(exception.Is(err, ErrImageFetchContentType), err)
+}
+
+func TestImageFetcherFetchMagicBytes(t *testing.T) {
+	assert := assert.New(t)
+
+	// the header says gif, but the contents aren't.
+	server := testImageServer("image/gif", []byte("<html><body>not a gif</body></html>"))
+	defer server.Close()
+
+	_, _, err := testImageFetcher(1024).Fetch(context.TODO(), server.URL+"/foo.gif")
+	assert.True(exception.Is(err, ErrImageFetchContentType), err)
+
+	// or they're a different image type than the header says.
+	png := testImageServer("image/gif", append([]byte("\x89PNG\x0D\x0A\x1A\x0A"), make([]byte, 64)...))
+	defer png.Close()
+
+	_, _, err = testImageFetcher(1024).Fetch(context.TODO(), png.URL+"/foo.gif")
+	assert.True(exception.Is(err, ErrImageFetchContentType), err)
+}
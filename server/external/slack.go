@@ -15,11 +15,37 @@ type SlackOAuthResponse struct {
 	Error string `json:"error"`
 
 	AccessToken string `json:"access_token"`
-	Scope       string `json:"scopes"`
+	Scope       string `json:"scope"`
 
 	UserID   string `json:"user_id"`
 	TeamID   string `json:"team_id"`
 	TeamName string `json:"team_name"`
+
+	Bot SlackOAuthBot `json:"bot"`
+}
+
+// BotToken returns the bot access token if one was issued, otherwise the access token.
+func (sor SlackOAuthResponse) BotToken() string {
+	if sor.Bot.BotAccessToken != "" {
+		return sor.Bot.BotAccessToken
+	}
+	return sor.AccessToken
+}
+
+// Scopes returns the granted scopes.
+func (sor SlackOAuthResponse) Scopes() (scopes []string) {
+	for _, scope := range strings.Split(sor.Scope, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return
+}
+
+// SlackOAuthBot is the bot user details returned by the oauth process.
+type SlackOAuthBot struct {
+	BotUserID      string `json:"bot_user_id"`
+	BotAccessToken string `json:"bot_access_token"`
 }
 
 // SlackProfile is the response from the auth.test service.
@@ -37,6 +63,9 @@ var defaultScopes = []string{
 	"chat:write.public",
 	"chat:write.customize",
 	"chat:write",
+	"links:read",
+	"links:write",
+	"app_mentions:read",
 }
 
 // SlackAuthURL is the url to start the OAuth 2.0 process with slack.
@@ -60,7 +89,7 @@ func SlackAuthReturnURL(cfg *config.Giffy) string {
 // FetchSlackProfile gets the slack user details for an access token.
 func FetchSlackProfile(accessToken string, cfg *config.Giffy) (*SlackProfile, error) {
 	var auth SlackProfile
-	_, err := r2.New("https://slack.com/api/auth.test",
+	_, err := r2.New(NewSlackClient(cfg, accessToken).methodURL("auth.test"),
 		r2.OptPost(),
 		r2.OptPostFormValue("token", accessToken)).JSON(&auth)
 	return &auth, err
@@ -69,7 +98,7 @@ func FetchSlackProfile(accessToken string, cfg *config.Giffy) (*SlackProfile, er
 // SlackOAuth completes the oauth 2.0 process with slack.
 func SlackOAuth(code string, cfg *config.Giffy) (*SlackOAuthResponse, error) {
 	var oar SlackOAuthResponse
-	_, err := r2.New("https://slack.com/api/oauth.access",
+	_, err := r2.New(NewSlackClient(cfg, "").methodURL("oauth.access"),
 		r2.OptPost(),
 		r2.OptPostFormValue("client_id", cfg.SlackClientID),
 		r2.OptPostFormValue("client_secret", cfg.SlackClientSecret),
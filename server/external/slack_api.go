@@ -0,0 +1,117 @@
+package external
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/blend/go-sdk/ex"
+	"github.com/blend/go-sdk/r2"
+
+	"github.com/wcharczuk/giffy/server/config"
+)
+
+const (
+	// ErrSlackAPI is returned when the slack web api responds with `ok: false`.
+	ErrSlackAPI ex.Class = "slack api error"
+	// ErrSlackResponseURL is returned when posting to an interaction `response_url` fails.
+	ErrSlackResponseURL ex.Class = "slack response url error"
+)
+
+// NewSlackClient returns a new slack web api client for a given (bot) token.
+func NewSlackClient(cfg *config.Giffy, token string) *SlackClient {
+	return &SlackClient{
+		BaseURL: cfg.SlackAPIURL,
+		Token:   token,
+	}
+}
+
+// SlackClient is a minimal client for the slack web api.
+// The BaseURL can be pointed at a local server in tests.
+type SlackClient struct {
+	BaseURL string
+	Token   string
+}
+
+// SlackAPIResponse is the envelope every slack web api method responds with.
+type SlackAPIResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+// SlackUnfurl is the unfurl content for a single url.
+type SlackUnfurl struct {
+	Title     string `json:"title,omitempty"`
+	TitleLink string `json:"title_link,omitempty"`
+	Text      string `json:"text,omitempty"`
+	ImageURL  string `json:"image_url,omitempty"`
+	ThumbURL  string `json:"thumb_url,omitempty"`
+	Footer    string `json:"footer,omitempty"`
+}
+
+// SlackChatUnfurlArgs are the arguments to `chat.unfurl`.
+type SlackChatUnfurlArgs struct {
+	Channel string                 `json:"channel"`
+	TS      string                 `json:"ts"`
+	Unfurls map[string]SlackUnfurl `json:"unfurls"`
+}
+
+// SlackChatPostMessageArgs are the arguments to `chat.postMessage`.
+type SlackChatPostMessageArgs struct {
+	Channel     string        `json:"channel"`
+	ThreadTS    string        `json:"thread_ts,omitempty"`
+	Text        string        `json:"text,omitempty"`
+	Attachments []interface{} `json:"attachments,omitempty"`
+	Blocks      []interface{} `json:"blocks,omitempty"`
+}
+
+// ChatUnfurl calls `chat.unfurl`.
+func (sc SlackClient) ChatUnfurl(ctx context.Context, args SlackChatUnfurlArgs) error {
+	return sc.post(ctx, "chat.unfurl", args)
+}
+
+// ChatPostMessage calls `chat.postMessage`.
+func (sc SlackClient) ChatPostMessage(ctx context.Context, args SlackChatPostMessageArgs) error {
+	return sc.post(ctx, "chat.postMessage", args)
+}
+
+// SlackRespond posts a message to the `response_url` of a slash command or interaction.
+// Response urls are pre-authorized, so no token is needed.
+func SlackRespond(ctx context.Context, responseURL string, message interface{}) error {
+	res, err := r2.New(responseURL,
+		r2.OptContext(ctx),
+		r2.OptPost(),
+		r2.OptJSONBody(message),
+	).Discard()
+	if err != nil {
+		return ex.New(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return ex.New(ErrSlackResponseURL, ex.OptMessagef("status code: %d", res.StatusCode))
+	}
+	return nil
+}
+
+func (sc SlackClient) post(ctx context.Context, method string, args interface{}) error {
+	var res SlackAPIResponse
+	if _, err := r2.New(sc.methodURL(method),
+		r2.OptContext(ctx),
+		r2.OptPost(),
+		r2.OptHeaderValue("Authorization", "Bearer "+sc.Token),
+		r2.OptJSONBody(args),
+	).JSON(&res); err != nil {
+		return ex.New(err)
+	}
+	if !res.OK {
+		return ex.New(ErrSlackAPI, ex.OptMessagef("method: %s, error: %s", method, res.Error))
+	}
+	return nil
+}
+
+func (sc SlackClient) methodURL(method string) string {
+	baseURL := sc.BaseURL
+	if baseURL == "" {
+		baseURL = config.DefaultSlackAPIURL
+	}
+	return strings.TrimSuffix(baseURL, "/") + "/" + method
+}
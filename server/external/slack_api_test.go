@@ -0,0 +1,122 @@
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	exception "github.com/blend/go-sdk/ex"
+
+	"github.com/wcharczuk/giffy/server/config"
+)
+
+func TestSlackClientChatPostMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	var path, authorization, contentType string
+	var args SlackChatPostMessageArgs
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		path = req.URL.Path
+		authorization = req.Header.Get("Authorization")
+		contentType = req.Header.Get("Content-Type")
+		assert.Nil(json.NewDecoder(req.Body).Decode(&args))
+		rw.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	client := NewSlackClient(&config.Giffy{SlackAPIURL: server.URL + "/api"}, "xoxb-test")
+	assert.Nil(client.ChatPostMessage(context.TODO(), SlackChatPostMessageArgs{
+		Channel:  "C123",
+		ThreadTS: "1234.5678",
+		Text:     "hello",
+	}))
+	assert.Equal("/api/chat.postMessage", path)
+	assert.Equal("Bearer xoxb-test", authorization)
+	assert.Equal("application/json; charset=utf-8", contentType)
+	assert.Equal("C123", args.Channel)
+	assert.Equal("1234.5678", args.ThreadTS)
+	assert.Equal("hello", args.Text)
+}
+
+func TestSlackClientChatUnfurl(t *testing.T) {
+	assert := assert.New(t)
+
+	var path string
+	var args SlackChatUnfurlArgs
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		path = req.URL.Path
+		assert.Nil(json.NewDecoder(req.Body).Decode(&args))
+		rw.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	client := NewSlackClient(&config.Giffy{SlackAPIURL: server.URL}, "xoxb-test")
+	assert.Nil(client.ChatUnfurl(context.TODO(), SlackChatUnfurlArgs{
+		Channel: "C123",
+		TS:      "1234.5678",
+		Unfurls: map[string]SlackUnfurl{
+			"https://gifffy.com/image/abc": {Title: "dancing cat", ImageURL: "https://example.com/abc.gif"},
+		},
+	}))
+	assert.Equal("/chat.unfurl", path)
+	assert.Equal("C123", args.Channel)
+	assert.Equal("1234.5678", args.TS)
+	assert.Equal("dancing cat", args.Unfurls["https://gifffy.com/image/abc"].Title)
+}
+
+func TestSlackClientError(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`{"ok":false,"error":"invalid_auth"}`))
+	}))
+	defer server.Close()
+
+	client := NewSlackClient(&config.Giffy{SlackAPIURL: server.URL}, "xoxb-bad")
+	err := client.ChatPostMessage(context.TODO(), SlackChatPostMessageArgs{Channel: "C123", Text: "hello"})
+	assert.True(exception.Is(err, ErrSlackAPI))
+	assert.Contains(exception.ErrMessage(err), "invalid_auth")
+}
+
+func TestSlackClientDefaultBaseURL(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("https://slack.com/api/chat.unfurl", SlackClient{}.methodURL("chat.unfurl"))
+	assert.Equal("http://localhost/api/auth.test", SlackClient{BaseURL: "http://localhost/api/"}.methodURL("auth.test"))
+}
+
+func TestSlackOAuthResponseScopes(t *testing.T) {
+	assert := assert.New(t)
+
+	var res SlackOAuthResponse
+	assert.Nil(json.Unmarshal([]byte(`{"ok":true,"access_token":"xoxp-test","scope":"commands, links:read,links:write","bot":{"bot_user_id":"UGIFFY","bot_access_token":"xoxb-test"}}`), &res))
+	assert.Equal([]string{"commands", "links:read", "links:write"}, res.Scopes())
+	assert.Equal("xoxb-test", res.BotToken())
+	assert.Equal("UGIFFY", res.Bot.BotUserID)
+
+	assert.Empty(SlackOAuthResponse{}.Scopes())
+	assert.Equal("xoxp-test", SlackOAuthResponse{AccessToken: "xoxp-test"}.BotToken())
+}
+
+func TestSlackRespond(t *testing.T) {
+	assert := assert.New(t)
+
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/response" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		assert.Nil(json.NewDecoder(req.Body).Decode(&body))
+		rw.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	assert.Nil(SlackRespond(context.TODO(), server.URL+"/response", map[string]interface{}{"delete_original": true}))
+	assert.Equal(true, body["delete_original"])
+
+	err := SlackRespond(context.TODO(), server.URL+"/expired", map[string]interface{}{"delete_original": true})
+	assert.True(exception.Is(err, ErrSlackResponseURL))
+}
@@ -0,0 +1,111 @@
+package external
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	exception "github.com/blend/go-sdk/ex"
+)
+
+const (
+	// SlackHeaderSignature is the header slack sets the request signature on.
+	SlackHeaderSignature = "X-Slack-Signature"
+	// SlackHeaderTimestamp is the header slack sets the request timestamp on.
+	SlackHeaderTimestamp = "X-Slack-Request-Timestamp"
+	// SlackHeaderRetryNum is the header slack sets on event deliveries it's retrying.
+	SlackHeaderRetryNum = "X-Slack-Retry-Num"
+
+	// SlackSignatureVersion is the version prefix for slack request signatures.
+	SlackSignatureVersion = "v0"
+	// SlackSignatureMaxAge is the replay window for signed slack requests.
+	SlackSignatureMaxAge = 5 * time.Minute
+)
+
+const (
+	// ErrSlackSignatureMissing is returned when a request has neither a signature nor a verification token.
+	ErrSlackSignatureMissing exception.Class = "slack request is unsigned"
+	// ErrSlackSignatureInvalid is returned when a request signature doesn't match the body.
+	ErrSlackSignatureInvalid exception.Class = "slack request signature is invalid"
+	// ErrSlackTimestampInvalid is returned when the request timestamp is missing or malformed.
+	ErrSlackTimestampInvalid exception.Class = "slack request timestamp is invalid"
+	// ErrSlackTimestampExpired is returned when the request timestamp is outside the replay window.
+	ErrSlackTimestampExpired exception.Class = "slack request timestamp is outside the replay window"
+	// ErrSlackTokenInvalid is returned when a legacy verification token doesn't match.
+	ErrSlackTokenInvalid exception.Class = "slack verification token is invalid"
+)
+
+// SlackSignature computes the `v0=<hex hmac>` signature for a request body.
+func SlackSignature(signingSecret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	mac.Write([]byte(fmt.Sprintf("%s:%s:", SlackSignatureVersion, timestamp)))
+	mac.Write(body)
+	return SlackSignatureVersion + "=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySlackSignature verifies a request signature and that its timestamp is within the replay window of `now`.
+func VerifySlackSignature(signingSecret, timestamp, signature string, body []byte, now time.Time) error {
+	if signature == "" {
+		return exception.New(ErrSlackSignatureMissing)
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return exception.New(ErrSlackTimestampInvalid, exception.OptMessagef("timestamp: %q", timestamp))
+	}
+	age := now.Sub(time.Unix(seconds, 0))
+	if age < 0 {
+		age = -age
+	}
+	if age > SlackSignatureMaxAge {
+		return exception.New(ErrSlackTimestampExpired, exception.OptMessagef("age: %v", age))
+	}
+	if !hmac.Equal([]byte(signature), []byte(SlackSignature(signingSecret, timestamp, body))) {
+		return exception.New(ErrSlackSignatureInvalid)
+	}
+	return nil
+}
+
+// VerifySlackToken verifies the legacy verification token included in a request body.
+// The token is read from form bodies (slash commands), form encoded `payload` json (interactive actions)
+// or json bodies (events).
+func VerifySlackToken(verificationToken, contentType string, body []byte) error {
+	token := SlackTokenFromBody(contentType, body)
+	if token == "" {
+		return exception.New(ErrSlackSignatureMissing)
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(verificationToken)) != 1 {
+		return exception.New(ErrSlackTokenInvalid)
+	}
+	return nil
+}
+
+// SlackTokenFromBody returns the legacy verification token from a request body.
+func SlackTokenFromBody(contentType string, body []byte) string {
+	var payload struct {
+		Token string `json:"token"`
+	}
+	if strings.HasPrefix(contentType, "application/json") {
+		_ = json.Unmarshal(body, &payload)
+		return payload.Token
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return ""
+	}
+	if token := values.Get("token"); token != "" {
+		return token
+	}
+	if raw := values.Get("payload"); raw != "" {
+		_ = json.Unmarshal([]byte(raw), &payload)
+		return payload.Token
+	}
+	return ""
+}
@@ -0,0 +1,54 @@
+package external
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/blend/go-sdk/assert"
+	exception "github.com/blend/go-sdk/ex"
+)
+
+func TestSlackSignature(t *testing.T) {
+	assert := assert.New(t)
+
+	// from https://api.slack.com/authentication/verifying-requests-from-slack
+	secret := "8f742231b10e8888abcd99yyyzzz85a5"
+	timestamp := "1531420618"
+	body := []byte("token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&team_domain=testteamnow&channel_id=G8PSS9T3V&channel_name=foobar&user_id=U2CERLKJA&user_name=roadrunner&command=%2Fwebhook-collect&text=&response_url=https%3A%2F%2Fhooks.slack.com%2Fcommands%2FT1DC2JH3J%2F397700885554%2F96rGlfmibIGlgcZRskXaIFfN&trigger_id=398738663015.47445629121.803a0bc887a14d10d2c447fce8b6703c")
+	assert.Equal("v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503", SlackSignature(secret, timestamp, body))
+}
+
+func TestVerifySlackSignature(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2020, 01, 02, 03, 04, 05, 0, time.UTC)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	body := []byte("text=hello")
+	signature := SlackSignature("secret", timestamp, body)
+
+	assert.Nil(VerifySlackSignature("secret", timestamp, signature, body, now))
+	assert.Nil(VerifySlackSignature("secret", timestamp, signature, body, now.Add(SlackSignatureMaxAge-time.Second)))
+
+	assert.True(exception.Is(VerifySlackSignature("not secret", timestamp, signature, body, now), ErrSlackSignatureInvalid))
+	assert.True(exception.Is(VerifySlackSignature("secret", timestamp, signature, []byte("text=goodbye"), now), ErrSlackSignatureInvalid))
+	assert.True(exception.Is(VerifySlackSignature("secret", timestamp, signature, body, now.Add(SlackSignatureMaxAge+time.Second)), ErrSlackTimestampExpired))
+	assert.True(exception.Is(VerifySlackSignature("secret", timestamp, signature, body, now.Add(-(SlackSignatureMaxAge+time.Second))), ErrSlackTimestampExpired))
+	assert.True(exception.Is(VerifySlackSignature("secret", "not a timestamp", signature, body, now), ErrSlackTimestampInvalid))
+	assert.True(exception.Is(VerifySlackSignature("secret", timestamp, "", body, now), ErrSlackSignatureMissing))
+}
+
+func TestVerifySlackToken(t *testing.T) {
+	assert := assert.New(t)
+
+	form := url.Values{"token": []string{"legacy"}, "text": []string{"hello"}}.Encode()
+	assert.Nil(VerifySlackToken("legacy", "application/x-www-form-urlencoded", []byte(form)))
+	assert.True(exception.Is(VerifySlackToken("other", "application/x-www-form-urlencoded", []byte(form)), ErrSlackTokenInvalid))
+
+	action := url.Values{"payload": []string{`{"token":"legacy","callback_id":"foo"}`}}.Encode()
+	assert.Nil(VerifySlackToken("legacy", "application/x-www-form-urlencoded", []byte(action)))
+
+	assert.Nil(VerifySlackToken("legacy", "application/json", []byte(`{"token":"legacy","type":"event_callback"}`)))
+	assert.True(exception.Is(VerifySlackToken("legacy", "application/json", []byte(`{"type":"event_callback"}`)), ErrSlackSignatureMissing))
+}
@@ -0,0 +1,51 @@
+package external
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+
+	exception "github.com/blend/go-sdk/ex"
+)
+
+const (
+	// TeamsAuthorizationScheme is the scheme teams outgoing webhooks sign the `Authorization` header with.
+	TeamsAuthorizationScheme = "HMAC"
+)
+
+const (
+	// ErrTeamsSecretInvalid is returned when the webhook security token isn't base64 encoded.
+	ErrTeamsSecretInvalid exception.Class = "teams webhook secret is invalid"
+	// ErrTeamsSignatureMissing is returned when a request doesn't have an hmac authorization header.
+	ErrTeamsSignatureMissing exception.Class = "teams request is unsigned"
+	// ErrTeamsSignatureInvalid is returned when a request signature doesn't match the body.
+	ErrTeamsSignatureInvalid exception.Class = "teams request signature is invalid"
+)
+
+// TeamsSignature computes the `HMAC <base64 hmac>` authorization header for a request body.
+// The secret is the base64 encoded security token teams generates for the outgoing webhook.
+func TeamsSignature(secret string, body []byte) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil || len(key) == 0 {
+		return "", exception.New(ErrTeamsSecretInvalid)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	return TeamsAuthorizationScheme + " " + base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// VerifyTeamsSignature verifies the `Authorization` header of an outgoing webhook request.
+func VerifyTeamsSignature(secret, authorization string, body []byte) error {
+	if !strings.HasPrefix(authorization, TeamsAuthorizationScheme+" ") {
+		return exception.New(ErrTeamsSignatureMissing)
+	}
+	expected, err := TeamsSignature(secret, body)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(authorization), []byte(expected)) {
+		return exception.New(ErrTeamsSignatureInvalid)
+	}
+	return nil
+}
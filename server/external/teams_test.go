@@ -0,0 +1,29 @@
+package external
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	exception "github.com/blend/go-sdk/ex"
+)
+
+func TestVerifyTeamsSignature(t *testing.T) {
+	assert := assert.New(t)
+
+	secret := base64.StdEncoding.EncodeToString([]byte("webhook security token"))
+	body := []byte(`{"type":"message","text":"<at>giffy</at> cats"}`)
+
+	authorization, err := TeamsSignature(secret, body)
+	assert.Nil(err)
+	assert.HasPrefix(authorization, "HMAC ")
+
+	assert.Nil(VerifyTeamsSignature(secret, authorization, body))
+
+	assert.True(exception.Is(VerifyTeamsSignature(secret, authorization, []byte(`{"type":"message","text":"dogs"}`)), ErrTeamsSignatureInvalid))
+	other := base64.StdEncoding.EncodeToString([]byte("other token"))
+	assert.True(exception.Is(VerifyTeamsSignature(other, authorization, body), ErrTeamsSignatureInvalid))
+	assert.True(exception.Is(VerifyTeamsSignature(secret, "", body), ErrTeamsSignatureMissing))
+	assert.True(exception.Is(VerifyTeamsSignature(secret, "Bearer foo", body), ErrTeamsSignatureMissing))
+	assert.True(exception.Is(VerifyTeamsSignature("not base64!", authorization, body), ErrTeamsSecretInvalid))
+}
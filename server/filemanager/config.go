@@ -0,0 +1,59 @@
+package filemanager
+
+import (
+	"context"
+
+	"github.com/blend/go-sdk/configutil"
+	"github.com/blend/go-sdk/env"
+)
+
+// Assert Config implements configutil.Resolver
+var (
+	_ configutil.Resolver = (*Config)(nil)
+)
+
+const (
+	// ProviderS3 stores files in s3.
+	ProviderS3 = "s3"
+	// ProviderLocal stores files on the local disk.
+	ProviderLocal = "local"
+	// ProviderMemory stores files in memory; it is useful for tests.
+	ProviderMemory = "memory"
+
+	// DefaultProvider is the default storage provider.
+	DefaultProvider = ProviderS3
+	// DefaultLocalPath is the default root path for local storage.
+	DefaultLocalPath = "_files"
+)
+
+// Config is the storage backend config.
+type Config struct {
+	Provider  string `json:"provider,omitempty" yaml:"provider,omitempty" env:"STORAGE_PROVIDER"`
+	LocalPath string `json:"localPath,omitempty" yaml:"localPath,omitempty" env:"STORAGE_LOCAL_PATH"`
+}
+
+// Resolve implements configutil.Resolver.
+func (c *Config) Resolve(ctx context.Context) error {
+	return env.GetVars(ctx).ReadInto(c)
+}
+
+// ProviderOrDefault gets a property or a default.
+func (c Config) ProviderOrDefault() string {
+	if c.Provider != "" {
+		return c.Provider
+	}
+	return DefaultProvider
+}
+
+// LocalPathOrDefault gets a property or a default.
+func (c Config) LocalPathOrDefault() string {
+	if c.LocalPath != "" {
+		return c.LocalPath
+	}
+	return DefaultLocalPath
+}
+
+// IsLocal returns if files are stored on the local disk.
+func (c Config) IsLocal() bool {
+	return c.ProviderOrDefault() == ProviderLocal
+}
@@ -0,0 +1,55 @@
+package filemanager
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+
+	"github.com/wcharczuk/giffy/server/imageutil"
+)
+
+// Derivatives are the locations of the files generated from an original image.
+type Derivatives struct {
+	Poster    *Location
+	Thumbnail *Location
+}
+
+// UploadDerivatives generates and uploads a still poster frame and a downscaled thumbnail for an image.
+// If the thumbnail fails to upload, the error is returned along with derivatives holding just the poster,
+// which has already been uploaded. Keys are content addressed, so callers should queue it for deletion
+// rather than deleting it outright.
+func (fm *FileManager) UploadDerivatives(fileContents []byte) (*Derivatives, error) {
+	poster, err := imageutil.Poster(fileContents)
+	if err != nil {
+		return nil, err
+	}
+	thumbnail, err := imageutil.Thumbnail(fileContents, imageutil.ThumbnailMaxDimension)
+	if err != nil {
+		return nil, err
+	}
+
+	var derivatives Derivatives
+	derivatives.Poster, err = fm.UploadFile(bytes.NewReader(poster), FileType{Extension: imageutil.PosterExtension, MimeType: imageutil.PosterMimeType})
+	if err != nil {
+		return nil, err
+	}
+	derivatives.Thumbnail, err = fm.UploadFile(bytes.NewReader(thumbnail), FileType{Extension: imageutil.ThumbnailExtension, MimeType: imageutil.ThumbnailMimeType})
+	if err != nil {
+		// the poster was uploaded, so it's returned for the caller to clean up.
+		return &Derivatives{Poster: derivatives.Poster}, err
+	}
+	return &derivatives, nil
+}
+
+// UploadVideo transcodes a gif to the configured video format and uploads it.
+// It returns a nil location if the file isn't a gif, or if the file manager can't transcode.
+func (fm *FileManager) UploadVideo(ctx context.Context, fileContents []byte) (*Location, error) {
+	if !fm.CanTranscode() || http.DetectContentType(fileContents) != "image/gif" {
+		return nil, nil
+	}
+	video, err := fm.transcoder.Transcode(ctx, fileContents, fm.videoFormat)
+	if err != nil {
+		return nil, err
+	}
+	return fm.UploadFile(bytes.NewReader(video), FileType{Extension: fm.videoFormat.Extension, MimeType: fm.videoFormat.MimeType})
+}
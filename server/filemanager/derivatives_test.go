@@ -0,0 +1,115 @@
+package filemanager
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+
+	"github.com/wcharczuk/giffy/server/transcode"
+)
+
+func TestUploadDerivatives(t *testing.T) {
+	assert := assert.New(t)
+
+	img := image.NewRGBA(image.Rect(0, 0, 480, 320))
+	for x := 0; x < 480; x++ {
+		img.Set(x, x%320, color.White)
+	}
+	buffer := new(bytes.Buffer)
+	assert.Nil(png.Encode(buffer, img))
+
+	storage := NewMemoryStorage()
+	fm := NewWithStorage("test-bucket", storage)
+
+	derivatives, err := fm.UploadDerivatives(buffer.Bytes())
+	assert.Nil(err)
+	assert.Equal(2, storage.Len())
+	assert.Equal(".jpg", filepath.Ext(derivatives.Poster.Key))
+	assert.Equal(".gif", filepath.Ext(derivatives.Thumbnail.Key))
+
+	_, err = fm.UploadDerivatives([]byte("not an image"))
+	assert.NotNil(err)
+	assert.Equal(2, storage.Len())
+}
+
+// failingStorage fails uploads of a given extension.
+type failingStorage struct {
+	Storage
+	Extension string
+}
+
+func (fs failingStorage) UploadFile(location *Location, uploadFile io.Reader, fileType FileType) error {
+	if fileType.Extension == fs.Extension {
+		return fmt.Errorf("upload failed")
+	}
+	return fs.Storage.UploadFile(location, uploadFile, fileType)
+}
+
+func TestUploadDerivativesThumbnailFails(t *testing.T) {
+	assert := assert.New(t)
+
+	img := image.NewRGBA(image.Rect(0, 0, 480, 320))
+	buffer := new(bytes.Buffer)
+	assert.Nil(png.Encode(buffer, img))
+
+	storage := NewMemoryStorage()
+	fm := NewWithStorage("test-bucket", failingStorage{Storage: storage, Extension: ".gif"})
+
+	// the poster made it up, so it's handed back to be cleaned up.
+	derivatives, err := fm.UploadDerivatives(buffer.Bytes())
+	assert.NotNil(err)
+	assert.NotNil(derivatives)
+	assert.NotNil(derivatives.Poster)
+	assert.Nil(derivatives.Thumbnail)
+	assert.Equal(1, storage.Len())
+	assert.Equal(".jpg", filepath.Ext(derivatives.Poster.Key))
+}
+
+func TestUploadVideo(t *testing.T) {
+	assert := assert.New(t)
+
+	frame := image.NewPaletted(image.Rect(0, 0, 32, 32), palette.Plan9)
+	animated := new(bytes.Buffer)
+	assert.Nil(gif.EncodeAll(animated, &gif.GIF{Image: []*image.Paletted{frame, frame}, Delay: []int{10, 10}}))
+	still := new(bytes.Buffer)
+	assert.Nil(png.Encode(still, frame))
+
+	storage := NewMemoryStorage()
+	fm := NewWithStorage("test-bucket", storage)
+
+	// without a worker there's nothing to do.
+	location, err := fm.UploadVideo(context.Background(), animated.Bytes())
+	assert.Nil(err)
+	assert.Nil(location)
+
+	worker := &transcode.Fake{Output: []byte("not really a video")}
+	fm.WithTranscoder(worker, transcode.FormatWebM)
+
+	location, err = fm.UploadVideo(context.Background(), animated.Bytes())
+	assert.Nil(err)
+	assert.NotNil(location)
+	assert.Equal(".webm", filepath.Ext(location.Key))
+	assert.Equal(1, storage.Len())
+	assert.Equal([]transcode.Format{transcode.FormatWebM}, worker.Calls)
+
+	// only gifs are transcoded.
+	location, err = fm.UploadVideo(context.Background(), still.Bytes())
+	assert.Nil(err)
+	assert.Nil(location)
+	assert.Len(worker.Calls, 1)
+
+	worker.Err = fmt.Errorf("encoder failed")
+	_, err = fm.UploadVideo(context.Background(), animated.Bytes())
+	assert.NotNil(err)
+	assert.Equal(1, storage.Len())
+}
@@ -0,0 +1,136 @@
+package filemanager
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/blend/go-sdk/ex"
+	"github.com/wcharczuk/giffy/server/awsutil"
+	"github.com/wcharczuk/giffy/server/transcode"
+)
+
+// Location is a storage location.
+type Location struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+}
+
+// FileType is metadata for a file.
+type FileType struct {
+	Extension string
+	MimeType  string
+}
+
+// New returns a new filemanager backed by s3.
+func New(s3Bucket string, cfg awsutil.Config) *FileManager {
+	return NewWithStorage(s3Bucket, NewS3Storage(cfg))
+}
+
+// NewFromConfig returns a new filemanager with the storage backend selected by the config.
+func NewFromConfig(bucket string, cfg Config, awsCfg awsutil.Config) (*FileManager, error) {
+	switch cfg.ProviderOrDefault() {
+	case ProviderS3:
+		return New(bucket, awsCfg), nil
+	case ProviderLocal:
+		return NewWithStorage(bucket, NewLocalStorage(cfg.LocalPathOrDefault())), nil
+	case ProviderMemory:
+		return NewWithStorage(bucket, NewMemoryStorage()), nil
+	default:
+		return nil, fmt.Errorf("invalid storage provider: %s", cfg.Provider)
+	}
+}
+
+// NewWithStorage returns a new filemanager for a given storage backend.
+func NewWithStorage(bucket string, storage Storage) *FileManager {
+	return &FileManager{
+		bucket:  bucket,
+		storage: storage,
+	}
+}
+
+// FileManager is a helper for file storage related operations.
+type FileManager struct {
+	bucket  string
+	storage Storage
+
+	transcoder  transcode.Worker
+	videoFormat transcode.Format
+}
+
+// Bucket returns the default bucket for the file manager.
+func (fm *FileManager) Bucket() string {
+	return fm.bucket
+}
+
+// Storage returns the underlying storage backend.
+func (fm *FileManager) Storage() Storage {
+	return fm.storage
+}
+
+// WithTranscoder sets the worker (and format) used to transcode gifs to video.
+func (fm *FileManager) WithTranscoder(worker transcode.Worker, format transcode.Format) *FileManager {
+	fm.transcoder = worker
+	fm.videoFormat = format
+	return fm
+}
+
+// CanTranscode returns if the file manager has a worker to transcode gifs to video.
+func (fm *FileManager) CanTranscode() bool {
+	return fm.transcoder != nil && !fm.videoFormat.IsZero()
+}
+
+// NewLocationFromKey makes a new location from a key.
+func (fm *FileManager) NewLocationFromKey(key string) *Location {
+	return &Location{
+		Bucket: fm.bucket,
+		Key:    key,
+	}
+}
+
+//UploadFile uploads a file.
+func (fm *FileManager) UploadFile(uploadFile io.Reader, fileType FileType) (*Location, error) {
+	return fm.UploadFileToBucket(fm.bucket, uploadFile, fileType)
+}
+
+//UploadFileToBucket uploads a file to a given location.
+// Keys are content addressed, so uploading the same contents twice writes to the same key.
+func (fm *FileManager) UploadFileToBucket(bucket string, uploadFile io.Reader, fileType FileType) (*Location, error) {
+	contents, err := ioutil.ReadAll(uploadFile)
+	if err != nil {
+		return nil, ex.New(err)
+	}
+	location := &Location{
+		Bucket: bucket,
+		Key:    ContentKey(contents, fileType.Extension),
+	}
+	if err := fm.storage.UploadFile(location, bytes.NewReader(contents), fileType); err != nil {
+		return nil, err
+	}
+	return location, nil
+}
+
+// ContentKey returns the storage key for file contents; the hex sha256 of the contents with the file extension.
+func ContentKey(contents []byte, extension string) string {
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:]) + extension
+}
+
+//DeleteFile deletes a file.
+func (fm *FileManager) DeleteFile(fileLocation *Location) error {
+	return fm.storage.DeleteFile(fileLocation)
+}
+
+// ListFiles returns the locations of every file stored in a bucket.
+func (fm *FileManager) ListFiles(bucket string) ([]Location, error) {
+	return fm.storage.ListFiles(bucket)
+}
+
+// GetFile gets a file.
+// It is the caller's responsibility to close the returned reader.
+func (fm *FileManager) GetFile(fileLocation *Location) (io.ReadCloser, error) {
+	return fm.storage.GetFile(fileLocation)
+}
@@ -0,0 +1,139 @@
+package filemanager
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/blend/go-sdk/ex"
+)
+
+var (
+	_ Storage = (*LocalStorage)(nil)
+)
+
+// NewLocalStorage returns a new local disk storage backend rooted at a given path.
+func NewLocalStorage(root string) *LocalStorage {
+	return &LocalStorage{Root: root}
+}
+
+// LocalStorage stores files on the local disk.
+//
+// Files are written to `<Root>/<Bucket>/<Key>`.
+type LocalStorage struct {
+	Root string
+}
+
+// UploadFile writes a file to disk.
+// The contents are written to a temporary file first, and then renamed into place
+// so that readers never observe a partially written file.
+func (ls *LocalStorage) UploadFile(location *Location, uploadFile io.Reader, _ FileType) error {
+	filePath, err := ls.path(location)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return ex.New(err)
+	}
+	tempFile, err := ioutil.TempFile(filepath.Dir(filePath), ".upload-")
+	if err != nil {
+		return ex.New(err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	if _, err = io.Copy(tempFile, uploadFile); err != nil {
+		tempFile.Close()
+		return ex.New(err)
+	}
+	if err = tempFile.Close(); err != nil {
+		return ex.New(err)
+	}
+	if err = os.Chmod(tempFile.Name(), 0644); err != nil {
+		return ex.New(err)
+	}
+	return ex.New(os.Rename(tempFile.Name(), filePath))
+}
+
+// GetFile opens a file from disk.
+func (ls *LocalStorage) GetFile(location *Location) (io.ReadCloser, error) {
+	filePath, err := ls.path(location)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil, ex.New(ErrFileNotFound, ex.OptMessagef("bucket: %s, key: %s", location.Bucket, location.Key))
+	}
+	if err != nil {
+		return nil, ex.New(err)
+	}
+	return f, nil
+}
+
+// DeleteFile removes a file from disk.
+func (ls *LocalStorage) DeleteFile(location *Location) error {
+	filePath, err := ls.path(location)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filePath)
+	if os.IsNotExist(err) {
+		return ex.New(ErrFileNotFound, ex.OptMessagef("bucket: %s, key: %s", location.Bucket, location.Key))
+	}
+	return ex.New(err)
+}
+
+// ListFiles walks the directory for a bucket.
+// Partially written uploads are skipped.
+func (ls *LocalStorage) ListFiles(bucket string) ([]Location, error) {
+	root, err := filepath.Abs(ls.Root)
+	if err != nil {
+		return nil, ex.New(err)
+	}
+	bucketPath := filepath.Join(root, bucket)
+	if bucket == "" || filepath.Dir(bucketPath) != root {
+		return nil, ex.New(ErrInvalidLocation, ex.OptMessagef("bucket: %s", bucket))
+	}
+
+	var locations []Location
+	err = filepath.Walk(bucketPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && filePath == bucketPath {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".upload-") {
+			return nil
+		}
+		key, err := filepath.Rel(bucketPath, filePath)
+		if err != nil {
+			return err
+		}
+		locations = append(locations, Location{Bucket: bucket, Key: filepath.ToSlash(key)})
+		return nil
+	})
+	if err != nil {
+		return nil, ex.New(err)
+	}
+	return locations, nil
+}
+
+// path returns the on disk path for a location, making sure
+// the location cannot escape the storage root.
+func (ls *LocalStorage) path(location *Location) (string, error) {
+	if location == nil || location.Bucket == "" || location.Key == "" {
+		return "", ex.New(ErrInvalidLocation)
+	}
+	root, err := filepath.Abs(ls.Root)
+	if err != nil {
+		return "", ex.New(err)
+	}
+	filePath := filepath.Join(root, location.Bucket, location.Key)
+	if !strings.HasPrefix(filePath, filepath.Join(root, location.Bucket)+string(filepath.Separator)) {
+		return "", ex.New(ErrInvalidLocation, ex.OptMessagef("bucket: %s, key: %s", location.Bucket, location.Key))
+	}
+	return filePath, nil
+}
@@ -0,0 +1,65 @@
+package filemanager
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/ex"
+)
+
+func TestLocalStorage(t *testing.T) {
+	assert := assert.New(t)
+
+	root, err := ioutil.TempDir("", "giffy-storage-")
+	assert.Nil(err)
+	defer os.RemoveAll(root)
+
+	fm := NewWithStorage("test-bucket", NewLocalStorage(root))
+
+	location, err := fm.UploadFile(bytes.NewBufferString("hello world"), FileType{Extension: ".gif", MimeType: "image/gif"})
+	assert.Nil(err)
+	assert.Equal("test-bucket", location.Bucket)
+	assert.NotEmpty(location.Key)
+
+	file, err := fm.GetFile(location)
+	assert.Nil(err)
+	contents, err := ioutil.ReadAll(file)
+	assert.Nil(err)
+	assert.Nil(file.Close())
+	assert.Equal("hello world", string(contents))
+
+	locations, err := fm.ListFiles("test-bucket")
+	assert.Nil(err)
+	assert.Equal([]Location{*location}, locations)
+
+	locations, err = fm.ListFiles("empty-bucket")
+	assert.Nil(err)
+	assert.Empty(locations)
+
+	_, err = fm.ListFiles("../escaped")
+	assert.True(ex.Is(err, ErrInvalidLocation))
+
+	assert.Nil(fm.DeleteFile(location))
+
+	_, err = fm.GetFile(location)
+	assert.True(ex.Is(err, ErrFileNotFound))
+	assert.True(ex.Is(fm.DeleteFile(location), ErrFileNotFound))
+}
+
+func TestLocalStorageInvalidLocation(t *testing.T) {
+	assert := assert.New(t)
+
+	root, err := ioutil.TempDir("", "giffy-storage-")
+	assert.Nil(err)
+	defer os.RemoveAll(root)
+
+	storage := NewLocalStorage(root)
+	err = storage.UploadFile(&Location{Bucket: "test-bucket", Key: "../../escaped"}, bytes.NewBufferString("nope"), FileType{})
+	assert.True(ex.Is(err, ErrInvalidLocation))
+
+	_, err = storage.GetFile(&Location{Bucket: "test-bucket"})
+	assert.True(ex.Is(err, ErrInvalidLocation))
+}
@@ -0,0 +1,91 @@
+package filemanager
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/blend/go-sdk/ex"
+)
+
+var (
+	_ Storage = (*MemoryStorage)(nil)
+)
+
+// NewMemoryStorage returns a new in-memory storage backend.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		files: map[Location][]byte{},
+	}
+}
+
+// MemoryStorage stores files in memory.
+// It is safe for concurrent use, and is mostly useful for tests.
+type MemoryStorage struct {
+	sync.RWMutex
+	files map[Location][]byte
+}
+
+// UploadFile stores a file.
+func (ms *MemoryStorage) UploadFile(location *Location, uploadFile io.Reader, _ FileType) error {
+	if location == nil {
+		return ex.New(ErrInvalidLocation)
+	}
+	contents, err := ioutil.ReadAll(uploadFile)
+	if err != nil {
+		return ex.New(err)
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	ms.files[*location] = contents
+	return nil
+}
+
+// GetFile returns a file.
+func (ms *MemoryStorage) GetFile(location *Location) (io.ReadCloser, error) {
+	if location == nil {
+		return nil, ex.New(ErrInvalidLocation)
+	}
+	ms.RLock()
+	defer ms.RUnlock()
+	contents, ok := ms.files[*location]
+	if !ok {
+		return nil, ex.New(ErrFileNotFound, ex.OptMessagef("bucket: %s, key: %s", location.Bucket, location.Key))
+	}
+	return ioutil.NopCloser(bytes.NewReader(contents)), nil
+}
+
+// DeleteFile removes a file.
+func (ms *MemoryStorage) DeleteFile(location *Location) error {
+	if location == nil {
+		return ex.New(ErrInvalidLocation)
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	if _, ok := ms.files[*location]; !ok {
+		return ex.New(ErrFileNotFound, ex.OptMessagef("bucket: %s, key: %s", location.Bucket, location.Key))
+	}
+	delete(ms.files, *location)
+	return nil
+}
+
+// ListFiles returns the locations of the files in a bucket.
+func (ms *MemoryStorage) ListFiles(bucket string) ([]Location, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+	var locations []Location
+	for location := range ms.files {
+		if location.Bucket == bucket {
+			locations = append(locations, location)
+		}
+	}
+	return locations, nil
+}
+
+// Len returns the number of stored files.
+func (ms *MemoryStorage) Len() int {
+	ms.RLock()
+	defer ms.RUnlock()
+	return len(ms.files)
+}
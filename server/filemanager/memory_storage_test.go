@@ -0,0 +1,72 @@
+package filemanager
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/ex"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	assert := assert.New(t)
+
+	fm := NewWithStorage("test-bucket", NewMemoryStorage())
+
+	location, err := fm.UploadFile(bytes.NewBufferString("hello world"), FileType{Extension: ".gif"})
+	assert.Nil(err)
+
+	file, err := fm.GetFile(location)
+	assert.Nil(err)
+	contents, err := ioutil.ReadAll(file)
+	assert.Nil(err)
+	assert.Equal("hello world", string(contents))
+	assert.Equal(ContentKey([]byte("hello world"), ".gif"), location.Key)
+
+	// the same contents go to the same key.
+	again, err := fm.UploadFile(bytes.NewBufferString("hello world"), FileType{Extension: ".gif"})
+	assert.Nil(err)
+	assert.Equal(*location, *again)
+
+	locations, err := fm.ListFiles("test-bucket")
+	assert.Nil(err)
+	assert.Equal([]Location{*location}, locations)
+
+	assert.Nil(fm.DeleteFile(location))
+	_, err = fm.GetFile(location)
+	assert.True(ex.Is(err, ErrFileNotFound))
+}
+
+func TestMemoryStorageConcurrent(t *testing.T) {
+	assert := assert.New(t)
+
+	storage := NewMemoryStorage()
+	fm := NewWithStorage("test-bucket", storage)
+
+	wg := sync.WaitGroup{}
+	errors := make(chan error, 32)
+	for x := 0; x < 32; x++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			location, err := fm.UploadFile(bytes.NewBufferString(fmt.Sprint(index)), FileType{})
+			if err != nil {
+				errors <- err
+				return
+			}
+			if _, err = fm.GetFile(location); err != nil {
+				errors <- err
+			}
+		}(x)
+	}
+	wg.Wait()
+	close(errors)
+
+	for err := range errors {
+		assert.Nil(err)
+	}
+	assert.Equal(32, storage.Len())
+}
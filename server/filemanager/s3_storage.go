@@ -0,0 +1,95 @@
+package filemanager
+
+import (
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/blend/go-sdk/ex"
+
+	"github.com/wcharczuk/giffy/server/awsutil"
+)
+
+var (
+	_ Storage = (*S3Storage)(nil)
+)
+
+// NewS3Storage returns a new s3 storage backend.
+func NewS3Storage(cfg awsutil.Config) *S3Storage {
+	awsConfig := &aws.Config{
+		Region:      aws.String(cfg.RegionOrDefault()),
+		Credentials: credentials.NewStaticCredentials(cfg.AccessKeyID, cfg.SecretAccessKey, cfg.Token),
+	}
+	awsSession := session.New(awsConfig)
+	return &S3Storage{
+		config:   cfg,
+		session:  awsSession,
+		uploader: s3manager.NewUploader(awsSession),
+		s3Client: s3.New(awsSession),
+	}
+}
+
+// S3Storage stores files in s3.
+type S3Storage struct {
+	config   awsutil.Config
+	session  *session.Session
+	s3Client *s3.S3
+	uploader *s3manager.Uploader
+}
+
+// UploadFile uploads a file.
+func (s *S3Storage) UploadFile(location *Location, uploadFile io.Reader, fileType FileType) error {
+	_, err := s.uploader.Upload(&s3manager.UploadInput{
+		Bucket:      &location.Bucket,
+		Key:         &location.Key,
+		Body:        uploadFile,
+		ContentType: &fileType.MimeType,
+		ACL:         aws.String("public-read"),
+	})
+	return err
+}
+
+// GetFile gets a file.
+func (s *S3Storage) GetFile(location *Location) (io.ReadCloser, error) {
+	res, err := s.s3Client.GetObject(&s3.GetObjectInput{
+		Bucket: &location.Bucket,
+		Key:    &location.Key,
+	})
+	if err != nil {
+		if typed, ok := err.(awserr.Error); ok && typed.Code() == s3.ErrCodeNoSuchKey {
+			return nil, ex.New(ErrFileNotFound, ex.OptMessagef("bucket: %s, key: %s", location.Bucket, location.Key))
+		}
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// DeleteFile deletes a file.
+func (s *S3Storage) DeleteFile(location *Location) error {
+	_, err := s.s3Client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: &location.Bucket,
+		Key:    &location.Key,
+	})
+	return err
+}
+
+// ListFiles lists the objects in a bucket.
+func (s *S3Storage) ListFiles(bucket string) ([]Location, error) {
+	var locations []Location
+	err := s.s3Client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: &bucket,
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, object := range page.Contents {
+			locations = append(locations, Location{Bucket: bucket, Key: aws.StringValue(object.Key)})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
@@ -0,0 +1,22 @@
+package filemanager
+
+import (
+	"io"
+
+	"github.com/blend/go-sdk/ex"
+)
+
+const (
+	// ErrFileNotFound is returned when a location does not exist in a storage backend.
+	ErrFileNotFound ex.Class = "file not found"
+	// ErrInvalidLocation is returned when a location cannot be mapped onto a storage backend.
+	ErrInvalidLocation ex.Class = "invalid file location"
+)
+
+// Storage is a backend that file contents are written to and read from.
+type Storage interface {
+	UploadFile(location *Location, uploadFile io.Reader, fileType FileType) error
+	GetFile(location *Location) (io.ReadCloser, error)
+	DeleteFile(location *Location) error
+	ListFiles(bucket string) ([]Location, error)
+}
@@ -0,0 +1,201 @@
+package imageutil
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+
+	exception "github.com/blend/go-sdk/ex"
+)
+
+const (
+	// ThumbnailMaxDimension is the max width or height of a thumbnail.
+	ThumbnailMaxDimension = 240
+
+	// PosterExtension is the file extension for posters.
+	PosterExtension = ".jpg"
+	// PosterMimeType is the mime type for posters.
+	PosterMimeType = "image/jpeg"
+	// PosterQuality is the jpeg quality for posters.
+	PosterQuality = 85
+
+	// ThumbnailExtension is the file extension for thumbnails.
+	ThumbnailExtension = ".gif"
+	// ThumbnailMimeType is the mime type for thumbnails.
+	ThumbnailMimeType = "image/gif"
+)
+
+// Poster renders the first frame of an image as a static jpeg.
+func Poster(contents []byte) ([]byte, error) {
+	var first image.Image
+	anim, err := gif.DecodeAll(bytes.NewReader(contents))
+	if err == nil && len(anim.Image) > 0 {
+		err = eachFrame(anim, func(index int, canvas *image.RGBA) error {
+			if first == nil {
+				first = copyRGBA(canvas)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, exception.New(err)
+		}
+	} else {
+		first, _, err = image.Decode(bytes.NewReader(contents))
+		if err != nil {
+			return nil, exception.New(err)
+		}
+	}
+
+	// jpeg has no alpha channel, so flatten onto white.
+	flattened := image.NewRGBA(first.Bounds())
+	draw.Draw(flattened, flattened.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flattened, flattened.Bounds(), first, first.Bounds().Min, draw.Over)
+
+	buffer := new(bytes.Buffer)
+	if err = jpeg.Encode(buffer, flattened, &jpeg.Options{Quality: PosterQuality}); err != nil {
+		return nil, exception.New(err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// Thumbnail renders a downscaled (animated) gif that fits within maxDimension on both sides.
+// Images that already fit are re-encoded at their original size.
+func Thumbnail(contents []byte, maxDimension int) ([]byte, error) {
+	anim, err := gif.DecodeAll(bytes.NewReader(contents))
+	if err != nil {
+		img, _, decodeErr := image.Decode(bytes.NewReader(contents))
+		if decodeErr != nil {
+			return nil, exception.New(decodeErr)
+		}
+		paletted := image.NewPaletted(img.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), img, img.Bounds().Min)
+		anim = &gif.GIF{Image: []*image.Paletted{paletted}, Delay: []int{0}}
+	}
+	if len(anim.Image) == 0 {
+		return nil, exception.New("invalid image").WithMessage("gif has no frames")
+	}
+
+	bounds := image.Rect(0, 0, anim.Config.Width, anim.Config.Height)
+	if bounds.Empty() {
+		bounds = anim.Image[0].Bounds()
+	}
+	target := image.Rect(0, 0, bounds.Dx(), bounds.Dy())
+	if bounds.Dx() > maxDimension || bounds.Dy() > maxDimension {
+		target = fit(bounds.Dx(), bounds.Dy(), maxDimension)
+	}
+
+	output := &gif.GIF{
+		LoopCount: anim.LoopCount,
+		Config: image.Config{
+			Width:  target.Dx(),
+			Height: target.Dy(),
+		},
+	}
+	err = eachFrame(anim, func(index int, canvas *image.RGBA) error {
+		framePalette := anim.Image[index].Palette
+		if len(framePalette) == 0 {
+			framePalette = palette.Plan9
+		}
+		paletted := image.NewPaletted(target, withTransparent(framePalette))
+		draw.Draw(paletted, target, scale(canvas, target), image.Point{}, draw.Src)
+
+		output.Image = append(output.Image, paletted)
+		if index < len(anim.Delay) {
+			output.Delay = append(output.Delay, anim.Delay[index])
+		} else {
+			output.Delay = append(output.Delay, 0)
+		}
+		// every frame is fully rendered, so nothing needs to be disposed.
+		output.Disposal = append(output.Disposal, gif.DisposalBackground)
+		return nil
+	})
+	if err != nil {
+		return nil, exception.New(err)
+	}
+	output.Config.ColorModel = output.Image[0].Palette
+
+	buffer := new(bytes.Buffer)
+	if err = gif.EncodeAll(buffer, output); err != nil {
+		return nil, exception.New(err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// fit returns the largest rectangle with the same aspect ratio as width x height
+// that fits within maxDimension on both sides.
+func fit(width, height, maxDimension int) image.Rectangle {
+	if width >= height {
+		scaled := (height * maxDimension) / width
+		if scaled < 1 {
+			scaled = 1
+		}
+		return image.Rect(0, 0, maxDimension, scaled)
+	}
+	scaled := (width * maxDimension) / height
+	if scaled < 1 {
+		scaled = 1
+	}
+	return image.Rect(0, 0, scaled, maxDimension)
+}
+
+// scale box-filters an image down (or nearest-neighbors it up) to the target bounds.
+func scale(src *image.RGBA, target image.Rectangle) *image.RGBA {
+	dst := image.NewRGBA(target)
+	srcBounds := src.Bounds()
+	srcWidth, srcHeight := srcBounds.Dx(), srcBounds.Dy()
+	dstWidth, dstHeight := target.Dx(), target.Dy()
+
+	for y := 0; y < dstHeight; y++ {
+		y0 := (y * srcHeight) / dstHeight
+		y1 := ((y + 1) * srcHeight) / dstHeight
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < dstWidth; x++ {
+			x0 := (x * srcWidth) / dstWidth
+			x1 := ((x + 1) * srcWidth) / dstWidth
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, count int
+			for sy := y0; sy < y1; sy++ {
+				offset := src.PixOffset(srcBounds.Min.X+x0, srcBounds.Min.Y+sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(src.Pix[offset])
+					g += int(src.Pix[offset+1])
+					b += int(src.Pix[offset+2])
+					a += int(src.Pix[offset+3])
+					offset += 4
+					count++
+				}
+			}
+			dstOffset := dst.PixOffset(target.Min.X+x, target.Min.Y+y)
+			dst.Pix[dstOffset] = uint8(r / count)
+			dst.Pix[dstOffset+1] = uint8(g / count)
+			dst.Pix[dstOffset+2] = uint8(b / count)
+			dst.Pix[dstOffset+3] = uint8(a / count)
+		}
+	}
+	return dst
+}
+
+// withTransparent ensures a palette has a fully transparent entry, so
+// transparent regions of the source survive scaling.
+func withTransparent(p color.Palette) color.Palette {
+	for _, c := range p {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			return p
+		}
+	}
+	if len(p) >= 256 {
+		return p
+	}
+	output := make(color.Palette, len(p), len(p)+1)
+	copy(output, p)
+	return append(output, color.Transparent)
+}
@@ -0,0 +1,78 @@
+package imageutil
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+)
+
+func TestPoster(t *testing.T) {
+	assert := assert.New(t)
+
+	contents := encodeGIF(t, gradient(320, 240, false), gradient(320, 240, true))
+	poster, err := Poster(contents)
+	assert.Nil(err)
+
+	img, err := jpeg.Decode(bytes.NewReader(poster))
+	assert.Nil(err)
+	assert.Equal(320, img.Bounds().Dx())
+	assert.Equal(240, img.Bounds().Dy())
+
+	// the poster should be the first frame, not a later one.
+	posterHash := DifferenceHash(img)
+	assert.True(HammingDistance(posterHash, DifferenceHash(gradient(320, 240, false))) <= 4)
+}
+
+func TestPosterStill(t *testing.T) {
+	assert := assert.New(t)
+
+	poster, err := Poster(encodePNG(t, gradient(64, 32, false)))
+	assert.Nil(err)
+	config, err := jpeg.DecodeConfig(bytes.NewReader(poster))
+	assert.Nil(err)
+	assert.Equal(64, config.Width)
+}
+
+func TestThumbnail(t *testing.T) {
+	assert := assert.New(t)
+
+	contents := encodeGIF(t, gradient(480, 320, false), gradient(480, 320, true), gradient(480, 320, false))
+	thumbnail, err := Thumbnail(contents, 240)
+	assert.Nil(err)
+
+	anim, err := gif.DecodeAll(bytes.NewReader(thumbnail))
+	assert.Nil(err)
+	assert.Len(anim.Image, 3)
+	assert.Equal(240, anim.Config.Width)
+	assert.Equal(160, anim.Config.Height)
+	assert.True(len(thumbnail) < len(contents))
+}
+
+func TestThumbnailStill(t *testing.T) {
+	assert := assert.New(t)
+
+	thumbnail, err := Thumbnail(encodePNG(t, gradient(100, 400, false)), 240)
+	assert.Nil(err)
+	anim, err := gif.DecodeAll(bytes.NewReader(thumbnail))
+	assert.Nil(err)
+	assert.Len(anim.Image, 1)
+	assert.Equal(60, anim.Config.Width)
+	assert.Equal(240, anim.Config.Height)
+}
+
+func TestThumbnailInvalid(t *testing.T) {
+	assert := assert.New(t)
+	_, err := Thumbnail([]byte("not an image"), 240)
+	assert.NotNil(err)
+}
+
+func TestFit(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(image.Rect(0, 0, 240, 120), fit(480, 240, 240))
+	assert.Equal(image.Rect(0, 0, 120, 240), fit(240, 480, 240))
+	assert.Equal(image.Rect(0, 0, 240, 1), fit(10000, 2, 240))
+}
@@ -0,0 +1,49 @@
+package imageutil
+
+import (
+	"image"
+	"image/draw"
+	"image/gif"
+)
+
+// eachFrame composites the frames of an animated gif in order and calls the action
+// with the fully rendered canvas for each frame.
+// gif frames are usually partial deltas, so the canvas is only valid for the
+// duration of the call and must be copied if it needs to be retained.
+func eachFrame(anim *gif.GIF, action func(index int, canvas *image.RGBA) error) error {
+	bounds := image.Rect(0, 0, anim.Config.Width, anim.Config.Height)
+	if bounds.Empty() && len(anim.Image) > 0 {
+		bounds = anim.Image[0].Bounds()
+	}
+	canvas := image.NewRGBA(bounds)
+
+	var previous *image.RGBA
+	for index, frame := range anim.Image {
+		disposal := byte(gif.DisposalNone)
+		if index < len(anim.Disposal) {
+			disposal = anim.Disposal[index]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = copyRGBA(canvas)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		if err := action(index, canvas); err != nil {
+			return err
+		}
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return nil
+}
+
+func copyRGBA(src *image.RGBA) *image.RGBA {
+	dst := image.NewRGBA(src.Bounds())
+	copy(dst.Pix, src.Pix)
+	return dst
+}
@@ -0,0 +1,142 @@
+package imageutil
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"math/bits"
+
+	// for image processing
+	_ "image/jpeg"
+	// for image processing
+	_ "image/png"
+
+	exception "github.com/blend/go-sdk/ex"
+)
+
+const (
+	// MaxSampledFrames is the maximum number of frames of an animated gif that contribute to the hash.
+	MaxSampledFrames = 5
+
+	hashWidth  = 9
+	hashHeight = 8
+)
+
+// PerceptualHash computes a difference hash (dHash) for an image.
+// For animated gifs the first frame and a few evenly spaced frames are hashed
+// and combined by majority vote per bit, so re-encoded or resized copies
+// of the same gif hash to (nearly) the same value.
+func PerceptualHash(contents []byte) (uint64, error) {
+	frames, err := sampleFrames(contents)
+	if err != nil {
+		return 0, err
+	}
+
+	var counts [64]int
+	for _, frame := range frames {
+		hash := DifferenceHash(frame)
+		for bit := 0; bit < 64; bit++ {
+			if hash&(1<<uint(bit)) != 0 {
+				counts[bit]++
+			}
+		}
+	}
+
+	var hash uint64
+	for bit := 0; bit < 64; bit++ {
+		if counts[bit]*2 > len(frames) {
+			hash |= 1 << uint(bit)
+		}
+	}
+	return hash, nil
+}
+
+// DifferenceHash computes the dHash of a single image.
+func DifferenceHash(img image.Image) uint64 {
+	pixels := downsampleGray(img, hashWidth, hashHeight)
+
+	var hash uint64
+	var bit uint
+	for y := 0; y < hashHeight; y++ {
+		for x := 0; x < hashWidth-1; x++ {
+			if pixels[y*hashWidth+x] < pixels[y*hashWidth+x+1] {
+				hash |= 1 << bit
+			}
+			bit++
+		}
+	}
+	return hash
+}
+
+// HammingDistance returns the number of bits that differ between two hashes.
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// sampleFrames decodes the frames that should contribute to the hash.
+func sampleFrames(contents []byte) ([]image.Image, error) {
+	anim, err := gif.DecodeAll(bytes.NewReader(contents))
+	if err != nil || len(anim.Image) < 2 {
+		img, _, err := image.Decode(bytes.NewReader(contents))
+		if err != nil {
+			return nil, exception.New(err)
+		}
+		return []image.Image{img}, nil
+	}
+
+	wanted := sampledFrameIndexes(len(anim.Image), MaxSampledFrames)
+	var frames []image.Image
+	err = eachFrame(anim, func(index int, canvas *image.RGBA) error {
+		if wanted[index] {
+			frames = append(frames, copyRGBA(canvas))
+		}
+		return nil
+	})
+	return frames, err
+}
+
+// sampledFrameIndexes returns the first frame plus evenly spaced frames after it.
+func sampledFrameIndexes(frameCount, maxFrames int) map[int]bool {
+	output := map[int]bool{0: true}
+	if frameCount <= maxFrames {
+		for x := 0; x < frameCount; x++ {
+			output[x] = true
+		}
+		return output
+	}
+	step := float64(frameCount-1) / float64(maxFrames-1)
+	for x := 1; x < maxFrames; x++ {
+		output[int(float64(x)*step)] = true
+	}
+	return output
+}
+
+// downsampleGray box-filters an image down to a width x height grid of luminance values.
+func downsampleGray(img image.Image, width, height int) []float64 {
+	bounds := img.Bounds()
+	sums := make([]float64, width*height)
+	counts := make([]float64, width*height)
+
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	if srcWidth == 0 || srcHeight == 0 {
+		return sums
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		cellY := (y - bounds.Min.Y) * height / srcHeight
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			cellX := (x - bounds.Min.X) * width / srcWidth
+			r, g, b, _ := img.At(x, y).RGBA()
+			cell := cellY*width + cellX
+			sums[cell] += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			counts[cell]++
+		}
+	}
+
+	for x := range sums {
+		if counts[x] > 0 {
+			sums[x] = sums[x] / counts[x]
+		}
+	}
+	return sums
+}
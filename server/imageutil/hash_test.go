@@ -0,0 +1,99 @@
+package imageutil
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+)
+
+func gradient(width, height int, invert bool) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			value := uint8((x * 255) / width)
+			if invert {
+				value = 255 - value
+			}
+			img.Set(x, y, color.RGBA{R: value, G: uint8((y * 255) / height), B: value, A: 255})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	buffer := new(bytes.Buffer)
+	assert.New(t).Nil(png.Encode(buffer, img))
+	return buffer.Bytes()
+}
+
+func encodeGIF(t *testing.T, frames ...image.Image) []byte {
+	anim := &gif.GIF{}
+	for _, frame := range frames {
+		paletted := image.NewPaletted(frame.Bounds(), palette.Plan9)
+		for y := frame.Bounds().Min.Y; y < frame.Bounds().Max.Y; y++ {
+			for x := frame.Bounds().Min.X; x < frame.Bounds().Max.X; x++ {
+				paletted.Set(x, y, frame.At(x, y))
+			}
+		}
+		anim.Image = append(anim.Image, paletted)
+		anim.Delay = append(anim.Delay, 10)
+	}
+	buffer := new(bytes.Buffer)
+	assert.New(t).Nil(gif.EncodeAll(buffer, anim))
+	return buffer.Bytes()
+}
+
+func TestPerceptualHashResized(t *testing.T) {
+	assert := assert.New(t)
+
+	original, err := PerceptualHash(encodePNG(t, gradient(320, 240, false)))
+	assert.Nil(err)
+	resized, err := PerceptualHash(encodePNG(t, gradient(160, 120, false)))
+	assert.Nil(err)
+	inverted, err := PerceptualHash(encodePNG(t, gradient(320, 240, true)))
+	assert.Nil(err)
+
+	assert.True(HammingDistance(original, resized) <= 4)
+	assert.True(HammingDistance(original, inverted) > 32)
+}
+
+func TestPerceptualHashAnimated(t *testing.T) {
+	assert := assert.New(t)
+
+	frame := gradient(200, 200, false)
+	animated, err := PerceptualHash(encodeGIF(t, frame, frame, gradient(200, 200, true), frame))
+	assert.Nil(err)
+	still, err := PerceptualHash(encodePNG(t, frame))
+	assert.Nil(err)
+
+	assert.True(HammingDistance(animated, still) <= 4)
+}
+
+func TestPerceptualHashInvalid(t *testing.T) {
+	assert := assert.New(t)
+	_, err := PerceptualHash([]byte("not an image"))
+	assert.NotNil(err)
+}
+
+func TestSampledFrameIndexes(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Len(sampledFrameIndexes(3, 5), 3)
+	indexes := sampledFrameIndexes(100, 5)
+	assert.Len(indexes, 5)
+	assert.True(indexes[0])
+	assert.True(indexes[99])
+}
+
+func TestHammingDistance(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(0, HammingDistance(0xff, 0xff))
+	assert.Equal(8, HammingDistance(0xff, 0x00))
+	assert.Equal(64, HammingDistance(0, ^uint64(0)))
+}
@@ -0,0 +1,81 @@
+package jobs
+
+import (
+	"context"
+	"io/ioutil"
+	"time"
+
+	"github.com/blend/go-sdk/cron"
+	"github.com/blend/go-sdk/ex"
+	"github.com/blend/go-sdk/logger"
+	"github.com/wcharczuk/giffy/server/filemanager"
+	"github.com/wcharczuk/giffy/server/model"
+)
+
+// computePerceptualHashesBatchSize is how many images are read at a time.
+const computePerceptualHashesBatchSize = 100
+
+// ComputePerceptualHashes backfills perceptual hashes for images uploaded before they were computed on upload.
+type ComputePerceptualHashes struct {
+	Log   logger.Log
+	Model *model.Manager
+	Files *filemanager.FileManager
+}
+
+// Name returns the job name.
+func (cph ComputePerceptualHashes) Name() string {
+	return "compute_perceptual_hashes"
+}
+
+// Schedule returns the schedule.
+func (cph ComputePerceptualHashes) Schedule() cron.Schedule {
+	return cron.Every(30 * time.Minute)
+}
+
+// Execute runs the job.
+// Failures are recorded against the image, so images that can't be hashed are only tried a few times.
+func (cph ComputePerceptualHashes) Execute(ctx context.Context) error {
+	for {
+		images, err := cph.Model.GetImagesWithoutPerceptualHash(ctx, computePerceptualHashesBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, image := range images {
+			perceptualHash, err := cph.hash(image)
+			if err != nil {
+				// a single missing or corrupt file shouldn't block the rest of the backfill.
+				logger.MaybeWarningf(cph.Log, "compute_perceptual_hashes: skipping image %s: %v", image.UUID, err)
+				if err = cph.Model.UpdateImagePerceptualHashFailed(ctx, image.ID); err != nil {
+					return err
+				}
+				continue
+			}
+			if err = cph.Model.UpdateImagePerceptualHash(ctx, image.ID, *perceptualHash); err != nil {
+				return err
+			}
+		}
+		if len(images) < computePerceptualHashesBatchSize {
+			return nil
+		}
+	}
+}
+
+// hash returns the perceptual hash for an image's stored contents.
+func (cph ComputePerceptualHashes) hash(image model.Image) (*int64, error) {
+	file, err := cph.Files.GetFile(&filemanager.Location{Bucket: image.S3Bucket, Key: image.S3Key})
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	contents, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	perceptualHash := model.PerceptualHash(contents)
+	if perceptualHash == nil {
+		return nil, ex.New("image contents could not be hashed")
+	}
+	return perceptualHash, nil
+}
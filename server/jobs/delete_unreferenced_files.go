@@ -0,0 +1,108 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/blend/go-sdk/cron"
+	"github.com/blend/go-sdk/ex"
+	"github.com/blend/go-sdk/logger"
+	"github.com/wcharczuk/giffy/server/filemanager"
+	"github.com/wcharczuk/giffy/server/model"
+)
+
+const (
+	// DeleteUnreferencedFilesBatchSize is the number of queued deletions processed per run.
+	DeleteUnreferencedFilesBatchSize = 100
+
+	// DeleteUnreferencedFilesGracePeriod is how long a file stays queued before it's deleted.
+	// It gives uploads that are still saving an image with the same (content addressed) key time to finish.
+	DeleteUnreferencedFilesGracePeriod = time.Hour
+)
+
+// DeleteUnreferencedFiles removes stored files queued for deletion when their image was deleted.
+// Keys are content addressed, so a file is only removed if no image references it anymore;
+// otherwise it's just dropped from the queue.
+type DeleteUnreferencedFiles struct {
+	Log   logger.Log
+	Model *model.Manager
+	Files *filemanager.FileManager
+}
+
+// Name returns the job name.
+func (duf DeleteUnreferencedFiles) Name() string {
+	return "delete_unreferenced_files"
+}
+
+// Schedule returns the schedule.
+func (duf DeleteUnreferencedFiles) Schedule() cron.Schedule {
+	return cron.Every(5 * time.Minute)
+}
+
+// Execute runs the job.
+func (duf DeleteUnreferencedFiles) Execute(ctx context.Context) error {
+	deletions, err := duf.Model.GetFileDeletions(ctx, time.Now().UTC().Add(-DeleteUnreferencedFilesGracePeriod), DeleteUnreferencedFilesBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, deletion := range deletions {
+		location := &filemanager.Location{Bucket: deletion.S3Bucket, Key: deletion.S3Key}
+		referenced, err := duf.Model.IsFileReferenced(ctx, deletion.S3Bucket, deletion.S3Key)
+		if err != nil {
+			return err
+		}
+		if !referenced {
+			if err = duf.delete(ctx, location); err != nil {
+				// leave it queued; it'll be retried on the next run.
+				logger.MaybeWarningf(duf.Log, "delete_unreferenced_files: skipping %s/%s: %v", deletion.S3Bucket, deletion.S3Key, err)
+				continue
+			}
+		}
+		if err = duf.Model.DeleteFileDeletion(ctx, deletion.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delete removes an unreferenced file from storage.
+// An image can start referencing the file between the check and the delete (i.e. a new upload of the same contents),
+// so the references are checked again afterwards, and the file is put back if one showed up.
+func (duf DeleteUnreferencedFiles) delete(ctx context.Context, location *filemanager.Location) error {
+	contents, err := duf.read(location)
+	if ex.Is(err, filemanager.ErrFileNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err = duf.Files.DeleteFile(location); err != nil && !ex.Is(err, filemanager.ErrFileNotFound) {
+		return err
+	}
+
+	referenced, err := duf.Model.IsFileReferenced(ctx, location.Bucket, location.Key)
+	if err == nil && !referenced {
+		return nil
+	}
+	// if we can't tell, err on the side of keeping the file.
+	logger.MaybeWarningf(duf.Log, "delete_unreferenced_files: restoring %s/%s", location.Bucket, location.Key)
+	if restoreErr := duf.Files.Storage().UploadFile(location, bytes.NewReader(contents), filemanager.FileType{Extension: path.Ext(location.Key), MimeType: http.DetectContentType(contents)}); restoreErr != nil {
+		return restoreErr
+	}
+	return err
+}
+
+func (duf DeleteUnreferencedFiles) read(location *filemanager.Location) ([]byte, error) {
+	file, err := duf.Files.GetFile(location)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	contents, err := ioutil.ReadAll(file)
+	return contents, ex.New(err)
+}
@@ -0,0 +1,76 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/ex"
+	"github.com/blend/go-sdk/testutil"
+	"github.com/blend/go-sdk/uuid"
+	"github.com/wcharczuk/giffy/server/filemanager"
+	"github.com/wcharczuk/giffy/server/model"
+)
+
+// createTestStoredImage creates a test image whose original and poster are stored in the file manager.
+func createTestStoredImage(assert *assert.Assertions, m *model.Manager, fm *filemanager.FileManager, userID int64, original, poster string) *model.Image {
+	ctx := context.TODO()
+	image, err := m.CreateTestImage(ctx, userID)
+	assert.Nil(err)
+	originalLocation, err := fm.UploadFile(bytes.NewBufferString(original), filemanager.FileType{Extension: ".gif"})
+	assert.Nil(err)
+	posterLocation, err := fm.UploadFile(bytes.NewBufferString(poster), filemanager.FileType{Extension: ".jpg"})
+	assert.Nil(err)
+	_, err = m.Invoke(ctx).Exec(`update image set s3_bucket = $2, s3_key = $3 where id = $1`, image.ID, fm.Bucket(), originalLocation.Key)
+	assert.Nil(err)
+	assert.Nil(m.UpdateImageDerivatives(ctx, image.ID, posterLocation.Key, ""))
+	image, err = m.GetImageByID(ctx, image.ID)
+	assert.Nil(err)
+	return image
+}
+
+func TestDeleteUnreferencedFiles(t *testing.T) {
+	assert := assert.New(t)
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+	ctx := context.TODO()
+
+	storage := filemanager.NewMemoryStorage()
+	fm := filemanager.NewWithStorage(uuid.V4().String(), storage)
+
+	u, err := m.CreateTestUser(ctx)
+	assert.Nil(err)
+
+	// both images have the same poster.
+	deleted := createTestStoredImage(assert, &m, fm, u.ID, "deleted", "poster")
+	kept := createTestStoredImage(assert, &m, fm, u.ID, "kept", "poster")
+	assert.Equal(deleted.PosterS3Key, kept.PosterS3Key)
+	assert.Equal(3, storage.Len())
+
+	assert.Nil(m.DeleteImageByID(ctx, deleted.ID))
+	// nothing is removed from storage until the job runs.
+	assert.Equal(3, storage.Len())
+
+	job := DeleteUnreferencedFiles{Model: &m, Files: fm}
+	assert.Nil(job.Execute(ctx))
+	// the files are still inside the grace period.
+	assert.Equal(3, storage.Len())
+
+	_, err = m.Invoke(ctx).Exec(`update file_deletion set created_utc = $1`, time.Now().UTC().Add(-2*DeleteUnreferencedFilesGracePeriod))
+	assert.Nil(err)
+	assert.Nil(job.Execute(ctx))
+
+	assert.Equal(2, storage.Len())
+	_, err = fm.GetFile(&filemanager.Location{Bucket: fm.Bucket(), Key: deleted.S3Key})
+	assert.True(ex.Is(err, filemanager.ErrFileNotFound))
+	_, err = fm.GetFile(&filemanager.Location{Bucket: fm.Bucket(), Key: kept.PosterS3Key})
+	assert.Nil(err)
+
+	deletions, err := m.GetFileDeletions(ctx, time.Now().UTC(), 100)
+	assert.Nil(err)
+	assert.Empty(deletions)
+}
@@ -0,0 +1,80 @@
+package jobs
+
+import (
+	"context"
+	"io/ioutil"
+	"time"
+
+	"github.com/blend/go-sdk/cron"
+	"github.com/blend/go-sdk/logger"
+	"github.com/wcharczuk/giffy/server/filemanager"
+	"github.com/wcharczuk/giffy/server/model"
+)
+
+// generateImageDerivativesBatchSize is how many images are read at a time.
+const generateImageDerivativesBatchSize = 100
+
+// GenerateImageDerivatives backfills posters and thumbnails for images that are missing them.
+type GenerateImageDerivatives struct {
+	Log   logger.Log
+	Model *model.Manager
+	Files *filemanager.FileManager
+}
+
+// Name returns the job name.
+func (gid GenerateImageDerivatives) Name() string {
+	return "generate_image_derivatives"
+}
+
+// Schedule returns the schedule.
+func (gid GenerateImageDerivatives) Schedule() cron.Schedule {
+	return cron.Every(30 * time.Minute)
+}
+
+// Execute runs the job.
+// Failures are recorded against the image, so images that can't be processed are only tried a few times.
+func (gid GenerateImageDerivatives) Execute(ctx context.Context) error {
+	for {
+		images, err := gid.Model.GetImagesWithoutDerivatives(ctx, generateImageDerivativesBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, image := range images {
+			derivatives, err := gid.generate(image)
+			if err != nil {
+				logger.MaybeWarningf(gid.Log, "generate_image_derivatives: skipping image %s: %v", image.UUID, err)
+				if derivatives != nil && derivatives.Poster != nil {
+					if err = gid.Model.QueueFileDeletion(ctx, derivatives.Poster.Bucket, derivatives.Poster.Key); err != nil {
+						return err
+					}
+				}
+				if err = gid.Model.UpdateImageDerivativesFailed(ctx, image.ID); err != nil {
+					return err
+				}
+				continue
+			}
+			if err = gid.Model.UpdateImageDerivatives(ctx, image.ID, derivatives.Poster.Key, derivatives.Thumbnail.Key); err != nil {
+				return err
+			}
+		}
+		if len(images) < generateImageDerivativesBatchSize {
+			return nil
+		}
+	}
+}
+
+// generate uploads derivatives for an image's stored contents; see `FileManager.UploadDerivatives` for partial failures.
+func (gid GenerateImageDerivatives) generate(image model.Image) (*filemanager.Derivatives, error) {
+	file, err := gid.Files.GetFile(&filemanager.Location{Bucket: image.S3Bucket, Key: image.S3Key})
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	contents, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	return gid.Files.UploadDerivatives(contents)
+}
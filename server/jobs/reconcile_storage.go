@@ -0,0 +1,120 @@
+package jobs
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/blend/go-sdk/cron"
+	"github.com/blend/go-sdk/logger"
+	"github.com/wcharczuk/giffy/server/filemanager"
+	"github.com/wcharczuk/giffy/server/model"
+)
+
+// StorageReport is the result of reconciling stored files against the image rows that reference them.
+type StorageReport struct {
+	GeneratedUTC time.Time `json:"generated_utc"`
+	// StoredFiles is the number of files in storage.
+	StoredFiles int `json:"stored_files"`
+	// ReferencedFiles is the number of files image rows reference.
+	ReferencedFiles int `json:"referenced_files"`
+	// Orphaned are stored files no image references.
+	// Files queued for deletion show up here until the `delete_unreferenced_files` job removes them.
+	Orphaned []filemanager.Location `json:"orphaned"`
+	// Missing are files image rows reference that aren't in storage.
+	Missing []model.ImageFile `json:"missing"`
+}
+
+// IsClean returns if storage and the image rows agree.
+func (sr StorageReport) IsClean() bool {
+	return len(sr.Orphaned) == 0 && len(sr.Missing) == 0
+}
+
+// ReconcileStorage reports stored files that no image references and image rows whose files are missing.
+// It doesn't fix anything; the report is logged so someone can look.
+type ReconcileStorage struct {
+	Log   logger.Log
+	Model *model.Manager
+	Files *filemanager.FileManager
+}
+
+// Name returns the job name.
+func (rs ReconcileStorage) Name() string {
+	return "reconcile_storage"
+}
+
+// Schedule returns the schedule.
+func (rs ReconcileStorage) Schedule() cron.Schedule {
+	return cron.Every(24 * time.Hour)
+}
+
+// Execute runs the job.
+func (rs ReconcileStorage) Execute(ctx context.Context) error {
+	report, err := rs.Report(ctx)
+	if err != nil {
+		return err
+	}
+	if report.IsClean() {
+		logger.MaybeInfof(rs.Log, "reconcile_storage: %d stored files, all referenced", report.StoredFiles)
+		return nil
+	}
+	for _, orphaned := range report.Orphaned {
+		logger.MaybeWarningf(rs.Log, "reconcile_storage: orphaned file %s/%s", orphaned.Bucket, orphaned.Key)
+	}
+	for _, missing := range report.Missing {
+		logger.MaybeWarningf(rs.Log, "reconcile_storage: image %s is missing its %s file %s/%s", missing.ImageUUID, missing.Kind, missing.S3Bucket, missing.S3Key)
+	}
+	return nil
+}
+
+// Report builds the reconciliation report.
+// Every bucket an image references is listed, along with the file manager's default bucket.
+func (rs ReconcileStorage) Report(ctx context.Context) (*StorageReport, error) {
+	imageFiles, err := rs.Model.GetImageFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	referenced := map[filemanager.Location]bool{}
+	buckets := map[string]bool{rs.Files.Bucket(): true}
+	for _, imageFile := range imageFiles {
+		referenced[filemanager.Location{Bucket: imageFile.S3Bucket, Key: imageFile.S3Key}] = true
+		buckets[imageFile.S3Bucket] = true
+	}
+
+	stored := map[filemanager.Location]bool{}
+	for bucket := range buckets {
+		locations, err := rs.Files.ListFiles(bucket)
+		if err != nil {
+			return nil, err
+		}
+		for _, location := range locations {
+			stored[location] = true
+		}
+	}
+
+	report := StorageReport{
+		GeneratedUTC:    time.Now().UTC(),
+		StoredFiles:     len(stored),
+		ReferencedFiles: len(referenced),
+		Orphaned:        []filemanager.Location{},
+		Missing:         []model.ImageFile{},
+	}
+	for location := range stored {
+		if !referenced[location] {
+			report.Orphaned = append(report.Orphaned, location)
+		}
+	}
+	sort.Slice(report.Orphaned, func(i, j int) bool {
+		if report.Orphaned[i].Bucket != report.Orphaned[j].Bucket {
+			return report.Orphaned[i].Bucket < report.Orphaned[j].Bucket
+		}
+		return report.Orphaned[i].Key < report.Orphaned[j].Key
+	})
+	for _, imageFile := range imageFiles {
+		if !stored[filemanager.Location{Bucket: imageFile.S3Bucket, Key: imageFile.S3Key}] {
+			report.Missing = append(report.Missing, imageFile)
+		}
+	}
+	return &report, nil
+}
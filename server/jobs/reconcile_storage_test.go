@@ -0,0 +1,48 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/testutil"
+	"github.com/blend/go-sdk/uuid"
+	"github.com/wcharczuk/giffy/server/filemanager"
+	"github.com/wcharczuk/giffy/server/model"
+)
+
+func TestReconcileStorage(t *testing.T) {
+	assert := assert.New(t)
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := model.NewTestManager(tx)
+	ctx := context.TODO()
+
+	fm := filemanager.NewWithStorage(uuid.V4().String(), filemanager.NewMemoryStorage())
+
+	u, err := m.CreateTestUser(ctx)
+	assert.Nil(err)
+	stored := createTestStoredImage(assert, &m, fm, u.ID, "stored", "stored poster")
+	missing := createTestStoredImage(assert, &m, fm, u.ID, "missing", "missing poster")
+	assert.Nil(fm.DeleteFile(&filemanager.Location{Bucket: fm.Bucket(), Key: missing.PosterS3Key}))
+	orphaned, err := fm.UploadFile(bytes.NewBufferString("orphaned"), filemanager.FileType{Extension: ".gif"})
+	assert.Nil(err)
+
+	report, err := ReconcileStorage{Model: &m, Files: fm}.Report(ctx)
+	assert.Nil(err)
+	assert.False(report.IsClean())
+	assert.Equal([]filemanager.Location{*orphaned}, report.Orphaned)
+
+	var missingFiles []model.ImageFile
+	for _, imageFile := range report.Missing {
+		if imageFile.S3Bucket == fm.Bucket() {
+			missingFiles = append(missingFiles, imageFile)
+		}
+		assert.NotEqual(stored.UUID, imageFile.ImageUUID)
+	}
+	assert.Len(missingFiles, 1)
+	assert.Equal(missing.UUID, missingFiles[0].ImageUUID)
+	assert.Equal(model.ImageFilePoster, missingFiles[0].Kind)
+}
@@ -0,0 +1,119 @@
+package model
+
+import (
+	"time"
+
+	"github.com/blend/go-sdk/crypto"
+	"github.com/blend/go-sdk/ex"
+	"github.com/blend/go-sdk/stringutil"
+	"github.com/blend/go-sdk/uuid"
+)
+
+const (
+	// APITokenScopeRead lets a token read data that requires a session.
+	APITokenScopeRead = "read"
+	// APITokenScopeUpload lets a token upload images.
+	APITokenScopeUpload = "upload"
+	// APITokenScopeVote lets a token tag images and cast votes.
+	APITokenScopeVote = "vote"
+	// APITokenScopeModerate lets a token perform moderator actions (if the user is a moderator).
+	APITokenScopeModerate = "moderate"
+
+	// APITokenPrefix is prepended to api tokens so they're recognizable.
+	APITokenPrefix = "gfy_"
+)
+
+const (
+	// ErrAPITokenScopeInvalid is returned when a requested scope doesn't exist.
+	ErrAPITokenScopeInvalid ex.Class = "invalid api token scope"
+)
+
+// APITokenScopes are all the valid api token scopes.
+var APITokenScopes = []string{
+	APITokenScopeRead,
+	APITokenScopeUpload,
+	APITokenScopeVote,
+	APITokenScopeModerate,
+}
+
+// NewAPIToken returns a new api token along with the plaintext token value.
+// Only the hash of the token is stored, so the plaintext has to be handed back to the user now.
+func NewAPIToken(userID int64, name string, scopes []string, expiresUTC *time.Time, key []byte) (*APIToken, string, error) {
+	if len(key) == 0 {
+		return nil, "", ex.New("`ENCRYPTION_KEY` is not set, cannot continue.")
+	}
+	for _, scope := range scopes {
+		if !containsString(APITokenScopes, scope) {
+			return nil, "", ex.New(ErrAPITokenScopeInvalid, ex.OptMessagef("scope: %s", scope))
+		}
+	}
+
+	token := APITokenPrefix + stringutil.Random(stringutil.LettersAndNumbers, 40)
+	return &APIToken{
+		UUID:       uuid.V4().String(),
+		UserID:     userID,
+		CreatedUTC: time.Now().UTC(),
+		Name:       name,
+		TokenHash:  HashAPIToken(token, key),
+		Scopes:     scopes,
+		ExpiresUTC: expiresUTC,
+	}, token, nil
+}
+
+// HashAPIToken hashes an api token the same way user auth tokens are hashed.
+func HashAPIToken(token string, key []byte) []byte {
+	return crypto.HMAC512(key, []byte(token))
+}
+
+// APIToken is a personal access token for the api.
+type APIToken struct {
+	ID          int64      `json:"-" db:"id,pk,serial"`
+	UUID        string     `json:"uuid" db:"uuid"`
+	UserID      int64      `json:"-" db:"user_id"`
+	CreatedUTC  time.Time  `json:"created_utc" db:"created_utc"`
+	Name        string     `json:"name" db:"name"`
+	TokenHash   []byte     `json:"-" db:"token_hash"`
+	Scopes      []string   `json:"scopes" db:"scopes,json"`
+	ExpiresUTC  *time.Time `json:"expires_utc,omitempty" db:"expires_utc"`
+	LastUsedUTC *time.Time `json:"last_used_utc,omitempty" db:"last_used_utc"`
+	RevokedUTC  *time.Time `json:"revoked_utc,omitempty" db:"revoked_utc"`
+}
+
+// TableName returns the table name.
+func (at APIToken) TableName() string {
+	return "api_token"
+}
+
+// IsZero returns if the object has been set or not.
+func (at APIToken) IsZero() bool {
+	return at.ID == 0
+}
+
+// IsRevoked returns if the token has been revoked.
+func (at APIToken) IsRevoked() bool {
+	return at.RevokedUTC != nil
+}
+
+// IsExpired returns if the token has expired as of a given time.
+func (at APIToken) IsExpired(asOf time.Time) bool {
+	return at.ExpiresUTC != nil && !asOf.Before(*at.ExpiresUTC)
+}
+
+// IsValid returns if the token can be used as of a given time.
+func (at APIToken) IsValid(asOf time.Time) bool {
+	return !at.IsZero() && !at.IsRevoked() && !at.IsExpired(asOf)
+}
+
+// HasScope returns if the token was granted a given scope.
+func (at APIToken) HasScope(scope string) bool {
+	return containsString(at.Scopes, scope)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/crypto"
+	"github.com/blend/go-sdk/ex"
+	"github.com/blend/go-sdk/testutil"
+)
+
+func TestNewAPIToken(t *testing.T) {
+	assert := assert.New(t)
+
+	key, err := crypto.CreateKey(32)
+	assert.Nil(err)
+
+	at, token, err := NewAPIToken(1, "test", []string{APITokenScopeRead, APITokenScopeVote}, nil, key)
+	assert.Nil(err)
+	assert.True(len(token) > len(APITokenPrefix))
+	assert.Equal(APITokenPrefix, token[:len(APITokenPrefix)])
+	assert.Equal(HashAPIToken(token, key), at.TokenHash)
+	assert.True(at.HasScope(APITokenScopeRead))
+	assert.True(at.HasScope(APITokenScopeVote))
+	assert.False(at.HasScope(APITokenScopeModerate))
+	assert.False(at.IsRevoked())
+	assert.False(at.IsExpired(time.Now().UTC()))
+
+	_, _, err = NewAPIToken(1, "test", []string{"not-a-scope"}, nil, key)
+	assert.True(ex.Is(err, ErrAPITokenScopeInvalid))
+
+	_, _, err = NewAPIToken(1, "test", []string{APITokenScopeRead}, nil, nil)
+	assert.NotNil(err)
+}
+
+func TestAPITokenIsValid(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now().UTC()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	assert.True((&APIToken{ID: 1, ExpiresUTC: &future}).IsValid(now))
+	assert.False((&APIToken{ID: 1, ExpiresUTC: &past}).IsValid(now))
+	assert.False((&APIToken{ID: 1, RevokedUTC: &past}).IsValid(now))
+}
+
+func TestGetAPITokenByToken(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	key, err := crypto.CreateKey(32)
+	assert.Nil(err)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+
+	at, token, err := m.CreateTestAPIToken(todo, u.ID, key, APITokenScopeRead)
+	assert.Nil(err)
+
+	verify, err := m.GetAPITokenByToken(todo, token, key)
+	assert.Nil(err)
+	assert.False(verify.IsZero())
+	assert.Equal(at.UUID, verify.UUID)
+	assert.Equal(u.ID, verify.UserID)
+	assert.Equal([]string{APITokenScopeRead}, verify.Scopes)
+
+	missing, err := m.GetAPITokenByToken(todo, "gfy_not_a_token", key)
+	assert.Nil(err)
+	assert.True(missing.IsZero())
+
+	byUUID, err := m.GetAPITokenByUUID(todo, at.UUID)
+	assert.Nil(err)
+	assert.Equal(at.ID, byUUID.ID)
+
+	all, err := m.GetAPITokensForUserID(todo, u.ID)
+	assert.Nil(err)
+	assert.Len(all, 1)
+}
+
+func TestRevokeAPIToken(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	key, err := crypto.CreateKey(32)
+	assert.Nil(err)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+
+	at, token, err := m.CreateTestAPIToken(todo, u.ID, key, APITokenScopeRead)
+	assert.Nil(err)
+
+	assert.Nil(m.UpdateAPITokenLastUsed(todo, at.ID, time.Now().UTC()))
+	assert.Nil(m.RevokeAPIToken(todo, at.ID))
+
+	verify, err := m.GetAPITokenByToken(todo, token, key)
+	assert.Nil(err)
+	assert.False(verify.IsZero())
+	assert.NotNil(verify.LastUsedUTC)
+	assert.True(verify.IsRevoked())
+	assert.False(verify.IsValid(time.Now().UTC()))
+}
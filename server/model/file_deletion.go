@@ -0,0 +1,48 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	// ImageFileOriginal is the uploaded image.
+	ImageFileOriginal = "original"
+	// ImageFilePoster is the still poster frame.
+	ImageFilePoster = "poster"
+	// ImageFileThumbnail is the downscaled thumbnail.
+	ImageFileThumbnail = "thumbnail"
+	// ImageFileVideo is the video rendition of a gif.
+	ImageFileVideo = "video"
+)
+
+// FileDeletion is a stored file queued for deletion when the image that referenced it was deleted.
+// Keys are content addressed, so the file is only removed if no other image references it by the time it's processed.
+type FileDeletion struct {
+	ID         int64     `json:"id" db:"id,pk,serial"`
+	CreatedUTC time.Time `json:"created_utc" db:"created_utc"`
+	S3Bucket   string    `json:"s3_bucket" db:"s3_bucket"`
+	S3Key      string    `json:"s3_key" db:"s3_key"`
+}
+
+// TableName returns the table name.
+func (fd FileDeletion) TableName() string {
+	return "file_deletion"
+}
+
+// IsZero returns if the object has been set.
+func (fd FileDeletion) IsZero() bool {
+	return fd.ID == 0
+}
+
+// ImageFile is a stored file an image references.
+type ImageFile struct {
+	ImageUUID string `json:"image_uuid" db:"image_uuid"`
+	Kind      string `json:"kind" db:"kind"`
+	S3Bucket  string `json:"s3_bucket" db:"s3_bucket"`
+	S3Key     string `json:"s3_key" db:"s3_key"`
+}
+
+// TableName returns the table name.
+func (imf ImageFile) TableName() string {
+	return "image_file"
+}
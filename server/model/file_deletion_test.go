@@ -0,0 +1,99 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/testutil"
+	"github.com/blend/go-sdk/uuid"
+)
+
+func TestDeleteImageByIDQueuesFiles(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+
+	// the posters are identical, so they share a key.
+	posterKey := uuid.V4().String() + ".jpg"
+	deleted, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	assert.Nil(m.UpdateImageDerivatives(todo, deleted.ID, posterKey, uuid.V4().String()+".gif"))
+	kept, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	assert.Nil(m.UpdateImageDerivatives(todo, kept.ID, posterKey, uuid.V4().String()+".gif"))
+	_, err = m.Invoke(todo).Exec(`update image set s3_bucket = $2 where id = $1`, kept.ID, deleted.S3Bucket)
+	assert.Nil(err)
+
+	files, err := m.GetImageFiles(todo)
+	assert.Nil(err)
+	var deletedFiles int
+	for _, file := range files {
+		if file.ImageUUID == deleted.UUID {
+			deletedFiles++
+		}
+	}
+	assert.Equal(3, deletedFiles)
+
+	assert.Nil(m.DeleteImageByID(todo, deleted.ID))
+
+	deletions, err := m.GetFileDeletions(todo, time.Now().UTC(), 100)
+	assert.Nil(err)
+	queued := map[string]FileDeletion{}
+	for _, deletion := range deletions {
+		queued[deletion.S3Key] = deletion
+	}
+	assert.Len(queued, 3)
+	assert.NotZero(queued[deleted.S3Key].ID)
+	assert.NotZero(queued[posterKey].ID)
+
+	referenced, err := m.IsFileReferenced(todo, deleted.S3Bucket, deleted.S3Key)
+	assert.Nil(err)
+	assert.False(referenced)
+	referenced, err = m.IsFileReferenced(todo, deleted.S3Bucket, posterKey)
+	assert.Nil(err)
+	assert.True(referenced)
+
+	assert.Nil(m.DeleteFileDeletion(todo, queued[deleted.S3Key].ID))
+	deletions, err = m.GetFileDeletions(todo, time.Now().UTC(), 100)
+	assert.Nil(err)
+	assert.Len(deletions, 2)
+}
+
+func TestQueueFileDeletion(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	key := uuid.V4().String() + ".jpg"
+	assert.Nil(m.QueueFileDeletion(todo, "test-bucket", key))
+	// queueing the same file again is a no-op.
+	assert.Nil(m.QueueFileDeletion(todo, "test-bucket", key))
+
+	deletions, err := m.GetFileDeletions(todo, time.Now().UTC(), 100)
+	assert.Nil(err)
+	var queued int
+	for _, deletion := range deletions {
+		if deletion.S3Key == key {
+			queued++
+			assert.Equal("test-bucket", deletion.S3Bucket)
+		}
+	}
+	assert.Equal(1, queued)
+
+	deletions, err = m.GetFileDeletions(todo, time.Now().UTC().Add(-time.Hour), 100)
+	assert.Nil(err)
+	for _, deletion := range deletions {
+		assert.NotEqual(key, deletion.S3Key)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	exception "github.com/blend/go-sdk/ex"
 	"github.com/blend/go-sdk/uuid"
 	"github.com/wcharczuk/giffy/server/core"
+	"github.com/wcharczuk/giffy/server/imageutil"
 )
 
 const (
@@ -36,6 +37,21 @@ const (
 
 	// MinImageHeightOrWidth is the minimum height or width.
 	MinImageHeightOrWidth = 300
+
+	// MaxPerceptualHashAttempts is how many times the backfill tries to hash an image before giving up on it.
+	MaxPerceptualHashAttempts = 3
+
+	// MaxDerivativesAttempts is how many times the backfill tries to generate an image's derivatives before giving up on it.
+	MaxDerivativesAttempts = 3
+)
+
+const (
+	// ImageReviewStatePending is an image waiting on a moderator; it is hidden from search.
+	ImageReviewStatePending = "pending"
+	// ImageReviewStateApproved is an image that shows up in search.
+	ImageReviewStateApproved = "approved"
+	// ImageReviewStateRejected is an image a moderator turned down; it is hidden from search.
+	ImageReviewStateRejected = "rejected"
 )
 
 // ConvertMD5 takes a fixed buffer and turns it into a byte slice.
@@ -62,15 +78,33 @@ type Image struct {
 	S3Bucket string `json:"s3_bucket" db:"s3_bucket"`
 	S3Key    string `json:"s3_key" db:"s3_key"`
 
+	PosterS3Key    string `json:"poster_s3_key,omitempty" db:"poster_s3_key"`
+	ThumbnailS3Key string `json:"thumbnail_s3_key,omitempty" db:"thumbnail_s3_key"`
+	VideoS3Key     string `json:"video_s3_key,omitempty" db:"video_s3_key"`
+
 	Width  int `json:"width" db:"width"`
 	Height int `json:"height" db:"height"`
 
 	FileSize  int    `json:"file_size" db:"file_size"`
 	Extension string `json:"extension" db:"extension"`
 
+	PerceptualHash *int64 `json:"perceptual_hash,omitempty" db:"perceptual_hash"`
+
+	ReviewState string `json:"review_state" db:"review_state"`
+
 	Tags []Tag `json:"tags,omitempty" db:"-"`
 }
 
+// IsApproved returns if the image has been approved to show up in search.
+func (i Image) IsApproved() bool {
+	return i.ReviewState == ImageReviewStateApproved
+}
+
+// HasDerivatives returns if the poster and thumbnail have been generated for the image.
+func (i Image) HasDerivatives() bool {
+	return len(i.PosterS3Key) > 0 && len(i.ThumbnailS3Key) > 0
+}
+
 // TableName returns the tablename for the object.
 func (i Image) TableName() string {
 	return "image"
@@ -106,24 +140,42 @@ func (i *Image) Populate(r db.Rows) error {
 		&i.MD5,
 		&i.S3Bucket,
 		&i.S3Key,
+		&i.PosterS3Key,
+		&i.ThumbnailS3Key,
+		&i.VideoS3Key,
 		&i.Width,
 		&i.Height,
 		&i.FileSize,
 		&i.Extension,
+		&i.PerceptualHash,
+		&i.ReviewState,
 	))
 }
 
+// PerceptualHash returns the perceptual hash for an image's contents as it is stored in the db.
+// It returns nil if the contents could not be hashed.
+func PerceptualHash(fileContents []byte) *int64 {
+	hash, err := imageutil.PerceptualHash(fileContents)
+	if err != nil {
+		return nil
+	}
+	value := int64(hash)
+	return &value
+}
+
 // NewImage returns a new instance of an image.
 func NewImage() *Image {
 	return &Image{
 		UUID:          uuid.V4().String(),
 		CreatedUTC:    time.Now().UTC(),
 		ContentRating: ContentRatingPG13,
+		ReviewState:   ImageReviewStateApproved,
 	}
 }
 
 // NewImageFromPostedFile creates an image and parses the meta data for an image from a posted file.
-func NewImageFromPostedFile(userID int64, shouldValidate bool, fileContents []byte, fileName string) (*Image, error) {
+// The perceptual hash is passed in, as it's computed before upload to look for duplicates (see `PerceptualHash`).
+func NewImageFromPostedFile(userID int64, shouldValidate bool, fileContents []byte, perceptualHash *int64, fileName string) (*Image, error) {
 	newImage := NewImage()
 	newImage.MD5 = ConvertMD5(md5.Sum(fileContents))
 	newImage.CreatedBy = userID
@@ -143,6 +195,7 @@ func NewImageFromPostedFile(userID int64, shouldValidate bool, fileContents []by
 	newImage.Height = imageMeta.Height
 	newImage.Width = imageMeta.Width
 	newImage.FileSize = len(fileContents)
+	newImage.PerceptualHash = perceptualHash
 
 	if shouldValidate {
 		if newImage.Width < MinImageWidth {
@@ -362,3 +415,60 @@ func (isda imageSignaturesScoreDescending) Swap(i, j int) {
 func (isda imageSignaturesScoreDescending) Less(i, j int) bool {
 	return isda[i].Score > isda[j].Score
 }
+
+// --------------------------------------------------------------------------------
+// Perceptual Hash Bands
+// --------------------------------------------------------------------------------
+
+const (
+	// perceptualHashBands is how many bands the hash is split into; each band has an index on the image table.
+	perceptualHashBands = 4
+	// perceptualHashBandBits is the width of a band.
+	perceptualHashBandBits = 64 / perceptualHashBands
+	// perceptualHashBandMaxDistance is the largest per band distance that is looked up with the band indexes.
+	// Past it there are too many band values to list, so the lookup falls back to checking every hashed image.
+	perceptualHashBandMaxDistance = 2
+)
+
+// perceptualHashBandsPredicate returns a where clause (starting with `and`) that narrows the image table to
+// candidates within a given hamming distance of a hash, using the band indexes.
+//
+// If two hashes are within `maxDistance` of each other, then at least one of their bands is within
+// `maxDistance / perceptualHashBands` of each other (otherwise the bands would add up to more than `maxDistance`),
+// so it's enough to look up every band value that close to one of the hash's bands.
+// The expressions here have to match the ones in the `ix_image_perceptual_hash_band_*` indexes.
+func perceptualHashBandsPredicate(perceptualHash int64, maxDistance int) string {
+	bandDistance := maxDistance / perceptualHashBands
+	if bandDistance > perceptualHashBandMaxDistance {
+		return ""
+	}
+	var bands []string
+	for band := 0; band < perceptualHashBands; band++ {
+		values := perceptualHashBandNeighbors(perceptualHashBand(perceptualHash, band), bandDistance)
+		bands = append(bands, fmt.Sprintf("((perceptual_hash >> %d) & 65535) in (%s)", band*perceptualHashBandBits, csvOfInt(values)))
+	}
+	return fmt.Sprintf("and (%s)", strings.Join(bands, " or "))
+}
+
+// perceptualHashBand returns one of the bands of a hash.
+func perceptualHashBand(perceptualHash int64, band int) int64 {
+	return int64((uint64(perceptualHash) >> uint(band*perceptualHashBandBits)) & (1<<perceptualHashBandBits - 1))
+}
+
+// perceptualHashBandNeighbors returns every band value within a given hamming distance of a band value (including itself).
+func perceptualHashBandNeighbors(value int64, distance int) []int64 {
+	neighbors := []int64{value}
+	var flip func(current int64, from, remaining int)
+	flip = func(current int64, from, remaining int) {
+		if remaining == 0 {
+			return
+		}
+		for bit := from; bit < perceptualHashBandBits; bit++ {
+			next := current ^ (1 << uint(bit))
+			neighbors = append(neighbors, next)
+			flip(next, bit+1, remaining-1)
+		}
+	}
+	flip(value, 0, distance)
+	return neighbors
+}
@@ -3,9 +3,12 @@ package model
 import (
 	"context"
 	"fmt"
+	"math/bits"
 	"math/rand"
 	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/blend/go-sdk/assert"
 	"github.com/blend/go-sdk/stringutil"
@@ -161,6 +164,63 @@ func TestDeleteImageByID(t *testing.T) {
 	assert.True(verify.IsZero())
 }
 
+func TestCreateImageWithTags(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+
+	existing, err := m.CreateTestTag(todo, u.ID, "__test_existing_"+uuid.V4().String())
+	assert.Nil(err)
+	newTagValue := "__test_new_" + uuid.V4().String()
+
+	i := NewImage()
+	i.CreatedBy = u.ID
+	i.Extension = "gif"
+	i.Width = 720
+	i.Height = 480
+	i.S3Bucket = uuid.V4().String()
+	i.S3Key = uuid.V4().String()
+	i.MD5 = uuid.V4()
+	i.DisplayName = "Test Image"
+
+	err = m.CreateImageWithTags(todo, i, []string{existing.TagValue, newTagValue, existing.TagValue})
+	assert.Nil(err)
+	assert.False(i.IsZero())
+	assert.Len(i.Tags, 2)
+
+	tags, err := m.GetTagsForImageID(todo, i.ID)
+	assert.Nil(err)
+	assert.Len(tags, 2)
+
+	created, err := m.GetTagByValue(todo, newTagValue)
+	assert.Nil(err)
+	assert.False(created.IsZero())
+	assert.Equal(u.ID, created.CreatedBy)
+
+	for _, tagID := range []int64{existing.ID, created.ID} {
+		summary, err := m.GetVoteSummary(todo, i.ID, tagID)
+		assert.Nil(err)
+		assert.Equal(1, summary.VotesFor)
+		assert.Equal(1, summary.VotesTotal)
+
+		vote, err := m.GetVote(todo, u.ID, i.ID, tagID)
+		assert.Nil(err)
+		assert.True(vote.IsUpvote)
+	}
+
+	moderation, err := m.GetModerationForUserID(todo, u.ID)
+	assert.Nil(err)
+	assert.Len(moderation, 1)
+	assert.Equal(ModerationObjectImage, moderation[0].Object)
+	assert.Equal(i.UUID, moderation[0].Noun)
+}
+
 func TestImageMD5Check(t *testing.T) {
 	assert := assert.New(t)
 	todo := context.TODO()
@@ -180,6 +240,205 @@ func TestImageMD5Check(t *testing.T) {
 	assert.False(verify.IsZero())
 }
 
+func TestGetSimilarImages(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+
+	exact, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	assert.Nil(m.UpdateImagePerceptualHash(todo, exact.ID, 0x0f0f))
+
+	near, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	assert.Nil(m.UpdateImagePerceptualHash(todo, near.ID, 0x0f0c))
+
+	far, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	assert.Nil(m.UpdateImagePerceptualHash(todo, far.ID, -1))
+
+	similar, err := m.GetSimilarImages(todo, 0x0f0f, 4)
+	assert.Nil(err)
+	assert.Len(similar, 2)
+	assert.Equal(exact.ID, similar[0].ID)
+	assert.Equal(near.ID, similar[1].ID)
+	assert.NotNil(similar[0].PerceptualHash)
+
+	closest, err := m.GetSimilarImage(todo, 0x0f0b, 4)
+	assert.Nil(err)
+	assert.Equal(exact.ID, closest.ID)
+
+	missing, err := m.GetSimilarImage(todo, 0x7070707070, 4)
+	assert.Nil(err)
+	assert.True(missing.IsZero())
+
+	// a distance spread over every band is still found.
+	spread, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	assert.Nil(m.UpdateImagePerceptualHash(todo, spread.ID, 0x5555000000000000^0x0003000300030003))
+	similar, err = m.GetSimilarImages(todo, 0x5555000000000000, 8)
+	assert.Nil(err)
+	assert.Len(similar, 1)
+	assert.Equal(spread.ID, similar[0].ID)
+
+	// as is one past where the band indexes are used.
+	similar, err = m.GetSimilarImages(todo, -1, 64)
+	assert.Nil(err)
+	assert.True(len(similar) >= 4)
+
+	unhashed, err := m.GetImagesWithoutPerceptualHash(todo, 1<<20)
+	assert.Nil(err)
+	for _, i := range unhashed {
+		assert.NotEqual(far.ID, i.ID)
+	}
+}
+
+func TestPerceptualHashBand(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(0x3210, perceptualHashBand(0x7654321076543210, 0))
+	assert.Equal(0x7654, perceptualHashBand(0x7654321076543210, 1))
+	assert.Equal(0xffff, perceptualHashBand(-1, 3))
+	assert.Equal(0x8000, perceptualHashBand(-1<<63, 3))
+}
+
+func TestPerceptualHashBandNeighbors(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]int64{0x0f0f}, perceptualHashBandNeighbors(0x0f0f, 0))
+
+	neighbors := perceptualHashBandNeighbors(0x0f0f, 2)
+	assert.Len(neighbors, 1+16+120)
+	seen := map[int64]bool{}
+	for _, neighbor := range neighbors {
+		assert.False(seen[neighbor])
+		seen[neighbor] = true
+		assert.True(bits.OnesCount64(uint64(neighbor^0x0f0f)) <= 2)
+		assert.True(neighbor >= 0 && neighbor <= 0xffff)
+	}
+}
+
+func TestPerceptualHashBandsPredicate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Empty(perceptualHashBandsPredicate(0, 4*(perceptualHashBandMaxDistance+1)))
+	predicate := perceptualHashBandsPredicate(0, 6)
+	assert.True(strings.HasPrefix(predicate, "and ("))
+	assert.Equal(perceptualHashBands, strings.Count(predicate, "perceptual_hash >>"))
+
+	// every hash within the distance has a band close enough to be a candidate.
+	r := rand.New(rand.NewSource(1))
+	for x := 0; x < 1000; x++ {
+		hash := int64(r.Uint64())
+		other := hash
+		for _, bit := range r.Perm(64)[:r.Intn(7)] {
+			other ^= 1 << uint(bit)
+		}
+		var isCandidate bool
+		for band := 0; band < perceptualHashBands; band++ {
+			for _, value := range perceptualHashBandNeighbors(perceptualHashBand(hash, band), 6/perceptualHashBands) {
+				isCandidate = isCandidate || value == perceptualHashBand(other, band)
+			}
+		}
+		assert.True(isCandidate)
+	}
+}
+
+func TestGetImagesWithoutPerceptualHashSkipsFailures(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	i, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	assert.Nil(i.PerceptualHash)
+
+	isUnhashed := func(v interface{}) bool { return v.(Image).ID == i.ID }
+	for attempt := 0; attempt < MaxPerceptualHashAttempts; attempt++ {
+		unhashed, err := m.GetImagesWithoutPerceptualHash(todo, 1<<20)
+		assert.Nil(err)
+		assert.Any(unhashed, isUnhashed)
+		assert.Nil(m.UpdateImagePerceptualHashFailed(todo, i.ID))
+	}
+
+	unhashed, err := m.GetImagesWithoutPerceptualHash(todo, 1<<20)
+	assert.Nil(err)
+	assert.None(unhashed, isUnhashed)
+
+	limited, err := m.GetImagesWithoutPerceptualHash(todo, 1)
+	assert.Nil(err)
+	assert.True(len(limited) <= 1)
+}
+
+func TestUpdateImageDerivatives(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+
+	i, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	assert.False(i.HasDerivatives())
+
+	missing, err := m.GetImagesWithoutDerivatives(todo, 1<<20)
+	assert.Nil(err)
+	assert.Any(missing, func(v interface{}) bool { return v.(Image).ID == i.ID })
+
+	assert.Nil(m.UpdateImageDerivatives(todo, i.ID, "poster.jpg", "thumbnail.gif"))
+
+	verify, err := m.GetImageByID(todo, i.ID)
+	assert.Nil(err)
+	assert.True(verify.HasDerivatives())
+	assert.Equal("poster.jpg", verify.PosterS3Key)
+	assert.Equal("thumbnail.gif", verify.ThumbnailS3Key)
+
+	missing, err = m.GetImagesWithoutDerivatives(todo, 1<<20)
+	assert.Nil(err)
+	assert.None(missing, func(v interface{}) bool { return v.(Image).ID == i.ID })
+}
+
+func TestGetImagesWithoutDerivativesSkipsFailures(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	i, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+
+	isMissing := func(v interface{}) bool { return v.(Image).ID == i.ID }
+	for attempt := 0; attempt < MaxDerivativesAttempts; attempt++ {
+		missing, err := m.GetImagesWithoutDerivatives(todo, 1<<20)
+		assert.Nil(err)
+		assert.Any(missing, isMissing)
+		assert.Nil(m.UpdateImageDerivativesFailed(todo, i.ID))
+	}
+
+	missing, err := m.GetImagesWithoutDerivatives(todo, 1<<20)
+	assert.Nil(err)
+	assert.None(missing, isMissing)
+}
+
 func TestSearchImages(t *testing.T) {
 	assert := assert.New(t)
 	todo := context.TODO()
@@ -230,6 +489,83 @@ func TestSearchImages(t *testing.T) {
 	assert.NotEmpty(firstImage.Tags)
 }
 
+func TestSearchImagesMultiTerm(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+
+	both, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	_, err = m.CreateTestTagForImageWithVote(todo, u.ID, both.ID, "giraffedance")
+	assert.Nil(err)
+	_, err = m.CreateTestTagForImageWithVote(todo, u.ID, both.ID, "pelicanhappy")
+	assert.Nil(err)
+
+	one, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	_, err = m.CreateTestTagForImageWithVote(todo, u.ID, one.ID, "giraffedance")
+	assert.Nil(err)
+
+	images, err := m.SearchImages(todo, "pelicanhappy giraffedance", ContentRatingFilterDefault)
+	assert.Nil(err)
+	assert.Len(images, 2)
+	assert.Equal(both.ID, images[0].ID)
+	assert.Equal(one.ID, images[1].ID)
+}
+
+func TestSearchImagesPhrasesAndExclusions(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+
+	exact, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	_, err = m.CreateTestTagForImageWithVote(todo, u.ID, exact.ID, "wombat")
+	assert.Nil(err)
+
+	fuzzy, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	_, err = m.CreateTestTagForImageWithVote(todo, u.ID, fuzzy.ID, "wombats")
+	assert.Nil(err)
+
+	excluded, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	_, err = m.CreateTestTagForImageWithVote(todo, u.ID, excluded.ID, "wombat")
+	assert.Nil(err)
+	_, err = m.CreateTestTagForImageWithVote(todo, u.ID, excluded.ID, "quokka")
+	assert.Nil(err)
+
+	images, err := m.SearchImages(todo, "wombat", ContentRatingFilterDefault)
+	assert.Nil(err)
+	assert.Len(images, 3)
+
+	images, err = m.SearchImages(todo, `"wombat"`, ContentRatingFilterDefault)
+	assert.Nil(err)
+	assert.Len(images, 2)
+	assert.None(images, func(v interface{}) bool { return v.(Image).ID == fuzzy.ID })
+
+	images, err = m.SearchImages(todo, `"wombat" -quokka`, ContentRatingFilterDefault)
+	assert.Nil(err)
+	assert.Len(images, 1)
+	assert.Equal(exact.ID, images[0].ID)
+
+	images, err = m.SearchImages(todo, "-quokka", ContentRatingFilterDefault)
+	assert.Nil(err)
+	assert.Empty(images)
+}
+
 func TestSearchImagesRandom(t *testing.T) {
 	assert := assert.New(t)
 	todo := context.TODO()
@@ -513,3 +849,80 @@ func TestImageWeightedRandom(t *testing.T) {
 	randomN := imageSignatures(images).WeightedRandom(10)
 	assert.Len(randomN, 5)
 }
+
+func TestSearchImagesExcludesUnapproved(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+
+	approved, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	pending, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	rejected, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+
+	tagValue := "__test_review_" + uuid.V4().String()
+	tag, err := m.CreateTestTagForImageWithVote(todo, u.ID, approved.ID, tagValue)
+	assert.Nil(err)
+	_, err = m.CreatTestVoteSummaryWithVote(todo, pending.ID, tag.ID, u.ID, 1, 0)
+	assert.Nil(err)
+	_, err = m.CreatTestVoteSummaryWithVote(todo, rejected.ID, tag.ID, u.ID, 1, 0)
+	assert.Nil(err)
+
+	assert.Nil(m.UpdateImageReviewState(todo, pending.ID, ImageReviewStatePending))
+	assert.Nil(m.UpdateImageReviewState(todo, rejected.ID, ImageReviewStateRejected))
+
+	images, err := m.SearchImages(todo, tagValue, ContentRatingFilterDefault)
+	assert.Nil(err)
+	assert.Len(images, 1)
+	assert.Equal(approved.ID, images[0].ID)
+
+	queue, err := m.GetImagesByReviewState(todo, ImageReviewStatePending, 100, 0)
+	assert.Nil(err)
+	var found bool
+	for _, i := range queue {
+		assert.Equal(ImageReviewStatePending, i.ReviewState)
+		found = found || i.ID == pending.ID
+	}
+	assert.True(found)
+}
+
+func TestGetImagesByReviewStateOldestFirst(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+
+	// created newest first, so the ids are in the opposite order of the created times.
+	var ids []int64
+	for x := 0; x < 5; x++ {
+		i, err := m.CreateTestImage(todo, u.ID)
+		assert.Nil(err)
+		assert.Nil(m.UpdateImageReviewState(todo, i.ID, ImageReviewStatePending))
+		_, err = m.Invoke(todo).Exec(`update image set created_utc = $2 where id = $1`, i.ID, time.Now().UTC().AddDate(-10, 0, -x))
+		assert.Nil(err)
+		ids = append(ids, i.ID)
+	}
+
+	queue, err := m.GetImagesByReviewState(todo, ImageReviewStatePending, len(ids), 0)
+	assert.Nil(err)
+	assert.Len(queue, len(ids))
+	for x, i := range queue {
+		assert.Equal(ids[len(ids)-1-x], i.ID)
+		if x > 0 {
+			assert.False(i.CreatedUTC.Before(queue[x-1].CreatedUTC))
+		}
+	}
+}
@@ -24,6 +24,42 @@ func NewTestManager(tx *sql.Tx) Manager {
 // Manager is the common entrypoint for model functions.
 type Manager struct {
 	dbutil.BaseManager
+
+	// SearchInteractionWeight is how much (from 0 to 1) shuffle / post feedback moves search scores.
+	// It is zero (off) unless set.
+	SearchInteractionWeight float64
+}
+
+// InTx runs an action with a manager bound to a transaction, committing if the action
+// succeeds and rolling back if it returns an error.
+// If the manager is already bound to a transaction the action joins it, and the
+// outer transaction's owner is left to commit or roll back.
+func (m Manager) InTx(ctx context.Context, action func(Manager) error) (err error) {
+	if _, isTx := m.Invoke(ctx).DB.(*sql.Tx); isTx {
+		return action(m)
+	}
+
+	tx, err := m.Conn.BeginContext(ctx)
+	if err != nil {
+		return ex.New(err)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				err = ex.Nest(err, ex.New(rollbackErr))
+			}
+			return
+		}
+		err = ex.New(tx.Commit())
+	}()
+
+	options := append(append([]db.InvocationOption{}, m.Options...), db.OptTx(tx))
+	err = action(Manager{BaseManager: dbutil.NewBaseManager(m.Conn, options...), SearchInteractionWeight: m.SearchInteractionWeight})
+	return
 }
 
 // GetContentRatingByName gets a content rating by name.
@@ -73,7 +109,7 @@ func (m Manager) GetAllImagesWithContentRating(ctx context.Context, contentRatin
 // GetRandomImages returns an image by uuid.
 func (m Manager) GetRandomImages(ctx context.Context, count int) ([]Image, error) {
 	var imageIDs []imageSignature
-	err := m.Invoke(ctx).Query(`select id from (select id, row_number() over (order by gen_random_uuid()) as rank from image where content_rating < 5) data where rank <= $1`, count).OutMany(&imageIDs)
+	err := m.Invoke(ctx).Query(`select id from (select id, row_number() over (order by gen_random_uuid()) as rank from image where content_rating < 5 and review_state = $2) data where rank <= $1`, count, ImageReviewStateApproved).OutMany(&imageIDs)
 
 	if err != nil {
 		return nil, err
@@ -86,6 +122,37 @@ func (m Manager) GetRandomImages(ctx context.Context, count int) ([]Image, error
 	return images, err
 }
 
+// GetRandomImageForContentRating returns a random approved image at or below a content rating.
+// The image will be zero if there aren't any.
+func (m Manager) GetRandomImageForContentRating(ctx context.Context, contentRatingFilter int, excludeUUIDs []string) (*Image, error) {
+	args := []interface{}{contentRatingFilter, ImageReviewStateApproved}
+	var excludedClause string
+	if len(excludeUUIDs) > 0 {
+		excludedClause = fmt.Sprintf("and uuid not in (%s)", db.ParamTokens(len(args)+1, len(excludeUUIDs)))
+		for _, excludeUUID := range excludeUUIDs {
+			args = append(args, excludeUUID)
+		}
+	}
+	var imageID imageSignature
+	_, err := m.Invoke(ctx).Query(fmt.Sprintf(`
+select id
+from image
+where
+	content_rating <= $1
+	and review_state = $2
+	%s
+order by gen_random_uuid()
+limit 1
+`, excludedClause), args...).Out(&imageID)
+	if err != nil {
+		return nil, err
+	}
+	if imageID.ID == 0 {
+		return &Image{}, nil
+	}
+	return m.GetImageByID(ctx, imageID.ID)
+}
+
 // GetImageByID returns an image for an id.
 func (m Manager) GetImageByID(ctx context.Context, id int64) (*Image, error) {
 	images, err := m.GetImagesByID(ctx, []int64{id})
@@ -125,6 +192,91 @@ func (m Manager) GetImageByMD5(ctx context.Context, md5sum []byte) (*Image, erro
 	return &image, err
 }
 
+// GetSimilarImages returns images whose perceptual hash is within a given hamming distance, closest first.
+// Candidates are found with the perceptual hash band indexes (see `perceptualHashBandsPredicate`),
+// and then filtered by their exact distance.
+func (m Manager) GetSimilarImages(ctx context.Context, perceptualHash int64, maxDistance int) ([]Image, error) {
+	if maxDistance < 0 {
+		return []Image{}, nil
+	}
+	var imageIDs []imageSignature
+	query := fmt.Sprintf(`
+	select id, distance as score from (
+		select
+			id
+			, length(replace(((perceptual_hash # $1)::bit(64))::text, '0', '')) as distance
+		from image
+		where perceptual_hash is not null %s
+	) as distances
+	where distance <= $2
+	order by distance asc, id asc
+	`, perceptualHashBandsPredicate(perceptualHash, maxDistance))
+	err := m.Invoke(ctx).Query(query, perceptualHash, maxDistance).OutMany(&imageIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(imageIDs) == 0 {
+		return []Image{}, nil
+	}
+	return m.GetImagesByID(ctx, imageSignatures(imageIDs).AsInt64s())
+}
+
+// GetSimilarImage returns the closest image within a given hamming distance of a perceptual hash.
+func (m Manager) GetSimilarImage(ctx context.Context, perceptualHash int64, maxDistance int) (*Image, error) {
+	images, err := m.GetSimilarImages(ctx, perceptualHash, maxDistance)
+	if err != nil {
+		return nil, err
+	}
+	if len(images) == 0 {
+		return &Image{}, nil
+	}
+	return &images[0], nil
+}
+
+// GetImagesWithoutPerceptualHash returns up to `limit` images that have not been hashed yet.
+// Images that have failed to hash `MaxPerceptualHashAttempts` times are left out.
+func (m Manager) GetImagesWithoutPerceptualHash(ctx context.Context, limit int) ([]Image, error) {
+	var images []Image
+	imageColumns := db.Columns(Image{}).ColumnNames()
+	query := fmt.Sprintf(`select %s from image where perceptual_hash is null and perceptual_hash_attempts < $1 order by id asc limit $2`, strings.Join(imageColumns, ","))
+	err := m.Invoke(ctx).Query(query, MaxPerceptualHashAttempts, limit).OutMany(&images)
+	return images, err
+}
+
+// UpdateImagePerceptualHashFailed records a failed attempt to hash an image.
+func (m Manager) UpdateImagePerceptualHashFailed(ctx context.Context, imageID int64) error {
+	_, err := m.Invoke(ctx).Exec("update image set perceptual_hash_attempts = perceptual_hash_attempts + 1 where id = $1", imageID)
+	return err
+}
+
+// UpdateImagePerceptualHash sets just the perceptual hash for an image.
+func (m Manager) UpdateImagePerceptualHash(ctx context.Context, imageID int64, perceptualHash int64) error {
+	_, err := m.Invoke(ctx).Exec("update image set perceptual_hash = $2 where id = $1", imageID, perceptualHash)
+	return err
+}
+
+// GetImagesWithoutDerivatives returns up to `limit` images that do not have a poster or thumbnail yet.
+// Images that have failed `MaxDerivativesAttempts` times are left out.
+func (m Manager) GetImagesWithoutDerivatives(ctx context.Context, limit int) ([]Image, error) {
+	var images []Image
+	imageColumns := db.Columns(Image{}).ColumnNames()
+	query := fmt.Sprintf(`select %s from image where (poster_s3_key = '' or thumbnail_s3_key = '') and derivatives_attempts < $1 order by id asc limit $2`, strings.Join(imageColumns, ","))
+	err := m.Invoke(ctx).Query(query, MaxDerivativesAttempts, limit).OutMany(&images)
+	return images, err
+}
+
+// UpdateImageDerivativesFailed records a failed attempt to generate an image's derivatives.
+func (m Manager) UpdateImageDerivativesFailed(ctx context.Context, imageID int64) error {
+	_, err := m.Invoke(ctx).Exec("update image set derivatives_attempts = derivatives_attempts + 1 where id = $1", imageID)
+	return err
+}
+
+// UpdateImageDerivatives sets just the poster and thumbnail keys for an image.
+func (m Manager) UpdateImageDerivatives(ctx context.Context, imageID int64, posterS3Key, thumbnailS3Key string) error {
+	_, err := m.Invoke(ctx).Exec("update image set poster_s3_key = $2, thumbnail_s3_key = $3 where id = $1", imageID, posterS3Key, thumbnailS3Key)
+	return err
+}
+
 // UpdateImageDisplayName sets just the display name for an image.
 func (m Manager) UpdateImageDisplayName(ctx context.Context, imageID int64, displayName string) error {
 	_, err := m.Invoke(ctx).Exec("update image set display_name = $2 where id = $1", imageID, displayName)
@@ -132,68 +284,292 @@ func (m Manager) UpdateImageDisplayName(ctx context.Context, imageID int64, disp
 }
 
 // DeleteImageByID deletes an image fully.
+//
+// The image's stored files aren't deleted here; they're queued in `file_deletion` in the same transaction,
+// and the `delete_unreferenced_files` job removes them once nothing references them.
 func (m Manager) DeleteImageByID(ctx context.Context, imageID int64) error {
-	_, err := m.Invoke(ctx).Exec(`delete from vote_summary where image_id = $1`, imageID)
-	if err != nil {
+	return m.InTx(ctx, func(txm Manager) error {
+		_, err := txm.Invoke(ctx).Exec(fmt.Sprintf(`
+insert into file_deletion
+	(created_utc, s3_bucket, s3_key)
+select
+	$2, s3_bucket, s3_key
+from (%s) files
+where
+	image_id = $1
+on conflict (s3_bucket, s3_key) do nothing
+`, imageFilesQuery), imageID, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		_, err = txm.Invoke(ctx).Exec(`delete from vote_summary where image_id = $1`, imageID)
+		if err != nil {
+			return err
+		}
+		_, err = txm.Invoke(ctx).Exec(`delete from vote where image_id = $1`, imageID)
+		if err != nil {
+			return err
+		}
+		_, err = txm.Invoke(ctx).Exec(`delete from image where id = $1`, imageID)
 		return err
-	}
-	_, err = m.Invoke(ctx).Exec(`delete from vote where image_id = $1`, imageID)
+	})
+}
+
+// imageFilesQuery selects every stored file referenced by an image row, one row per file.
+var imageFilesQuery = fmt.Sprintf(`
+select id as image_id, uuid as image_uuid, '%s' as kind, s3_bucket, s3_key from image
+union all
+select id, uuid, '%s', s3_bucket, poster_s3_key from image where poster_s3_key <> ''
+union all
+select id, uuid, '%s', s3_bucket, thumbnail_s3_key from image where thumbnail_s3_key <> ''
+union all
+select id, uuid, '%s', s3_bucket, video_s3_key from image where video_s3_key <> ''
+`, ImageFileOriginal, ImageFilePoster, ImageFileThumbnail, ImageFileVideo)
+
+// GetImageFiles returns every stored file referenced by an image.
+func (m Manager) GetImageFiles(ctx context.Context) ([]ImageFile, error) {
+	var files []ImageFile
+	err := m.Invoke(ctx).Query(fmt.Sprintf(`select image_uuid, kind, s3_bucket, s3_key from (%s) files order by image_uuid, kind`, imageFilesQuery)).OutMany(&files)
+	return files, err
+}
+
+// IsFileReferenced returns if any image references a stored file.
+func (m Manager) IsFileReferenced(ctx context.Context, bucket, key string) (bool, error) {
+	return m.Invoke(ctx).Query(fmt.Sprintf(`select 1 from (%s) files where s3_bucket = $1 and s3_key = $2`, imageFilesQuery), bucket, key).Any()
+}
+
+// QueueFileDeletion queues a stored file for deletion, i.e. one that was uploaded but never saved to an image.
+func (m Manager) QueueFileDeletion(ctx context.Context, bucket, key string) error {
+	_, err := m.Invoke(ctx).Exec(`
+insert into file_deletion
+	(created_utc, s3_bucket, s3_key)
+values
+	($1, $2, $3)
+on conflict (s3_bucket, s3_key) do nothing
+`, time.Now().UTC(), bucket, key)
+	return err
+}
+
+// GetFileDeletions returns the oldest files queued for deletion before a given time.
+func (m Manager) GetFileDeletions(ctx context.Context, queuedBefore time.Time, count int) ([]FileDeletion, error) {
+	var deletions []FileDeletion
+	err := m.Invoke(ctx).Query(`select * from file_deletion where created_utc < $1 order by created_utc asc, id asc limit $2`, queuedBefore, count).OutMany(&deletions)
+	return deletions, err
+}
+
+// DeleteFileDeletion removes a file from the deletion queue.
+func (m Manager) DeleteFileDeletion(ctx context.Context, id int64) error {
+	_, err := m.Invoke(ctx).Exec(`delete from file_deletion where id = $1`, id)
+	return err
+}
+
+// GetImagesByReviewState returns images in a given review state, oldest first.
+func (m Manager) GetImagesByReviewState(ctx context.Context, reviewState string, count, offset int) ([]Image, error) {
+	var imageIDs []imageSignature
+	err := m.Invoke(ctx).Query(`select id from image where review_state = $1 order by created_utc asc, id asc limit $2 offset $3`, reviewState, count, offset).OutMany(&imageIDs)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	_, err = m.Invoke(ctx).Exec(`delete from image where id = $1`, imageID)
+	if len(imageIDs) == 0 {
+		return []Image{}, nil
+	}
+	images, err := m.GetImagesByID(ctx, imageSignatures(imageIDs).AsInt64s())
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	sort.SliceStable(images, func(i, j int) bool {
+		if images[i].CreatedUTC.Equal(images[j].CreatedUTC) {
+			return images[i].ID < images[j].ID
+		}
+		return images[i].CreatedUTC.Before(images[j].CreatedUTC)
+	})
+	return images, nil
+}
+
+// UpdateImageReviewState sets the review state for an image.
+// This is a moderator decision, so it replaces any hide by reports (see `CreateReport`).
+func (m Manager) UpdateImageReviewState(ctx context.Context, imageID int64, reviewState string) error {
+	_, err := m.Invoke(ctx).Exec(`update image set review_state = $2, hidden_by_reports = false where id = $1`, imageID, reviewState)
+	return err
 }
 
+// searchImagesInternal scores images for a search query.
+//
+// Each term is scored separately by trigram similarity against tag values (weighted by votes),
+// and the summed score is multiplied by the number of terms (and phrases) the image matched,
+// so images matching more of the query rank higher.
+// Quoted phrases must exactly match a tag on the image, and `-` terms exclude images with that tag.
+//
+// If `SearchInteractionWeight` is set, the score is then scaled by how often the image was posted
+// (rather than shuffled away from or cancelled) for the same query; see `searchInteractionScore`.
 func (m Manager) searchImagesInternal(ctx context.Context, query string, excludeUUIDs []string, contentRatingFilter int) ([]imageSignature, error) {
 	var imageIDs []imageSignature
 
+	searchQuery := ParseSearchQuery(query)
+	if searchQuery.IsZero() {
+		return imageIDs, nil
+	}
+
 	args := []interface{}{
-		query,
 		contentRatingFilter,
+		ImageReviewStateApproved,
+	}
+	params := func(values []string) string {
+		tokens := db.ParamTokens(len(args)+1, len(values))
+		for _, value := range values {
+			args = append(args, value)
+		}
+		return tokens
+	}
+
+	var tagScores []string
+	if len(searchQuery.Terms) > 0 {
+		var termValues []string
+		for _, term := range searchQuery.Terms {
+			termValues = append(termValues, fmt.Sprintf("(%s::text)", params([]string{term})))
+		}
+		tagScores = append(tagScores, fmt.Sprintf(`
+			select
+				t.id as tag_id
+				, terms.term
+				, similarity(t.tag_value, terms.term) as score
+			from
+				tag t
+				cross join (values %s) as terms(term)
+			where
+				similarity(t.tag_value, terms.term) > show_limit()
+		`, strings.Join(termValues, ",")))
+	}
+
+	var phraseClause string
+	if len(searchQuery.Phrases) > 0 {
+		phraseTokens := params(searchQuery.Phrases)
+		tagScores = append(tagScores, fmt.Sprintf(`
+			select
+				t.id as tag_id
+				, t.tag_value as term
+				, 1.0::real as score
+			from
+				tag t
+			where
+				t.tag_value in (%s)
+		`, phraseTokens))
+		phraseClause = fmt.Sprintf(`and (
+			select count(distinct pt.tag_value)
+			from vote_summary pvs join tag pt on pt.id = pvs.tag_id
+			where pvs.image_id = i.id and pvs.votes_total > 0 and not pvs.is_hidden and pt.tag_value in (%s)
+		) = %d`, phraseTokens, len(searchQuery.Phrases))
+	}
+
+	var excludedTagClause string
+	if len(searchQuery.Excluded) > 0 {
+		excludedTagClause = fmt.Sprintf(`and not exists (
+			select 1
+			from vote_summary evs join tag et on et.id = evs.tag_id
+			where evs.image_id = i.id and evs.votes_total > 0 and et.tag_value in (%s)
+		)`, params(searchQuery.Excluded))
 	}
 
 	var excludedClause string
 	if len(excludeUUIDs) > 0 {
-		excludedClause = fmt.Sprintf("and i.uuid not in (%s)", db.ParamTokens(len(args)+1, len(excludeUUIDs)))
-		for _, excluded := range excludeUUIDs {
-			args = append(args, excluded)
-		}
+		excludedClause = fmt.Sprintf("and i.uuid not in (%s)", params(excludeUUIDs))
+	}
+
+	scoreColumn, interactionJoin := "term_matches.score", ""
+	if weight := m.searchInteractionWeight(); weight > 0 {
+		scoreColumn = fmt.Sprintf("term_matches.score * (1 + %s::real * (2 * coalesce(interactions.ctr, 0.5) - 1))", params([]string{fmt.Sprint(weight)}))
+		interactionJoin = fmt.Sprintf("left join (%s) interactions on interactions.image_id = term_matches.id", m.searchInteractionScore(params([]string{NormalizeSearchQuery(query)})))
 	}
 
 	searchImageQuery := fmt.Sprintf(`
 	select
-		vs.image_id as id
-		, sum(ts.score * vs.votes_total) as score
+		term_matches.id
+		, %s as score
+	from
+	(
+	select
+		id
+		, sum(score) * count(*) as score
 	from
 		(
 			select
-				t.id as tag_id
-				, similarity(t.tag_value, $1) as score
+				vs.image_id as id
+				, ts.term
+				, sum(ts.score * vs.votes_total) as score
 			from
-				tag t
+				(%s) ts
+				join vote_summary vs on vs.tag_id = ts.tag_id
+				join image i on vs.image_id = i.id
 			where
-				similarity(t.tag_value, $1) > show_limit()
-		) ts
-		join vote_summary vs on vs.tag_id = ts.tag_id
-		join image i on vs.image_id = i.id
-	where
-		vs.votes_total > 0
-		and i.content_rating <= $2
-		%s
+				vs.votes_total > 0
+				and not vs.is_hidden
+				and i.content_rating <= $1
+				and i.review_state = $2
+				%s
+				%s
+				%s
+			group by
+				vs.image_id, ts.term
+		) as term_scores
 	group by
-		vs.image_id
+		id
+	) as term_matches
+	%s
 	order by
 		score desc;
-	`, excludedClause)
+	`, scoreColumn, strings.Join(tagScores, " union all "), excludedClause, phraseClause, excludedTagClause, interactionJoin)
 
 	err := m.Invoke(ctx).Query(searchImageQuery, args...).OutMany(&imageIDs)
 	return imageIDs, err
 }
 
+// searchInteractionWeight returns the interaction weight clamped to [0, 1],
+// so feedback can at most double or zero a score.
+func (m Manager) searchInteractionWeight() float64 {
+	if m.SearchInteractionWeight < 0 {
+		return 0
+	}
+	if m.SearchInteractionWeight > 1 {
+		return 1
+	}
+	return m.SearchInteractionWeight
+}
+
+// searchInteractionScore returns a query for the smoothed post rate of each image for a (normalized) query.
+// The rate is (posts + 1) / (interactions + 2), so images without feedback sit at 0.5, which leaves their score alone.
+func (m Manager) searchInteractionScore(queryParam string) string {
+	return fmt.Sprintf(`
+		select
+			image_id
+			, (count(*) filter (where action = '%s') + 1)::real / (count(*) + 2) as ctr
+		from
+			search_interaction
+		where
+			search_query = %s
+		group by
+			image_id
+	`, SearchInteractionActionPost, queryParam)
+}
+
+type imageInteractionScore struct {
+	ImageID int64   `db:"image_id"`
+	CTR     float64 `db:"ctr"`
+}
+
+// GetSearchInteractionScore returns the smoothed post rate for an image for a query.
+// It returns 0.5 (neutral) if there hasn't been any feedback.
+func (m Manager) GetSearchInteractionScore(ctx context.Context, query string, imageID int64) (float64, error) {
+	var score imageInteractionScore
+	_, err := m.Invoke(ctx).Query(fmt.Sprintf(`select * from (%s) interactions where image_id = $2`, m.searchInteractionScore("$1")), NormalizeSearchQuery(query), imageID).Out(&score)
+	if err != nil {
+		return 0, err
+	}
+	if score.ImageID == 0 {
+		return 0.5, nil
+	}
+	return score.CTR, nil
+}
+
 // SearchImages searches for an image.
 func (m Manager) SearchImages(ctx context.Context, query string, contentRatingFilter int) ([]Image, error) {
 	imageIDs, err := m.searchImagesInternal(ctx, query, nil, contentRatingFilter)
@@ -443,51 +819,101 @@ func (m Manager) SetVoteSummaryTagID(ctx context.Context, imageID, oldTagID, new
 }
 
 // CreateOrUpdateVote votes for a tag for an image in the db.
-func (m Manager) CreateOrUpdateVote(ctx context.Context, userID, imageID, tagID int64, isUpvote bool) (bool, error) {
-	existing, err := m.GetVoteSummary(ctx, imageID, tagID)
-	if err != nil {
-		return false, err
-	}
-
-	if existing.IsZero() {
-		itv := NewVoteSummary(imageID, tagID, userID, time.Now().UTC())
-		if isUpvote {
-			itv.VotesFor = 1
-			itv.VotesAgainst = 0
-			itv.VotesTotal = 1
-		} else {
-			itv.VotesFor = 0
-			itv.VotesAgainst = 1
-			itv.VotesTotal = -1
-		}
-		err := m.Invoke(ctx).Create(itv)
+//
+// The user's vote and the vote summary are both written with upserts in a single transaction,
+// so concurrent votes on the same image and tag each count exactly once. Repeating a vote is a no-op,
+// and changing a vote moves it from one side of the summary to the other.
+// It returns true if this vote created the link between the image and the tag.
+func (m Manager) CreateOrUpdateVote(ctx context.Context, userID, imageID, tagID int64, isUpvote bool) (didCreate bool, err error) {
+	err = m.InTx(ctx, func(txm Manager) error {
+		now := time.Now().UTC()
+
+		var inserted bool
+		found, err := txm.Invoke(ctx).Query(`
+insert into vote
+	(user_id, image_id, tag_id, created_utc, is_upvote)
+values
+	($1, $2, $3, $4, $5)
+on conflict (user_id, image_id, tag_id) do update set
+	created_utc = excluded.created_utc
+	, is_upvote = excluded.is_upvote
+where
+	vote.is_upvote <> excluded.is_upvote
+returning (xmax = 0) as inserted
+`, userID, imageID, tagID, now, isUpvote).Scan(&inserted)
 		if err != nil {
-			return true, err
+			return err
 		}
-	} else {
-		//check if user has already voted for this image ...
+		// the user had already cast this exact vote.
+		if !found {
+			return nil
+		}
+
+		var votesFor, votesAgainst int
 		if isUpvote {
-			existing.VotesFor = existing.VotesFor + 1
+			votesFor = 1
 		} else {
-			existing.VotesAgainst = existing.VotesAgainst + 1
+			votesAgainst = 1
+		}
+		// the user flipped their vote, so take it off the other side.
+		if !inserted {
+			votesFor, votesAgainst = votesFor-votesAgainst, votesAgainst-votesFor
 		}
-		existing.LastVoteBy = userID
-		existing.LastVoteUTC = time.Now().UTC()
-		existing.VotesTotal = existing.VotesFor - existing.VotesAgainst
 
-		_, err := m.Invoke(ctx).Update(existing)
-		if err != nil {
-			return false, err
+		_, err = txm.Invoke(ctx).Query(`
+insert into vote_summary
+	(image_id, tag_id, created_utc, last_vote_by, last_vote_utc, votes_for, votes_against, votes_total)
+values
+	($1, $2, $3, $4, $3, $5, $6, $5 - $6)
+on conflict (image_id, tag_id) do update set
+	last_vote_by = excluded.last_vote_by
+	, last_vote_utc = excluded.last_vote_utc
+	, votes_for = vote_summary.votes_for + excluded.votes_for
+	, votes_against = vote_summary.votes_against + excluded.votes_against
+	, votes_total = vote_summary.votes_total + excluded.votes_total
+returning (xmax = 0) as inserted
+`, imageID, tagID, now, userID, votesFor, votesAgainst).Scan(&didCreate)
+		return err
+	})
+	return
+}
+
+// CreateImageWithTags saves a new image with the uploader's upvote for each of the tags, in a single transaction.
+// Tags that don't exist yet are created. A single moderation entry is written for the upload (in the same transaction),
+// rather than one each for the image, the new tags and the links.
+// Tag values should already be cleaned with `CleanTagValue`. The image's tags are set to the tags that were voted for.
+func (m Manager) CreateImageWithTags(ctx context.Context, image *Image, tagValues []string) error {
+	return m.InTx(ctx, func(txm Manager) error {
+		if err := txm.Invoke(ctx).Create(image); err != nil {
+			return err
 		}
-	}
 
-	err = m.DeleteVote(ctx, userID, imageID, tagID)
-	if err != nil {
-		return false, err
-	}
+		image.Tags = []Tag{}
+		seen := map[string]bool{}
+		for _, tagValue := range tagValues {
+			if seen[tagValue] {
+				continue
+			}
+			seen[tagValue] = true
+
+			tag, err := txm.GetTagByValue(ctx, tagValue)
+			if err != nil {
+				return err
+			}
+			if tag.IsZero() {
+				tag = NewTag(image.CreatedBy, tagValue)
+				if err = txm.Invoke(ctx).Create(tag); err != nil {
+					return err
+				}
+			}
+			if _, err = txm.CreateOrUpdateVote(ctx, image.CreatedBy, image.ID, tag.ID, true); err != nil {
+				return err
+			}
+			image.Tags = append(image.Tags, *tag)
+		}
 
-	logEntry := NewVote(userID, imageID, tagID, isUpvote)
-	return false, m.Invoke(ctx).Create(logEntry)
+		return txm.Invoke(ctx).Create(NewModeration(image.CreatedBy, ModerationVerbCreate, ModerationObjectImage, image.UUID))
+	})
 }
 
 func (m Manager) getVoteSummaryQuery(whereClause string) string {
@@ -612,6 +1038,120 @@ func (m Manager) DeleteVoteSummary(ctx context.Context, imageID, tagID int64) er
 	return err
 }
 
+func (m Manager) getReportsQuery(whereClause string) string {
+	return fmt.Sprintf(`
+select
+	r.*
+	, u.uuid as user_uuid
+	, i.uuid as image_uuid
+	, coalesce(t.uuid, '') as tag_uuid
+	, coalesce(t.tag_value, '') as tag_value
+from
+	report r
+	join users u on u.id = r.user_id
+	join image i on i.id = r.image_id
+	left join tag t on t.id = r.tag_id
+%s
+`, whereClause)
+}
+
+// GetReportByUUID returns a report by uuid.
+func (m Manager) GetReportByUUID(ctx context.Context, uuid string) (*Report, error) {
+	var report Report
+	_, err := m.Invoke(ctx).Query(m.getReportsQuery("where r.uuid = $1"), uuid).Out(&report)
+	return &report, err
+}
+
+// GetReportsByState returns reports in a given state, oldest first.
+func (m Manager) GetReportsByState(ctx context.Context, state string, count, offset int) ([]Report, error) {
+	reports := []Report{}
+	err := m.Invoke(ctx).Query(m.getReportsQuery("where r.state = $1 order by r.created_utc asc limit $2 offset $3"), state, count, offset).OutMany(&reports)
+	return reports, err
+}
+
+// CreateReport files a report, hiding the image or link once `hideThreshold` distinct users have open reports on it.
+// A user reporting the same image or link again while their report is open is a no-op.
+// It returns true if this report is the one that hid the image or link.
+func (m Manager) CreateReport(ctx context.Context, report *Report, hideThreshold int) (didHide bool, err error) {
+	err = m.InTx(ctx, func(txm Manager) error {
+		// lock the image so concurrent reports on it are counted one at a time,
+		// otherwise two of them could each miss the other and neither would hide it.
+		if _, err := txm.Invoke(ctx).Exec(`select 1 from image where id = $1 for update`, report.ImageID); err != nil {
+			return err
+		}
+
+		var existing Report
+		_, err := txm.Invoke(ctx).Query(
+			`select * from report where user_id = $1 and image_id = $2 and tag_id is not distinct from $3 and state = $4`,
+			report.UserID, report.ImageID, report.TagID, ReportStateOpen,
+		).Out(&existing)
+		if err != nil {
+			return err
+		}
+		if !existing.IsZero() {
+			*report = existing
+			return nil
+		}
+		if err = txm.Invoke(ctx).Create(report); err != nil {
+			return err
+		}
+
+		var reporters int
+		_, err = txm.Invoke(ctx).Query(
+			`select count(distinct user_id) from report where image_id = $1 and tag_id is not distinct from $2 and state = $3`,
+			report.ImageID, report.TagID, ReportStateOpen,
+		).Scan(&reporters)
+		if err != nil {
+			return err
+		}
+		if hideThreshold <= 0 || reporters < hideThreshold {
+			return nil
+		}
+
+		var res sql.Result
+		if report.IsLinkReport() {
+			res, err = txm.Invoke(ctx).Exec(`update vote_summary set is_hidden = true where image_id = $1 and tag_id = $2 and not is_hidden`, report.ImageID, *report.TagID)
+		} else {
+			// hidden images go back into the moderation queue.
+			res, err = txm.Invoke(ctx).Exec(`update image set review_state = $2, hidden_by_reports = true where id = $1 and review_state = $3`, report.ImageID, ImageReviewStatePending, ImageReviewStateApproved)
+		}
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return ex.New(err)
+		}
+		didHide = rowsAffected > 0
+		return nil
+	})
+	return
+}
+
+// CloseReports closes every open report on the same image or link as the given report.
+// Dismissing the reports also un-hides anything the reports had hidden; an image only goes back to
+// approved if it was the reports that moved it to pending (and not, say, an upload waiting on review).
+func (m Manager) CloseReports(ctx context.Context, report *Report, state string, moderatorID int64) error {
+	return m.InTx(ctx, func(txm Manager) error {
+		_, err := txm.Invoke(ctx).Exec(
+			`update report set state = $1, resolved_by = $2, resolved_utc = $3 where image_id = $4 and tag_id is not distinct from $5 and state = $6`,
+			state, moderatorID, time.Now().UTC(), report.ImageID, report.TagID, ReportStateOpen,
+		)
+		if err != nil {
+			return err
+		}
+		if state != ReportStateDismissed {
+			return nil
+		}
+		if report.IsLinkReport() {
+			_, err = txm.Invoke(ctx).Exec(`update vote_summary set is_hidden = false where image_id = $1 and tag_id = $2`, report.ImageID, *report.TagID)
+		} else {
+			_, err = txm.Invoke(ctx).Exec(`update image set review_state = $2, hidden_by_reports = false where id = $1 and review_state = $3 and hidden_by_reports`, report.ImageID, ImageReviewStateApproved, ImageReviewStatePending)
+		}
+		return err
+	})
+}
+
 // GetAllTags returns all the tags in the db.
 func (m Manager) GetAllTags(ctx context.Context) ([]Tag, error) {
 	all := []Tag{}
@@ -675,19 +1215,36 @@ func (m Manager) DeleteTagByID(ctx context.Context, tagID int64) error {
 
 // DeleteTagAndVotesByID deletes an tag fully.
 func (m Manager) DeleteTagAndVotesByID(ctx context.Context, tagID int64) error {
-	_, err := m.Invoke(ctx).Exec(`delete from vote_summary where tag_id = $1`, tagID)
-	if err != nil {
-		return err
-	}
-	_, err = m.Invoke(ctx).Exec(`delete from vote where tag_id = $1`, tagID)
-	if err != nil {
-		return err
-	}
-	return m.DeleteTagByID(ctx, tagID)
+	return m.InTx(ctx, func(txm Manager) error {
+		_, err := txm.Invoke(ctx).Exec(`delete from vote_summary where tag_id = $1`, tagID)
+		if err != nil {
+			return err
+		}
+		_, err = txm.Invoke(ctx).Exec(`delete from vote where tag_id = $1`, tagID)
+		if err != nil {
+			return err
+		}
+		return txm.DeleteTagByID(ctx, tagID)
+	})
 }
 
 // MergeTags merges the fromTagID into the toTagID, deleting the fromTagID.
+// Votes and vote summaries are moved in a single transaction; where the image already had the
+// destination tag, the summary totals are recomputed from the merged votes.
 func (m Manager) MergeTags(ctx context.Context, fromTagID, toTagID int64) error {
+	return m.InTx(ctx, func(txm Manager) error {
+		return txm.mergeTags(ctx, fromTagID, toTagID)
+	})
+}
+
+func (m Manager) mergeTags(ctx context.Context, fromTagID, toTagID int64) error {
+	// locking both tags holds off concurrent votes on either (their foreign keys need a share lock)
+	// until the merge commits, so the moved votes and the reconciled totals can't drift.
+	_, err := m.Invoke(ctx).Exec(`select 1 from tag where id in ($1, $2) order by id for update`, fromTagID, toTagID)
+	if err != nil {
+		return err
+	}
+
 	votes, err := m.GetVotesForTag(ctx, fromTagID)
 	if err != nil {
 		return err
@@ -984,6 +1541,205 @@ func (m Manager) GetSlackTeamByTeamID(ctx context.Context, teamID string) (*Slac
 	return &team, err
 }
 
+// GetAllMattermostInstances gets all mattermost instances.
+func (m Manager) GetAllMattermostInstances(ctx context.Context) ([]MattermostInstance, error) {
+	var instances []MattermostInstance
+	err := m.Invoke(ctx).Query(`select * from mattermost_instance order by name asc`).OutMany(&instances)
+	return instances, err
+}
+
+// GetMattermostInstanceByUUID gets a mattermost instance by uuid.
+func (m Manager) GetMattermostInstanceByUUID(ctx context.Context, uuid string) (*MattermostInstance, error) {
+	var instance MattermostInstance
+	_, err := m.Invoke(ctx).Get(&instance, uuid)
+	return &instance, err
+}
+
+// GetMattermostInstanceByToken gets a mattermost instance by its (plaintext) slash command token.
+func (m Manager) GetMattermostInstanceByToken(ctx context.Context, token string, key []byte) (*MattermostInstance, error) {
+	if len(key) == 0 {
+		return nil, ex.New("`ENCRYPTION_KEY` is not set, cannot continue.")
+	}
+	var instance MattermostInstance
+	_, err := m.Invoke(ctx).Query(`select * from mattermost_instance where token_hash = $1`, HashMattermostToken(token, key)).Out(&instance)
+	return &instance, err
+}
+
+// GetSlackChannelSettings gets the channel overrides for a team.
+func (m Manager) GetSlackChannelSettings(ctx context.Context, teamID string) ([]SlackChannelSetting, error) {
+	var settings []SlackChannelSetting
+	err := m.Invoke(ctx).Query(`select * from slack_channel_setting where team_id = $1 order by channel_name asc, channel_id asc`, teamID).OutMany(&settings)
+	return settings, err
+}
+
+// GetSlackChannelSetting gets the overrides for a channel.
+func (m Manager) GetSlackChannelSetting(ctx context.Context, teamID, channelID string) (*SlackChannelSetting, error) {
+	var setting SlackChannelSetting
+	_, err := m.Invoke(ctx).Get(&setting, teamID, channelID)
+	return &setting, err
+}
+
+// SaveSlackChannelSetting creates or updates the overrides for a channel.
+func (m Manager) SaveSlackChannelSetting(ctx context.Context, setting *SlackChannelSetting) error {
+	_, err := m.Invoke(ctx).Exec(`
+insert into slack_channel_setting
+	(team_id, channel_id, channel_name, content_rating, created_utc, updated_utc, updated_by_id, updated_by_name)
+values
+	($1, $2, $3, $4, $5, $6, $7, $8)
+on conflict (team_id, channel_id) do update
+set
+	channel_name = coalesce(nullif(excluded.channel_name, ''), slack_channel_setting.channel_name)
+	, content_rating = excluded.content_rating
+	, updated_utc = excluded.updated_utc
+	, updated_by_id = excluded.updated_by_id
+	, updated_by_name = excluded.updated_by_name
+`, setting.TeamID, setting.ChannelID, setting.ChannelName, setting.ContentRatingFilter, setting.CreatedUTC, setting.UpdatedUTC, setting.UpdatedByID, setting.UpdatedByName)
+	return err
+}
+
+// DeleteSlackChannelSetting removes the overrides for a channel.
+func (m Manager) DeleteSlackChannelSetting(ctx context.Context, teamID, channelID string) error {
+	_, err := m.Invoke(ctx).Exec(`delete from slack_channel_setting where team_id = $1 and channel_id = $2`, teamID, channelID)
+	return err
+}
+
+// MarkSlackEventHandled records that a slack event is being handled.
+// It returns false if the event was already handled (slack redelivers events it isn't sure we got).
+// Handled events older than `SlackEventRetention` are forgotten, as slack will have stopped retrying them.
+func (m Manager) MarkSlackEventHandled(ctx context.Context, eventID string) (bool, error) {
+	now := time.Now().UTC()
+	if _, err := m.Invoke(ctx).Exec(`delete from slack_event where created_utc < $1`, now.Add(-SlackEventRetention)); err != nil {
+		return false, err
+	}
+	res, err := m.Invoke(ctx).Exec(`insert into slack_event (event_id, created_utc) values ($1, $2) on conflict (event_id) do nothing`, eventID, now)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, ex.New(err)
+	}
+	return rowsAffected > 0, nil
+}
+
+// GetUserForSlackIdentity returns the giffy user linked to a slack user.
+// The user will be zero if the slack user hasn't linked their account.
+func (m Manager) GetUserForSlackIdentity(ctx context.Context, teamID, slackUserID string) (*User, error) {
+	var user User
+	_, err := m.Invoke(ctx).Query(`
+select u.*
+from users u
+join slack_identity si on si.user_id = u.id
+where si.team_id = $1 and si.slack_user_id = $2
+`, teamID, slackUserID).Out(&user)
+	return &user, err
+}
+
+// GetSlackIdentitiesForUserID returns the slack users linked to a giffy user.
+func (m Manager) GetSlackIdentitiesForUserID(ctx context.Context, userID int64) ([]SlackIdentity, error) {
+	var identities []SlackIdentity
+	err := m.Invoke(ctx).Query(`
+select
+	si.*
+	, coalesce(st.team_name, '') as team_name
+from slack_identity si
+left join slack_team st on st.team_id = si.team_id
+where si.user_id = $1
+order by si.created_utc desc
+`, userID).OutMany(&identities)
+	return identities, err
+}
+
+// SaveSlackIdentity links a slack user to a giffy user, replacing any existing link for the slack user.
+func (m Manager) SaveSlackIdentity(ctx context.Context, identity *SlackIdentity) error {
+	_, err := m.Invoke(ctx).Exec(`
+insert into slack_identity
+	(team_id, slack_user_id, user_id, created_utc)
+values
+	($1, $2, $3, $4)
+on conflict (team_id, slack_user_id) do update
+set
+	user_id = excluded.user_id
+	, created_utc = excluded.created_utc
+`, identity.TeamID, identity.SlackUserID, identity.UserID, identity.CreatedUTC)
+	return err
+}
+
+// DeleteSlackIdentity unlinks a slack user from a giffy user.
+func (m Manager) DeleteSlackIdentity(ctx context.Context, userID int64, teamID, slackUserID string) error {
+	_, err := m.Invoke(ctx).Exec(`delete from slack_identity where user_id = $1 and team_id = $2 and slack_user_id = $3`, userID, teamID, slackUserID)
+	return err
+}
+
+// GetLastSlackPost returns the most recent result posted to a slack channel.
+func (m Manager) GetLastSlackPost(ctx context.Context, teamID, channelID string) (*SearchHistory, error) {
+	var post SearchHistory
+	_, err := m.Invoke(ctx).Query(`
+select *
+from search_history
+where
+	source = 'slack'
+	and source_team_identifier = $1
+	and source_channel_identifier = $2
+	and is_post
+	and image_id is not null
+order by timestamp_utc desc
+limit 1
+`, teamID, channelID).Out(&post)
+	return &post, err
+}
+
+// UninstallSlackTeam disables a team and drops its tokens after it uninstalls the app or revokes its tokens.
+func (m Manager) UninstallSlackTeam(ctx context.Context, teamID string) error {
+	_, err := m.Invoke(ctx).Exec(`
+update slack_team
+set
+	is_enabled = false
+	, bot_access_token = null
+	, user_access_token = null
+	, uninstalled_utc = $2
+where
+	team_id = $1
+`, teamID, time.Now().UTC())
+	return err
+}
+
+// GetAPITokenByToken returns an api token by its plaintext value.
+func (m Manager) GetAPITokenByToken(ctx context.Context, token string, key []byte) (*APIToken, error) {
+	if len(key) == 0 {
+		return nil, ex.New("`ENCRYPTION_KEY` is not set, cannot continue.")
+	}
+	var apiToken APIToken
+	_, err := m.Invoke(ctx).Query(`select * from api_token where token_hash = $1`, HashAPIToken(token, key)).Out(&apiToken)
+	return &apiToken, err
+}
+
+// GetAPITokenByUUID returns an api token by uuid.
+func (m Manager) GetAPITokenByUUID(ctx context.Context, uuid string) (*APIToken, error) {
+	var apiToken APIToken
+	_, err := m.Invoke(ctx).Query(`select * from api_token where uuid = $1`, uuid).Out(&apiToken)
+	return &apiToken, err
+}
+
+// GetAPITokensForUserID returns the api tokens for a user, newest first.
+func (m Manager) GetAPITokensForUserID(ctx context.Context, userID int64) ([]APIToken, error) {
+	var apiTokens []APIToken
+	err := m.Invoke(ctx).Query(`select * from api_token where user_id = $1 order by created_utc desc`, userID).OutMany(&apiTokens)
+	return apiTokens, err
+}
+
+// RevokeAPIToken revokes an api token.
+func (m Manager) RevokeAPIToken(ctx context.Context, id int64) error {
+	_, err := m.Invoke(ctx).Exec(`update api_token set revoked_utc = $2 where id = $1 and revoked_utc is null`, id, time.Now().UTC())
+	return err
+}
+
+// UpdateAPITokenLastUsed sets when an api token was last used.
+func (m Manager) UpdateAPITokenLastUsed(ctx context.Context, id int64, lastUsedUTC time.Time) error {
+	_, err := m.Invoke(ctx).Exec(`update api_token set last_used_utc = $2 where id = $1`, id, lastUsedUTC)
+	return err
+}
+
 // GetUserAuthByToken returns an auth entry for the given auth token.
 func (m Manager) GetUserAuthByToken(ctx context.Context, token string, key []byte) (*UserAuth, error) {
 	if len(key) == 0 {
@@ -1300,6 +2056,16 @@ func (m Manager) CreateTestUserAuth(ctx context.Context, userID int64, token, se
 	return ua, err
 }
 
+// CreateTestAPIToken creates a test api token, returning the plaintext token alongside it.
+func (m Manager) CreateTestAPIToken(ctx context.Context, userID int64, key []byte, scopes ...string) (*APIToken, string, error) {
+	at, token, err := NewAPIToken(userID, "test", scopes, nil, key)
+	if err != nil {
+		return at, token, err
+	}
+	err = m.Invoke(ctx).Create(at)
+	return at, token, err
+}
+
 // CreateTestUserSession creates a test user session.
 func (m Manager) CreateTestUserSession(ctx context.Context, userID int64) (*UserSession, error) {
 	us := NewUserSession(userID)
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"time"
+
+	"github.com/blend/go-sdk/crypto"
+	"github.com/blend/go-sdk/ex"
+	"github.com/blend/go-sdk/uuid"
+)
+
+// NewMattermostInstance returns a new mattermost instance for a slash command token.
+// Only the hash of the token is stored; it's used to identify the instance requests come from.
+func NewMattermostInstance(name, token string, createdBy int64, key []byte) (*MattermostInstance, error) {
+	if len(key) == 0 {
+		return nil, ex.New("`ENCRYPTION_KEY` is not set, cannot continue.")
+	}
+	if token == "" {
+		return nil, ex.New("mattermost slash command token is required")
+	}
+	return &MattermostInstance{
+		UUID:                uuid.V4().String(),
+		Name:                name,
+		TokenHash:           HashMattermostToken(token, key),
+		IsEnabled:           true,
+		ContentRatingFilter: ContentRatingPG13,
+		CreatedUTC:          time.Now().UTC(),
+		CreatedBy:           &createdBy,
+	}, nil
+}
+
+// HashMattermostToken hashes a mattermost slash command token the same way api tokens are hashed.
+func HashMattermostToken(token string, key []byte) []byte {
+	return crypto.HMAC512(key, []byte(token))
+}
+
+// MattermostInstance is a (self hosted) mattermost server that is mapped to giffy.
+type MattermostInstance struct {
+	UUID                string    `json:"uuid" db:"uuid,pk"`
+	Name                string    `json:"name" db:"name"`
+	TokenHash           []byte    `json:"-" db:"token_hash"`
+	IsEnabled           bool      `json:"is_enabled" db:"is_enabled"`
+	ContentRatingFilter int       `json:"content_rating" db:"content_rating"`
+	CreatedUTC          time.Time `json:"created_utc" db:"created_utc"`
+	CreatedBy           *int64    `json:"-" db:"created_by"`
+}
+
+// TableName returns the mapped table name.
+func (mi MattermostInstance) TableName() string {
+	return "mattermost_instance"
+}
+
+// IsZero returns if the object has been set or not.
+func (mi MattermostInstance) IsZero() bool {
+	return len(mi.UUID) == 0
+}
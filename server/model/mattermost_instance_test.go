@@ -0,0 +1,64 @@
+package model
+
+import (
+	"context"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/crypto"
+	"github.com/blend/go-sdk/testutil"
+	"github.com/blend/go-sdk/uuid"
+)
+
+func TestGetMattermostInstanceByToken(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	key, err := crypto.CreateKey(32)
+	assert.Nil(err)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+
+	token := uuid.V4().String()
+	instance, err := NewMattermostInstance("test_instance", token, u.ID, key)
+	assert.Nil(err)
+	assert.Equal(ContentRatingPG13, instance.ContentRatingFilter)
+	assert.Nil(m.Invoke(todo).Create(instance))
+
+	verify, err := m.GetMattermostInstanceByToken(todo, token, key)
+	assert.Nil(err)
+	assert.Equal(instance.UUID, verify.UUID)
+
+	verify, err = m.GetMattermostInstanceByToken(todo, uuid.V4().String(), key)
+	assert.Nil(err)
+	assert.True(verify.IsZero())
+
+	_, err = m.GetMattermostInstanceByToken(todo, token, nil)
+	assert.NotNil(err)
+
+	instances, err := m.GetAllMattermostInstances(todo)
+	assert.Nil(err)
+	assert.NotEmpty(instances)
+}
+
+func TestNewMattermostInstance(t *testing.T) {
+	assert := assert.New(t)
+
+	key, err := crypto.CreateKey(32)
+	assert.Nil(err)
+
+	instance, err := NewMattermostInstance("test_instance", "token", 1, key)
+	assert.Nil(err)
+	assert.Equal(HashMattermostToken("token", key), instance.TokenHash)
+	assert.True(instance.IsEnabled)
+
+	_, err = NewMattermostInstance("test_instance", "", 1, key)
+	assert.NotNil(err)
+	_, err = NewMattermostInstance("test_instance", "token", 1, nil)
+	assert.NotNil(err)
+}
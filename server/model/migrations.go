@@ -284,7 +284,8 @@ func Schema(cfg *config.Giffy) *migration.Suite {
 	)
 }
 
-// Migrations returns the migrations.
+// Migrations returns a suite that applies any pending versioned migrations.
+// New schema changes should be added with `go run ./db/main.go create <name>` rather than here.
 func Migrations(cfg *config.Giffy) *migration.Suite {
-	return migration.New()
+	return SchemaMigrationsUp(MustLoadSchemaMigrations())
 }
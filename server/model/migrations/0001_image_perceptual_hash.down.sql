@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS ix_image_perceptual_hash;
+ALTER TABLE image DROP COLUMN IF EXISTS perceptual_hash;
@@ -0,0 +1,2 @@
+ALTER TABLE image ADD COLUMN IF NOT EXISTS perceptual_hash bigint;
+CREATE INDEX IF NOT EXISTS ix_image_perceptual_hash ON image(perceptual_hash);
@@ -0,0 +1,2 @@
+ALTER TABLE image DROP COLUMN IF EXISTS thumbnail_s3_key;
+ALTER TABLE image DROP COLUMN IF EXISTS poster_s3_key;
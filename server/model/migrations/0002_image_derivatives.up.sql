@@ -0,0 +1,2 @@
+ALTER TABLE image ADD COLUMN IF NOT EXISTS poster_s3_key varchar(64) not null default '';
+ALTER TABLE image ADD COLUMN IF NOT EXISTS thumbnail_s3_key varchar(64) not null default '';
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS api_token (
+	id serial not null,
+	uuid varchar(32) not null,
+	user_id bigint not null,
+	created_utc timestamp not null,
+	name varchar(255) not null,
+	token_hash bytea not null,
+	scopes jsonb not null,
+	expires_utc timestamp,
+	last_used_utc timestamp,
+	revoked_utc timestamp,
+	CONSTRAINT pk_api_token_id PRIMARY KEY (id),
+	CONSTRAINT uk_api_token_uuid UNIQUE (uuid),
+	CONSTRAINT uk_api_token_token_hash UNIQUE (token_hash),
+	CONSTRAINT fk_api_token_user_id FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS ix_api_token_user_id ON api_token(user_id);
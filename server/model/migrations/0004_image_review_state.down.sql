@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS ix_image_review_state;
+ALTER TABLE image DROP COLUMN IF EXISTS review_state;
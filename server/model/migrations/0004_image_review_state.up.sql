@@ -0,0 +1,2 @@
+ALTER TABLE image ADD COLUMN IF NOT EXISTS review_state varchar(16) not null default 'approved';
+CREATE INDEX IF NOT EXISTS ix_image_review_state ON image(review_state);
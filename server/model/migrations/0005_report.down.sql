@@ -0,0 +1,2 @@
+ALTER TABLE vote_summary DROP COLUMN IF EXISTS is_hidden;
+DROP TABLE IF EXISTS report;
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS report (
+	id serial not null,
+	uuid varchar(32) not null,
+	created_utc timestamp not null,
+	user_id bigint not null,
+	image_id bigint not null,
+	tag_id bigint,
+	reason varchar(32) not null,
+	note varchar(1024) not null default '',
+	state varchar(16) not null,
+	resolved_by bigint,
+	resolved_utc timestamp,
+	CONSTRAINT pk_report_id PRIMARY KEY (id),
+	CONSTRAINT uk_report_uuid UNIQUE (uuid),
+	CONSTRAINT fk_report_user_id FOREIGN KEY (user_id) REFERENCES users(id),
+	CONSTRAINT fk_report_image_id FOREIGN KEY (image_id) REFERENCES image(id) ON DELETE CASCADE,
+	CONSTRAINT fk_report_tag_id FOREIGN KEY (tag_id) REFERENCES tag(id) ON DELETE CASCADE,
+	CONSTRAINT fk_report_resolved_by FOREIGN KEY (resolved_by) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS ix_report_state_created_utc ON report(state, created_utc);
+CREATE INDEX IF NOT EXISTS ix_report_image_id_tag_id ON report(image_id, tag_id);
+-- a user can only have one open report on a given image or link at a time.
+CREATE UNIQUE INDEX IF NOT EXISTS uk_report_open_user_id_image_id_tag_id ON report(user_id, image_id, coalesce(tag_id, 0)) WHERE state = 'open';
+
+ALTER TABLE vote_summary ADD COLUMN IF NOT EXISTS is_hidden bool not null default false;
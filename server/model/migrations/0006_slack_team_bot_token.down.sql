@@ -0,0 +1 @@
+ALTER TABLE slack_team DROP COLUMN IF EXISTS bot_access_token;
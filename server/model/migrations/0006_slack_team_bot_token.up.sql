@@ -0,0 +1 @@
+ALTER TABLE slack_team ADD COLUMN IF NOT EXISTS bot_access_token bytea;
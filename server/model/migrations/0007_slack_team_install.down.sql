@@ -0,0 +1,5 @@
+ALTER TABLE slack_team DROP COLUMN IF EXISTS uninstalled_utc;
+ALTER TABLE slack_team DROP COLUMN IF EXISTS installed_utc;
+ALTER TABLE slack_team DROP COLUMN IF EXISTS bot_user_id;
+ALTER TABLE slack_team DROP COLUMN IF EXISTS scopes;
+ALTER TABLE slack_team DROP COLUMN IF EXISTS user_access_token;
@@ -0,0 +1,5 @@
+ALTER TABLE slack_team ADD COLUMN IF NOT EXISTS user_access_token bytea;
+ALTER TABLE slack_team ADD COLUMN IF NOT EXISTS scopes jsonb;
+ALTER TABLE slack_team ADD COLUMN IF NOT EXISTS bot_user_id varchar(32) not null default '';
+ALTER TABLE slack_team ADD COLUMN IF NOT EXISTS installed_utc timestamp;
+ALTER TABLE slack_team ADD COLUMN IF NOT EXISTS uninstalled_utc timestamp;
@@ -0,0 +1 @@
+ALTER TABLE slack_team ADD COLUMN IF NOT EXISTS use_legacy_attachments boolean not null default false;
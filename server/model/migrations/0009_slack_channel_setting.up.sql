@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS slack_channel_setting (
+	team_id varchar(32) not null,
+	channel_id varchar(32) not null,
+	channel_name varchar(128) not null default '',
+	content_rating int not null,
+	created_utc timestamp not null,
+	updated_utc timestamp not null,
+	updated_by_id varchar(32) not null default '',
+	updated_by_name varchar(128) not null default '',
+	CONSTRAINT pk_slack_channel_setting_team_id_channel_id PRIMARY KEY (team_id, channel_id),
+	CONSTRAINT fk_slack_channel_setting_team_id FOREIGN KEY (team_id) REFERENCES slack_team(team_id) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS ix_search_history_slack_posts;
+ALTER TABLE search_history DROP COLUMN IF EXISTS is_post;
+DROP TABLE IF EXISTS slack_identity;
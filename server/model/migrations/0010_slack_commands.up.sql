@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS slack_identity (
+	team_id varchar(32) not null,
+	slack_user_id varchar(32) not null,
+	user_id bigint not null,
+	created_utc timestamp not null,
+	CONSTRAINT pk_slack_identity_team_id_slack_user_id PRIMARY KEY (team_id, slack_user_id),
+	CONSTRAINT fk_slack_identity_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS ix_slack_identity_user_id ON slack_identity(user_id);
+ALTER TABLE search_history ADD COLUMN IF NOT EXISTS is_post boolean not null default false;
+CREATE INDEX IF NOT EXISTS ix_search_history_slack_posts ON search_history(source_team_identifier, source_channel_identifier, timestamp_utc) WHERE is_post;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS ix_search_history_user_id;
+ALTER TABLE search_history DROP COLUMN IF EXISTS user_id;
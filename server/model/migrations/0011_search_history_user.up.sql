@@ -0,0 +1,2 @@
+ALTER TABLE search_history ADD COLUMN IF NOT EXISTS user_id bigint REFERENCES users(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS ix_search_history_user_id ON search_history(user_id) WHERE user_id IS NOT NULL;
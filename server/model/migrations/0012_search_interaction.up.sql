@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS search_interaction (
+	id bigserial not null,
+	source varchar(32) not null,
+	source_team_identifier varchar(32) not null default '',
+	source_user_identifier varchar(32) not null default '',
+	created_utc timestamp not null,
+	search_query varchar(255) not null,
+	image_id bigint not null,
+	tag_id bigint,
+	action varchar(16) not null,
+	CONSTRAINT pk_search_interaction_id PRIMARY KEY (id),
+	CONSTRAINT fk_search_interaction_image_id FOREIGN KEY (image_id) REFERENCES image(id) ON DELETE CASCADE,
+	CONSTRAINT fk_search_interaction_tag_id FOREIGN KEY (tag_id) REFERENCES tag(id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS ix_search_interaction_search_query_image_id ON search_interaction(search_query, image_id);
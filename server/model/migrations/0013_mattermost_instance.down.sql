@@ -0,0 +1 @@
+DROP TABLE IF EXISTS mattermost_instance;
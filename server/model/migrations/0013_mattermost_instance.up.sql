@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS mattermost_instance (
+	uuid varchar(32) not null,
+	name varchar(255) not null,
+	token_hash bytea not null,
+	is_enabled boolean not null default true,
+	content_rating int not null,
+	created_utc timestamp not null,
+	created_by bigint,
+	CONSTRAINT pk_mattermost_instance_uuid PRIMARY KEY (uuid),
+	CONSTRAINT uk_mattermost_instance_token_hash UNIQUE (token_hash),
+	CONSTRAINT fk_mattermost_instance_created_by FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
@@ -0,0 +1 @@
+ALTER TABLE image DROP COLUMN IF EXISTS video_s3_key;
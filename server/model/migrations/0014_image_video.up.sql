@@ -0,0 +1 @@
+ALTER TABLE image ADD COLUMN IF NOT EXISTS video_s3_key varchar(64) not null default '';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS file_deletion;
+-- the image key columns are left at varchar(128); content addressed (sha256) keys don't fit back into varchar(64).
@@ -0,0 +1,12 @@
+ALTER TABLE image ALTER COLUMN s3_key TYPE varchar(128);
+ALTER TABLE image ALTER COLUMN poster_s3_key TYPE varchar(128);
+ALTER TABLE image ALTER COLUMN thumbnail_s3_key TYPE varchar(128);
+ALTER TABLE image ALTER COLUMN video_s3_key TYPE varchar(128);
+CREATE TABLE IF NOT EXISTS file_deletion (
+	id bigserial not null,
+	created_utc timestamp not null,
+	s3_bucket varchar(64) not null,
+	s3_key varchar(128) not null,
+	CONSTRAINT pk_file_deletion_id PRIMARY KEY (id),
+	CONSTRAINT uk_file_deletion_s3_bucket_s3_key UNIQUE (s3_bucket, s3_key)
+);
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS ix_image_perceptual_hash ON image(perceptual_hash);
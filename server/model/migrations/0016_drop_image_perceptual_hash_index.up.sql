@@ -0,0 +1,2 @@
+-- similar images are found by hamming distance, which a btree on the hash can't help with.
+DROP INDEX IF EXISTS ix_image_perceptual_hash;
@@ -0,0 +1 @@
+ALTER TABLE image DROP COLUMN IF EXISTS perceptual_hash_attempts;
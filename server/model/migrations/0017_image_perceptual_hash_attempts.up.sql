@@ -0,0 +1 @@
+ALTER TABLE image ADD COLUMN IF NOT EXISTS perceptual_hash_attempts int not null default 0;
@@ -0,0 +1 @@
+ALTER TABLE image ADD COLUMN IF NOT EXISTS derivatives_attempts int not null default 0;
@@ -0,0 +1,2 @@
+-- set when reports moved an approved image back to pending, so dismissing them can approve it again.
+ALTER TABLE image ADD COLUMN IF NOT EXISTS hidden_by_reports boolean not null default false;
@@ -0,0 +1,7 @@
+-- slack event ids we've already handled, so redelivered events are only handled once.
+CREATE TABLE IF NOT EXISTS slack_event (
+	event_id varchar(64) not null,
+	created_utc timestamp not null,
+	CONSTRAINT pk_slack_event_event_id PRIMARY KEY (event_id)
+);
+CREATE INDEX IF NOT EXISTS ix_slack_event_created_utc ON slack_event(created_utc);
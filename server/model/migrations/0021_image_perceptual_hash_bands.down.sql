@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS ix_image_perceptual_hash_band_3;
+DROP INDEX IF EXISTS ix_image_perceptual_hash_band_2;
+DROP INDEX IF EXISTS ix_image_perceptual_hash_band_1;
+DROP INDEX IF EXISTS ix_image_perceptual_hash_band_0;
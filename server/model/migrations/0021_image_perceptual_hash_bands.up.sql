@@ -0,0 +1,5 @@
+-- similar images are looked up by 16 bit bands of the perceptual hash (see `perceptualHashBandsPredicate`).
+CREATE INDEX IF NOT EXISTS ix_image_perceptual_hash_band_0 ON image(((perceptual_hash >> 0) & 65535)) WHERE perceptual_hash IS NOT NULL;
+CREATE INDEX IF NOT EXISTS ix_image_perceptual_hash_band_1 ON image(((perceptual_hash >> 16) & 65535)) WHERE perceptual_hash IS NOT NULL;
+CREATE INDEX IF NOT EXISTS ix_image_perceptual_hash_band_2 ON image(((perceptual_hash >> 32) & 65535)) WHERE perceptual_hash IS NOT NULL;
+CREATE INDEX IF NOT EXISTS ix_image_perceptual_hash_band_3 ON image(((perceptual_hash >> 48) & 65535)) WHERE perceptual_hash IS NOT NULL;
@@ -27,6 +27,16 @@ const (
 	ModerationVerbBan = "ban"
 	// ModerationVerbUnban = "unban"
 	ModerationVerbUnban = "unban"
+	// ModerationVerbApprove = "approve"
+	ModerationVerbApprove = "approve"
+	// ModerationVerbReject = "reject"
+	ModerationVerbReject = "reject"
+	// ModerationVerbHide = "hide"
+	ModerationVerbHide = "hide"
+	// ModerationVerbResolve = "resolve"
+	ModerationVerbResolve = "resolve"
+	// ModerationVerbDismiss = "dismiss"
+	ModerationVerbDismiss = "dismiss"
 	// ModerationObjectImage = "image"
 	ModerationObjectImage = "image"
 	// ModerationObjectTag = "tag"
@@ -0,0 +1,104 @@
+package model
+
+import (
+	"time"
+	"unicode/utf8"
+
+	"github.com/blend/go-sdk/ex"
+	"github.com/blend/go-sdk/uuid"
+)
+
+const (
+	// ReportReasonMisrated is an image with the wrong content rating.
+	ReportReasonMisrated = "misrated"
+	// ReportReasonSpam is spam, or a tag link that has nothing to do with the image.
+	ReportReasonSpam = "spam"
+	// ReportReasonOffensive is something that shouldn't be on the site at all.
+	ReportReasonOffensive = "offensive"
+	// ReportReasonDuplicate is an image that already exists.
+	ReportReasonDuplicate = "duplicate"
+	// ReportReasonOther is anything else; the note should explain.
+	ReportReasonOther = "other"
+
+	// ReportStateOpen is a report waiting on a moderator.
+	ReportStateOpen = "open"
+	// ReportStateResolved is a report a moderator acted on.
+	ReportStateResolved = "resolved"
+	// ReportStateDismissed is a report a moderator decided against.
+	ReportStateDismissed = "dismissed"
+
+	// ReportNoteMaxLength is the longest note (in characters) we'll keep.
+	ReportNoteMaxLength = 1024
+
+	// ErrReportReasonInvalid is returned if a report reason is not one of the known reasons.
+	ErrReportReasonInvalid ex.Class = "report reason invalid"
+)
+
+// ReportReasons are all the valid report reasons.
+var ReportReasons = []string{
+	ReportReasonMisrated,
+	ReportReasonSpam,
+	ReportReasonOffensive,
+	ReportReasonDuplicate,
+	ReportReasonOther,
+}
+
+// NewReport returns a new open report on an image, or on a tag link if the tag id is set.
+func NewReport(userID, imageID int64, tagID *int64, reason, note string) (*Report, error) {
+	if !containsString(ReportReasons, reason) {
+		return nil, ex.New(ErrReportReasonInvalid, ex.OptMessagef("reason: %s", reason))
+	}
+	if utf8.RuneCountInString(note) > ReportNoteMaxLength {
+		note = string([]rune(note)[:ReportNoteMaxLength])
+	}
+	return &Report{
+		UUID:       uuid.V4().String(),
+		CreatedUTC: time.Now().UTC(),
+		UserID:     userID,
+		ImageID:    imageID,
+		TagID:      tagID,
+		Reason:     reason,
+		Note:       note,
+		State:      ReportStateOpen,
+	}, nil
+}
+
+// Report is a user flagging an image, or a tag link on an image, for a moderator to look at.
+type Report struct {
+	ID          int64      `json:"-" db:"id,pk,serial"`
+	UUID        string     `json:"uuid" db:"uuid"`
+	CreatedUTC  time.Time  `json:"created_utc" db:"created_utc"`
+	UserID      int64      `json:"-" db:"user_id"`
+	ImageID     int64      `json:"-" db:"image_id"`
+	TagID       *int64     `json:"-" db:"tag_id"`
+	Reason      string     `json:"reason" db:"reason"`
+	Note        string     `json:"note" db:"note"`
+	State       string     `json:"state" db:"state"`
+	ResolvedBy  *int64     `json:"-" db:"resolved_by"`
+	ResolvedUTC *time.Time `json:"resolved_utc,omitempty" db:"resolved_utc"`
+
+	UserUUID  string `json:"user_uuid" db:"user_uuid,readonly"`
+	ImageUUID string `json:"image_uuid" db:"image_uuid,readonly"`
+	TagUUID   string `json:"tag_uuid,omitempty" db:"tag_uuid,readonly"`
+	TagValue  string `json:"tag_value,omitempty" db:"tag_value,readonly"`
+}
+
+// TableName returns the tablename for the object.
+func (r Report) TableName() string {
+	return "report"
+}
+
+// IsZero returns if the object has been set.
+func (r Report) IsZero() bool {
+	return r.ID == 0
+}
+
+// IsLinkReport returns if the report is on a tag link rather than the image as a whole.
+func (r Report) IsLinkReport() bool {
+	return r.TagID != nil
+}
+
+// IsOpen returns if the report is waiting on a moderator.
+func (r Report) IsOpen() bool {
+	return r.State == ReportStateOpen
+}
@@ -0,0 +1,172 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/ex"
+	"github.com/blend/go-sdk/testutil"
+	"github.com/blend/go-sdk/uuid"
+)
+
+func TestNewReport(t *testing.T) {
+	assert := assert.New(t)
+
+	report, err := NewReport(1, 2, nil, ReportReasonMisrated, "not pg-13")
+	assert.Nil(err)
+	assert.True(report.IsOpen())
+	assert.False(report.IsLinkReport())
+
+	_, err = NewReport(1, 2, nil, "not-a-reason", "")
+	assert.True(ex.Is(err, ErrReportReasonInvalid))
+
+	// long notes are cut at a character, not a byte.
+	report, err = NewReport(1, 2, nil, ReportReasonOther, strings.Repeat("é", ReportNoteMaxLength+1))
+	assert.Nil(err)
+	assert.True(utf8.ValidString(report.Note))
+	assert.Equal(ReportNoteMaxLength, utf8.RuneCountInString(report.Note))
+}
+
+func TestCreateReportHidesImage(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	owner, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	i, err := m.CreateTestImage(todo, owner.ID)
+	assert.Nil(err)
+
+	var last *Report
+	for x := 0; x < 2; x++ {
+		reporter, err := m.CreateTestUser(todo)
+		assert.Nil(err)
+		report, err := NewReport(reporter.ID, i.ID, nil, ReportReasonOffensive, "")
+		assert.Nil(err)
+
+		didHide, err := m.CreateReport(todo, report, 2)
+		assert.Nil(err)
+		assert.Equal(x == 1, didHide)
+
+		// reporting again while the report is open is a no-op.
+		again, err := NewReport(reporter.ID, i.ID, nil, ReportReasonSpam, "")
+		assert.Nil(err)
+		didHide, err = m.CreateReport(todo, again, 2)
+		assert.Nil(err)
+		assert.False(didHide)
+		assert.Equal(report.UUID, again.UUID)
+		last = report
+	}
+
+	verify, err := m.GetImageByID(todo, i.ID)
+	assert.Nil(err)
+	assert.Equal(ImageReviewStatePending, verify.ReviewState)
+
+	open, err := m.GetReportsByState(todo, ReportStateOpen, 1000, 0)
+	assert.Nil(err)
+	var count int
+	for _, report := range open {
+		if report.ImageUUID == i.UUID {
+			count++
+		}
+	}
+	assert.Equal(2, count)
+
+	moderator, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	assert.Nil(m.CloseReports(todo, last, ReportStateDismissed, moderator.ID))
+
+	verify, err = m.GetImageByID(todo, i.ID)
+	assert.Nil(err)
+	assert.Equal(ImageReviewStateApproved, verify.ReviewState)
+
+	closed, err := m.GetReportByUUID(todo, last.UUID)
+	assert.Nil(err)
+	assert.Equal(ReportStateDismissed, closed.State)
+	assert.NotNil(closed.ResolvedUTC)
+}
+
+func TestCloseReportsDismissLeavesPendingImage(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	owner, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	i, err := m.CreateTestImage(todo, owner.ID)
+	assert.Nil(err)
+	assert.Nil(m.UpdateImageReviewState(todo, i.ID, ImageReviewStatePending))
+
+	reporter, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	report, err := NewReport(reporter.ID, i.ID, nil, ReportReasonSpam, "")
+	assert.Nil(err)
+	_, err = m.CreateReport(todo, report, 0)
+	assert.Nil(err)
+
+	moderator, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	assert.Nil(m.CloseReports(todo, report, ReportStateDismissed, moderator.ID))
+
+	verify, err := m.GetImageByID(todo, i.ID)
+	assert.Nil(err)
+	assert.Equal(ImageReviewStatePending, verify.ReviewState)
+
+	closed, err := m.GetReportByUUID(todo, report.UUID)
+	assert.Nil(err)
+	assert.Equal(ReportStateDismissed, closed.State)
+}
+
+func TestCreateReportHidesLink(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	owner, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	i, err := m.CreateTestImage(todo, owner.ID)
+	assert.Nil(err)
+	tagValue := "__test_report_" + uuid.V4().String()
+	tag, err := m.CreateTestTagForImageWithVote(todo, owner.ID, i.ID, tagValue)
+	assert.Nil(err)
+
+	images, err := m.SearchImages(todo, tagValue, ContentRatingFilterDefault)
+	assert.Nil(err)
+	assert.Len(images, 1)
+
+	reporter, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	report, err := NewReport(reporter.ID, i.ID, &tag.ID, ReportReasonSpam, "")
+	assert.Nil(err)
+	didHide, err := m.CreateReport(todo, report, 1)
+	assert.Nil(err)
+	assert.True(didHide)
+
+	images, err = m.SearchImages(todo, tagValue, ContentRatingFilterDefault)
+	assert.Nil(err)
+	assert.Empty(images)
+
+	verify, err := m.GetReportByUUID(todo, report.UUID)
+	assert.Nil(err)
+	assert.Equal(tag.UUID, verify.TagUUID)
+	assert.Equal(i.UUID, verify.ImageUUID)
+
+	assert.Nil(m.CloseReports(todo, verify, ReportStateResolved, owner.ID))
+
+	// resolving keeps the link hidden.
+	images, err = m.SearchImages(todo, tagValue, ContentRatingFilterDefault)
+	assert.Nil(err)
+	assert.Empty(images)
+}
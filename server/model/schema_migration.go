@@ -0,0 +1,258 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/db/migration"
+	"github.com/blend/go-sdk/ex"
+)
+
+const (
+	// SchemaMigrationsDir is the path, relative to the repository root, the versioned migrations live in.
+	SchemaMigrationsDir = "server/model/migrations"
+
+	// ErrSchemaMigrationInvalid is returned if the versioned migrations are malformed.
+	ErrSchemaMigrationInvalid ex.Class = "schema migration invalid"
+)
+
+//go:embed migrations/*.sql
+var schemaMigrationFiles embed.FS
+
+var (
+	schemaMigrationFileName    = regexp.MustCompile(`^([0-9]+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+	schemaMigrationNameInvalid = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// SchemaMigration is a numbered, append only, schema change.
+type SchemaMigration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// String returns the migration as it is named on disk.
+func (sm SchemaMigration) String() string {
+	return fmt.Sprintf("%04d_%s", sm.Version, sm.Name)
+}
+
+// SchemaMigrationRecord is a row in `schema_migrations` recording that a migration was applied.
+type SchemaMigrationRecord struct {
+	Version    int       `json:"version" db:"version,pk"`
+	Name       string    `json:"name" db:"name"`
+	AppliedUTC time.Time `json:"applied_utc" db:"applied_utc"`
+}
+
+// TableName returns the tablename for the object.
+func (smr SchemaMigrationRecord) TableName() string {
+	return "schema_migrations"
+}
+
+// SchemaMigrationStatus is a migration and when it was applied, if it has been.
+type SchemaMigrationStatus struct {
+	SchemaMigration
+	AppliedUTC *time.Time
+}
+
+// IsApplied returns if the migration has been applied.
+func (sms SchemaMigrationStatus) IsApplied() bool {
+	return sms.AppliedUTC != nil
+}
+
+// LoadSchemaMigrations returns the versioned migrations compiled into the binary, in version order.
+func LoadSchemaMigrations() ([]SchemaMigration, error) {
+	return ParseSchemaMigrations(schemaMigrationFiles, "migrations")
+}
+
+// MustLoadSchemaMigrations returns the compiled in migrations and panics if they're malformed.
+func MustLoadSchemaMigrations() []SchemaMigration {
+	migrations, err := LoadSchemaMigrations()
+	if err != nil {
+		panic(err)
+	}
+	return migrations
+}
+
+// ParseSchemaMigrations reads `<version>_<name>.(up|down).sql` files from a directory.
+// Versions must start at 1, be contiguous, and have both an up and a down file.
+func ParseSchemaMigrations(fsys fs.FS, dir string) ([]SchemaMigration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, ex.New(err)
+	}
+
+	byVersion := map[int]*SchemaMigration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		pieces := schemaMigrationFileName.FindStringSubmatch(entry.Name())
+		if len(pieces) == 0 {
+			return nil, ex.New(ErrSchemaMigrationInvalid, ex.OptMessagef("unexpected file: %s", entry.Name()))
+		}
+		version, _ := strconv.Atoi(pieces[1])
+		contents, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, ex.New(err)
+		}
+
+		sm, ok := byVersion[version]
+		if !ok {
+			sm = &SchemaMigration{Version: version, Name: pieces[2]}
+			byVersion[version] = sm
+		} else if sm.Name != pieces[2] {
+			return nil, ex.New(ErrSchemaMigrationInvalid, ex.OptMessagef("version %d has multiple names: %s, %s", version, sm.Name, pieces[2]))
+		}
+		if pieces[3] == "up" {
+			sm.Up = string(contents)
+		} else {
+			sm.Down = string(contents)
+		}
+	}
+
+	output := make([]SchemaMigration, 0, len(byVersion))
+	for _, sm := range byVersion {
+		output = append(output, *sm)
+	}
+	sort.Slice(output, func(i, j int) bool {
+		return output[i].Version < output[j].Version
+	})
+	for index, sm := range output {
+		if sm.Version != index+1 {
+			return nil, ex.New(ErrSchemaMigrationInvalid, ex.OptMessagef("missing version %d", index+1))
+		}
+		if strings.TrimSpace(sm.Up) == "" {
+			return nil, ex.New(ErrSchemaMigrationInvalid, ex.OptMessagef("%s is missing an up migration", sm))
+		}
+		if strings.TrimSpace(sm.Down) == "" {
+			return nil, ex.New(ErrSchemaMigrationInvalid, ex.OptMessagef("%s is missing a down migration", sm))
+		}
+	}
+	return output, nil
+}
+
+// CreateSchemaMigration writes empty up and down files for the next version to a directory.
+func CreateSchemaMigration(dir, name string) (upPath, downPath string, err error) {
+	name = strings.Trim(schemaMigrationNameInvalid.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		err = ex.New(ErrSchemaMigrationInvalid, ex.OptMessage("name is required"))
+		return
+	}
+
+	existing, err := ParseSchemaMigrations(os.DirFS(dir), ".")
+	if err != nil {
+		return
+	}
+	next := SchemaMigration{Version: len(existing) + 1, Name: name}
+
+	upPath = filepath.Join(dir, next.String()+".up.sql")
+	downPath = filepath.Join(dir, next.String()+".down.sql")
+	if err = os.WriteFile(upPath, []byte(fmt.Sprintf("-- %s up\n", next)), 0644); err != nil {
+		err = ex.New(err)
+		return
+	}
+	if err = os.WriteFile(downPath, []byte(fmt.Sprintf("-- %s down\n", next)), 0644); err != nil {
+		err = ex.New(err)
+		return
+	}
+	return
+}
+
+// SchemaMigrationsUp returns a suite that applies the given migrations in order, skipping any already applied.
+func SchemaMigrationsUp(migrations []SchemaMigration) *migration.Suite {
+	groups := []*migration.Group{schemaMigrationsTable()}
+	for _, sm := range migrations {
+		groups = append(groups, migration.NewGroupWithAction(
+			migration.Guard(fmt.Sprintf("up %s", sm), schemaMigrationNotApplied(sm.Version)),
+			migration.Actions(
+				migration.Statements(sm.Up),
+				migration.Exec(`INSERT INTO schema_migrations (version, name, applied_utc) VALUES ($1, $2, timezone('utc', now()))`, sm.Version, sm.Name),
+			),
+		))
+	}
+	return migration.New(migration.OptGroups(groups...))
+}
+
+// SchemaMigrationsDown returns a suite that reverts the given migrations in reverse order, skipping any not applied.
+func SchemaMigrationsDown(migrations []SchemaMigration) *migration.Suite {
+	groups := []*migration.Group{schemaMigrationsTable()}
+	for index := len(migrations) - 1; index >= 0; index-- {
+		sm := migrations[index]
+		groups = append(groups, migration.NewGroupWithAction(
+			migration.Guard(fmt.Sprintf("down %s", sm), schemaMigrationApplied(sm.Version)),
+			migration.Actions(
+				migration.Statements(sm.Down),
+				migration.Exec(`DELETE FROM schema_migrations WHERE version = $1`, sm.Version),
+			),
+		))
+	}
+	return migration.New(migration.OptGroups(groups...))
+}
+
+// GetSchemaMigrationStatus returns the status of each of the given migrations.
+func (m Manager) GetSchemaMigrationStatus(ctx context.Context, migrations []SchemaMigration) ([]SchemaMigrationStatus, error) {
+	hasTable, err := m.Invoke(ctx).Query(`SELECT 1 FROM pg_catalog.pg_tables WHERE schemaname = current_schema() AND tablename = 'schema_migrations'`).Any()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []SchemaMigrationRecord
+	if hasTable {
+		if err = m.Invoke(ctx).All(&records); err != nil {
+			return nil, err
+		}
+	}
+	applied := map[int]time.Time{}
+	for _, record := range records {
+		applied[record.Version] = record.AppliedUTC
+	}
+
+	output := make([]SchemaMigrationStatus, len(migrations))
+	for index, sm := range migrations {
+		output[index] = SchemaMigrationStatus{SchemaMigration: sm}
+		if appliedUTC, ok := applied[sm.Version]; ok {
+			output[index].AppliedUTC = &appliedUTC
+		}
+	}
+	return output, nil
+}
+
+func schemaMigrationsTable() *migration.Group {
+	return migration.NewGroupWithAction(
+		migration.TableNotExists("schema_migrations"),
+		migration.Statements(
+			`CREATE TABLE schema_migrations (
+				version int not null,
+				name varchar(255) not null,
+				applied_utc timestamp not null
+			);`,
+			`ALTER TABLE schema_migrations ADD CONSTRAINT pk_schema_migrations_version PRIMARY KEY (version);`,
+		),
+	)
+}
+
+func schemaMigrationNotApplied(version int) migration.GuardPredicateFunc {
+	return func(ctx context.Context, c *db.Connection, tx *sql.Tx) (bool, error) {
+		return c.Invoke(db.OptContext(ctx), db.OptTx(tx)).Query(`SELECT 1 FROM schema_migrations WHERE version = $1`, version).None()
+	}
+}
+
+func schemaMigrationApplied(version int) migration.GuardPredicateFunc {
+	notApplied := schemaMigrationNotApplied(version)
+	return func(ctx context.Context, c *db.Connection, tx *sql.Tx) (bool, error) {
+		return migration.Not(notApplied(ctx, c, tx))
+	}
+}
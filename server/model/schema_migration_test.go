@@ -0,0 +1,85 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/ex"
+	"github.com/blend/go-sdk/testutil"
+)
+
+func TestLoadSchemaMigrations(t *testing.T) {
+	assert := assert.New(t)
+
+	migrations, err := LoadSchemaMigrations()
+	assert.Nil(err)
+	assert.NotEmpty(migrations)
+	for index, sm := range migrations {
+		assert.Equal(index+1, sm.Version)
+		assert.NotEmpty(sm.Name)
+	}
+}
+
+func TestParseSchemaMigrationsInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := ParseSchemaMigrations(fstest.MapFS{
+		"0001_foo.up.sql":   {Data: []byte("select 1;")},
+		"0001_foo.down.sql": {Data: []byte("select 1;")},
+		"0003_bar.up.sql":   {Data: []byte("select 1;")},
+		"0003_bar.down.sql": {Data: []byte("select 1;")},
+	}, ".")
+	assert.True(ex.Is(err, ErrSchemaMigrationInvalid))
+
+	_, err = ParseSchemaMigrations(fstest.MapFS{
+		"0001_foo.up.sql": {Data: []byte("select 1;")},
+	}, ".")
+	assert.True(ex.Is(err, ErrSchemaMigrationInvalid))
+
+	_, err = ParseSchemaMigrations(fstest.MapFS{
+		"foo.sql": {Data: []byte("select 1;")},
+	}, ".")
+	assert.True(ex.Is(err, ErrSchemaMigrationInvalid))
+}
+
+func TestCreateSchemaMigration(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := os.MkdirTemp("", "giffy_migrations")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(os.WriteFile(filepath.Join(dir, "0001_foo.up.sql"), []byte("select 1;"), 0644))
+	assert.Nil(os.WriteFile(filepath.Join(dir, "0001_foo.down.sql"), []byte("select 1;"), 0644))
+
+	upPath, downPath, err := CreateSchemaMigration(dir, "Add Image Column!")
+	assert.Nil(err)
+	assert.Equal(filepath.Join(dir, "0002_add_image_column.up.sql"), upPath)
+	assert.Equal(filepath.Join(dir, "0002_add_image_column.down.sql"), downPath)
+
+	migrations, err := ParseSchemaMigrations(os.DirFS(dir), ".")
+	assert.Nil(err)
+	assert.Len(migrations, 2)
+	assert.Equal("add_image_column", migrations[1].Name)
+}
+
+func TestGetSchemaMigrationStatus(t *testing.T) {
+	assert := assert.New(t)
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	migrations, err := LoadSchemaMigrations()
+	assert.Nil(err)
+
+	status, err := m.GetSchemaMigrationStatus(todo(), migrations)
+	assert.Nil(err)
+	assert.Len(status, len(migrations))
+	for _, sms := range status {
+		assert.True(sms.IsApplied(), sms.String())
+	}
+}
@@ -56,11 +56,15 @@ type SearchHistory struct {
 	SourceChannelName       string `json:"source_channel_name" db:"source_channel_name"`
 	SourceUserIdentifier    string `json:"source_user_identifier" db:"source_user_identifier"`
 	SourceUserName          string `json:"source_user_name" db:"source_user_name"`
+	// UserID is the giffy user the source user is linked to, if any.
+	UserID *int64 `json:"-" db:"user_id"`
 
 	TimestampUTC time.Time `json:"timestamp_utc" db:"timestamp_utc"`
 	SearchQuery  string    `json:"search_query" db:"search_query"`
 
 	DidFindMatch bool `json:"did_find_match" db:"did_find_match"`
+	// IsPost is set when the result was posted to a channel, rather than just shown to the searcher.
+	IsPost bool `json:"is_post" db:"is_post"`
 
 	ImageID *int64 `json:"image_id" db:"image_id"`
 	Image   *Image `json:"image" db:"-"`
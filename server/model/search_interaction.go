@@ -0,0 +1,75 @@
+package model
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/blend/go-sdk/logger"
+
+	"github.com/wcharczuk/giffy/server/core"
+)
+
+const (
+	// SearchInteractionActionShuffle is recorded when a user shuffles away from a result.
+	SearchInteractionActionShuffle = "shuffle"
+	// SearchInteractionActionPost is recorded when a user posts a result.
+	SearchInteractionActionPost = "post"
+	// SearchInteractionActionCancel is recorded when a user cancels a result.
+	SearchInteractionActionCancel = "cancel"
+)
+
+// NewSearchInteraction returns a new search interaction.
+func NewSearchInteraction(source, sourceTeamID, sourceUserID, searchQuery string, imageID int64, tagID *int64, action string) *SearchInteraction {
+	return &SearchInteraction{
+		Source:               source,
+		SourceTeamIdentifier: sourceTeamID,
+		SourceUserIdentifier: sourceUserID,
+		CreatedUTC:           time.Now().UTC(),
+		SearchQuery:          NormalizeSearchQuery(searchQuery),
+		ImageID:              imageID,
+		TagID:                tagID,
+		Action:               action,
+	}
+}
+
+// NormalizeSearchQuery lowercases a query and collapses its whitespace so
+// interactions for the same query are grouped together.
+func NormalizeSearchQuery(query string) string {
+	return strings.ToLower(strings.Join(strings.Fields(query), " "))
+}
+
+var (
+	_ logger.Event        = (*SearchInteraction)(nil)
+	_ logger.TextWritable = (*SearchInteraction)(nil)
+)
+
+// SearchInteraction is a record of what a user did with a search result they were shown.
+// Posts count as positive feedback for the (query, image) pair and shuffles or cancels as negative.
+type SearchInteraction struct {
+	ID                   int64     `json:"-" db:"id,pk,serial"`
+	Source               string    `json:"source" db:"source"`
+	SourceTeamIdentifier string    `json:"source_team_identifier" db:"source_team_identifier"`
+	SourceUserIdentifier string    `json:"source_user_identifier" db:"source_user_identifier"`
+	CreatedUTC           time.Time `json:"created_utc" db:"created_utc"`
+	SearchQuery          string    `json:"search_query" db:"search_query"`
+	ImageID              int64     `json:"image_id" db:"image_id"`
+	TagID                *int64    `json:"tag_id" db:"tag_id"`
+	Action               string    `json:"action" db:"action"`
+}
+
+// TableName returns the table name.
+func (si SearchInteraction) TableName() string {
+	return "search_interaction"
+}
+
+// GetFlag implements logger.Event.
+func (si SearchInteraction) GetFlag() string {
+	return core.FlagSearchInteraction
+}
+
+// WriteText implements logger.TextWritable.
+func (si SearchInteraction) WriteText(tf logger.TextFormatter, output io.Writer) {
+	fmt.Fprintf(output, "Search Query: %s Action: %s ImageID: %d", si.SearchQuery, si.Action, si.ImageID)
+}
@@ -0,0 +1,90 @@
+package model
+
+import (
+	"context"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/testutil"
+)
+
+func TestNormalizeSearchQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("dancing cat", NormalizeSearchQuery("  Dancing \t CAT "))
+	assert.Equal("", NormalizeSearchQuery(" "))
+	assert.Equal("dancing cat", NewSearchInteraction("slack", "T123", "U123", "Dancing  Cat", 1, nil, SearchInteractionActionPost).SearchQuery)
+}
+
+func TestGetSearchInteractionScore(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	i, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+
+	score, err := m.GetSearchInteractionScore(todo, "__test_interaction", i.ID)
+	assert.Nil(err)
+	assert.Equal(0.5, score)
+
+	assert.Nil(m.Invoke(todo).Create(NewSearchInteraction("slack", "T123", "U123", "__test_interaction", i.ID, nil, SearchInteractionActionPost)))
+	assert.Nil(m.Invoke(todo).Create(NewSearchInteraction("slack", "T123", "U123", "__TEST_interaction", i.ID, nil, SearchInteractionActionPost)))
+
+	// (2 posts + 1) / (2 interactions + 2)
+	score, err = m.GetSearchInteractionScore(todo, "__test_interaction", i.ID)
+	assert.Nil(err)
+	assert.InDelta(0.75, score, 0.0001)
+
+	// other queries are unaffected.
+	score, err = m.GetSearchInteractionScore(todo, "__test_other", i.ID)
+	assert.Nil(err)
+	assert.Equal(0.5, score)
+}
+
+func TestSearchImagesInteractionWeight(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	shuffled, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	posted, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	_, err = m.CreateTestTagForImageWithVote(todo, u.ID, shuffled.ID, "__test_interaction_weight")
+	assert.Nil(err)
+	_, err = m.CreateTestTagForImageWithVote(todo, u.ID, posted.ID, "__test_interaction_weight")
+	assert.Nil(err)
+
+	for x := 0; x < 3; x++ {
+		assert.Nil(m.Invoke(todo).Create(NewSearchInteraction("slack", "T123", "U123", "__test_interaction_weight", shuffled.ID, nil, SearchInteractionActionShuffle)))
+		assert.Nil(m.Invoke(todo).Create(NewSearchInteraction("slack", "T123", "U123", "__test_interaction_weight", posted.ID, nil, SearchInteractionActionPost)))
+	}
+
+	// without a weight the feedback is ignored.
+	results, err := m.searchImagesInternal(todo, "__test_interaction_weight", nil, ContentRatingFilterDefault)
+	assert.Nil(err)
+	assert.Len(results, 2)
+	assert.Equal(results[0].Score, results[1].Score)
+
+	m.SearchInteractionWeight = 1
+	results, err = m.searchImagesInternal(todo, "__test_interaction_weight", nil, ContentRatingFilterDefault)
+	assert.Nil(err)
+	assert.Len(results, 2)
+	assert.Equal(posted.ID, results[0].ID)
+	assert.True(results[0].Score > results[1].Score)
+
+	best, err := m.SearchImagesBestResult(todo, "__test_interaction_weight", nil, ContentRatingFilterDefault)
+	assert.Nil(err)
+	assert.Equal(posted.ID, best.ID)
+}
@@ -0,0 +1,113 @@
+package model
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SearchQuery is a parsed image search query.
+type SearchQuery struct {
+	// Terms are scored individually by trigram similarity against tag values.
+	Terms []string
+	// Phrases are quoted terms that must exactly match a (cleaned) tag on the image.
+	Phrases []string
+	// Excluded are `-` prefixed terms; images with a matching (cleaned) tag are excluded.
+	Excluded []string
+}
+
+// IsZero returns if the query has nothing to search for.
+func (sq SearchQuery) IsZero() bool {
+	return len(sq.Terms) == 0 && len(sq.Phrases) == 0
+}
+
+// ParseSearchQuery splits a raw search query into terms, quoted phrases and excluded terms.
+//
+// For example, `happy dance "cat" -dog` has the terms `happy`, `dance` and `happy dance`,
+// the phrase `cat` and excludes `dog`. Excluded terms can also be quoted, i.e. `-"hot dog"`.
+func ParseSearchQuery(query string) SearchQuery {
+	var output SearchQuery
+	var words []string
+
+	seen := map[string]bool{}
+	add := func(list *[]string, kind, value string) {
+		if len(value) == 0 || seen[kind+value] {
+			return
+		}
+		seen[kind+value] = true
+		*list = append(*list, value)
+	}
+
+	for _, token := range tokenizeSearchQuery(query) {
+		switch {
+		case token.excluded:
+			add(&output.Excluded, "-", CleanTagValue(token.value))
+		case token.quoted:
+			add(&output.Phrases, "\"", CleanTagValue(token.value))
+		default:
+			word := strings.ToLower(token.value)
+			// single characters match too much of everything to be useful on their own.
+			if utf8.RuneCountInString(word) > 1 {
+				add(&output.Terms, "", word)
+			}
+			if len(word) > 0 {
+				words = append(words, word)
+			}
+		}
+	}
+
+	// the whole unquoted query is also scored so multi-word tags still rank well.
+	if len(words) > 1 {
+		add(&output.Terms, "", strings.Join(words, " "))
+	}
+	return output
+}
+
+type searchQueryToken struct {
+	value    string
+	quoted   bool
+	excluded bool
+}
+
+func tokenizeSearchQuery(query string) []searchQueryToken {
+	var tokens []searchQueryToken
+	var current strings.Builder
+	var token searchQueryToken
+	var inQuotes bool
+
+	flush := func() {
+		if current.Len() > 0 {
+			token.value = current.String()
+			tokens = append(tokens, token)
+		}
+		current.Reset()
+		token = searchQueryToken{}
+	}
+
+	for _, r := range query {
+		switch {
+		case r == '"':
+			if inQuotes {
+				flush()
+				inQuotes = false
+			} else {
+				// a quote in the middle of a word starts a new token.
+				excluded := token.excluded && current.Len() == 0
+				flush()
+				token.excluded = excluded
+				token.quoted = true
+				inQuotes = true
+			}
+		case inQuotes:
+			current.WriteRune(r)
+		case unicode.IsSpace(r):
+			flush()
+		case r == '-' && current.Len() == 0 && !token.excluded:
+			token.excluded = true
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
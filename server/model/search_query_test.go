@@ -0,0 +1,39 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	parsed := ParseSearchQuery("happy dance cat")
+	assert.Equal([]string{"happy", "dance", "cat", "happy dance cat"}, parsed.Terms)
+	assert.Empty(parsed.Phrases)
+	assert.Empty(parsed.Excluded)
+
+	parsed = ParseSearchQuery(`Happy "Dance Party" -cat -"hot dog!"`)
+	assert.Equal([]string{"happy"}, parsed.Terms)
+	assert.Equal([]string{"dance party"}, parsed.Phrases)
+	assert.Equal([]string{"cat", "hot dog"}, parsed.Excluded)
+
+	parsed = ParseSearchQuery(`a b  "unterminated`)
+	assert.Equal([]string{"a b"}, parsed.Terms)
+	assert.Equal([]string{"unterminated"}, parsed.Phrases)
+
+	parsed = ParseSearchQuery("cat cat - -cat")
+	assert.Equal([]string{"cat", "cat cat"}, parsed.Terms)
+	assert.Equal([]string{"cat"}, parsed.Excluded)
+}
+
+func TestParseSearchQueryZero(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(ParseSearchQuery("").IsZero())
+	assert.True(ParseSearchQuery("-cat").IsZero())
+	assert.True(ParseSearchQuery(`""`).IsZero())
+	assert.False(ParseSearchQuery(`"cat"`).IsZero())
+	assert.False(ParseSearchQuery("__test").IsZero())
+}
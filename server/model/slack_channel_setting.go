@@ -0,0 +1,73 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"github.com/blend/go-sdk/ex"
+)
+
+const (
+	// ErrContentRatingInvalid is returned when a content rating name or value isn't recognized.
+	ErrContentRatingInvalid ex.Class = "invalid content rating"
+)
+
+// ContentRatingNames are the display names for the content ratings, keyed by value.
+var ContentRatingNames = map[int]string{
+	ContentRatingG:    "G",
+	ContentRatingPG:   "PG",
+	ContentRatingPG13: "PG-13",
+	ContentRatingR:    "R",
+	ContentRatingNR:   "NR",
+}
+
+// ParseContentRating parses a content rating name (i.e. `PG-13` or `pg13`) into its value.
+func ParseContentRating(name string) (int, error) {
+	normalized := strings.Replace(strings.ToUpper(strings.TrimSpace(name)), "-", "", -1)
+	for value, ratingName := range ContentRatingNames {
+		if strings.Replace(ratingName, "-", "", -1) == normalized {
+			return value, nil
+		}
+	}
+	return 0, ex.New(ErrContentRatingInvalid, ex.OptMessagef("rating: %s", name))
+}
+
+// IsValidContentRating returns if a value is one of the content ratings.
+func IsValidContentRating(value int) bool {
+	_, ok := ContentRatingNames[value]
+	return ok
+}
+
+// NewSlackChannelSetting returns a new slack channel setting.
+func NewSlackChannelSetting(teamID, channelID string, contentRating int) *SlackChannelSetting {
+	now := time.Now().UTC()
+	return &SlackChannelSetting{
+		TeamID:              teamID,
+		ChannelID:           channelID,
+		ContentRatingFilter: contentRating,
+		CreatedUTC:          now,
+		UpdatedUTC:          now,
+	}
+}
+
+// SlackChannelSetting overrides the team settings for a single channel.
+type SlackChannelSetting struct {
+	TeamID              string    `json:"team_id" db:"team_id,pk"`
+	ChannelID           string    `json:"channel_id" db:"channel_id,pk"`
+	ChannelName         string    `json:"channel_name" db:"channel_name"`
+	ContentRatingFilter int       `json:"content_rating" db:"content_rating"`
+	CreatedUTC          time.Time `json:"created_utc" db:"created_utc"`
+	UpdatedUTC          time.Time `json:"updated_utc" db:"updated_utc"`
+	UpdatedByID         string    `json:"updated_by_id" db:"updated_by_id"`
+	UpdatedByName       string    `json:"updated_by_name" db:"updated_by_name"`
+}
+
+// TableName returns the mapped table name.
+func (scs SlackChannelSetting) TableName() string {
+	return "slack_channel_setting"
+}
+
+// IsZero returns if the object has been set or not.
+func (scs SlackChannelSetting) IsZero() bool {
+	return len(scs.TeamID) == 0 || len(scs.ChannelID) == 0
+}
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"context"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/ex"
+	"github.com/blend/go-sdk/testutil"
+	"github.com/blend/go-sdk/uuid"
+)
+
+func TestParseContentRating(t *testing.T) {
+	assert := assert.New(t)
+
+	for name, expected := range map[string]int{
+		"G":     ContentRatingG,
+		"pg":    ContentRatingPG,
+		"PG-13": ContentRatingPG13,
+		"pg13":  ContentRatingPG13,
+		" R ":   ContentRatingR,
+		"nr":    ContentRatingNR,
+	} {
+		actual, err := ParseContentRating(name)
+		assert.Nil(err, name)
+		assert.Equal(expected, actual, name)
+	}
+
+	_, err := ParseContentRating("X")
+	assert.True(ex.Is(err, ErrContentRatingInvalid))
+	_, err = ParseContentRating("")
+	assert.True(ex.Is(err, ErrContentRatingInvalid))
+
+	assert.True(IsValidContentRating(ContentRatingPG13))
+	assert.False(IsValidContentRating(ContentRatingFilterAll))
+}
+
+func TestSaveSlackChannelSetting(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	team := NewSlackTeam(uuid.V4().String(), "test_team", uuid.V4().String(), "test_user")
+	assert.Nil(m.Invoke(todo).Create(team))
+
+	setting := NewSlackChannelSetting(team.TeamID, "C123", ContentRatingR)
+	setting.ChannelName = "random"
+	assert.Nil(m.SaveSlackChannelSetting(todo, setting))
+
+	verify, err := m.GetSlackChannelSetting(todo, team.TeamID, "C123")
+	assert.Nil(err)
+	assert.False(verify.IsZero())
+	assert.Equal(ContentRatingR, verify.ContentRatingFilter)
+	assert.Equal("random", verify.ChannelName)
+
+	// updating keeps the channel name if one isn't given.
+	assert.Nil(m.SaveSlackChannelSetting(todo, NewSlackChannelSetting(team.TeamID, "C123", ContentRatingG)))
+	verify, err = m.GetSlackChannelSetting(todo, team.TeamID, "C123")
+	assert.Nil(err)
+	assert.Equal(ContentRatingG, verify.ContentRatingFilter)
+	assert.Equal("random", verify.ChannelName)
+
+	settings, err := m.GetSlackChannelSettings(todo, team.TeamID)
+	assert.Nil(err)
+	assert.Len(settings, 1)
+
+	assert.Nil(m.DeleteSlackChannelSetting(todo, team.TeamID, "C123"))
+	verify, err = m.GetSlackChannelSetting(todo, team.TeamID, "C123")
+	assert.Nil(err)
+	assert.True(verify.IsZero())
+}
@@ -0,0 +1,108 @@
+package model
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/blend/go-sdk/crypto"
+	"github.com/blend/go-sdk/ex"
+)
+
+const (
+	// SlackConnectTokenTTL is how long a slack connect link is good for.
+	SlackConnectTokenTTL = 15 * time.Minute
+)
+
+const (
+	// ErrSlackConnectTokenInvalid is returned when a slack connect token is malformed or its signature doesn't match.
+	ErrSlackConnectTokenInvalid ex.Class = "invalid slack connect token"
+	// ErrSlackConnectTokenExpired is returned when a slack connect token is past its expiry.
+	ErrSlackConnectTokenExpired ex.Class = "slack connect token expired"
+)
+
+// NewSlackIdentity returns a new slack identity for a giffy user.
+func NewSlackIdentity(teamID, slackUserID string, userID int64) *SlackIdentity {
+	return &SlackIdentity{
+		TeamID:      teamID,
+		SlackUserID: slackUserID,
+		UserID:      userID,
+		CreatedUTC:  time.Now().UTC(),
+	}
+}
+
+// NewSlackConnectToken returns a signed token that lets whoever opens it link the slack user to their giffy account.
+// The token is handed out (ephemerally) to the slack user by `/giffy connect`, so it's only as trustworthy as slack.
+func NewSlackConnectToken(teamID, slackUserID string, key []byte) (string, error) {
+	if len(key) == 0 {
+		return "", ex.New("`ENCRYPTION_KEY` is not set, cannot continue.")
+	}
+	payload, err := json.Marshal(slackConnectClaims{
+		TeamID:      teamID,
+		SlackUserID: slackUserID,
+		ExpiresUTC:  time.Now().UTC().Add(SlackConnectTokenTTL).Unix(),
+	})
+	if err != nil {
+		return "", ex.New(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(crypto.HMAC256(key, payload)), nil
+}
+
+// ParseSlackConnectToken verifies a slack connect token and returns the slack user it was issued for.
+func ParseSlackConnectToken(token string, key []byte) (teamID, slackUserID string, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		err = ex.New(ErrSlackConnectTokenInvalid)
+		return
+	}
+	payload, payloadErr := base64.RawURLEncoding.DecodeString(parts[0])
+	signature, signatureErr := base64.RawURLEncoding.DecodeString(parts[1])
+	if payloadErr != nil || signatureErr != nil {
+		err = ex.New(ErrSlackConnectTokenInvalid)
+		return
+	}
+	if !hmac.Equal(signature, crypto.HMAC256(key, payload)) {
+		err = ex.New(ErrSlackConnectTokenInvalid)
+		return
+	}
+	var claims slackConnectClaims
+	if jsonErr := json.Unmarshal(payload, &claims); jsonErr != nil || claims.TeamID == "" || claims.SlackUserID == "" {
+		err = ex.New(ErrSlackConnectTokenInvalid)
+		return
+	}
+	if time.Now().UTC().Unix() > claims.ExpiresUTC {
+		err = ex.New(ErrSlackConnectTokenExpired)
+		return
+	}
+	teamID = claims.TeamID
+	slackUserID = claims.SlackUserID
+	return
+}
+
+type slackConnectClaims struct {
+	TeamID      string `json:"t"`
+	SlackUserID string `json:"u"`
+	ExpiresUTC  int64  `json:"e"`
+}
+
+// SlackIdentity links a slack user (in a team) to a giffy user.
+type SlackIdentity struct {
+	TeamID      string    `json:"team_id" db:"team_id,pk"`
+	SlackUserID string    `json:"slack_user_id" db:"slack_user_id,pk"`
+	UserID      int64     `json:"-" db:"user_id"`
+	CreatedUTC  time.Time `json:"created_utc" db:"created_utc"`
+
+	TeamName string `json:"team_name,omitempty" db:"team_name,readonly"`
+}
+
+// TableName returns the mapped table name.
+func (si SlackIdentity) TableName() string {
+	return "slack_identity"
+}
+
+// IsZero returns if the object has been set or not.
+func (si SlackIdentity) IsZero() bool {
+	return si.UserID == 0
+}
@@ -0,0 +1,180 @@
+package model
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/crypto"
+	"github.com/blend/go-sdk/ex"
+	"github.com/blend/go-sdk/testutil"
+	"github.com/blend/go-sdk/uuid"
+)
+
+func TestSlackConnectToken(t *testing.T) {
+	assert := assert.New(t)
+
+	key, err := crypto.CreateKey(32)
+	assert.Nil(err)
+
+	token, err := NewSlackConnectToken("T123", "U123", key)
+	assert.Nil(err)
+
+	teamID, slackUserID, err := ParseSlackConnectToken(token, key)
+	assert.Nil(err)
+	assert.Equal("T123", teamID)
+	assert.Equal("U123", slackUserID)
+
+	otherKey, err := crypto.CreateKey(32)
+	assert.Nil(err)
+	_, _, err = ParseSlackConnectToken(token, otherKey)
+	assert.True(ex.Is(err, ErrSlackConnectTokenInvalid))
+
+	_, _, err = ParseSlackConnectToken("not-a-token", key)
+	assert.True(ex.Is(err, ErrSlackConnectTokenInvalid))
+
+	payload, err := json.Marshal(slackConnectClaims{TeamID: "T123", SlackUserID: "U123", ExpiresUTC: time.Now().UTC().Add(-time.Minute).Unix()})
+	assert.Nil(err)
+	expired := base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(crypto.HMAC256(key, payload))
+	_, _, err = ParseSlackConnectToken(expired, key)
+	assert.True(ex.Is(err, ErrSlackConnectTokenExpired))
+
+	_, err = NewSlackConnectToken("T123", "U123", nil)
+	assert.NotNil(err)
+}
+
+func TestSaveSlackIdentity(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	first, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	second, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+
+	team := NewSlackTeam(uuid.V4().String(), "test_team", uuid.V4().String(), "test_user")
+	assert.Nil(m.Invoke(todo).Create(team))
+
+	assert.Nil(m.SaveSlackIdentity(todo, NewSlackIdentity(team.TeamID, "U123", first.ID)))
+	identities, err := m.GetSlackIdentitiesForUserID(todo, first.ID)
+	assert.Nil(err)
+	assert.Len(identities, 1)
+	assert.Equal("test_team", identities[0].TeamName)
+
+	// connecting again moves the slack user to the new account.
+	assert.Nil(m.SaveSlackIdentity(todo, NewSlackIdentity(team.TeamID, "U123", second.ID)))
+	identities, err = m.GetSlackIdentitiesForUserID(todo, first.ID)
+	assert.Nil(err)
+	assert.Empty(identities)
+
+	linked, err := m.GetUserForSlackIdentity(todo, team.TeamID, "U123")
+	assert.Nil(err)
+	assert.Equal(second.ID, linked.ID)
+
+	// only the linked user can remove the link.
+	assert.Nil(m.DeleteSlackIdentity(todo, first.ID, team.TeamID, "U123"))
+	identities, err = m.GetSlackIdentitiesForUserID(todo, second.ID)
+	assert.Nil(err)
+	assert.Len(identities, 1)
+
+	assert.Nil(m.DeleteSlackIdentity(todo, second.ID, team.TeamID, "U123"))
+	identities, err = m.GetSlackIdentitiesForUserID(todo, second.ID)
+	assert.Nil(err)
+	assert.Empty(identities)
+}
+
+func TestGetUserForSlackIdentity(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+
+	teamID := uuid.V4().String()
+	assert.Nil(m.Invoke(todo).Create(NewSlackIdentity(teamID, "U123", u.ID)))
+
+	linked, err := m.GetUserForSlackIdentity(todo, teamID, "U123")
+	assert.Nil(err)
+	assert.Equal(u.ID, linked.ID)
+
+	unlinked, err := m.GetUserForSlackIdentity(todo, teamID, "U456")
+	assert.Nil(err)
+	assert.True(unlinked.IsZero())
+}
+
+func TestGetLastSlackPost(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	first, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	second, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+
+	teamID := uuid.V4().String()
+
+	post := NewSearchHistoryDetailed("slack", teamID, "test_team", "C123", "random", "U123", "test_user", "cat", true, &first.ID, nil)
+	post.IsPost = true
+	post.TimestampUTC = time.Now().UTC().Add(-time.Minute)
+	assert.Nil(m.Invoke(todo).Create(post))
+
+	// searches that weren't posted don't count.
+	assert.Nil(m.Invoke(todo).Create(NewSearchHistoryDetailed("slack", teamID, "test_team", "C123", "random", "U123", "test_user", "dog", true, &second.ID, nil)))
+
+	last, err := m.GetLastSlackPost(todo, teamID, "C123")
+	assert.Nil(err)
+	assert.NotNil(last.ImageID)
+	assert.Equal(first.ID, *last.ImageID)
+
+	none, err := m.GetLastSlackPost(todo, teamID, "C456")
+	assert.Nil(err)
+	assert.Nil(none.ImageID)
+}
+
+func TestGetRandomImageForContentRating(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	i, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+
+	random, err := m.GetRandomImageForContentRating(todo, ContentRatingNR, nil)
+	assert.Nil(err)
+	assert.False(random.IsZero())
+
+	_, err = m.Invoke(todo).Exec(`update image set content_rating = $1 where id <> $2`, ContentRatingNR, i.ID)
+	assert.Nil(err)
+	_, err = m.Invoke(todo).Exec(`update image set content_rating = $1 where id = $2`, ContentRatingG, i.ID)
+	assert.Nil(err)
+
+	random, err = m.GetRandomImageForContentRating(todo, ContentRatingG, nil)
+	assert.Nil(err)
+	assert.Equal(i.UUID, random.UUID)
+
+	random, err = m.GetRandomImageForContentRating(todo, ContentRatingG, []string{i.UUID})
+	assert.Nil(err)
+	assert.True(random.IsZero())
+}
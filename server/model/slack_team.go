@@ -2,6 +2,15 @@ package model
 
 import (
 	"time"
+
+	"github.com/blend/go-sdk/crypto"
+	"github.com/blend/go-sdk/ex"
+)
+
+const (
+	// SlackEventRetention is how long handled slack event ids are kept to drop redeliveries.
+	// Slack gives up retrying an event within the hour.
+	SlackEventRetention = 24 * time.Hour
 )
 
 // NewSlackTeam returns a new SlackTeam.
@@ -26,6 +35,14 @@ type SlackTeam struct {
 	CreatedByID         string    `json:"created_by_id" db:"created_by_id"`
 	CreatedByName       string    `json:"created_by_name" db:"created_by_name"`
 	ContentRatingFilter int       `json:"content_rating" db:"content_rating"`
+	// UseLegacyAttachments renders slash command results with legacy attachments instead of block kit.
+	UseLegacyAttachments bool       `json:"use_legacy_attachments" db:"use_legacy_attachments"`
+	BotAccessToken       []byte     `json:"-" db:"bot_access_token"`
+	UserAccessToken      []byte     `json:"-" db:"user_access_token"`
+	BotUserID            string     `json:"bot_user_id" db:"bot_user_id"`
+	Scopes               []string   `json:"scopes" db:"scopes,json"`
+	InstalledUTC         *time.Time `json:"installed_utc,omitempty" db:"installed_utc"`
+	UninstalledUTC       *time.Time `json:"uninstalled_utc,omitempty" db:"uninstalled_utc"`
 }
 
 // TableName returns the mapped table name.
@@ -37,3 +54,75 @@ func (st SlackTeam) TableName() string {
 func (st SlackTeam) IsZero() bool {
 	return len(st.TeamID) == 0
 }
+
+// IsUninstalled returns if the slack app was uninstalled (or had its tokens revoked) by the team.
+func (st SlackTeam) IsUninstalled() bool {
+	return st.UninstalledUTC != nil
+}
+
+// HasBotToken returns if the team has a bot token stored.
+func (st SlackTeam) HasBotToken() bool {
+	return len(st.BotAccessToken) > 0
+}
+
+// SetInstall encrypts and sets the tokens from an oauth install.
+// A team that had uninstalled the app is re-enabled.
+func (st *SlackTeam) SetInstall(install SlackTeamInstall, key []byte) (err error) {
+	if st.BotAccessToken, err = encryptSlackToken(install.BotToken, key); err != nil {
+		return
+	}
+	if st.UserAccessToken, err = encryptSlackToken(install.UserToken, key); err != nil {
+		return
+	}
+	st.BotUserID = install.BotUserID
+	st.Scopes = install.Scopes
+	now := time.Now().UTC()
+	st.InstalledUTC = &now
+	if st.IsUninstalled() {
+		st.IsEnabled = true
+		st.UninstalledUTC = nil
+	}
+	return
+}
+
+// BotToken decrypts and returns the bot access token.
+func (st SlackTeam) BotToken(key []byte) (string, error) {
+	return decryptSlackToken(st.BotAccessToken, key)
+}
+
+// UserToken decrypts and returns the user access token of the installing user.
+func (st SlackTeam) UserToken(key []byte) (string, error) {
+	return decryptSlackToken(st.UserAccessToken, key)
+}
+
+// SlackTeamInstall are the credentials returned by slack when a team installs the app.
+type SlackTeamInstall struct {
+	BotToken  string
+	UserToken string
+	BotUserID string
+	Scopes    []string
+}
+
+func encryptSlackToken(token string, key []byte) ([]byte, error) {
+	if token == "" {
+		return nil, nil
+	}
+	if len(key) == 0 {
+		return nil, ex.New("`ENCRYPTION_KEY` is not set, cannot continue.")
+	}
+	return crypto.Encrypt(key, []byte(token))
+}
+
+func decryptSlackToken(encrypted, key []byte) (string, error) {
+	if len(encrypted) == 0 {
+		return "", nil
+	}
+	if len(key) == 0 {
+		return "", ex.New("`ENCRYPTION_KEY` is not set, cannot continue.")
+	}
+	token, err := crypto.Decrypt(key, encrypted)
+	if err != nil {
+		return "", err
+	}
+	return string(token), nil
+}
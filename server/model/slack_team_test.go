@@ -6,6 +6,7 @@ import (
 	"time"
 
 	assert "github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/crypto"
 	"github.com/blend/go-sdk/testutil"
 	"github.com/blend/go-sdk/uuid"
 )
@@ -35,3 +36,108 @@ func TestSlackTeam(t *testing.T) {
 	assert.Nil(err)
 	assert.False(verify.IsZero())
 }
+
+func TestSlackTeamSetInstall(t *testing.T) {
+	assert := assert.New(t)
+
+	key, err := crypto.CreateKey(32)
+	assert.Nil(err)
+
+	team := NewSlackTeam(uuid.V4().String(), "test_team", uuid.V4().String(), "test_user")
+	assert.False(team.HasBotToken())
+
+	err = team.SetInstall(SlackTeamInstall{
+		BotToken:  "xoxb-test",
+		UserToken: "xoxp-test",
+		BotUserID: "UGIFFY",
+		Scopes:    []string{"commands", "links:write"},
+	}, key)
+	assert.Nil(err)
+	assert.True(team.HasBotToken())
+	assert.NotEqual("xoxb-test", string(team.BotAccessToken))
+	assert.Equal("UGIFFY", team.BotUserID)
+	assert.Equal([]string{"commands", "links:write"}, team.Scopes)
+	assert.NotNil(team.InstalledUTC)
+
+	botToken, err := team.BotToken(key)
+	assert.Nil(err)
+	assert.Equal("xoxb-test", botToken)
+	userToken, err := team.UserToken(key)
+	assert.Nil(err)
+	assert.Equal("xoxp-test", userToken)
+
+	assert.NotNil(team.SetInstall(SlackTeamInstall{BotToken: "xoxb-test"}, nil))
+}
+
+func TestSlackTeamSetInstallReenablesUninstalled(t *testing.T) {
+	assert := assert.New(t)
+
+	key, err := crypto.CreateKey(32)
+	assert.Nil(err)
+
+	uninstalled := time.Now().UTC()
+	team := NewSlackTeam(uuid.V4().String(), "test_team", uuid.V4().String(), "test_user")
+	team.IsEnabled = false
+	team.UninstalledUTC = &uninstalled
+	assert.True(team.IsUninstalled())
+
+	assert.Nil(team.SetInstall(SlackTeamInstall{BotToken: "xoxb-test"}, key))
+	assert.True(team.IsEnabled)
+	assert.False(team.IsUninstalled())
+
+	// teams disabled by an admin stay disabled.
+	disabled := NewSlackTeam(uuid.V4().String(), "test_team", uuid.V4().String(), "test_user")
+	disabled.IsEnabled = false
+	assert.Nil(disabled.SetInstall(SlackTeamInstall{BotToken: "xoxb-test"}, key))
+	assert.False(disabled.IsEnabled)
+}
+
+func TestUninstallSlackTeam(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	key, err := crypto.CreateKey(32)
+	assert.Nil(err)
+
+	team := NewSlackTeam(uuid.V4().String(), "test_team", uuid.V4().String(), "test_user")
+	assert.Nil(team.SetInstall(SlackTeamInstall{BotToken: "xoxb-test", UserToken: "xoxp-test", BotUserID: "UGIFFY"}, key))
+	assert.Nil(m.Invoke(todo).Create(team))
+
+	assert.Nil(m.UninstallSlackTeam(todo, team.TeamID))
+
+	verify, err := m.GetSlackTeamByTeamID(todo, team.TeamID)
+	assert.Nil(err)
+	assert.False(verify.IsEnabled)
+	assert.True(verify.IsUninstalled())
+	assert.False(verify.HasBotToken())
+	assert.Empty(verify.UserAccessToken)
+	assert.Equal("UGIFFY", verify.BotUserID)
+}
+
+func TestMarkSlackEventHandled(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	eventID := uuid.V4().String()
+	isNew, err := m.MarkSlackEventHandled(todo, eventID)
+	assert.Nil(err)
+	assert.True(isNew)
+	isNew, err = m.MarkSlackEventHandled(todo, eventID)
+	assert.Nil(err)
+	assert.False(isNew)
+
+	// old events are forgotten.
+	_, err = m.Invoke(todo).Exec(`update slack_event set created_utc = $2 where event_id = $1`, eventID, time.Now().UTC().Add(-2*SlackEventRetention))
+	assert.Nil(err)
+	isNew, err = m.MarkSlackEventHandled(todo, eventID)
+	assert.Nil(err)
+	assert.True(isNew)
+}
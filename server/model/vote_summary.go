@@ -17,6 +17,7 @@ type VoteSummary struct {
 	VotesFor       int       `json:"votes_for" db:"votes_for"`
 	VotesAgainst   int       `json:"votes_against" db:"votes_against"`
 	VotesTotal     int       `json:"votes_total" db:"votes_total"`
+	IsHidden       bool      `json:"is_hidden" db:"is_hidden"`
 }
 
 // IsZero returns if an image has been set.
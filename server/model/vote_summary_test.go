@@ -2,10 +2,14 @@ package model
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/db/dbutil"
 	"github.com/blend/go-sdk/testutil"
+	"github.com/blend/go-sdk/uuid"
 )
 
 func TestSetVoteSummaryVoteCounts(t *testing.T) {
@@ -236,3 +240,208 @@ func TestReconcileVoteSummaryTotals(t *testing.T) {
 	assert.Equal(verify.VotesAgainst, verify2.VotesAgainst)
 	assert.Equal(verify.VotesTotal, verify2.VotesTotal)
 }
+
+func TestCreateOrUpdateVoteChangesVote(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	tx, err := testutil.DefaultDB().Begin()
+	assert.Nil(err)
+	defer tx.Rollback()
+	m := NewTestManager(tx)
+
+	u, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	i, err := m.CreateTestImage(todo, u.ID)
+	assert.Nil(err)
+	tag, err := m.CreateTestTag(todo, u.ID, uuid.V4().String())
+	assert.Nil(err)
+
+	didCreate, err := m.CreateOrUpdateVote(todo, u.ID, i.ID, tag.ID, true)
+	assert.Nil(err)
+	assert.True(didCreate)
+
+	// voting the same way again is a no-op.
+	didCreate, err = m.CreateOrUpdateVote(todo, u.ID, i.ID, tag.ID, true)
+	assert.Nil(err)
+	assert.False(didCreate)
+
+	verify, err := m.GetVoteSummary(todo, i.ID, tag.ID)
+	assert.Nil(err)
+	assert.Equal(1, verify.VotesFor)
+	assert.Equal(0, verify.VotesAgainst)
+	assert.Equal(1, verify.VotesTotal)
+
+	_, err = m.CreateOrUpdateVote(todo, u.ID, i.ID, tag.ID, false)
+	assert.Nil(err)
+
+	verify, err = m.GetVoteSummary(todo, i.ID, tag.ID)
+	assert.Nil(err)
+	assert.Equal(0, verify.VotesFor)
+	assert.Equal(1, verify.VotesAgainst)
+	assert.Equal(-1, verify.VotesTotal)
+
+	vote, err := m.GetVote(todo, u.ID, i.ID, tag.ID)
+	assert.Nil(err)
+	assert.False(vote.IsUpvote)
+}
+
+func TestInTxRollsBack(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	m := Manager{BaseManager: dbutil.NewBaseManager(testutil.DefaultDB())}
+
+	tagValue := uuid.V4().String()
+	err := m.InTx(todo, func(txm Manager) error {
+		u, err := txm.CreateTestUser(todo)
+		if err != nil {
+			return err
+		}
+		if _, err = txm.CreateTestTag(todo, u.ID, tagValue); err != nil {
+			return err
+		}
+		return fmt.Errorf("rollback")
+	})
+	assert.NotNil(err)
+
+	verify, err := m.GetTagByValue(todo, tagValue)
+	assert.Nil(err)
+	assert.True(verify.IsZero())
+}
+
+func TestCreateOrUpdateVoteConcurrent(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+
+	// these run outside a test transaction so the votes actually race; clean up after.
+	m := Manager{BaseManager: dbutil.NewBaseManager(testutil.DefaultDB())}
+
+	owner, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	i, err := m.CreateTestImage(todo, owner.ID)
+	assert.Nil(err)
+	tag, err := m.CreateTestTag(todo, owner.ID, uuid.V4().String())
+	assert.Nil(err)
+
+	const voters = 16
+	userIDs := []int64{owner.ID}
+	for x := 0; x < voters; x++ {
+		u, err := m.CreateTestUser(todo)
+		assert.Nil(err)
+		userIDs = append(userIDs, u.ID)
+	}
+	defer cleanupConcurrentVotes(assert, m, i.ID, tag.ID, userIDs)
+
+	var wg sync.WaitGroup
+	errors := make(chan error, voters*2)
+	for _, userID := range userIDs[1:] {
+		// each user votes twice at once; only one of them should count.
+		for y := 0; y < 2; y++ {
+			wg.Add(1)
+			go func(userID int64, isUpvote bool) {
+				defer wg.Done()
+				_, err := m.CreateOrUpdateVote(todo, userID, i.ID, tag.ID, isUpvote)
+				errors <- err
+			}(userID, userID%2 == 0)
+		}
+	}
+	wg.Wait()
+	close(errors)
+	for err := range errors {
+		assert.Nil(err)
+	}
+
+	votes, err := m.GetVotesForImage(todo, i.ID)
+	assert.Nil(err)
+	assert.Len(votes, voters)
+
+	var votesFor, votesAgainst int
+	for _, vote := range votes {
+		if vote.IsUpvote {
+			votesFor++
+		} else {
+			votesAgainst++
+		}
+	}
+
+	verify, err := m.GetVoteSummary(todo, i.ID, tag.ID)
+	assert.Nil(err)
+	assert.Equal(votesFor, verify.VotesFor)
+	assert.Equal(votesAgainst, verify.VotesAgainst)
+	assert.Equal(votesFor-votesAgainst, verify.VotesTotal)
+}
+
+func TestMergeTagsConcurrent(t *testing.T) {
+	assert := assert.New(t)
+	todo := context.TODO()
+	m := Manager{BaseManager: dbutil.NewBaseManager(testutil.DefaultDB())}
+
+	owner, err := m.CreateTestUser(todo)
+	assert.Nil(err)
+	i, err := m.CreateTestImage(todo, owner.ID)
+	assert.Nil(err)
+	from, err := m.CreateTestTag(todo, owner.ID, uuid.V4().String())
+	assert.Nil(err)
+	to, err := m.CreateTestTag(todo, owner.ID, uuid.V4().String())
+	assert.Nil(err)
+
+	const voters = 8
+	userIDs := []int64{owner.ID}
+	for x := 0; x < voters; x++ {
+		u, err := m.CreateTestUser(todo)
+		assert.Nil(err)
+		userIDs = append(userIDs, u.ID)
+		_, err = m.CreateOrUpdateVote(todo, u.ID, i.ID, from.ID, true)
+		assert.Nil(err)
+	}
+	defer cleanupConcurrentVotes(assert, m, i.ID, from.ID, userIDs)
+	defer cleanupConcurrentVotes(assert, m, i.ID, to.ID, nil)
+
+	var wg sync.WaitGroup
+	errors := make(chan error, voters+1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		errors <- m.MergeTags(todo, from.ID, to.ID)
+	}()
+	for _, userID := range userIDs[1:] {
+		wg.Add(1)
+		go func(userID int64) {
+			defer wg.Done()
+			_, err := m.CreateOrUpdateVote(todo, userID, i.ID, to.ID, true)
+			errors <- err
+		}(userID)
+	}
+	wg.Wait()
+	close(errors)
+	for err := range errors {
+		assert.Nil(err)
+	}
+
+	votes, err := m.GetVotesForImage(todo, i.ID)
+	assert.Nil(err)
+
+	var votesFor int
+	for _, vote := range votes {
+		if vote.TagID == to.ID && vote.IsUpvote {
+			votesFor++
+		}
+	}
+
+	verify, err := m.GetVoteSummary(todo, i.ID, to.ID)
+	assert.Nil(err)
+	assert.Equal(votesFor, verify.VotesFor)
+	assert.Equal(votesFor-verify.VotesAgainst, verify.VotesTotal)
+}
+
+func cleanupConcurrentVotes(assert *assert.Assertions, m Manager, imageID, tagID int64, userIDs []int64) {
+	todo := context.TODO()
+	assert.Nil(m.DeleteTagAndVotesByID(todo, tagID))
+	if len(userIDs) == 0 {
+		return
+	}
+	assert.Nil(m.DeleteImageByID(todo, imageID))
+	for _, userID := range userIDs {
+		_, err := m.Invoke(todo).Exec(`delete from users where id = $1`, userID)
+		assert.Nil(err)
+	}
+}
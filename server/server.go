@@ -18,6 +18,7 @@ import (
 	"github.com/wcharczuk/giffy/server/filemanager"
 	"github.com/wcharczuk/giffy/server/jobs"
 	"github.com/wcharczuk/giffy/server/model"
+	"github.com/wcharczuk/giffy/server/transcode"
 )
 
 const (
@@ -52,7 +53,7 @@ func New(cfg *config.Giffy) (*web.App, error) {
 	log := logger.MustNew(
 		logger.OptConfig(cfg.Logger),
 	)
-	log.Enable(core.FlagSearch, core.FlagModeration)
+	log.Enable(core.FlagSearch, core.FlagSearchInteraction, core.FlagModeration)
 	log.Disable(db.QueryStartFlag)
 
 	conn, err := db.New(
@@ -69,16 +70,25 @@ func New(cfg *config.Giffy) (*web.App, error) {
 	log.Infof("using service env: %s", cfg.ServiceEnvOrDefault())
 	log.Infof("using database: %s", conn.Config.CreateLoggingDSN())
 	log.Infof("using admin user email: %s", cfg.AdminUserEmail)
-	if cfg.Aws.AccessKeyID != "" {
-		log.Infof("using aws access key: %s", cfg.Aws.AccessKeyID)
-	} else {
-		log.Warningf("aws access key unset, uploads will fail")
+	log.Infof("using storage provider: %s", cfg.Storage.ProviderOrDefault())
+	switch cfg.Storage.ProviderOrDefault() {
+	case filemanager.ProviderS3:
+		if cfg.Aws.AccessKeyID != "" {
+			log.Infof("using aws access key: %s", cfg.Aws.AccessKeyID)
+		} else {
+			log.Warningf("aws access key unset, uploads will fail")
+		}
+		log.Infof("using aws region: %s", cfg.Aws.RegionOrDefault())
+		log.Infof("using aws s3 bucket: %s", cfg.S3Bucket)
+		log.Infof("using aws cloudfront dns: %s", cfg.CloudFrontDNS)
+	case filemanager.ProviderLocal:
+		log.Infof("using local storage path: %s", cfg.Storage.LocalPathOrDefault())
+	}
+	if cfg.SlackSigningSecret == "" && cfg.SlackVerificationToken == "" {
+		log.Warningf("slack signing secret and verification token unset, slack requests will be rejected")
 	}
-	log.Infof("using aws region: %s", cfg.Aws.RegionOrDefault())
-	log.Infof("using aws s3 bucket: %s", cfg.S3Bucket)
-	log.Infof("using aws cloudfront dns: %s", cfg.CloudFrontDNS)
 
-	mgr := &model.Manager{BaseManager: dbutil.NewBaseManager(conn)}
+	mgr := &model.Manager{BaseManager: dbutil.NewBaseManager(conn), SearchInteractionWeight: cfg.GetSearchInteractionWeight()}
 
 	oauthMgr, err := oauth.New(
 		oauth.OptConfig(cfg.GoogleAuth),
@@ -113,6 +123,11 @@ func New(cfg *config.Giffy) (*web.App, error) {
 			logger.MaybeError(log, mgr.Invoke(context.Background()).Create(typed))
 		}
 	})
+	log.Listen(core.FlagSearchInteraction, "event-writer", func(_ context.Context, e logger.Event) {
+		if typed, ok := e.(db.DatabaseMapped); ok {
+			logger.MaybeError(log, mgr.Invoke(context.Background()).Create(typed))
+		}
+	})
 	log.Listen(core.FlagModeration, "event-writer", func(_ context.Context, e logger.Event) {
 		if typed, ok := e.(db.DatabaseMapped); ok {
 			logger.MaybeError(log, mgr.Invoke(context.Background()).Create(typed))
@@ -121,11 +136,26 @@ func New(cfg *config.Giffy) (*web.App, error) {
 
 	app.Views.AddPaths(ViewPaths...)
 
-	fm := filemanager.New(cfg.S3Bucket, cfg.Aws)
+	fm, err := filemanager.NewFromConfig(cfg.S3Bucket, cfg.Storage, cfg.Aws)
+	if err != nil {
+		return nil, err
+	}
+	transcoder, err := transcode.NewFromConfig(cfg.Transcode)
+	if err != nil {
+		return nil, err
+	}
+	if transcoder != nil {
+		videoFormat, err := transcode.ParseFormat(cfg.Transcode.FormatOrDefault())
+		if err != nil {
+			return nil, err
+		}
+		fm.WithTranscoder(transcoder, videoFormat)
+	}
 
 	app.Register(controller.Index{Log: log, Model: mgr, Config: cfg})
 	app.Register(controller.APIs{Log: log, Model: mgr, Config: cfg, Files: fm, OAuth: oauthMgr})
-	app.Register(controller.Integrations{Log: log, Model: mgr, Config: cfg})
+	app.Register(controller.Integrations{Log: log, Model: mgr, Config: cfg, Files: fm})
+	app.Register(controller.Giphy{Log: log, Model: mgr, Config: cfg})
 	app.Register(controller.Auth{Log: log, Model: mgr, Config: cfg, OAuth: oauthMgr})
 	app.Register(controller.UploadImage{Log: log, Model: mgr, Config: cfg, Files: fm})
 	app.Register(controller.Chart{Log: log, Model: mgr, Config: cfg})
@@ -138,6 +168,10 @@ func New(cfg *config.Giffy) (*web.App, error) {
 	cron.Default().LoadJobs(jobs.DeleteOrphanedTags{Model: mgr})
 	cron.Default().LoadJobs(jobs.CleanTagValues{Model: mgr})
 	cron.Default().LoadJobs(jobs.FixContentRating{Model: mgr})
+	cron.Default().LoadJobs(jobs.ComputePerceptualHashes{Log: log, Model: mgr, Files: fm})
+	cron.Default().LoadJobs(jobs.GenerateImageDerivatives{Log: log, Model: mgr, Files: fm})
+	cron.Default().LoadJobs(jobs.DeleteUnreferencedFiles{Log: log, Model: mgr, Files: fm})
+	cron.Default().LoadJobs(jobs.ReconcileStorage{Log: log, Model: mgr, Files: fm})
 	cron.Default().StartAsync()
 
 	return app, nil
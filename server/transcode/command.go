@@ -0,0 +1,80 @@
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blend/go-sdk/ex"
+)
+
+var (
+	_ Worker = (*Command)(nil)
+)
+
+// Command is a worker that shells out to a local ffmpeg compatible encoder binary.
+type Command struct {
+	Binary  string
+	Timeout time.Duration
+}
+
+// Transcode implements Worker.
+func (c *Command) Transcode(ctx context.Context, contents []byte, format Format) ([]byte, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	workDir, err := ioutil.TempDir("", "giffy-transcode-")
+	if err != nil {
+		return nil, ex.New(err)
+	}
+	defer os.RemoveAll(workDir)
+
+	input := filepath.Join(workDir, "input.gif")
+	if err = ioutil.WriteFile(input, contents, 0600); err != nil {
+		return nil, ex.New(err)
+	}
+	output := filepath.Join(workDir, "output"+format.Extension)
+
+	args, err := Args(input, output, format)
+	if err != nil {
+		return nil, err
+	}
+	stderr := new(bytes.Buffer)
+	cmd := exec.CommandContext(ctx, c.Binary, args...)
+	cmd.Stderr = stderr
+	if err = cmd.Run(); err != nil {
+		return nil, ex.New(ErrEncoderFailed, ex.OptMessage(strings.TrimSpace(stderr.String())), ex.OptInner(err))
+	}
+
+	video, err := ioutil.ReadFile(output)
+	if err != nil {
+		return nil, ex.New(err)
+	}
+	if len(video) == 0 {
+		return nil, ex.New(ErrEncoderFailed, ex.OptMessage("the encoder produced an empty file"))
+	}
+	return video, nil
+}
+
+// Args returns the encoder arguments to transcode a gif to a format.
+// Both codecs need even dimensions, so odd widths and heights are rounded down a pixel.
+func Args(input, output string, format Format) ([]string, error) {
+	args := []string{"-y", "-hide_banner", "-loglevel", "error", "-i", input, "-an", "-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2"}
+	switch format.Name {
+	case FormatMP4.Name:
+		args = append(args, "-c:v", "libx264", "-pix_fmt", "yuv420p", "-movflags", "+faststart")
+	case FormatWebM.Name:
+		args = append(args, "-c:v", "libvpx-vp9", "-b:v", "0", "-crf", "40", "-pix_fmt", "yuv420p")
+	default:
+		return nil, ex.New(ErrInvalidFormat, ex.OptMessagef("format: %s", format.Name))
+	}
+	return append(args, output), nil
+}
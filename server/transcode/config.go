@@ -0,0 +1,55 @@
+package transcode
+
+import (
+	"context"
+	"time"
+
+	"github.com/blend/go-sdk/configutil"
+	"github.com/blend/go-sdk/env"
+)
+
+// Assert Config implements configutil.Resolver
+var (
+	_ configutil.Resolver = (*Config)(nil)
+)
+
+const (
+	// DefaultFormat is the default video format.
+	DefaultFormat = "mp4"
+	// DefaultTimeout is the default time an encode can take before it's abandoned.
+	DefaultTimeout = 2 * time.Minute
+)
+
+// Config is the video transcoding config.
+// Transcoding is disabled unless the encoder binary (i.e. `/usr/bin/ffmpeg`) is set.
+type Config struct {
+	Binary  string        `json:"binary,omitempty" yaml:"binary,omitempty" env:"TRANSCODE_BINARY"`
+	Format  string        `json:"format,omitempty" yaml:"format,omitempty" env:"TRANSCODE_FORMAT"`
+	Timeout time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty" env:"TRANSCODE_TIMEOUT"`
+}
+
+// Resolve implements configutil.Resolver.
+func (c *Config) Resolve(ctx context.Context) error {
+	return env.GetVars(ctx).ReadInto(c)
+}
+
+// IsEnabled returns if transcoding is configured.
+func (c Config) IsEnabled() bool {
+	return c.Binary != ""
+}
+
+// FormatOrDefault gets a property or a default.
+func (c Config) FormatOrDefault() string {
+	if c.Format != "" {
+		return c.Format
+	}
+	return DefaultFormat
+}
+
+// TimeoutOrDefault gets a property or a default.
+func (c Config) TimeoutOrDefault() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return DefaultTimeout
+}
@@ -0,0 +1,30 @@
+package transcode
+
+import (
+	"context"
+	"sync"
+)
+
+var (
+	_ Worker = (*Fake)(nil)
+)
+
+// Fake is a worker that doesn't encode anything; it returns its output (or error) for every call.
+// It is safe for concurrent use, and is mostly useful for tests.
+type Fake struct {
+	sync.Mutex
+	Output []byte
+	Err    error
+	Calls  []Format
+}
+
+// Transcode implements Worker.
+func (f *Fake) Transcode(_ context.Context, _ []byte, format Format) ([]byte, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.Calls = append(f.Calls, format)
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	return f.Output, nil
+}
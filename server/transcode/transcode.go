@@ -0,0 +1,76 @@
+package transcode
+
+import (
+	"context"
+	"strings"
+
+	"github.com/blend/go-sdk/ex"
+)
+
+const (
+	// ErrInvalidFormat is returned when a video format isn't recognized.
+	ErrInvalidFormat ex.Class = "invalid video format"
+	// ErrEncoderFailed is returned when the encoder exits without producing a video.
+	ErrEncoderFailed ex.Class = "video encoder failed"
+)
+
+var (
+	// FormatMP4 is h264 in an mp4 container; it plays nearly everywhere, including ios and slack.
+	FormatMP4 = Format{Name: "mp4", Extension: ".mp4", MimeType: "video/mp4"}
+	// FormatWebM is vp9 in a webm container; it is smaller, but safari support is spotty.
+	FormatWebM = Format{Name: "webm", Extension: ".webm", MimeType: "video/webm"}
+
+	// Formats are the supported video formats.
+	Formats = []Format{FormatMP4, FormatWebM}
+)
+
+// Format is a video format a gif can be transcoded to.
+type Format struct {
+	Name      string
+	Extension string
+	MimeType  string
+}
+
+// IsZero returns if the format has been set.
+func (f Format) IsZero() bool {
+	return f.Name == ""
+}
+
+// ParseFormat returns a format by name (i.e. `mp4`).
+func ParseFormat(name string) (Format, error) {
+	normalized := strings.ToLower(strings.TrimSpace(name))
+	for _, format := range Formats {
+		if format.Name == normalized {
+			return format, nil
+		}
+	}
+	return Format{}, ex.New(ErrInvalidFormat, ex.OptMessagef("format: %s", name))
+}
+
+// FormatForKey returns the format for a stored file by its extension.
+// The format will be zero if the key isn't a video.
+func FormatForKey(key string) Format {
+	for _, format := range Formats {
+		if strings.HasSuffix(strings.ToLower(key), format.Extension) {
+			return format
+		}
+	}
+	return Format{}
+}
+
+// Worker transcodes (animated) gifs to video.
+type Worker interface {
+	Transcode(ctx context.Context, contents []byte, format Format) ([]byte, error)
+}
+
+// NewFromConfig returns the worker for a config.
+// It returns nil if transcoding isn't configured.
+func NewFromConfig(cfg Config) (Worker, error) {
+	if !cfg.IsEnabled() {
+		return nil, nil
+	}
+	if _, err := ParseFormat(cfg.FormatOrDefault()); err != nil {
+		return nil, err
+	}
+	return &Command{Binary: cfg.Binary, Timeout: cfg.TimeoutOrDefault()}, nil
+}
@@ -0,0 +1,94 @@
+package transcode
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/ex"
+)
+
+func TestParseFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	format, err := ParseFormat(" MP4 ")
+	assert.Nil(err)
+	assert.Equal(FormatMP4, format)
+
+	format, err = ParseFormat("webm")
+	assert.Nil(err)
+	assert.Equal(FormatWebM, format)
+
+	_, err = ParseFormat("avi")
+	assert.True(ex.Is(err, ErrInvalidFormat))
+}
+
+func TestFormatForKey(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(FormatMP4, FormatForKey("abc.mp4"))
+	assert.Equal(FormatWebM, FormatForKey("abc.WEBM"))
+	assert.True(FormatForKey("abc.gif").IsZero())
+}
+
+func TestNewFromConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	worker, err := NewFromConfig(Config{})
+	assert.Nil(err)
+	assert.Nil(worker)
+
+	worker, err = NewFromConfig(Config{Binary: "ffmpeg"})
+	assert.Nil(err)
+	assert.NotNil(worker)
+
+	_, err = NewFromConfig(Config{Binary: "ffmpeg", Format: "avi"})
+	assert.NotNil(err)
+}
+
+func TestArgs(t *testing.T) {
+	assert := assert.New(t)
+
+	args, err := Args("in.gif", "out.mp4", FormatMP4)
+	assert.Nil(err)
+	assert.Equal("out.mp4", args[len(args)-1])
+	assert.Contains(strings.Join(args, " "), "libx264")
+
+	args, err = Args("in.gif", "out.webm", FormatWebM)
+	assert.Nil(err)
+	assert.Contains(strings.Join(args, " "), "libvpx-vp9")
+
+	_, err = Args("in.gif", "out.avi", Format{Name: "avi"})
+	assert.NotNil(err)
+}
+
+// testEncoder writes a script that stands in for the encoder binary; it writes to the last argument (the output path).
+func testEncoder(assert *assert.Assertions, dir, body string) string {
+	path := filepath.Join(dir, "encoder.sh")
+	assert.Nil(ioutil.WriteFile(path, []byte("#!/bin/sh\nfor last; do :; done\n"+body+"\n"), 0700))
+	return path
+}
+
+func TestCommand(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "giffy-transcode-test-")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	worker := &Command{Binary: testEncoder(assert, dir, `printf video > "$last"`)}
+	video, err := worker.Transcode(context.Background(), []byte("GIF89a"), FormatMP4)
+	assert.Nil(err)
+	assert.Equal("video", string(video))
+
+	worker = &Command{Binary: testEncoder(assert, dir, `echo "bad input" >&2; exit 1`)}
+	_, err = worker.Transcode(context.Background(), []byte("GIF89a"), FormatMP4)
+	assert.True(ex.Is(err, ErrEncoderFailed))
+
+	worker = &Command{Binary: testEncoder(assert, dir, `touch "$last"`)}
+	_, err = worker.Transcode(context.Background(), []byte("GIF89a"), FormatMP4)
+	assert.True(ex.Is(err, ErrEncoderFailed))
+}
@@ -0,0 +1,22 @@
+package viewmodel
+
+import (
+	"time"
+
+	"github.com/wcharczuk/giffy/server/model"
+)
+
+// CreateAPITokenArgs is the post body the POST /api/tokens method accepts.
+type CreateAPITokenArgs struct {
+	Name          string     `json:"name"`
+	Scopes        []string   `json:"scopes"`
+	ExpiresUTC    *time.Time `json:"expires_utc,omitempty"`
+	ExpiresInDays int        `json:"expires_in_days,omitempty"`
+}
+
+// CreatedAPIToken is the api response for a newly created token.
+// The plaintext token is only ever returned here.
+type CreatedAPIToken struct {
+	model.APIToken `json:",inline"`
+	Token          string `json:"token"`
+}
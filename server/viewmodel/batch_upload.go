@@ -0,0 +1,30 @@
+package viewmodel
+
+import "github.com/wcharczuk/giffy/server/model"
+
+const (
+	// BatchUploadStatusCreated is a file that was added as a new image.
+	BatchUploadStatusCreated = "created"
+	// BatchUploadStatusDuplicate is a file that matched an existing image (or an earlier file in the batch).
+	BatchUploadStatusDuplicate = "duplicate"
+	// BatchUploadStatusFailed is a file that couldn't be added.
+	BatchUploadStatusFailed = "failed"
+)
+
+// BatchUploadResult is the outcome for a single file the POST /api/images.batch method imported.
+type BatchUploadResult struct {
+	FileName string       `json:"filename"`
+	Status   string       `json:"status"`
+	Image    *model.Image `json:"image,omitempty"`
+	Tags     []string     `json:"tags,omitempty"`
+	Error    string       `json:"error,omitempty"`
+}
+
+// BatchUploadReport is the response the POST /api/images.batch method returns.
+// Results are in the order the files were posted (or stored in the archive).
+type BatchUploadReport struct {
+	Created    int                 `json:"created"`
+	Duplicates int                 `json:"duplicates"`
+	Failed     int                 `json:"failed"`
+	Results    []BatchUploadResult `json:"results"`
+}
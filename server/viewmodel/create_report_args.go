@@ -0,0 +1,7 @@
+package viewmodel
+
+// CreateReportArgs is the post body the POST /api/image.report and /api/link.report methods accept.
+type CreateReportArgs struct {
+	Reason string `json:"reason"`
+	Note   string `json:"note"`
+}
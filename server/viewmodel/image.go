@@ -2,23 +2,41 @@ package viewmodel
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/wcharczuk/giffy/server/config"
 	"github.com/wcharczuk/giffy/server/model"
+	"github.com/wcharczuk/giffy/server/transcode"
 )
 
 // NewImage creates a new viewmodel image.
 func NewImage(img model.Image, cfg *config.Giffy) Image {
-	if cfg.Meta.IsProdlike() && len(cfg.CloudFrontDNS) > 0 {
-		return Image{
-			Image:     img,
-			S3ReadURL: fmt.Sprintf("https://%s/%s", cfg.CloudFrontDNS, img.S3Key),
-		}
-	}
-	return Image{
+	output := Image{
 		Image:     img,
-		S3ReadURL: fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", img.S3Bucket, cfg.Aws.RegionOrDefault(), img.S3Key),
+		S3ReadURL: ReadURL(img.S3Bucket, img.S3Key, cfg),
+	}
+	if len(img.PosterS3Key) > 0 {
+		output.PosterReadURL = ReadURL(img.S3Bucket, img.PosterS3Key, cfg)
+	}
+	if len(img.ThumbnailS3Key) > 0 {
+		output.ThumbnailReadURL = ReadURL(img.S3Bucket, img.ThumbnailS3Key, cfg)
+	}
+	if len(img.VideoS3Key) > 0 {
+		output.VideoURL = ReadURL(img.S3Bucket, img.VideoS3Key, cfg)
+		output.VideoMimeType = transcode.FormatForKey(img.VideoS3Key).MimeType
+	}
+	return output
+}
+
+// ReadURL returns the public url for a stored file.
+func ReadURL(bucket, key string, cfg *config.Giffy) string {
+	if cfg.Storage.IsLocal() {
+		return fmt.Sprintf("%s/files/%s/%s", strings.TrimSuffix(cfg.Web.BaseURL, "/"), bucket, key)
+	}
+	if cfg.Meta.IsProdlike() && len(cfg.CloudFrontDNS) > 0 {
+		return fmt.Sprintf("https://%s/%s", cfg.CloudFrontDNS, key)
 	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, cfg.Aws.RegionOrDefault(), key)
 }
 
 // WrapImages wraps the image list as a viewmodel image.
@@ -30,8 +48,13 @@ func WrapImages(images []model.Image, cfg *config.Giffy) []Image {
 	return output
 }
 
-// Image is a wrapper viewmodel for an image that injects the s3 read url.
+// Image is a wrapper viewmodel for an image that injects the s3 read urls.
+// Gifs that have been transcoded also have a video url; clients that can play it should prefer it.
 type Image struct {
-	model.Image `json:",inline"`
-	S3ReadURL   string `json:"s3_read_url"`
+	model.Image      `json:",inline"`
+	S3ReadURL        string `json:"s3_read_url"`
+	PosterReadURL    string `json:"poster_read_url,omitempty"`
+	ThumbnailReadURL string `json:"thumbnail_read_url,omitempty"`
+	VideoURL         string `json:"video_url,omitempty"`
+	VideoMimeType    string `json:"video_mime_type,omitempty"`
 }
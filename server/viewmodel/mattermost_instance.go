@@ -0,0 +1,9 @@
+package viewmodel
+
+// CreateMattermostInstanceArgs is the post body the POST /api/mattermost.instances method accepts.
+type CreateMattermostInstanceArgs struct {
+	Name string `json:"name"`
+	// Token is the token mattermost generated for the `/giffy` slash command.
+	Token               string `json:"token"`
+	ContentRatingFilter int    `json:"content_rating"`
+}
@@ -0,0 +1,6 @@
+package viewmodel
+
+// ConnectSlackIdentityArgs is the post body the POST /api/slack.identities method accepts.
+type ConnectSlackIdentityArgs struct {
+	Token string `json:"token"`
+}